@@ -1,9 +1,12 @@
 package adapter
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
+	"strconv"
 
 	"github.com/darkit/plugmgr"
 )
@@ -18,10 +21,16 @@ type Handler[T any] interface {
 	DisablePlugin() T
 	PreloadPlugin() T
 	HotReloadPlugin() T
+	GetPluginDependencies() T
 
 	// 插件配置
 	GetPluginConfig() T
+	GetPluginSchema() T
+	GetResolvedPluginConfig() T
 	UpdatedPluginConfig() T
+	GetPluginConfigHistory() T
+	DiffPluginConfig() T
+	RollbackPluginConfig() T
 
 	// 插件执行
 	ExecutePlugin() T
@@ -42,8 +51,35 @@ type Handler[T any] interface {
 
 // PluginHandler 是一个泛型结构体，实现了 Handler 接口
 type PluginHandler[T any] struct {
-	manager *plugmgr.Manager
-	warp    func(http.HandlerFunc) T
+	manager   *plugmgr.Manager
+	warp      func(http.HandlerFunc) T
+	principal func(r *http.Request) (plugmgr.Principal, bool)
+}
+
+// operations 需要授权的管理器操作，由 *plugmgr.Manager 和 *plugmgr.Session 实现
+type operations interface {
+	ListPlugins() []string
+	DependencyTree(name string) (*plugmgr.DependencyNode, error)
+	Dependents(name string) []string
+	LoadPlugin(path string) error
+	PreloadPlugins(names []string) error
+	UnloadPlugin(name string, opts ...plugmgr.UnloadOption) error
+	EnablePlugin(name string) error
+	DisablePlugin(name string, opts ...plugmgr.UnloadOption) error
+	HotReload(name, path string) error
+	InstallPlugin(name, version string) error
+	RollbackPlugin(name, version string) error
+	GetPluginConfig(name string) (*plugmgr.PluginData, error)
+	GetPluginSchema(name string) ([]byte, error)
+	ResolveConfig(name string) (*plugmgr.ResolvedConfig, error)
+	ConfigUpdated(name string, config any, opts ...plugmgr.ConfigOption) ([]byte, error)
+	ConfigHistory(name string) ([]plugmgr.ConfigRevision, error)
+	DiffConfig(name string, from, to int) ([]plugmgr.ConfigDiff, error)
+	RollbackConfig(name string, revision int, opts ...plugmgr.ConfigOption) ([]byte, error)
+	GetPluginStats(name string) (*plugmgr.PluginStats, error)
+	ExecutePluginContext(ctx context.Context, name string, data any) (any, error)
+	SetPluginPermission(name string, permission *plugmgr.PluginPermission) error
+	RemovePluginPermission(name string) error
 }
 
 // NewPluginHandler 创建一个新的 PluginHandler 实例
@@ -54,6 +90,28 @@ func NewPluginHandler[T any](manager *plugmgr.Manager, warp func(http.HandlerFun
 	}
 }
 
+// WithPrincipal 设置从请求中获取调用方身份的函数
+//
+//	设置后所有插件操作都以调用方身份通过 Manager.As 执行，
+//	无法获取身份时返回 401，没有权限时返回 403。
+func (h *PluginHandler[T]) WithPrincipal(fn func(r *http.Request) (plugmgr.Principal, bool)) *PluginHandler[T] {
+	h.principal = fn
+	return h
+}
+
+// operations 返回处理请求使用的管理器操作
+func (h *PluginHandler[T]) operations(w http.ResponseWriter, r *http.Request) (operations, bool) {
+	if h.principal == nil {
+		return h.manager, true
+	}
+	principal, ok := h.principal(r)
+	if !ok {
+		errorResponse(w, http.StatusUnauthorized, "未认证")
+		return nil, false
+	}
+	return h.manager.As(principal), true
+}
+
 // GetHandlers 返回实现了 Handler 接口的 PluginHandler
 func (h *PluginHandler[T]) GetHandlers() Handler[T] {
 	return h
@@ -62,7 +120,11 @@ func (h *PluginHandler[T]) GetHandlers() Handler[T] {
 // ListPlugins 获取插件列表
 func (h *PluginHandler[T]) ListPlugins() T {
 	return h.warp(func(w http.ResponseWriter, r *http.Request) {
-		plugins := h.manager.ListPlugins()
+		ops, ok := h.operations(w, r)
+		if !ok {
+			return
+		}
+		plugins := ops.ListPlugins()
 		jsonResponse(w, http.StatusOK, map[string]interface{}{
 			"code": 0,
 			"data": plugins,
@@ -73,10 +135,14 @@ func (h *PluginHandler[T]) ListPlugins() T {
 // LoadPlugin 加载插件
 func (h *PluginHandler[T]) LoadPlugin() T {
 	return h.warp(func(w http.ResponseWriter, r *http.Request) {
+		ops, ok := h.operations(w, r)
+		if !ok {
+			return
+		}
 		name := r.URL.Query().Get("name")
-		err := h.manager.LoadPlugin(name)
+		err := ops.LoadPlugin(name)
 		if err != nil {
-			errorResponse(w, http.StatusInternalServerError, err.Error())
+			errorResponse(w, errorStatus(err), err.Error())
 			return
 		}
 		jsonResponse(w, http.StatusOK, map[string]interface{}{
@@ -89,10 +155,14 @@ func (h *PluginHandler[T]) LoadPlugin() T {
 // UnloadPlugin 卸载插件
 func (h *PluginHandler[T]) UnloadPlugin() T {
 	return h.warp(func(w http.ResponseWriter, r *http.Request) {
+		ops, ok := h.operations(w, r)
+		if !ok {
+			return
+		}
 		name := r.URL.Query().Get("name")
-		err := h.manager.UnloadPlugin(name)
+		err := ops.UnloadPlugin(name, unloadOptions(r)...)
 		if err != nil {
-			errorResponse(w, http.StatusInternalServerError, err.Error())
+			errorResponse(w, errorStatus(err), err.Error())
 			return
 		}
 		jsonResponse(w, http.StatusOK, map[string]interface{}{
@@ -105,10 +175,14 @@ func (h *PluginHandler[T]) UnloadPlugin() T {
 // EnablePlugin 启用插件
 func (h *PluginHandler[T]) EnablePlugin() T {
 	return h.warp(func(w http.ResponseWriter, r *http.Request) {
+		ops, ok := h.operations(w, r)
+		if !ok {
+			return
+		}
 		name := r.URL.Query().Get("name")
-		err := h.manager.EnablePlugin(name)
+		err := ops.EnablePlugin(name)
 		if err != nil {
-			errorResponse(w, http.StatusInternalServerError, err.Error())
+			errorResponse(w, errorStatus(err), err.Error())
 			return
 		}
 		jsonResponse(w, http.StatusOK, map[string]interface{}{
@@ -121,10 +195,14 @@ func (h *PluginHandler[T]) EnablePlugin() T {
 // DisablePlugin 禁用插件
 func (h *PluginHandler[T]) DisablePlugin() T {
 	return h.warp(func(w http.ResponseWriter, r *http.Request) {
+		ops, ok := h.operations(w, r)
+		if !ok {
+			return
+		}
 		name := r.URL.Query().Get("name")
-		err := h.manager.DisablePlugin(name)
+		err := ops.DisablePlugin(name, unloadOptions(r)...)
 		if err != nil {
-			errorResponse(w, http.StatusInternalServerError, err.Error())
+			errorResponse(w, errorStatus(err), err.Error())
 			return
 		}
 		jsonResponse(w, http.StatusOK, map[string]interface{}{
@@ -134,13 +212,43 @@ func (h *PluginHandler[T]) DisablePlugin() T {
 	})
 }
 
+// GetPluginDependencies 获取插件的依赖树和依赖方
+func (h *PluginHandler[T]) GetPluginDependencies() T {
+	return h.warp(func(w http.ResponseWriter, r *http.Request) {
+		ops, ok := h.operations(w, r)
+		if !ok {
+			return
+		}
+		name := r.URL.Query().Get("name")
+		tree, err := ops.DependencyTree(name)
+		if errors.Is(err, plugmgr.ErrPluginNotFound) {
+			errorResponse(w, http.StatusNotFound, err.Error())
+			return
+		} else if err != nil {
+			errorResponse(w, errorStatus(err), err.Error())
+			return
+		}
+		jsonResponse(w, http.StatusOK, map[string]interface{}{
+			"code": 0,
+			"data": map[string]interface{}{
+				"tree":       tree,
+				"dependents": ops.Dependents(name),
+			},
+		})
+	})
+}
+
 // GetPluginConfig 获取插件配置
 func (h *PluginHandler[T]) GetPluginConfig() T {
 	return h.warp(func(w http.ResponseWriter, r *http.Request) {
+		ops, ok := h.operations(w, r)
+		if !ok {
+			return
+		}
 		name := r.URL.Query().Get("name")
-		config, err := h.manager.GetPluginConfig(name)
+		config, err := ops.GetPluginConfig(name)
 		if err != nil {
-			errorResponse(w, http.StatusInternalServerError, err.Error())
+			errorResponse(w, errorStatus(err), err.Error())
 			return
 		}
 		jsonResponse(w, http.StatusOK, map[string]interface{}{
@@ -150,25 +258,145 @@ func (h *PluginHandler[T]) GetPluginConfig() T {
 	})
 }
 
+// GetPluginSchema 获取插件配置的 JSON Schema，供界面渲染配置表单
+func (h *PluginHandler[T]) GetPluginSchema() T {
+	return h.warp(func(w http.ResponseWriter, r *http.Request) {
+		ops, ok := h.operations(w, r)
+		if !ok {
+			return
+		}
+		name := r.URL.Query().Get("name")
+		schema, err := ops.GetPluginSchema(name)
+		if err != nil {
+			errorResponse(w, errorStatus(err), err.Error())
+			return
+		}
+		if schema == nil {
+			errorResponse(w, http.StatusNotFound, "插件未提供配置 Schema")
+			return
+		}
+		jsonResponse(w, http.StatusOK, map[string]interface{}{
+			"code": 0,
+			"data": json.RawMessage(schema),
+		})
+	})
+}
+
+// GetResolvedPluginConfig 获取合并所有配置层后的插件配置及每个字段的来源
+func (h *PluginHandler[T]) GetResolvedPluginConfig() T {
+	return h.warp(func(w http.ResponseWriter, r *http.Request) {
+		ops, ok := h.operations(w, r)
+		if !ok {
+			return
+		}
+		name := r.URL.Query().Get("name")
+		resolved, err := ops.ResolveConfig(name)
+		if err != nil {
+			errorResponse(w, errorStatus(err), err.Error())
+			return
+		}
+		jsonResponse(w, http.StatusOK, map[string]interface{}{
+			"code": 0,
+			"data": resolved,
+		})
+	})
+}
+
 // UpdatedPluginConfig 更新插件配置
 func (h *PluginHandler[T]) UpdatedPluginConfig() T {
 	return h.warp(func(w http.ResponseWriter, r *http.Request) {
+		ops, ok := h.operations(w, r)
+		if !ok {
+			return
+		}
 		name := r.URL.Query().Get("name")
 		body, err := io.ReadAll(r.Body)
 		if err != nil {
 			errorResponse(w, http.StatusBadRequest, "参数格式错误")
 			return
 		}
-		conf, err := h.manager.ConfigUpdated(name, body)
+		conf, err := ops.ConfigUpdated(name, body, configOptions(r)...)
 		if err != nil {
-			errorResponse(w, http.StatusInternalServerError, err.Error())
+			configErrorResponse(w, err)
 			return
 		}
 
 		jsonResponse(w, http.StatusOK, map[string]interface{}{
 			"code": 0,
 			"msg":  "配置更新成功",
-			"data": conf,
+			"data": h.manager.RedactConfig(name, conf),
+		})
+	})
+}
+
+// GetPluginConfigHistory 获取插件配置的修订历史
+func (h *PluginHandler[T]) GetPluginConfigHistory() T {
+	return h.warp(func(w http.ResponseWriter, r *http.Request) {
+		ops, ok := h.operations(w, r)
+		if !ok {
+			return
+		}
+		name := r.URL.Query().Get("name")
+		history, err := ops.ConfigHistory(name)
+		if err != nil {
+			errorResponse(w, errorStatus(err), err.Error())
+			return
+		}
+		jsonResponse(w, http.StatusOK, map[string]interface{}{
+			"code": 0,
+			"data": history,
+		})
+	})
+}
+
+// DiffPluginConfig 比较插件配置的两个修订版本
+func (h *PluginHandler[T]) DiffPluginConfig() T {
+	return h.warp(func(w http.ResponseWriter, r *http.Request) {
+		ops, ok := h.operations(w, r)
+		if !ok {
+			return
+		}
+		name := r.URL.Query().Get("name")
+		from, err1 := strconv.Atoi(r.URL.Query().Get("from"))
+		to, err2 := strconv.Atoi(r.URL.Query().Get("to"))
+		if err1 != nil || err2 != nil {
+			errorResponse(w, http.StatusBadRequest, "修订版本号格式错误")
+			return
+		}
+		diffs, err := ops.DiffConfig(name, from, to)
+		if err != nil {
+			errorResponse(w, errorStatus(err), err.Error())
+			return
+		}
+		jsonResponse(w, http.StatusOK, map[string]interface{}{
+			"code": 0,
+			"data": diffs,
+		})
+	})
+}
+
+// RollbackPluginConfig 将插件配置回滚到指定修订版本
+func (h *PluginHandler[T]) RollbackPluginConfig() T {
+	return h.warp(func(w http.ResponseWriter, r *http.Request) {
+		ops, ok := h.operations(w, r)
+		if !ok {
+			return
+		}
+		name := r.URL.Query().Get("name")
+		revision, err := strconv.Atoi(r.URL.Query().Get("revision"))
+		if err != nil {
+			errorResponse(w, http.StatusBadRequest, "修订版本号格式错误")
+			return
+		}
+		conf, err := ops.RollbackConfig(name, revision, configOptions(r)...)
+		if err != nil {
+			configErrorResponse(w, err)
+			return
+		}
+		jsonResponse(w, http.StatusOK, map[string]interface{}{
+			"code": 0,
+			"msg":  "配置回滚成功",
+			"data": h.manager.RedactConfig(name, conf),
 		})
 	})
 }
@@ -176,15 +404,19 @@ func (h *PluginHandler[T]) UpdatedPluginConfig() T {
 // ExecutePlugin 执行插件
 func (h *PluginHandler[T]) ExecutePlugin() T {
 	return h.warp(func(w http.ResponseWriter, r *http.Request) {
+		ops, ok := h.operations(w, r)
+		if !ok {
+			return
+		}
 		name := r.URL.Query().Get("name")
 		body, err := io.ReadAll(r.Body)
 		if err != nil {
 			errorResponse(w, http.StatusBadRequest, "参数格式错误")
 			return
 		}
-		result, err := h.manager.ExecutePlugin(name, body)
+		result, err := ops.ExecutePluginContext(r.Context(), name, body)
 		if err != nil {
-			errorResponse(w, http.StatusInternalServerError, err.Error())
+			errorResponse(w, errorStatus(err), err.Error())
 			return
 		}
 
@@ -208,11 +440,15 @@ func (h *PluginHandler[T]) ListMarketPlugins() T {
 // InstallPlugin 安装插件
 func (h *PluginHandler[T]) InstallPlugin() T {
 	return h.warp(func(w http.ResponseWriter, r *http.Request) {
+		ops, ok := h.operations(w, r)
+		if !ok {
+			return
+		}
 		name := r.URL.Query().Get("name")
 		version := r.URL.Query().Get("version")
-		err := h.manager.InstallPlugin(name, version)
+		err := ops.InstallPlugin(name, version)
 		if err != nil {
-			errorResponse(w, http.StatusInternalServerError, err.Error())
+			errorResponse(w, errorStatus(err), err.Error())
 			return
 		}
 		jsonResponse(w, http.StatusOK, map[string]interface{}{
@@ -225,11 +461,15 @@ func (h *PluginHandler[T]) InstallPlugin() T {
 // RollbackPlugin 回滚插件
 func (h *PluginHandler[T]) RollbackPlugin() T {
 	return h.warp(func(w http.ResponseWriter, r *http.Request) {
+		ops, ok := h.operations(w, r)
+		if !ok {
+			return
+		}
 		name := r.URL.Query().Get("name")
 		version := r.URL.Query().Get("version")
-		err := h.manager.RollbackPlugin(name, version)
+		err := ops.RollbackPlugin(name, version)
 		if err != nil {
-			errorResponse(w, http.StatusInternalServerError, err.Error())
+			errorResponse(w, errorStatus(err), err.Error())
 			return
 		}
 		jsonResponse(w, http.StatusOK, map[string]interface{}{
@@ -242,10 +482,14 @@ func (h *PluginHandler[T]) RollbackPlugin() T {
 // PreloadPlugin 预加载插件
 func (h *PluginHandler[T]) PreloadPlugin() T {
 	return h.warp(func(w http.ResponseWriter, r *http.Request) {
+		ops, ok := h.operations(w, r)
+		if !ok {
+			return
+		}
 		name := r.URL.Query().Get("name")
-		err := h.manager.PreloadPlugins([]string{name})
+		err := ops.PreloadPlugins([]string{name})
 		if err != nil {
-			errorResponse(w, http.StatusInternalServerError, err.Error())
+			errorResponse(w, errorStatus(err), err.Error())
 			return
 		}
 		jsonResponse(w, http.StatusOK, map[string]interface{}{
@@ -258,6 +502,10 @@ func (h *PluginHandler[T]) PreloadPlugin() T {
 // HotReloadPlugin 热重载插件
 func (h *PluginHandler[T]) HotReloadPlugin() T {
 	return h.warp(func(w http.ResponseWriter, r *http.Request) {
+		ops, ok := h.operations(w, r)
+		if !ok {
+			return
+		}
 		name := r.URL.Query().Get("name")
 		var params struct {
 			Path string `json:"path"`
@@ -266,9 +514,9 @@ func (h *PluginHandler[T]) HotReloadPlugin() T {
 			errorResponse(w, http.StatusBadRequest, "参数格式错误")
 			return
 		}
-		err := h.manager.HotReload(name, params.Path)
+		err := ops.HotReload(name, params.Path)
 		if err != nil {
-			errorResponse(w, http.StatusInternalServerError, err.Error())
+			errorResponse(w, errorStatus(err), err.Error())
 			return
 		}
 		jsonResponse(w, http.StatusOK, map[string]interface{}{
@@ -282,14 +530,28 @@ func (h *PluginHandler[T]) HotReloadPlugin() T {
 func (h *PluginHandler[T]) GetPluginPermission() T {
 	return h.warp(func(w http.ResponseWriter, r *http.Request) {
 		name := r.URL.Query().Get("name")
-		hasPermission := h.manager.HasPermission(name, "read")
-		if !hasPermission {
-			errorResponse(w, http.StatusForbidden, "无权限访问")
+		var permission *plugmgr.PluginPermission
+		if h.principal == nil {
+			permission, _ = h.manager.GetPluginPermission(name)
+		} else {
+			principal, ok := h.principal(r)
+			if !ok {
+				errorResponse(w, http.StatusUnauthorized, "未认证")
+				return
+			}
+			var err error
+			if permission, _, err = h.manager.As(principal).GetPluginPermission(name); err != nil {
+				errorResponse(w, errorStatus(err), err.Error())
+				return
+			}
+		}
+		if permission == nil {
+			errorResponse(w, http.StatusNotFound, "未配置插件权限")
 			return
 		}
 		jsonResponse(w, http.StatusOK, map[string]interface{}{
 			"code": 0,
-			"data": hasPermission,
+			"data": permission,
 		})
 	})
 }
@@ -297,13 +559,20 @@ func (h *PluginHandler[T]) GetPluginPermission() T {
 // SetPluginPermission 设置插件权限
 func (h *PluginHandler[T]) SetPluginPermission() T {
 	return h.warp(func(w http.ResponseWriter, r *http.Request) {
+		ops, ok := h.operations(w, r)
+		if !ok {
+			return
+		}
 		name := r.URL.Query().Get("name")
 		var permission plugmgr.PluginPermission
 		if err := json.NewDecoder(r.Body).Decode(&permission); err != nil {
 			errorResponse(w, http.StatusBadRequest, "权限格式错误")
 			return
 		}
-		h.manager.SetPluginPermission(name, &permission)
+		if err := ops.SetPluginPermission(name, &permission); err != nil {
+			errorResponse(w, errorStatus(err), err.Error())
+			return
+		}
 		jsonResponse(w, http.StatusOK, map[string]interface{}{
 			"code": 0,
 			"msg":  "权限设置成功",
@@ -314,8 +583,15 @@ func (h *PluginHandler[T]) SetPluginPermission() T {
 // RemovePluginPermission 移除插件权限
 func (h *PluginHandler[T]) RemovePluginPermission() T {
 	return h.warp(func(w http.ResponseWriter, r *http.Request) {
+		ops, ok := h.operations(w, r)
+		if !ok {
+			return
+		}
 		name := r.URL.Query().Get("name")
-		h.manager.RemovePluginPermission(name)
+		if err := ops.RemovePluginPermission(name); err != nil {
+			errorResponse(w, errorStatus(err), err.Error())
+			return
+		}
 		jsonResponse(w, http.StatusOK, map[string]interface{}{
 			"code": 0,
 			"msg":  "权限移除成功",
@@ -326,10 +602,14 @@ func (h *PluginHandler[T]) RemovePluginPermission() T {
 // GetPluginStats 获取插件统计信息
 func (h *PluginHandler[T]) GetPluginStats() T {
 	return h.warp(func(w http.ResponseWriter, r *http.Request) {
+		ops, ok := h.operations(w, r)
+		if !ok {
+			return
+		}
 		name := r.URL.Query().Get("name")
-		stats, err := h.manager.GetPluginStats(name)
+		stats, err := ops.GetPluginStats(name)
 		if err != nil {
-			errorResponse(w, http.StatusInternalServerError, "获取统计信息失败")
+			errorResponse(w, errorStatus(err), "获取统计信息失败")
 			return
 		}
 		jsonResponse(w, http.StatusOK, map[string]interface{}{
@@ -362,10 +642,16 @@ func (h *PluginHandler[T]) SetupRoutes() *http.ServeMux {
 	setupRoute("/plugins/disable/", h.DisablePlugin)
 	setupRoute("/plugins/preload/", h.PreloadPlugin)
 	setupRoute("/plugins/hotreload/", h.HotReloadPlugin)
+	setupRoute("/plugins/dependencies/", h.GetPluginDependencies)
 
 	// 插件配置路由
 	setupRoute("/plugins/config/", h.GetPluginConfig)
+	setupRoute("/plugins/schema/", h.GetPluginSchema)
+	setupRoute("/plugins/config/resolved/", h.GetResolvedPluginConfig)
 	setupRoute("/plugins/config/update/", h.UpdatedPluginConfig)
+	setupRoute("/plugins/config/history/", h.GetPluginConfigHistory)
+	setupRoute("/plugins/config/diff/", h.DiffPluginConfig)
+	setupRoute("/plugins/config/rollback/", h.RollbackPluginConfig)
 
 	// 插件权限路由
 	setupRoute("/plugins/permission/", h.GetPluginPermission)
@@ -384,6 +670,48 @@ func (h *PluginHandler[T]) SetupRoutes() *http.ServeMux {
 }
 
 // 辅助函数
+func unloadOptions(r *http.Request) []plugmgr.UnloadOption {
+	if r.URL.Query().Get("cascade") == "true" {
+		return []plugmgr.UnloadOption{plugmgr.WithCascade()}
+	}
+	return nil
+}
+
+// configOptions 从请求参数 comment 中获取配置修改说明
+func configOptions(r *http.Request) []plugmgr.ConfigOption {
+	if comment := r.URL.Query().Get("comment"); comment != "" {
+		return []plugmgr.ConfigOption{plugmgr.WithComment(comment)}
+	}
+	return nil
+}
+
+// errorStatus 根据错误类型返回 HTTP 状态码
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, plugmgr.ErrPermissionDenied):
+		return http.StatusForbidden
+	case errors.Is(err, plugmgr.ErrInvalidConfig):
+		return http.StatusBadRequest
+	case errors.Is(err, plugmgr.ErrRevisionNotFound):
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+// configErrorResponse 返回配置修改失败的响应，校验失败时附带字段错误
+func configErrorResponse(w http.ResponseWriter, err error) {
+	var validationErr *plugmgr.ConfigValidationError
+	if errors.As(err, &validationErr) {
+		jsonResponse(w, http.StatusBadRequest, map[string]interface{}{
+			"code":   -1,
+			"msg":    err.Error(),
+			"errors": validationErr.Fields,
+		})
+		return
+	}
+	errorResponse(w, errorStatus(err), err.Error())
+}
+
 func jsonResponse(w http.ResponseWriter, status int, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
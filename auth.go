@@ -0,0 +1,425 @@
+package plugmgr
+
+import (
+	"context"
+	"slices"
+)
+
+// 调用方对插件执行的操作
+//
+//	管理器操作与所需操作的对应关系:
+//	- ActionRead: GetPluginConfig、GetPluginSchema、GetPluginStats、GetPluginPermission、
+//	  ConfigHistory、DiffConfig、ResolveConfig、DependencyTree、PlanInstall、SubscribeTopic，
+//	  ListPlugins 和 Dependents 只返回有 read 权限的插件
+//	- ActionWrite: ConfigUpdated、RollbackConfig、PublishTopic
+//	- ActionExecute: ExecutePlugin 系列方法
+//	- ActionAdmin: LoadPlugin、UnloadPlugin、EnablePlugin、DisablePlugin、PreloadPlugins、
+//	  HotReload、RollbackPlugin、SetPluginPermission、RemovePluginPermission、InstallPackage；
+//	  InstallPlugin 和 ApplyInstallPlan 需要安装计划中每个插件的权限，
+//	  Lock 和 Sync 需要每个启用的插件和锁定的插件的权限
+const (
+	ActionRead    = "read"
+	ActionWrite   = "write"
+	ActionExecute = "execute"
+	ActionAdmin   = "admin"
+)
+
+// 内置角色
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// actionAll 角色策略中表示所有操作的通配符
+const actionAll = "*"
+
+// defaultRolePolicies 内置角色默认可以执行的操作
+var defaultRolePolicies = map[string][]string{
+	RoleUser:  {ActionRead, ActionExecute},
+	RoleAdmin: {ActionRead, ActionWrite, ActionExecute, ActionAdmin},
+}
+
+// Principal 调用管理器的身份
+type Principal struct {
+	Name  string   // 调用方名称，用于错误信息和日志
+	Roles []string // 调用方拥有的角色
+}
+
+// SetRolePolicy 设置角色可以执行的操作
+//
+//	参数:
+//	- role: 角色名称
+//	- actions: 角色可以执行的操作，"*" 表示所有操作；为空时删除该角色的策略
+//	功能:
+//	- 作为所有插件的默认策略，插件的 PluginPermission.RoleActions 可以覆盖
+//	- 策略通过配置存储持久化，重启后仍然生效
+//	返回:
+//	- error: 保存配置失败时返回
+func (m *Manager) SetRolePolicy(role string, actions ...string) error {
+	if len(actions) == 0 {
+		return m.config.SetRolePolicy(role, nil)
+	}
+	return m.config.SetRolePolicy(role, slices.Clone(actions))
+}
+
+// RolePolicy 获取角色可以执行的操作
+func (m *Manager) RolePolicy(role string) ([]string, bool) {
+	if actions, ok := m.config.RolePolicy(role); ok {
+		return slices.Clone(actions), actions != nil
+	}
+	actions, ok := defaultRolePolicies[role]
+	return slices.Clone(actions), ok
+}
+
+// Authorize 检查调用方是否可以对插件执行指定操作
+//
+//	参数:
+//	- principal: 调用方身份
+//	- plugin: 插件名称
+//	- action: 操作名称
+//	功能:
+//	- 调用方至少拥有一个满足以下条件的角色时允许操作:
+//	  1. 角色在插件 PluginPermission.Roles 中，Roles 为空时不限制角色
+//	  2. 角色策略包含该操作，插件的 RoleActions 优先于 SetRolePolicy 设置的全局策略
+//	  3. 插件的 AllowedActions 没有将该操作设置为 false
+//	- 条件对所有角色生效，策略包含 admin 或 "*" 的角色同样受插件的 Roles 和 AllowedActions 限制
+//	返回:
+//	- error: 没有权限时返回包含 ErrPermissionDenied 的错误
+func (m *Manager) Authorize(principal Principal, plugin, action string) error {
+	permission, _ := m.getPermission(plugin)
+	if allowed, set := permission.AllowedActions[action]; set && !allowed {
+		return wrapf(ErrPermissionDenied, "插件 %s 禁止 %s 操作", plugin, action)
+	}
+
+	for _, role := range principal.Roles {
+		if len(permission.Roles) > 0 && !slices.Contains(permission.Roles, role) {
+			continue
+		}
+		actions, ok := permission.RoleActions[role]
+		if !ok {
+			actions, _ = m.RolePolicy(role)
+		}
+		if slices.Contains(actions, action) || slices.Contains(actions, actionAll) {
+			return nil
+		}
+	}
+
+	return wrapf(ErrPermissionDenied, "%s 没有插件 %s 的 %s 权限", principal.Name, plugin, action)
+}
+
+// As 返回以指定身份操作管理器的会话
+//
+//	会话的每个方法在调用管理器之前使用 Authorize 检查对应的操作权限。
+func (m *Manager) As(principal Principal) *Session {
+	return &Session{manager: m, principal: principal}
+}
+
+// Session 以指定身份操作管理器，方法与 Manager 的同名方法一致
+type Session struct {
+	manager   *Manager
+	principal Principal
+}
+
+// Principal 返回会话的调用方身份
+func (s *Session) Principal() Principal {
+	return s.principal
+}
+
+// LoadPlugin 加载插件，需要 admin 权限
+func (s *Session) LoadPlugin(path string) error {
+	if err := s.manager.Authorize(s.principal, pluginNameFromPath(path), ActionAdmin); err != nil {
+		return err
+	}
+	return s.manager.LoadPlugin(path)
+}
+
+// PreloadPlugins 预加载插件，需要每个插件的 admin 权限
+func (s *Session) PreloadPlugins(names []string) error {
+	for _, name := range names {
+		if err := s.manager.Authorize(s.principal, name, ActionAdmin); err != nil {
+			return err
+		}
+	}
+	return s.manager.PreloadPlugins(names)
+}
+
+// UnloadPlugin 卸载插件，需要 admin 权限，级联卸载时同时需要所有依赖方的 admin 权限
+func (s *Session) UnloadPlugin(name string, opts ...UnloadOption) error {
+	if err := s.authorizeUnload(name, opts); err != nil {
+		return err
+	}
+	return s.manager.UnloadPlugin(name, opts...)
+}
+
+func (s *Session) authorizeUnload(name string, opts []UnloadOption) error {
+	if err := s.manager.Authorize(s.principal, name, ActionAdmin); err != nil {
+		return err
+	}
+
+	var options unloadOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if options.cascade {
+		for _, dependent := range s.manager.dependencies.TransitiveDependents(name) {
+			if err := s.manager.Authorize(s.principal, dependent, ActionAdmin); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// EnablePlugin 启用插件，需要 admin 权限
+func (s *Session) EnablePlugin(name string) error {
+	if err := s.manager.Authorize(s.principal, name, ActionAdmin); err != nil {
+		return err
+	}
+	return s.manager.EnablePlugin(name)
+}
+
+// DisablePlugin 禁用插件，需要 admin 权限
+func (s *Session) DisablePlugin(name string, opts ...UnloadOption) error {
+	if err := s.authorizeUnload(name, opts); err != nil {
+		return err
+	}
+	return s.manager.DisablePlugin(name, opts...)
+}
+
+// HotReload 热重载插件，需要 admin 权限
+func (s *Session) HotReload(name, path string) error {
+	if err := s.manager.Authorize(s.principal, name, ActionAdmin); err != nil {
+		return err
+	}
+	return s.manager.HotReload(name, path)
+}
+
+// InstallPlugin 安装插件，需要插件及安装计划中每个插件的 admin 权限
+func (s *Session) InstallPlugin(name, version string) error {
+	return s.InstallPluginContext(context.Background(), name, version)
+}
+
+// InstallPluginContext 在上下文控制下安装插件，需要插件及安装计划中每个插件的 admin 权限
+func (s *Session) InstallPluginContext(ctx context.Context, name, version string) error {
+	if err := s.manager.Authorize(s.principal, name, ActionAdmin); err != nil {
+		return err
+	}
+	if len(s.manager.Repositories()) == 0 {
+		return s.manager.InstallPluginContext(ctx, name, version)
+	}
+
+	plan, err := s.manager.PlanInstall(ctx, name, version)
+	if err != nil {
+		return wrapf(err, "安装插件 %s 失败", name)
+	}
+	return s.ApplyInstallPlan(ctx, plan)
+}
+
+// PlanInstall 计算安装插件的计划，需要 read 权限
+func (s *Session) PlanInstall(ctx context.Context, name, constraint string) (*InstallPlan, error) {
+	if err := s.manager.Authorize(s.principal, name, ActionRead); err != nil {
+		return nil, err
+	}
+	return s.manager.PlanInstall(ctx, name, constraint)
+}
+
+// ApplyInstallPlan 执行安装计划，需要计划中每个插件的 admin 权限
+func (s *Session) ApplyInstallPlan(ctx context.Context, plan *InstallPlan) error {
+	for _, step := range plan.Steps {
+		if err := s.manager.Authorize(s.principal, step.Name, ActionAdmin); err != nil {
+			return err
+		}
+	}
+	return s.manager.ApplyInstallPlan(ctx, plan)
+}
+
+// InstallPackage 安装插件包，需要清单中插件的 admin 权限，没有权限时不写入插件目录
+func (s *Session) InstallPackage(pkgPath string) error {
+	return s.manager.installPackage(pkgPath, func(manifest *PackageManifest) error {
+		return s.manager.Authorize(s.principal, manifest.Name, ActionAdmin)
+	})
+}
+
+// Lock 写入锁文件，需要每个启用插件的 admin 权限
+func (s *Session) Lock() error {
+	for _, name := range s.manager.config.GetEnabledPlugins() {
+		if err := s.manager.Authorize(s.principal, name, ActionAdmin); err != nil {
+			return err
+		}
+	}
+	return s.manager.Lock()
+}
+
+// Sync 使插件目录与锁文件一致，需要锁定的插件和每个启用插件的 admin 权限
+func (s *Session) Sync() error {
+	return s.SyncContext(context.Background())
+}
+
+// SyncContext 在上下文控制下使插件目录与锁文件一致，需要锁定的插件和每个启用插件的 admin 权限
+func (s *Session) SyncContext(ctx context.Context) error {
+	lock, err := ReadLockfile(s.manager.lockPath())
+	if err != nil {
+		return err
+	}
+	names := s.manager.config.GetEnabledPlugins()
+	for _, locked := range lock.Plugins {
+		names = append(names, locked.Name)
+	}
+	for _, name := range names {
+		if err := s.manager.Authorize(s.principal, name, ActionAdmin); err != nil {
+			return err
+		}
+	}
+	return s.manager.SyncContext(ctx)
+}
+
+// RollbackPlugin 回滚插件，需要 admin 权限
+func (s *Session) RollbackPlugin(name, version string) error {
+	if err := s.manager.Authorize(s.principal, name, ActionAdmin); err != nil {
+		return err
+	}
+	return s.manager.RollbackPlugin(name, version)
+}
+
+// ListPlugins 列出调用方有 read 权限的已加载插件
+func (s *Session) ListPlugins() []string {
+	return s.readable(s.manager.ListPlugins())
+}
+
+// DependencyTree 获取插件的依赖树，需要 read 权限
+func (s *Session) DependencyTree(name string) (*DependencyNode, error) {
+	if err := s.manager.Authorize(s.principal, name, ActionRead); err != nil {
+		return nil, err
+	}
+	return s.manager.DependencyTree(name)
+}
+
+// Dependents 获取直接依赖该插件且调用方有 read 权限的插件
+func (s *Session) Dependents(name string) []string {
+	return s.readable(s.manager.Dependents(name))
+}
+
+// readable 过滤出调用方有 read 权限的插件
+func (s *Session) readable(names []string) []string {
+	return slices.DeleteFunc(names, func(name string) bool {
+		return s.manager.Authorize(s.principal, name, ActionRead) != nil
+	})
+}
+
+// GetPluginConfig 获取插件配置，需要 read 权限
+func (s *Session) GetPluginConfig(name string) (*PluginData, error) {
+	if err := s.manager.Authorize(s.principal, name, ActionRead); err != nil {
+		return nil, err
+	}
+	return s.manager.GetPluginConfig(name)
+}
+
+// GetPluginSchema 获取插件配置的 JSON Schema，需要 read 权限
+func (s *Session) GetPluginSchema(name string) ([]byte, error) {
+	if err := s.manager.Authorize(s.principal, name, ActionRead); err != nil {
+		return nil, err
+	}
+	return s.manager.GetPluginSchema(name)
+}
+
+// ResolveConfig 获取合并所有配置层后的插件配置及字段来源，需要 read 权限
+func (s *Session) ResolveConfig(name string) (*ResolvedConfig, error) {
+	if err := s.manager.Authorize(s.principal, name, ActionRead); err != nil {
+		return nil, err
+	}
+	return s.manager.ResolveConfig(name)
+}
+
+// ConfigUpdated 更新插件配置，需要 write 权限，修订版本记录会话的调用方名称
+func (s *Session) ConfigUpdated(name string, config any, opts ...ConfigOption) ([]byte, error) {
+	if err := s.manager.Authorize(s.principal, name, ActionWrite); err != nil {
+		return nil, err
+	}
+	return s.manager.ConfigUpdated(name, config, append(slices.Clip(opts), WithActor(s.principal.Name))...)
+}
+
+// ConfigHistory 获取插件配置的修订历史，需要 read 权限
+func (s *Session) ConfigHistory(name string) ([]ConfigRevision, error) {
+	if err := s.manager.Authorize(s.principal, name, ActionRead); err != nil {
+		return nil, err
+	}
+	return s.manager.ConfigHistory(name)
+}
+
+// DiffConfig 比较插件配置的两个修订版本，需要 read 权限
+func (s *Session) DiffConfig(name string, from, to int) ([]ConfigDiff, error) {
+	if err := s.manager.Authorize(s.principal, name, ActionRead); err != nil {
+		return nil, err
+	}
+	return s.manager.DiffConfig(name, from, to)
+}
+
+// RollbackConfig 将插件配置回滚到指定修订版本，需要 write 权限，修订版本记录会话的调用方名称
+func (s *Session) RollbackConfig(name string, revision int, opts ...ConfigOption) ([]byte, error) {
+	if err := s.manager.Authorize(s.principal, name, ActionWrite); err != nil {
+		return nil, err
+	}
+	return s.manager.RollbackConfig(name, revision, append(slices.Clip(opts), WithActor(s.principal.Name))...)
+}
+
+// GetPluginStats 获取插件统计信息，需要 read 权限
+func (s *Session) GetPluginStats(name string) (*PluginStats, error) {
+	if err := s.manager.Authorize(s.principal, name, ActionRead); err != nil {
+		return nil, err
+	}
+	return s.manager.GetPluginStats(name)
+}
+
+// ExecutePlugin 执行插件，需要 execute 权限
+func (s *Session) ExecutePlugin(name string, data any) (any, error) {
+	return s.ExecutePluginContext(context.Background(), name, data)
+}
+
+// ExecutePluginContext 在上下文控制下执行插件，需要 execute 权限
+func (s *Session) ExecutePluginContext(ctx context.Context, name string, data any) (any, error) {
+	if err := s.manager.Authorize(s.principal, name, ActionExecute); err != nil {
+		return nil, err
+	}
+	return s.manager.ExecutePluginContext(WithCaller(ctx, s.principal.Name), name, data)
+}
+
+// GetPluginPermission 获取插件权限配置，需要 read 权限
+func (s *Session) GetPluginPermission(name string) (*PluginPermission, bool, error) {
+	if err := s.manager.Authorize(s.principal, name, ActionRead); err != nil {
+		return nil, false, err
+	}
+	permission, ok := s.manager.GetPluginPermission(name)
+	return permission, ok, nil
+}
+
+// SetPluginPermission 设置插件权限，需要 admin 权限
+func (s *Session) SetPluginPermission(name string, permission *PluginPermission) error {
+	if err := s.manager.Authorize(s.principal, name, ActionAdmin); err != nil {
+		return err
+	}
+	return s.manager.SetPluginPermission(name, permission)
+}
+
+// RemovePluginPermission 移除插件权限，需要 admin 权限
+func (s *Session) RemovePluginPermission(name string) error {
+	if err := s.manager.Authorize(s.principal, name, ActionAdmin); err != nil {
+		return err
+	}
+	return s.manager.RemovePluginPermission(name)
+}
+
+// PublishTopic 以插件的名义向其主题发布事件，需要 write 权限
+func (s *Session) PublishTopic(plugin, topic string, data any) error {
+	if err := s.manager.Authorize(s.principal, plugin, ActionWrite); err != nil {
+		return err
+	}
+	return s.manager.PublishTopic(plugin, topic, data)
+}
+
+// SubscribeTopic 以插件的名义订阅主题事件，需要 read 权限
+func (s *Session) SubscribeTopic(plugin, eventName string, handler EventHandler, filters ...EventFilter) (*TopicSubscription, error) {
+	if err := s.manager.Authorize(s.principal, plugin, ActionRead); err != nil {
+		return nil, err
+	}
+	return s.manager.SubscribeTopic(plugin, eventName, handler, filters...)
+}
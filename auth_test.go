@@ -0,0 +1,258 @@
+package plugmgr
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestAuthorizeRolePolicies(t *testing.T) {
+	m := newTestManager(t)
+	m.permissions.Store("demo", &PluginPermission{
+		AllowedActions: map[string]bool{"execute": true, "read": true, "write": false},
+		Roles:          []string{RoleUser, "editor", RoleAdmin},
+	})
+	if err := m.SetRolePolicy("editor", ActionRead, ActionWrite); err != nil {
+		t.Fatal(err)
+	}
+
+	user := Principal{Name: "alice", Roles: []string{RoleUser}}
+	editor := Principal{Name: "bob", Roles: []string{"editor"}}
+	admin := Principal{Name: "root", Roles: []string{RoleAdmin}}
+	guest := Principal{Name: "eve", Roles: []string{"guest"}}
+
+	tests := []struct {
+		principal Principal
+		action    string
+		allowed   bool
+	}{
+		{user, ActionRead, true},
+		{user, ActionExecute, true},
+		{user, ActionWrite, false},
+		{user, ActionAdmin, false},
+		{editor, ActionRead, true},
+		{editor, ActionWrite, false}, // AllowedActions 禁止写入
+		{admin, ActionWrite, false},  // AllowedActions 的禁止对管理员同样生效
+		{admin, ActionAdmin, true},
+		{guest, ActionRead, false},
+	}
+	for _, tt := range tests {
+		err := m.Authorize(tt.principal, "demo", tt.action)
+		if (err == nil) != tt.allowed {
+			t.Errorf("%s %s: 期望 allowed=%v, 得到 %v", tt.principal.Name, tt.action, tt.allowed, err)
+		}
+		if err != nil && !errors.Is(err, ErrPermissionDenied) {
+			t.Errorf("拒绝时应返回 ErrPermissionDenied, 得到 %v", err)
+		}
+	}
+
+	// 插件的角色策略覆盖全局策略，Roles 限制可访问的角色
+	m.permissions.Store("demo", &PluginPermission{
+		AllowedActions: map[string]bool{"write": true},
+		Roles:          []string{"editor"},
+		RoleActions:    map[string][]string{"editor": {ActionWrite}},
+	})
+	if err := m.Authorize(editor, "demo", ActionWrite); err != nil {
+		t.Errorf("插件策略应允许 editor 写入: %v", err)
+	}
+	if err := m.Authorize(editor, "demo", ActionRead); err == nil {
+		t.Error("插件策略覆盖后 editor 不应能读取")
+	}
+	if err := m.Authorize(user, "demo", ActionRead); err == nil {
+		t.Error("不在 Roles 中的角色不应能访问插件")
+	}
+	if err := m.Authorize(admin, "demo", ActionAdmin); err == nil {
+		t.Error("不在 Roles 中的管理员不应能访问插件")
+	}
+}
+
+func TestRolePolicyPersisted(t *testing.T) {
+	m := newTestManager(t)
+	if err := m.SetRolePolicy("editor", ActionRead, ActionWrite); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.SetRolePolicy(RoleUser); err != nil {
+		t.Fatal(err)
+	}
+	m.Shutdown()
+
+	m2, err := NewManager(m.pluginDir, "config.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m2.Shutdown()
+	if actions, ok := m2.RolePolicy("editor"); !ok || len(actions) != 2 || actions[1] != ActionWrite {
+		t.Fatalf("重启后应恢复角色策略, 得到 %v %v", actions, ok)
+	}
+	if _, ok := m2.RolePolicy(RoleUser); ok {
+		t.Fatal("重启后删除的内置角色策略不应恢复")
+	}
+}
+
+func TestSessionOperations(t *testing.T) {
+	m := newTestManager(t)
+	loadHostPlugin(t, m, "base", &fakePlugin{metadata: PluginMetadata{Version: "1.0.0"}})
+	loadHostPlugin(t, m, "app", &fakePlugin{metadata: PluginMetadata{
+		Version:      "1.0.0",
+		Dependencies: map[string]string{"base": "^1.0.0"},
+	}})
+
+	user := m.As(Principal{Name: "alice", Roles: []string{RoleUser}})
+	if result, err := user.ExecutePlugin("base", "hi"); err != nil || result != "hi" {
+		t.Fatalf("用户应能执行插件, 得到 %v, %v", result, err)
+	}
+	if _, err := user.GetPluginConfig("base"); err != nil {
+		t.Fatalf("用户应能读取配置: %v", err)
+	}
+	if _, err := user.ConfigUpdated("base", map[string]any{"a": 1}); !errors.Is(err, ErrPermissionDenied) {
+		t.Fatalf("用户不应能修改配置, 得到 %v", err)
+	}
+	if err := user.UnloadPlugin("base"); !errors.Is(err, ErrPermissionDenied) {
+		t.Fatalf("用户不应能卸载插件, 得到 %v", err)
+	}
+	if err := user.SetPluginPermission("base", &PluginPermission{}); !errors.Is(err, ErrPermissionDenied) {
+		t.Fatalf("用户不应能修改权限, 得到 %v", err)
+	}
+
+	// 级联卸载需要所有依赖方的管理权限
+	if err := m.SetRolePolicy("ops", ActionRead, ActionAdmin); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.SetPluginPermission("app", &PluginPermission{
+		AllowedActions: map[string]bool{"execute": true},
+		RoleActions:    map[string][]string{"ops": {ActionRead}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	ops := m.As(Principal{Name: "ops", Roles: []string{"ops"}})
+	if err := ops.UnloadPlugin("base", WithCascade()); !errors.Is(err, ErrPermissionDenied) {
+		t.Fatalf("没有依赖方的管理权限时不应级联卸载, 得到 %v", err)
+	}
+
+	admin := m.As(Principal{Name: "root", Roles: []string{RoleAdmin}})
+	if err := admin.UnloadPlugin("base", WithCascade()); err != nil {
+		t.Fatalf("管理员级联卸载失败: %v", err)
+	}
+}
+
+func TestSessionReadFilters(t *testing.T) {
+	m := newTestManager(t)
+	addDependentTestPlugins(m)
+	if err := m.SetPluginPermission("app", &PluginPermission{Roles: []string{RoleAdmin}}); err != nil {
+		t.Fatal(err)
+	}
+
+	user := m.As(Principal{Name: "alice", Roles: []string{RoleUser}})
+	if plugins := user.ListPlugins(); len(plugins) != 3 || slices.Contains(plugins, "app") {
+		t.Fatalf("只应列出有读取权限的插件, 得到 %v", plugins)
+	}
+	if dependents := user.Dependents("db"); len(dependents) != 0 {
+		t.Fatalf("不应返回没有读取权限的依赖方, 得到 %v", dependents)
+	}
+	if _, err := user.DependencyTree("app"); !errors.Is(err, ErrPermissionDenied) {
+		t.Fatalf("没有读取权限时不应返回依赖树, 得到 %v", err)
+	}
+	if _, err := user.DependencyTree("db"); err != nil {
+		t.Fatalf("读取依赖树失败: %v", err)
+	}
+}
+
+func TestSessionInstallAuthorizesPlan(t *testing.T) {
+	repo := newTestRepository(t)
+	repo.add("app", PluginRelease{Version: "1.0.0", Dependencies: map[string]string{"storage": "^1"}}, "app 1")
+	repo.add("storage", PluginRelease{Version: "1.0.0"}, "storage 1")
+	m := newResolverTestManager(t, repo)
+	preloadRelease(m, "app", "1.0.0", map[string]string{"storage": "^1"})
+	preloadRelease(m, "storage", "1.0.0", nil)
+
+	if err := m.SetRolePolicy("ops", ActionRead, ActionAdmin); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.SetPluginPermission("storage", &PluginPermission{Roles: []string{RoleAdmin}}); err != nil {
+		t.Fatal(err)
+	}
+
+	ops := m.As(Principal{Name: "ops", Roles: []string{"ops"}})
+	if _, err := ops.PlanInstall(context.Background(), "app", ""); err != nil {
+		t.Fatalf("计算安装计划失败: %v", err)
+	}
+	if err := ops.InstallPlugin("app", ""); !errors.Is(err, ErrPermissionDenied) || !strings.Contains(err.Error(), "storage") {
+		t.Fatalf("没有依赖的管理权限时不应安装, 得到 %v", err)
+	}
+	if _, ok := m.plugins.Load("storage"); ok {
+		t.Fatal("拒绝安装时不应加载依赖")
+	}
+
+	admin := m.As(Principal{Name: "root", Roles: []string{RoleAdmin}})
+	if err := admin.InstallPlugin("app", ""); err != nil {
+		t.Fatalf("管理员安装失败: %v", err)
+	}
+}
+
+func TestSessionInstallPackageDenied(t *testing.T) {
+	repo := newTestRepository(t)
+	src := writePackageSource(t, PackageManifest{Name: "greeter", Version: "1.0.0"}, map[string]string{"greeter.so": "binary"})
+	pkg := filepath.Join(t.TempDir(), "greeter-1.0.0.tar.gz")
+	if err := CreatePackage(src, pkg, repo.privateKeyPath()); err != nil {
+		t.Fatal(err)
+	}
+
+	m := newTestManager(t)
+	m.publicKeyPath = repo.keyPath
+	user := m.As(Principal{Name: "alice", Roles: []string{RoleUser}})
+	if err := user.InstallPackage(pkg); !errors.Is(err, ErrPermissionDenied) {
+		t.Fatalf("没有管理权限时不应安装插件包, 得到 %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(m.pluginDir, "versions", "greeter")); !os.IsNotExist(err) {
+		t.Fatalf("拒绝安装时不应写入版本目录: %v", err)
+	}
+}
+
+func TestPluginPermissionPersisted(t *testing.T) {
+	m := newTestManager(t)
+	loadHostPlugin(t, m, "demo", &fakePlugin{})
+
+	// LoadPlugin 以指针形式保存默认权限
+	if !m.HasPermission("demo", "execute") || m.HasPermission("demo", "admin") {
+		t.Fatal("默认权限不正确")
+	}
+
+	permission := &PluginPermission{
+		AllowedActions: map[string]bool{"execute": true, "write": true},
+		Roles:          []string{"editor"},
+		RoleActions:    map[string][]string{"editor": {ActionRead, ActionWrite}},
+	}
+	if err := m.SetPluginPermission("demo", permission); err != nil {
+		t.Fatalf("设置权限失败: %v", err)
+	}
+
+	// 卸载后重新加载恢复保存的权限
+	if err := m.UnloadPlugin("demo"); err != nil {
+		t.Fatal(err)
+	}
+	loadHostPlugin(t, m, "demo", &fakePlugin{})
+	editor := Principal{Name: "bob", Roles: []string{"editor"}}
+	if err := m.Authorize(editor, "demo", ActionWrite); err != nil {
+		t.Fatalf("重新加载后权限应恢复: %v", err)
+	}
+
+	// 新的管理器从配置加载权限
+	m2, err := NewManager(m.pluginDir, "config.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m2.Authorize(editor, "demo", ActionWrite); err != nil {
+		t.Fatalf("新管理器应从配置加载权限: %v", err)
+	}
+
+	if err := m2.RemovePluginPermission("demo"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m2.config.GetPluginPermissions("demo"); ok {
+		t.Fatal("移除权限后配置中不应保留")
+	}
+}
@@ -0,0 +1,295 @@
+package plugmgr
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// cgroupControllers 资源限制需要的 cgroup v2 控制器
+var cgroupControllers = []string{"cpu", "memory", "pids"}
+
+// cpuMaxPeriod cpu.max 使用的调度周期(微秒)
+const cpuMaxPeriod = 100000
+
+// CgroupLimits 进程插件的 cgroup v2 资源限制
+//
+//	字段说明:
+//	- MemoryMax: memory.max，内存上限字节数，超出后插件进程被 OOM 结束
+//	- CPUMax: cpu.max，可使用的 CPU 核数，例如 0.5 表示每个调度周期最多使用半个核
+//	- PidsMax: pids.max，插件可以创建的进程和线程总数
+//
+//	零值表示不限制。
+type CgroupLimits struct {
+	MemoryMax int64   `json:"memory_max,omitempty"`
+	CPUMax    float64 `json:"cpu_max,omitempty"`
+	PidsMax   int64   `json:"pids_max,omitempty"`
+}
+
+// cgroupUsage 从 cgroup 读取的资源使用情况
+type cgroupUsage struct {
+	CPUTime       time.Duration // cpu.stat 中的 usage_usec
+	PeakMemory    int64         // memory.peak，内核不支持时为 memory.current
+	OOMKills      int64         // memory.events 中的 oom_kill
+	PidsLimitHits int64         // pids.events 中的 max
+}
+
+// exceeded 返回相对于之前的使用情况新出现的资源限制事件
+func (u cgroupUsage) exceeded(prev cgroupUsage) string {
+	switch {
+	case u.OOMKills > prev.OOMKills:
+		return "memory"
+	case u.PidsLimitHits > prev.PidsLimitHits:
+		return "pids"
+	default:
+		return ""
+	}
+}
+
+// ResourceLimitError 插件超出 cgroup 资源限制时返回的错误
+//
+//	可以通过 errors.Is(err, ErrResourceLimitExceeded) 判断，
+//	同时保留插件执行返回的原始错误。
+type ResourceLimitError struct {
+	Plugin   string       // 插件名称
+	Resource string       // 超出限制的资源: "memory" 或 "pids"
+	Limits   CgroupLimits // 插件的资源限制
+	Err      error        // 插件执行返回的原始错误
+}
+
+// Error 实现 error 接口
+func (e *ResourceLimitError) Error() string {
+	var limit string
+	switch e.Resource {
+	case "memory":
+		limit = fmt.Sprintf("memory.max=%d", e.Limits.MemoryMax)
+	case "pids":
+		limit = fmt.Sprintf("pids.max=%d", e.Limits.PidsMax)
+	}
+	if e.Err == nil {
+		return fmt.Sprintf("插件 %s 超出资源限制 %s", e.Plugin, limit)
+	}
+	return fmt.Sprintf("插件 %s 超出资源限制 %s: %v", e.Plugin, limit, e.Err)
+}
+
+// Unwrap 返回错误类型和原始错误
+func (e *ResourceLimitError) Unwrap() []error {
+	if e.Err == nil {
+		return []error{ErrResourceLimitExceeded}
+	}
+	return []error{ErrResourceLimitExceeded, e.Err}
+}
+
+// cgroupManager 管理所有插件 cgroup 的公共父 cgroup
+type cgroupManager struct {
+	base string
+	seq  atomic.Uint64
+}
+
+// newCgroupManager 在父 cgroup 下创建管理器使用的 cgroup
+//
+//	参数:
+//	- parent: 委派给管理器的父 cgroup 目录，不能为空
+//	返回:
+//	- *cgroupManager: cgroup 管理器
+//	- error: 未指定父 cgroup、cgroup v2 不可用或父 cgroup 未委派所需控制器时返回 ErrCgroupUnavailable
+//	功能:
+//	- cgroup v2 不允许在包含进程的 cgroup 中启用子控制器，宿主进程所在的 cgroup
+//	  通常无法使用，因此要求显式指定不包含进程的父 cgroup
+func newCgroupManager(parent string) (*cgroupManager, error) {
+	if parent == "" {
+		return nil, wrap(ErrCgroupUnavailable, "未设置父 cgroup，请使用 SetCgroupParent 指定委派了 cpu、memory 和 pids 控制器的 cgroup")
+	}
+
+	data, err := os.ReadFile(filepath.Join(parent, "cgroup.controllers"))
+	if err != nil {
+		return nil, wrapf(ErrCgroupUnavailable, "读取 cgroup %s 的控制器失败: %v", parent, err)
+	}
+	available := strings.Fields(string(data))
+	for _, controller := range cgroupControllers {
+		if !containsString(available, controller) {
+			return nil, wrapf(ErrCgroupUnavailable, "cgroup %s 未启用 %s 控制器", parent, controller)
+		}
+	}
+
+	enable := "+" + strings.Join(cgroupControllers, " +")
+	if err := enableCgroupControllers(parent, enable); err != nil {
+		return nil, wrap(ErrCgroupUnavailable, err.Error())
+	}
+
+	base := filepath.Join(parent, fmt.Sprintf("plugmgr-%d", os.Getpid()))
+	if err := os.Mkdir(base, 0o755); err != nil && !os.IsExist(err) {
+		return nil, wrapf(ErrCgroupUnavailable, "创建 cgroup %s 失败: %v", base, err)
+	}
+	if err := enableCgroupControllers(base, enable); err != nil {
+		_ = os.Remove(base)
+		return nil, wrap(ErrCgroupUnavailable, err.Error())
+	}
+	return &cgroupManager{base: base}, nil
+}
+
+func enableCgroupControllers(dir, enable string) error {
+	path := filepath.Join(dir, "cgroup.subtree_control")
+	if data, err := os.ReadFile(path); err == nil {
+		enabled := strings.Fields(string(data))
+		missing := false
+		for _, controller := range cgroupControllers {
+			missing = missing || !containsString(enabled, controller)
+		}
+		if !missing {
+			return nil
+		}
+	}
+	if err := os.WriteFile(path, []byte(enable), 0o644); err != nil {
+		return wrapf(err, "为 cgroup %s 启用控制器失败", dir)
+	}
+	return nil
+}
+
+// create 为插件创建 cgroup 并写入资源限制
+func (cm *cgroupManager) create(name string, limits CgroupLimits) (*pluginCgroup, error) {
+	path := filepath.Join(cm.base, fmt.Sprintf("%s-%d", name, cm.seq.Add(1)))
+	if err := os.Mkdir(path, 0o755); err != nil {
+		return nil, wrapf(err, "创建插件 cgroup 失败: %s", path)
+	}
+
+	cg := &pluginCgroup{path: path, limits: limits, fd: -1}
+	if err := cg.writeLimits(); err != nil {
+		_ = cg.remove()
+		return nil, err
+	}
+	return cg, nil
+}
+
+// remove 删除管理器创建的父 cgroup
+func (cm *cgroupManager) remove() error {
+	return os.Remove(cm.base)
+}
+
+// pluginCgroup 单个插件进程的 cgroup
+type pluginCgroup struct {
+	path   string
+	limits CgroupLimits
+	fd     int
+
+	mu       sync.Mutex
+	reported cgroupUsage
+}
+
+func (cg *pluginCgroup) writeLimits() error {
+	values := map[string]string{
+		"memory.max": "max",
+		"cpu.max":    fmt.Sprintf("max %d", cpuMaxPeriod),
+		"pids.max":   "max",
+	}
+	if cg.limits.MemoryMax > 0 {
+		values["memory.max"] = strconv.FormatInt(cg.limits.MemoryMax, 10)
+	}
+	if cg.limits.CPUMax > 0 {
+		quota := int64(cg.limits.CPUMax * cpuMaxPeriod)
+		values["cpu.max"] = fmt.Sprintf("%d %d", max(quota, 1000), cpuMaxPeriod)
+	}
+	if cg.limits.PidsMax > 0 {
+		values["pids.max"] = strconv.FormatInt(cg.limits.PidsMax, 10)
+	}
+
+	for _, file := range sortedKeys(values) {
+		if err := os.WriteFile(filepath.Join(cg.path, file), []byte(values[file]), 0o644); err != nil {
+			return wrapf(err, "设置 cgroup 限制 %s 失败", file)
+		}
+	}
+
+	// 超出内存限制时结束插件的所有进程，旧内核不支持时忽略
+	_ = os.WriteFile(filepath.Join(cg.path, "memory.oom.group"), []byte("1"), 0o644)
+	return nil
+}
+
+// usage 读取 cgroup 当前的资源使用情况
+func (cg *pluginCgroup) usage() (cgroupUsage, error) {
+	var u cgroupUsage
+
+	cpu, err := readCgroupKeyed(filepath.Join(cg.path, "cpu.stat"))
+	if err != nil {
+		return u, err
+	}
+	u.CPUTime = time.Duration(cpu["usage_usec"]) * time.Microsecond
+
+	if u.PeakMemory, err = readCgroupInt(filepath.Join(cg.path, "memory.peak")); os.IsNotExist(err) {
+		u.PeakMemory, err = readCgroupInt(filepath.Join(cg.path, "memory.current"))
+	}
+	if err != nil {
+		return u, err
+	}
+
+	memory, err := readCgroupKeyed(filepath.Join(cg.path, "memory.events"))
+	if err != nil {
+		return u, err
+	}
+	u.OOMKills = memory["oom_kill"]
+
+	pids, err := readCgroupKeyed(filepath.Join(cg.path, "pids.events"))
+	if err != nil {
+		return u, err
+	}
+	u.PidsLimitHits = pids["max"]
+	return u, nil
+}
+
+// report 返回最新的使用情况，以及自上次调用以来新出现的资源限制事件
+func (cg *pluginCgroup) report(u cgroupUsage) string {
+	cg.mu.Lock()
+	defer cg.mu.Unlock()
+	exceeded := u.exceeded(cg.reported)
+	cg.reported = u
+	return exceeded
+}
+
+// remove 删除插件的 cgroup，插件进程必须已经退出
+func (cg *pluginCgroup) remove() error {
+	cg.closeFD()
+	if err := os.Remove(cg.path); err != nil && !os.IsNotExist(err) {
+		return wrapf(err, "删除插件 cgroup 失败: %s", cg.path)
+	}
+	return nil
+}
+
+func readCgroupInt(path string) (int64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+}
+
+// readCgroupKeyed 读取 "键 值" 格式的 cgroup 统计文件
+func readCgroupKeyed(path string) (map[string]int64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]int64)
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		if n, err := strconv.ParseInt(fields[1], 10, 64); err == nil {
+			values[fields[0]] = n
+		}
+	}
+	return values, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
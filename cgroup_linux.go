@@ -0,0 +1,35 @@
+//go:build linux
+// +build linux
+
+package plugmgr
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// apply 配置命令在启动时直接进入插件的 cgroup
+//
+//	使用 CLONE_INTO_CGROUP，子进程从第一条指令起就受到资源限制。
+func (cg *pluginCgroup) apply(cmd *exec.Cmd) error {
+	fd, err := syscall.Open(cg.path, syscall.O_RDONLY|syscall.O_DIRECTORY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return wrapf(err, "打开插件 cgroup 失败: %s", cg.path)
+	}
+	cg.fd = fd
+
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.UseCgroupFD = true
+	cmd.SysProcAttr.CgroupFD = fd
+	return nil
+}
+
+// closeFD 关闭启动子进程时使用的 cgroup 目录描述符
+func (cg *pluginCgroup) closeFD() {
+	if cg.fd >= 0 {
+		_ = syscall.Close(cg.fd)
+		cg.fd = -1
+	}
+}
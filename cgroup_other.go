@@ -0,0 +1,13 @@
+//go:build !linux
+// +build !linux
+
+package plugmgr
+
+import "os/exec"
+
+// apply cgroup 资源限制仅支持 Linux 平台
+func (cg *pluginCgroup) apply(cmd *exec.Cmd) error {
+	return newError("cgroup 资源限制仅支持 Linux 平台")
+}
+
+func (cg *pluginCgroup) closeFD() {}
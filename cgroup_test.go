@@ -0,0 +1,176 @@
+package plugmgr
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newFakeCgroupParent 创建模拟 cgroup v2 父目录的普通目录
+func newFakeCgroupParent(t *testing.T, controllers string) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "cgroup.controllers"), []byte(controllers), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func writeCgroupFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func readCgroupFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(string(data))
+}
+
+func TestCgroupManagerCreate(t *testing.T) {
+	parent := newFakeCgroupParent(t, "cpuset cpu io memory pids")
+	cgroups, err := newCgroupManager(parent)
+	if err != nil {
+		t.Fatalf("创建 cgroup 管理器失败: %v", err)
+	}
+
+	if got := readCgroupFile(t, filepath.Join(parent, "cgroup.subtree_control")); got != "+cpu +memory +pids" {
+		t.Fatalf("父 cgroup 未启用控制器: %q", got)
+	}
+
+	cg, err := cgroups.create("demo", CgroupLimits{MemoryMax: 64 << 20, CPUMax: 0.5})
+	if err != nil {
+		t.Fatalf("创建插件 cgroup 失败: %v", err)
+	}
+	if !strings.HasPrefix(cg.path, cgroups.base) {
+		t.Fatalf("插件 cgroup 应位于管理器 cgroup 下: %s", cg.path)
+	}
+
+	want := map[string]string{
+		"memory.max": "67108864",
+		"cpu.max":    "50000 100000",
+		"pids.max":   "max",
+	}
+	for file, value := range want {
+		if got := readCgroupFile(t, filepath.Join(cg.path, file)); got != value {
+			t.Errorf("%s 期望 %q, 得到 %q", file, value, got)
+		}
+	}
+}
+
+func TestCgroupManagerUnavailable(t *testing.T) {
+	parent := newFakeCgroupParent(t, "cpu io")
+	if _, err := newCgroupManager(parent); err == nil || !strings.Contains(err.Error(), "memory") {
+		t.Fatalf("期望缺少 memory 控制器的错误, 得到 %v", err)
+	}
+	if _, err := newCgroupManager(filepath.Join(parent, "missing")); !errors.Is(err, ErrCgroupUnavailable) {
+		t.Fatalf("期望不存在的父 cgroup 返回 ErrCgroupUnavailable, 得到 %v", err)
+	}
+}
+
+func TestCgroupUsage(t *testing.T) {
+	cg := &pluginCgroup{path: t.TempDir(), fd: -1}
+	writeCgroupFiles(t, cg.path, map[string]string{
+		"cpu.stat":       "usage_usec 1500000\nuser_usec 1000000\nsystem_usec 500000\n",
+		"memory.current": "4096\n",
+		"memory.events":  "low 0\nhigh 0\nmax 3\noom 1\noom_kill 1\n",
+		"pids.events":    "max 0\n",
+	})
+
+	usage, err := cg.usage()
+	if err != nil {
+		t.Fatalf("读取资源使用情况失败: %v", err)
+	}
+	want := cgroupUsage{CPUTime: 1500 * time.Millisecond, PeakMemory: 4096, OOMKills: 1}
+	if usage != want {
+		t.Fatalf("期望 %+v, 得到 %+v", want, usage)
+	}
+
+	writeCgroupFiles(t, cg.path, map[string]string{"memory.peak": "8192\n"})
+	if usage, _ = cg.usage(); usage.PeakMemory != 8192 {
+		t.Fatalf("存在 memory.peak 时应优先使用, 得到 %d", usage.PeakMemory)
+	}
+
+	if got := cg.report(usage); got != "memory" {
+		t.Fatalf("期望首次报告内存超限, 得到 %q", got)
+	}
+	if got := cg.report(usage); got != "" {
+		t.Fatalf("相同的使用情况不应重复报告, 得到 %q", got)
+	}
+}
+
+func TestUpdateResourceUsageLimitExceeded(t *testing.T) {
+	m := newTestManager(t)
+	cg := &pluginCgroup{path: t.TempDir(), fd: -1, limits: CgroupLimits{PidsMax: 8}}
+	writeCgroupFiles(t, cg.path, map[string]string{
+		"cpu.stat":       "usage_usec 2000\n",
+		"memory.current": "1024\n",
+		"memory.events":  "oom_kill 0\n",
+		"pids.events":    "max 0\n",
+	})
+	p := newProcessPlugin("limited", nil, m.logger)
+	p.cgroup = cg
+	m.plugins.Store("limited", &lazyPlugin{path: "limited.plugin", loaded: p})
+	m.stats.Store("limited", &PluginStats{})
+
+	var events atomic.Int32
+	m.SubscribeToEvent(PluginResourceLimitExceeded, func(Event) { events.Add(1) })
+
+	if err := m.updateResourceUsage("limited", &lazyPlugin{loaded: p}, nil); err != nil {
+		t.Fatalf("未超限时不应返回错误: %v", err)
+	}
+
+	writeCgroupFiles(t, cg.path, map[string]string{"pids.events": "max 2\n"})
+	execErr := errors.New("fork failed")
+	err := m.updateResourceUsage("limited", &lazyPlugin{loaded: p}, execErr)
+
+	var limitErr *ResourceLimitError
+	if !errors.As(err, &limitErr) || limitErr.Resource != "pids" {
+		t.Fatalf("期望 pids 超限错误, 得到 %v", err)
+	}
+	if !errors.Is(err, ErrResourceLimitExceeded) || !errors.Is(err, execErr) {
+		t.Fatalf("错误应同时包含 ErrResourceLimitExceeded 和原始错误: %v", err)
+	}
+
+	stats, _ := m.GetPluginStats("limited")
+	if stats.CPUTime != 2*time.Millisecond || stats.PeakMemory != 1024 || stats.ResourceLimitCount != 1 {
+		t.Fatalf("统计信息未更新: %+v", stats)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for events.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if events.Load() != 1 {
+		t.Fatalf("期望收到 1 个资源超限事件, 得到 %d", events.Load())
+	}
+}
+
+func TestResourceLimitsRequireCgroup(t *testing.T) {
+	for _, parent := range []string{"", newFakeCgroupParent(t, "cpu")} {
+		m := newTestManager(t)
+		m.SetCgroupParent(parent)
+		m.SetPluginResourceLimits("echo", CgroupLimits{MemoryMax: 64 << 20})
+		linkTestProcessPlugins(t, m.pluginDir, "echo")
+
+		err := m.LoadPlugin(filepath.Join(m.pluginDir, "echo"+ProcessPluginExt))
+		if !errors.Is(err, ErrCgroupUnavailable) {
+			t.Fatalf("父 cgroup %q 不可用时应返回 ErrCgroupUnavailable, 得到 %v", parent, err)
+		}
+		if _, ok := m.plugins.Load("echo"); ok {
+			t.Fatal("无法设置资源限制的插件不应被加载")
+		}
+		m.Shutdown()
+	}
+}
@@ -0,0 +1,189 @@
+// plugmgr-repo 插件仓库服务器
+//
+// 用法:
+//
+//	plugmgr-repo serve -dir ./repo -addr :8080 -key repo.key -token secret
+//	plugmgr-repo index -dir ./repo -key repo.key
+//	plugmgr-repo upload -url http://localhost:8080 -token secret -name greeter -version 1.2.0 -file greeter.so
+//	plugmgr-repo pack -dir ./greeter -out greeter-1.2.0.tar.gz -key repo.key
+//
+// serve 从目录提供索引和插件制品，并接受使用 Bearer 令牌认证的上传。
+// index 根据目录中的 release.json 重新生成并签名索引。
+// upload 上传新版本，-dep 可以重复指定依赖，例如 -dep storage=^2.0。
+// pack 将包含 plugin.json 的目录打包为插件包并签名清单。
+// 令牌也可以通过环境变量 PLUGMGR_REPO_TOKEN 设置。
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	pm "github.com/darkit/plugmgr"
+)
+
+const usage = "用法: plugmgr-repo (serve | index | upload | pack) [参数]"
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "serve":
+		err = serve(os.Args[2:])
+	case "index":
+		err = index(os.Args[2:])
+	case "upload":
+		err = upload(os.Args[2:])
+	case "pack":
+		err = pack(os.Args[2:])
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, os.Args[1], "失败:", err)
+		os.Exit(1)
+	}
+}
+
+func serve(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	dir := fs.String("dir", ".", "仓库目录")
+	addr := fs.String("addr", ":8080", "监听地址")
+	key := fs.String("key", "", "签名私钥文件")
+	token := fs.String("token", os.Getenv("PLUGMGR_REPO_TOKEN"), "上传令牌，为空时禁止上传")
+	certFile := fs.String("tls-cert", "", "TLS 证书文件")
+	keyFile := fs.String("tls-key", "", "TLS 私钥文件")
+	maxUpload := fs.Int64("max-upload", 512<<20, "单次上传的大小限制(字节)")
+	fs.Parse(args)
+
+	opts := []pm.RepositoryServerOption{pm.WithUploadToken(*token), pm.WithMaxUploadSize(*maxUpload)}
+	if *key != "" {
+		opts = append(opts, pm.WithSigningKey(*key))
+	}
+	server, err := pm.NewRepositoryServer(*dir, opts...)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("插件仓库监听", *addr)
+	if *certFile != "" {
+		return http.ListenAndServeTLS(*addr, *certFile, *keyFile, server)
+	}
+	return http.ListenAndServe(*addr, server)
+}
+
+func index(args []string) error {
+	fs := flag.NewFlagSet("index", flag.ExitOnError)
+	dir := fs.String("dir", ".", "仓库目录")
+	key := fs.String("key", "", "签名私钥文件")
+	fs.Parse(args)
+
+	var opts []pm.RepositoryServerOption
+	if *key != "" {
+		opts = append(opts, pm.WithSigningKey(*key))
+	}
+	// 创建服务器时重新生成索引
+	if _, err := pm.NewRepositoryServer(*dir, opts...); err != nil {
+		return err
+	}
+	fmt.Println("已生成索引", filepath.Join(*dir, pm.RepositoryIndexFile))
+	return nil
+}
+
+// dependencies 收集重复的 -dep name=constraint 参数
+type dependencies map[string]string
+
+func (d dependencies) String() string {
+	data, _ := json.Marshal(map[string]string(d))
+	return string(data)
+}
+
+func (d dependencies) Set(value string) error {
+	name, constraint, ok := strings.Cut(value, "=")
+	if !ok || name == "" {
+		return fmt.Errorf("依赖格式应为 name=constraint: %s", value)
+	}
+	d[name] = constraint
+	return nil
+}
+
+func upload(args []string) error {
+	deps := dependencies{}
+	fs := flag.NewFlagSet("upload", flag.ExitOnError)
+	url := fs.String("url", "", "仓库地址")
+	token := fs.String("token", os.Getenv("PLUGMGR_REPO_TOKEN"), "上传令牌")
+	file := fs.String("file", "", "插件制品文件")
+	name := fs.String("name", "", "插件名称，默认使用文件名")
+	version := fs.String("version", "", "插件版本")
+	description := fs.String("description", "", "插件描述")
+	author := fs.String("author", "", "插件作者")
+	goos := fs.String("os", "", "适用的操作系统")
+	arch := fs.String("arch", "", "适用的处理器架构")
+	goVersion := fs.String("go", "", "编译插件的 Go 版本")
+	fs.Var(deps, "dep", "依赖的插件及版本约束，可以重复指定")
+	fs.Parse(args)
+
+	if *url == "" || *file == "" || *version == "" {
+		return fmt.Errorf("需要指定 -url、-file 和 -version")
+	}
+	if *name == "" {
+		*name = strings.TrimSuffix(filepath.Base(*file), filepath.Ext(*file))
+	}
+
+	f, err := os.Open(*file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	repo, err := pm.NewPluginRepository(*url)
+	if err != nil {
+		return err
+	}
+	release, err := repo.Upload(context.Background(), *token, &pm.RepositoryUpload{
+		Name:        *name,
+		Description: *description,
+		Author:      *author,
+		Release: pm.PluginRelease{
+			Version:      *version,
+			OS:           *goos,
+			Arch:         *arch,
+			GoVersion:    *goVersion,
+			Dependencies: deps,
+		},
+		FileName: filepath.Base(*file),
+		Artifact: f,
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("已发布 %s %s (%s)\n", *name, release.Version, release.SHA256)
+	return nil
+}
+
+func pack(args []string) error {
+	fs := flag.NewFlagSet("pack", flag.ExitOnError)
+	dir := fs.String("dir", ".", "包含 plugin.json 的插件目录")
+	out := fs.String("out", "", "插件包路径，扩展名为 .zip 时生成 zip，否则生成 tar.gz")
+	key := fs.String("key", "", "签名清单的私钥文件")
+	fs.Parse(args)
+
+	if *out == "" {
+		return fmt.Errorf("需要指定 -out")
+	}
+	if err := pm.CreatePackage(*dir, *out, *key); err != nil {
+		return err
+	}
+	fmt.Println("已生成插件包", *out)
+	return nil
+}
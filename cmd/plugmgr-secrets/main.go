@@ -0,0 +1,80 @@
+// plugmgr-secrets 管理插件配置中加密保存的密钥字段
+//
+// 用法:
+//
+//	plugmgr-secrets rotate -config plugins/config.db -keyring ./keys
+//	plugmgr-secrets rotate -config plugins/config.db -key-file new.key -old-key-file old.key
+//
+// rotate 使用新密钥重新加密配置及修订历史中的所有密钥字段，执行时管理器不应运行。
+// 指定 -keyring 时先在密钥环中生成新密钥，旧密钥保留在密钥环中。
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	pm "github.com/darkit/plugmgr"
+)
+
+func main() {
+	if len(os.Args) < 2 || os.Args[1] != "rotate" {
+		fmt.Fprintln(os.Stderr, "用法: plugmgr-secrets rotate -config <配置文件> (-keyring <目录> | -key-file <新密钥> -old-key-file <旧密钥>)")
+		os.Exit(2)
+	}
+
+	fs := flag.NewFlagSet("rotate", flag.ExitOnError)
+	configPath := fs.String("config", "", "配置文件路径")
+	journal := fs.Bool("journal", false, "配置使用 JournalConfigStore 保存")
+	keyringDir := fs.String("keyring", "", "密钥环目录")
+	keyFile := fs.String("key-file", "", "新密钥文件")
+	oldKeyFile := fs.String("old-key-file", "", "旧密钥文件")
+	fs.Parse(os.Args[2:])
+
+	if err := rotate(*configPath, *journal, *keyringDir, *keyFile, *oldKeyFile); err != nil {
+		fmt.Fprintln(os.Stderr, "轮换密钥失败:", err)
+		os.Exit(1)
+	}
+}
+
+func rotate(configPath string, journal bool, keyringDir, keyFile, oldKeyFile string) error {
+	if configPath == "" {
+		return fmt.Errorf("未指定 -config")
+	}
+
+	var provider pm.KeyProvider
+	var previous []pm.KeyProvider
+	switch {
+	case keyringDir != "":
+		keyring, err := pm.NewKeyring(keyringDir)
+		if err != nil {
+			return err
+		}
+		id, err := keyring.Rotate()
+		if err != nil {
+			return err
+		}
+		fmt.Println("已生成新密钥:", id)
+		provider = keyring
+	case keyFile != "" && oldKeyFile != "":
+		provider = pm.FileKeyProvider(keyFile)
+		previous = append(previous, pm.FileKeyProvider(oldKeyFile))
+	default:
+		return fmt.Errorf("需要指定 -keyring 或同时指定 -key-file 和 -old-key-file")
+	}
+
+	var store pm.ConfigStore
+	if journal {
+		store = pm.NewJournalConfigStore(configPath, 0)
+	} else {
+		store = pm.NewFileConfigStore(configPath)
+	}
+	defer store.Close()
+
+	count, err := pm.RotateConfigSecrets(store, provider, previous...)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("已重新加密 %d 个密钥字段\n", count)
+	return nil
+}
@@ -1,12 +1,11 @@
 package plugmgr
 
 import (
-	"os"
+	"maps"
 	"path/filepath"
+	"slices"
 	"sync"
 	"time"
-
-	msgpack "github.com/vmihailenco/msgpack/v5"
 )
 
 // PluginData 存储插件配置的详细信息
@@ -14,22 +13,34 @@ type PluginData struct {
 	Config      []byte            `msgpack:"config"`     // 插件的配置数据
 	UpdatedAt   time.Time         `msgpack:"updated_at"` // 最后更新时间
 	Permissions *PluginPermission `msgpack:"permissions,omitempty"`
+	Values      map[string][]byte `msgpack:"values,omitempty"`   // 插件通过 Host 写入的键值数据
+	Revision    int               `msgpack:"revision,omitempty"` // 最新的配置修订版本号
+	History     []ConfigRevision  `msgpack:"history,omitempty"`  // 配置修订历史，按版本号升序排列
 }
 
 // config 配置结构
+//
+//	配置保存在内存中，每次修改通过 ConfigStore 持久化。
 type config struct {
-	path          string                 `msgpack:"-"`       // 配置文件路径
-	mu            sync.RWMutex           `msgpack:"-"`       // 读写锁
-	enabled       map[string]bool        `msgpack:"enabled"` // 私有化：插件启用状态
-	pluginConfigs map[string]*PluginData `msgpack:"configs"` // 私有化：插件配置数据
+	store         ConfigStore            // 配置存储
+	mu            sync.RWMutex           // 读写锁
+	enabled       map[string]bool        // 插件启用状态
+	pluginConfigs map[string]*PluginData // 插件配置数据
+	roles         map[string][]string    // 角色策略
+	historyLimit  int                    // 每个插件保留的配置修订版本数量
 }
 
-// NewConfig 创建新的配置实例
+// NewConfig 创建使用文件存储的配置实例
 func NewConfig(filename string) *config {
+	return newConfig(NewFileConfigStore(filename))
+}
+
+func newConfig(store ConfigStore) *config {
 	return &config{
-		path:          filename,
+		store:         store,
 		enabled:       make(map[string]bool),
 		pluginConfigs: make(map[string]*PluginData),
+		roles:         make(map[string][]string),
 	}
 }
 
@@ -38,57 +49,148 @@ func LoadConfig(filename string, pluginDir ...string) (*config, error) {
 	if len(pluginDir) > 0 {
 		filename = filepath.Join(pluginDir[0], filename)
 	}
+	return loadConfig(NewFileConfigStore(filename))
+}
 
-	c := NewConfig(filename)
-
-	file, err := os.ReadFile(filename)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return c, nil
-		}
-		return nil, wrap(err, "读取配置文件失败")
+// loadConfig 从存储加载配置
+//
+//	存储回退到最后一个完好的快照时，同时返回配置和 ErrConfigRecovered。
+func loadConfig(store ConfigStore) (*config, error) {
+	snapshot, err := store.Load()
+	if snapshot == nil {
+		return nil, wrap(err, "加载配置失败")
 	}
 
-	if err := msgpack.Unmarshal(file, c); err != nil {
-		return nil, wrap(err, "解析配置文件失败")
-	}
+	c := newConfig(store)
+	c.enabled = snapshot.Enabled
+	c.pluginConfigs = snapshot.Configs
+	c.roles = snapshot.Roles
+	return c, err
+}
 
-	return c, nil
+// snapshot 返回引用当前配置的快照，调用方需持有锁
+func (c *config) snapshot() *ConfigSnapshot {
+	return &ConfigSnapshot{Enabled: c.enabled, Configs: c.pluginConfigs, Roles: c.roles}
 }
 
-// Save 保存配置到文件
+// Save 保存完整配置
 func (c *config) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.save(ConfigChange{})
+}
+
+// save 保存配置修改，调用方需持有写锁
+func (c *config) save(change ConfigChange) error {
+	return wrap(c.store.Save(c.snapshot(), change), "保存配置失败")
+}
+
+// savePlugin 保存单个插件的配置数据，调用方需持有写锁
+func (c *config) savePlugin(name string) error {
+	return c.save(ConfigChange{Plugin: name, Data: c.pluginConfigs[name]})
+}
+
+// RolePolicy 获取保存的角色策略，actions 为 nil 表示已删除
+func (c *config) RolePolicy(role string) (actions []string, ok bool) {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
-	data, err := msgpack.Marshal(c)
-	if err != nil {
-		return wrap(err, "序列化配置失败")
-	}
+	actions, ok = c.roles[role]
+	return actions, ok
+}
 
-	return wrap(os.WriteFile(c.path, data, 0o644), "写入配置文件失败")
+// SetRolePolicy 保存角色策略，actions 为 nil 表示删除
+func (c *config) SetRolePolicy(role string, actions []string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.roles[role] = actions
+	return c.save(ConfigChange{Role: role, Actions: actions})
 }
 
-// GetPluginConfig 获取插件配置
+// Close 关闭配置存储
+func (c *config) Close() error {
+	return c.store.Close()
+}
+
+// GetPluginConfig 获取插件配置的副本
+//
+//	副本在读锁内复制，Values 和 History 不与之后的修改共享。
 func (c *config) GetPluginConfig(name string) (*PluginData, bool) {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
 	data, exists := c.pluginConfigs[name]
-	return data, exists
+	if !exists || data == nil {
+		return nil, false
+	}
+	clone := *data
+	clone.Values = maps.Clone(data.Values)
+	clone.History = slices.Clone(data.History)
+	return &clone, true
+}
+
+// SetPluginConfig 设置插件配置，并记录为新的修订版本
+func (c *config) SetPluginConfig(name string, config []byte, opts ...ConfigOption) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data := c.pluginData(name)
+	data.Config = config
+	data.UpdatedAt = time.Now()
+	c.recordRevision(data, newConfigOptions(opts))
+
+	return c.savePlugin(name)
+}
+
+// pluginData 获取插件的配置数据，不存在时创建，调用方需持有写锁
+func (c *config) pluginData(name string) *PluginData {
+	data, exists := c.pluginConfigs[name]
+	if !exists {
+		data = &PluginData{}
+		c.pluginConfigs[name] = data
+	}
+	return data
 }
 
-// SetPluginConfig 设置插件配置
-func (c *config) SetPluginConfig(name string, config []byte) error {
+// GetPluginValue 获取插件键值存储中的值
+func (c *config) GetPluginValue(name, key string) ([]byte, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if data, exists := c.pluginConfigs[name]; exists {
+		value, ok := data.Values[key]
+		return value, ok
+	}
+	return nil, false
+}
+
+// SetPluginValue 设置插件键值存储中的值
+func (c *config) SetPluginValue(name, key string, value []byte) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	c.pluginConfigs[name] = &PluginData{
-		Config:    config,
-		UpdatedAt: time.Now(),
+	data := c.pluginData(name)
+	if data.Values == nil {
+		data.Values = make(map[string][]byte)
 	}
+	data.Values[key] = value
+	return c.savePlugin(name)
+}
+
+// DeletePluginValue 删除插件键值存储中的值
+func (c *config) DeletePluginValue(name, key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-	return c.Save()
+	if data, exists := c.pluginConfigs[name]; exists {
+		if _, ok := data.Values[key]; ok {
+			delete(data.Values, key)
+			return c.savePlugin(name)
+		}
+	}
+	return nil
 }
 
 // IsEnabled 检查插件是否启用
@@ -104,7 +206,7 @@ func (c *config) SetEnabled(name string, status bool) error {
 	defer c.mu.Unlock()
 
 	c.enabled[name] = status
-	return c.Save()
+	return c.save(ConfigChange{Plugin: name, Enabled: &status})
 }
 
 // GetEnabledPlugins 获取所有启用的插件
@@ -143,14 +245,33 @@ func (c *config) GetPluginPermissions(name string) (*PluginPermission, bool) {
 	return nil, false
 }
 
-// SetPluginPermissions 设置插件权限
+// SetPluginPermissions 设置插件权限，permissions 为 nil 时删除
 func (c *config) SetPluginPermissions(name string, permissions *PluginPermission) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	if data, exists := c.pluginConfigs[name]; exists {
-		data.Permissions = permissions
-		return c.Save()
+	if permissions == nil {
+		if data, exists := c.pluginConfigs[name]; exists && data.Permissions != nil {
+			data.Permissions = nil
+			return c.savePlugin(name)
+		}
+		return nil
+	}
+
+	c.pluginData(name).Permissions = permissions
+	return c.savePlugin(name)
+}
+
+// PluginPermissions 获取所有已保存的插件权限
+func (c *config) PluginPermissions() map[string]*PluginPermission {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	permissions := make(map[string]*PluginPermission)
+	for name, data := range c.pluginConfigs {
+		if data.Permissions != nil {
+			permissions[name] = data.Permissions
+		}
 	}
-	return newError("plugin not found")
+	return permissions
 }
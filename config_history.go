@@ -0,0 +1,277 @@
+package plugmgr
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// defaultConfigHistoryLimit 每个插件默认保留的配置修订版本数量
+const defaultConfigHistoryLimit = 50
+
+// ConfigRevision 插件配置的一个修订版本
+type ConfigRevision struct {
+	Revision  int       `msgpack:"revision" json:"revision"`                   // 修订版本号，从 1 开始递增
+	Config    []byte    `msgpack:"config" json:"config"`                       // 该版本的配置数据
+	UpdatedAt time.Time `msgpack:"updated_at" json:"updated_at"`               // 修改时间
+	Actor     string    `msgpack:"actor,omitempty" json:"actor,omitempty"`     // 修改者
+	Comment   string    `msgpack:"comment,omitempty" json:"comment,omitempty"` // 修改说明
+}
+
+// 配置差异的操作类型
+const (
+	DiffAdd     = "add"     // 新增字段
+	DiffRemove  = "remove"  // 删除字段
+	DiffReplace = "replace" // 修改字段
+)
+
+// ConfigDiff 两个配置修订版本之间的一处差异
+type ConfigDiff struct {
+	Path string `json:"path"`          // 差异位置的 JSON Pointer，根为空字符串
+	Op   string `json:"op"`            // 差异类型: add、remove、replace
+	Old  any    `json:"old,omitempty"` // 旧值，add 时为空
+	New  any    `json:"new,omitempty"` // 新值，remove 时为空
+}
+
+// ConfigOption 配置修改选项
+type ConfigOption func(*configOptions)
+
+type configOptions struct {
+	actor   string
+	comment string
+}
+
+// WithActor 记录修改配置的调用方
+//
+//	通过 Session 修改配置时自动使用会话的调用方名称。
+func WithActor(actor string) ConfigOption {
+	return func(o *configOptions) {
+		o.actor = actor
+	}
+}
+
+// WithComment 记录配置修改说明
+func WithComment(comment string) ConfigOption {
+	return func(o *configOptions) {
+		o.comment = comment
+	}
+}
+
+func newConfigOptions(opts []ConfigOption) configOptions {
+	var options configOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return options
+}
+
+// recordRevision 为配置记录新的修订版本，调用方需持有写锁
+//
+//	配置与最新修订版本相同且没有修改说明时不记录，超过保留数量时丢弃最早的版本。
+func (c *config) recordRevision(data *PluginData, options configOptions) {
+	if n := len(data.History); n > 0 && options.comment == "" &&
+		string(data.History[n-1].Config) == string(data.Config) {
+		return
+	}
+
+	data.Revision++
+	data.History = append(data.History, ConfigRevision{
+		Revision:  data.Revision,
+		Config:    data.Config,
+		UpdatedAt: data.UpdatedAt,
+		Actor:     options.actor,
+		Comment:   options.comment,
+	})
+
+	limit := c.historyLimit
+	if limit <= 0 {
+		limit = defaultConfigHistoryLimit
+	}
+	if len(data.History) > limit {
+		data.History = slices.Clone(data.History[len(data.History)-limit:])
+	}
+}
+
+// SetHistoryLimit 设置每个插件保留的配置修订版本数量，小于等于 0 时使用默认值
+func (c *config) SetHistoryLimit(limit int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.historyLimit = limit
+}
+
+// PluginHistory 获取插件配置的所有修订版本，按版本号升序排列
+func (c *config) PluginHistory(name string) ([]ConfigRevision, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	data, exists := c.pluginConfigs[name]
+	if !exists {
+		return nil, false
+	}
+	return slices.Clone(data.History), true
+}
+
+// PluginRevision 获取插件配置的指定修订版本
+func (c *config) PluginRevision(name string, revision int) (ConfigRevision, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if data, exists := c.pluginConfigs[name]; exists {
+		for _, r := range data.History {
+			if r.Revision == revision {
+				return r, true
+			}
+		}
+	}
+	return ConfigRevision{}, false
+}
+
+// SetConfigHistoryLimit 设置每个插件保留的配置修订版本数量
+//
+//	limit 小于等于 0 时使用默认值 50，超出数量的最早版本在下次修改时丢弃。
+func (m *Manager) SetConfigHistoryLimit(limit int) {
+	m.config.SetHistoryLimit(limit)
+}
+
+// ConfigHistory 获取插件配置的修订历史
+//
+//	返回:
+//	- []ConfigRevision: 按版本号升序排列的修订版本，密钥字段已脱敏
+//	- error: 插件没有配置记录时返回 ErrPluginNotFound
+func (m *Manager) ConfigHistory(name string) ([]ConfigRevision, error) {
+	history, ok := m.config.PluginHistory(name)
+	if !ok {
+		return nil, ErrPluginNotFound
+	}
+	redact := m.redactor(m.secretRules(name))
+	for i := range history {
+		history[i].Config, _ = rewriteConfig(history[i].Config, redact)
+	}
+	return history, nil
+}
+
+// DiffConfig 比较插件配置的两个修订版本
+//
+//	参数:
+//	- name: 插件名称
+//	- from: 旧修订版本号
+//	- to: 新修订版本号
+//	功能:
+//	- 将两个版本的 msgpack 配置解码为 JSON 数据模型后逐字段比较
+//	- 对象按键比较，数组按下标比较，其他值不相等时记为 replace
+//	- 密钥字段解密后比较，差异中的值替换为 RedactedValue
+//	返回:
+//	- []ConfigDiff: 按字段名和下标顺序排列的差异，版本相同时为空
+func (m *Manager) DiffConfig(name string, from, to int) ([]ConfigDiff, error) {
+	docs := make([]any, 2)
+	rules := m.secretRules(name)
+	rules.sealed = make(map[string]bool)
+	for i, revision := range []int{from, to} {
+		r, ok := m.config.PluginRevision(name, revision)
+		if !ok {
+			return nil, wrapf(ErrRevisionNotFound, "插件 %s 的修订版本 %d", name, revision)
+		}
+		for path := range sealedPaths(r.Config) {
+			rules.sealed[path] = true
+		}
+		config, err := m.openConfig(name, r.Config)
+		if err != nil {
+			return nil, wrapf(err, "解密插件 %s 的修订版本 %d 失败", name, revision)
+		}
+		doc, err := configDocument(config)
+		if err != nil {
+			return nil, wrapf(err, "解码插件 %s 的修订版本 %d 失败", name, revision)
+		}
+		docs[i] = doc
+	}
+
+	var diffs []ConfigDiff
+	diffConfigValues("", docs[0], docs[1], &diffs)
+	for i := range diffs {
+		diffs[i].Old = m.redactValue(rules, diffs[i].Path, diffs[i].Old)
+		diffs[i].New = m.redactValue(rules, diffs[i].Path, diffs[i].New)
+	}
+	return diffs, nil
+}
+
+// RollbackConfig 将插件配置回滚到指定修订版本
+//
+//	参数:
+//	- name: 插件名称
+//	- revision: 目标修订版本号
+//	- opts: 修改选项，未设置说明时记录为 "回滚到修订版本 N"
+//	功能:
+//	- 目标版本的配置同样经过 Schema 校验和插件的 ConfigUpdated 处理
+//	- 回滚结果记录为新的修订版本，不删除目标版本之后的历史
+func (m *Manager) RollbackConfig(name string, revision int, opts ...ConfigOption) ([]byte, error) {
+	r, ok := m.config.PluginRevision(name, revision)
+	if !ok {
+		return nil, wrapf(ErrRevisionNotFound, "插件 %s 的修订版本 %d", name, revision)
+	}
+
+	config, err := m.openConfig(name, r.Config)
+	if err != nil {
+		return nil, wrapf(err, "解密插件 %s 的修订版本 %d 失败", name, revision)
+	}
+
+	options := newConfigOptions(opts)
+	if options.comment == "" {
+		options.comment = fmt.Sprintf("回滚到修订版本 %d", revision)
+	}
+	return m.updateConfig(name, config, true, options)
+}
+
+// diffConfigValues 递归比较两个 JSON 数据模型的值
+func diffConfigValues(path string, oldValue, newValue any, diffs *[]ConfigDiff) {
+	switch o := oldValue.(type) {
+	case map[string]any:
+		if n, ok := newValue.(map[string]any); ok {
+			keys := make([]string, 0, len(o)+len(n))
+			for k := range o {
+				keys = append(keys, k)
+			}
+			for k := range n {
+				if _, exists := o[k]; !exists {
+					keys = append(keys, k)
+				}
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				child := path + "/" + escapePointer(k)
+				ov, inOld := o[k]
+				nv, inNew := n[k]
+				switch {
+				case !inOld:
+					*diffs = append(*diffs, ConfigDiff{Path: child, Op: DiffAdd, New: nv})
+				case !inNew:
+					*diffs = append(*diffs, ConfigDiff{Path: child, Op: DiffRemove, Old: ov})
+				default:
+					diffConfigValues(child, ov, nv, diffs)
+				}
+			}
+			return
+		}
+	case []any:
+		if n, ok := newValue.([]any); ok {
+			for i := 0; i < max(len(o), len(n)); i++ {
+				child := path + "/" + strconv.Itoa(i)
+				switch {
+				case i >= len(o):
+					*diffs = append(*diffs, ConfigDiff{Path: child, Op: DiffAdd, New: n[i]})
+				case i >= len(n):
+					*diffs = append(*diffs, ConfigDiff{Path: child, Op: DiffRemove, Old: o[i]})
+				default:
+					diffConfigValues(child, o[i], n[i], diffs)
+				}
+			}
+			return
+		}
+	}
+
+	if !reflect.DeepEqual(oldValue, newValue) {
+		*diffs = append(*diffs, ConfigDiff{Path: path, Op: DiffReplace, Old: oldValue, New: newValue})
+	}
+}
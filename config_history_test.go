@@ -0,0 +1,129 @@
+package plugmgr
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestConfigHistoryAndRollback(t *testing.T) {
+	m := newTestManager(t)
+	p := &schemaPlugin{}
+	loadHostPlugin(t, m, "server", p)
+
+	v1, err := m.ConfigUpdated("server", map[string]any{"host": "a", "port": 80, "tags": []any{"x"}}, WithComment("初始配置"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	admin := m.As(Principal{Name: "alice", Roles: []string{RoleAdmin}})
+	if _, err := admin.ConfigUpdated("server", map[string]any{"host": "b", "port": 80, "mode": "fast"}); err != nil {
+		t.Fatal(err)
+	}
+
+	history, err := m.ConfigHistory("server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 || history[0].Revision != 1 || history[0].Comment != "初始配置" ||
+		history[1].Revision != 2 || history[1].Actor != "alice" {
+		t.Fatalf("修订历史不正确: %+v", history)
+	}
+
+	diffs, err := m.DiffConfig("server", 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ConfigDiff{
+		{Path: "/host", Op: DiffReplace, Old: "a", New: "b"},
+		{Path: "/mode", Op: DiffAdd, New: "fast"},
+		{Path: "/tags", Op: DiffRemove, Old: []any{"x"}},
+	}
+	if !reflect.DeepEqual(diffs, want) {
+		t.Fatalf("期望差异 %+v, 得到 %+v", want, diffs)
+	}
+
+	updates := p.updates
+	rolled, err := m.RollbackConfig("server", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.updates != updates+1 || string(rolled) != string(v1) {
+		t.Fatal("回滚应通过插件的 ConfigUpdated 应用目标版本")
+	}
+	history, _ = m.ConfigHistory("server")
+	last := history[len(history)-1]
+	if last.Revision != 3 || string(last.Config) != string(v1) || last.Comment != "回滚到修订版本 1" {
+		t.Fatalf("回滚应记录为新的修订版本: %+v", last)
+	}
+	if diffs, _ := m.DiffConfig("server", 1, 3); len(diffs) != 0 {
+		t.Fatalf("回滚后的配置应与目标版本一致: %+v", diffs)
+	}
+
+	if _, err := m.RollbackConfig("server", 42); !errors.Is(err, ErrRevisionNotFound) {
+		t.Fatalf("期望 ErrRevisionNotFound, 得到 %v", err)
+	}
+
+	// 修订历史随配置持久化
+	reloaded, err := loadConfig(m.config.store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if history, _ := reloaded.PluginHistory("server"); len(history) != 3 {
+		t.Fatalf("修订历史未持久化: %+v", history)
+	}
+}
+
+func TestConfigHistoryLimit(t *testing.T) {
+	c := newConfig(NewMemoryConfigStore())
+	c.SetHistoryLimit(2)
+
+	for _, v := range []string{"1", "2", "2", "3"} {
+		if err := c.SetPluginConfig("demo", []byte(v)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	history, _ := c.PluginHistory("demo")
+	if len(history) != 2 || history[0].Revision != 2 || history[1].Revision != 3 {
+		t.Fatalf("应只保留最近的修订版本且跳过未变化的配置: %+v", history)
+	}
+	if _, ok := c.PluginRevision("demo", 1); ok {
+		t.Fatal("超出保留数量的修订版本应被丢弃")
+	}
+}
+
+func TestGetPluginConfigConcurrentUpdates(t *testing.T) {
+	m := newTestManager(t)
+	loadHostPlugin(t, m, "demo", &fakePlugin{})
+	if err := m.config.SetPluginValue("demo", "k", []byte("v")); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			if err := m.config.SetPluginConfig("demo", []byte(strconv.Itoa(i))); err != nil {
+				t.Error(err)
+				return
+			}
+			_ = m.config.SetPluginValue("demo", strconv.Itoa(i), []byte("v"))
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		data, err := m.GetPluginConfig("demo")
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = len(data.History)
+		data.Values["k"] = []byte("changed")
+	}
+	wg.Wait()
+
+	if value, ok := m.config.GetPluginValue("demo", "k"); !ok || string(value) != "v" {
+		t.Fatalf("修改返回的配置不应影响内存中的配置, 得到 %q", value)
+	}
+}
@@ -0,0 +1,465 @@
+package plugmgr
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// 配置层，按优先级从低到高排列
+const (
+	ConfigLayerStored   = "stored"   // 持久化存储中的 PluginData.Config
+	ConfigLayerFile     = "file"     // 配置目录中的 <plugin>.json 或 <plugin>.toml
+	ConfigLayerEnv      = "env"      // 环境变量 PLUGMGR_<PLUGIN>__<KEY> 或 PLUGMGR_<PLUGIN>_<KEY>
+	ConfigLayerOverride = "override" // SetConfigOverride 设置的运行时覆盖
+)
+
+// configEnvPrefix 插件配置环境变量的前缀
+const configEnvPrefix = "PLUGMGR_"
+
+// internalEnvs 管理器和命令行工具自身使用的环境变量，不作为插件配置
+var internalEnvs = map[string]bool{
+	RPCCodecEnv:            true,
+	"PLUGMGR_SANDBOX_SPEC": true,
+	"PLUGMGR_REPO_TOKEN":   true,
+}
+
+// ConfigSource 配置值的来源
+type ConfigSource struct {
+	Layer  string `json:"layer"`            // 配置层
+	Origin string `json:"origin,omitempty"` // 文件路径或环境变量名
+}
+
+// ResolvedConfig 合并所有配置层后的插件配置
+type ResolvedConfig struct {
+	Config  []byte                  `json:"-"`       // 序列化后的合并结果，即 PreLoad 收到的配置
+	Values  any                     `json:"values"`  // 合并结果的 JSON 数据模型
+	Sources map[string]ConfigSource `json:"sources"` // 每个叶子字段的来源，键为 JSON Pointer
+}
+
+// configOverrides 插件的运行时配置覆盖
+type configOverrides struct {
+	mu     sync.Mutex
+	values map[string]any // JSON Pointer -> 值
+}
+
+// WithConfigDir 设置配置覆盖文件所在目录
+//
+//	目录中的 <plugin>.json 和 <plugin>.toml 覆盖持久化存储中的插件配置，两者同时存在时 TOML 优先。
+func WithConfigDir(dir string) ManagerOption {
+	return func(o *managerOptions) {
+		o.configDir = dir
+	}
+}
+
+// SetConfigOverride 设置插件配置的运行时覆盖
+//
+//	参数:
+//	- name: 插件名称
+//	- path: 字段的 JSON Pointer，例如 "/db/host"
+//	- value: 覆盖值，需能编码为 JSON
+//	功能:
+//	- 运行时覆盖优先级最高，只保存在内存中，在下次加载或热重载插件时生效
+func (m *Manager) SetConfigOverride(name, path string, value any) error {
+	if path == "" || !strings.HasPrefix(path, "/") {
+		return newErrorf("无效的配置路径 %q", path)
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return wrap(err, "序列化覆盖值失败")
+	}
+	doc, err := decodeJSON(data)
+	if err != nil {
+		return wrap(err, "序列化覆盖值失败")
+	}
+
+	v, _ := m.overrides.LoadOrStore(name, &configOverrides{values: make(map[string]any)})
+	overrides := v.(*configOverrides)
+	overrides.mu.Lock()
+	defer overrides.mu.Unlock()
+	overrides.values[path] = doc
+	return nil
+}
+
+// RemoveConfigOverride 移除插件配置的运行时覆盖，path 为空时移除插件的所有覆盖
+func (m *Manager) RemoveConfigOverride(name, path string) {
+	if path == "" {
+		m.overrides.Delete(name)
+		return
+	}
+	if v, ok := m.overrides.Load(name); ok {
+		overrides := v.(*configOverrides)
+		overrides.mu.Lock()
+		defer overrides.mu.Unlock()
+		delete(overrides.values, path)
+	}
+}
+
+// ResolveConfig 合并插件的所有配置层
+//
+//	参数:
+//	- name: 插件名称
+//	功能:
+//	- 以持久化存储中的配置为基础，依次叠加配置文件、环境变量和运行时覆盖
+//	- 对象按字段递归合并，其他值整体替换
+//	- 环境变量 PLUGMGR_<PLUGIN>__<KEY> 中插件名转为大写，连续的非字母数字字符替换为一个 _，
+//	  插件名与 KEY 之间以及 KEY 中的双下划线表示嵌套字段，键名按已有字段忽略大小写匹配，否则使用小写；
+//	  值是有效的 JSON 时按 JSON 解析，否则作为字符串
+//	- 插件名与 KEY 之间也可以使用单个下划线 PLUGMGR_<PLUGIN>_<KEY>，变量同时匹配名称更长的已加载插件时
+//	  属于该插件；两种形式设置同一字段时双下划线形式优先
+//	- 合并结果中的密钥字段替换为 RedactedValue
+//	返回:
+//	- *ResolvedConfig: 合并结果和每个字段的来源
+func (m *Manager) ResolveConfig(name string) (*ResolvedConfig, error) {
+	rules := m.secretRules(name)
+	var stored []byte
+	if data, ok := m.config.GetPluginConfig(name); ok {
+		stored = data.Config
+		rules.sealed = sealedPaths(stored)
+	}
+
+	config, err := m.openConfig(name, stored)
+	if err != nil {
+		return nil, wrap(err, "解密插件配置失败")
+	}
+	resolved, err := m.resolveConfig(name, config)
+	if err != nil {
+		return nil, err
+	}
+
+	resolved.Values = m.redactValue(rules, "", resolved.Values)
+	resolved.Config, _ = rewriteConfig(resolved.Config, m.redactor(rules))
+	return resolved, nil
+}
+
+// resolveConfig 在基础配置上叠加配置文件、环境变量和运行时覆盖
+//
+//	没有其他配置层时原样返回基础配置。
+func (m *Manager) resolveConfig(name string, stored []byte) (*ResolvedConfig, error) {
+	layers, err := m.configLayers(name)
+	if err != nil {
+		return nil, err
+	}
+
+	resolved := &ResolvedConfig{Config: stored, Sources: make(map[string]ConfigSource)}
+	var base any
+	if stored != nil {
+		if base, err = configDocument(stored); err != nil {
+			return nil, wrapf(err, "解析插件 %s 的配置失败", name)
+		}
+	}
+	if len(layers) == 0 {
+		resolved.Values = base
+		if stored != nil {
+			collectSources(resolved.Sources, "", base, ConfigSource{Layer: ConfigLayerStored})
+		}
+		return resolved, nil
+	}
+
+	values, ok := base.(map[string]any)
+	if base != nil && !ok {
+		return nil, newErrorf("插件 %s 的配置不是对象，无法叠加配置层", name)
+	}
+	merged := make(map[string]any)
+	mergeConfigLayer(merged, "", values, ConfigSource{Layer: ConfigLayerStored}, resolved.Sources)
+	for _, layer := range layers {
+		values := layer.values
+		if layer.keys != nil {
+			values = nestedValue(merged, layer.keys, layer.value, layer.foldCase)
+		}
+		mergeConfigLayer(merged, "", values, layer.source, resolved.Sources)
+	}
+	resolved.Values = merged
+
+	if resolved.Config, err = encodeConfigDocument(merged, stored != nil && isTextConfig(stored)); err != nil {
+		return nil, wrapf(err, "序列化插件 %s 的配置失败", name)
+	}
+	return resolved, nil
+}
+
+// configLayer 叠加在持久化配置上的一个配置层
+type configLayer struct {
+	source ConfigSource
+	values map[string]any // 配置文件的内容
+
+	// 环境变量和运行时覆盖按路径设置单个值
+	keys     []string
+	value    any
+	foldCase bool // 键名按已有字段忽略大小写匹配
+}
+
+// configLayers 按优先级返回插件的配置文件、环境变量和运行时覆盖
+func (m *Manager) configLayers(name string) ([]configLayer, error) {
+	var layers []configLayer
+
+	if m.configDir != "" {
+		for _, ext := range []string{".json", ".toml"} {
+			path := filepath.Join(m.configDir, name+ext)
+			data, err := os.ReadFile(path)
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				return nil, wrapf(err, "读取配置文件 %s 失败", path)
+			}
+
+			var values map[string]any
+			if ext == ".json" {
+				err = json.Unmarshal(data, &values)
+			} else {
+				values, err = decodeTOML(data)
+			}
+			if err != nil {
+				return nil, wrapf(err, "解析配置文件 %s 失败", path)
+			}
+			layers = append(layers, configLayer{
+				source: ConfigSource{Layer: ConfigLayerFile, Origin: path},
+				values: values,
+			})
+		}
+	}
+
+	// 排序后 PLUGMGR_DB_HOST 在 PLUGMGR_DB__HOST 之前，双下划线形式后合并而优先
+	var others []string
+	for _, plugin := range m.ListPlugins() {
+		others = append(others, envName(plugin))
+	}
+	var envs []string
+	for _, env := range os.Environ() {
+		if key, _, ok := strings.Cut(env, "="); ok && !internalEnvs[key] {
+			envs = append(envs, env)
+		}
+	}
+	sort.Strings(envs)
+	for _, env := range envs {
+		key, value, _ := strings.Cut(env, "=")
+		keys, ok := envKeys(key, envName(name), others)
+		if !ok {
+			continue
+		}
+		var parsed any = value
+		if doc, err := decodeJSON([]byte(value)); err == nil {
+			parsed = doc
+		}
+		layers = append(layers, configLayer{
+			source:   ConfigSource{Layer: ConfigLayerEnv, Origin: key},
+			keys:     keys,
+			value:    parsed,
+			foldCase: true,
+		})
+	}
+
+	if v, ok := m.overrides.Load(name); ok {
+		overrides := v.(*configOverrides)
+		overrides.mu.Lock()
+		paths := make([]string, 0, len(overrides.values))
+		for path := range overrides.values {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+		for _, path := range paths {
+			var keys []string
+			for _, key := range strings.Split(path[1:], "/") {
+				keys = append(keys, unescapePointer(key))
+			}
+			layers = append(layers, configLayer{
+				source: ConfigSource{Layer: ConfigLayerOverride, Origin: path},
+				keys:   keys,
+				value:  overrides.values[path],
+			})
+		}
+		overrides.mu.Unlock()
+	}
+
+	return layers, nil
+}
+
+// envKeys 返回环境变量对应的配置键路径，变量不属于插件时返回 false
+//
+//	plugin 和 others 为 envName 转换后的插件名，others 为其他已加载的插件。
+//	插件名中不会出现双下划线，PLUGMGR_<PLUGIN>__<KEY> 总是属于该插件；
+//	PLUGMGR_<PLUGIN>_<KEY> 同时匹配名称更长的插件时属于名称更长的插件，
+//	例如插件 db_admin 已加载时 PLUGMGR_DB_ADMIN_HOST 不属于插件 db。
+func envKeys(key, plugin string, others []string) ([]string, bool) {
+	prefix := configEnvPrefix + plugin + "_"
+	if plugin == "" || !strings.HasPrefix(key, prefix) {
+		return nil, false
+	}
+	rest := key[len(prefix):]
+	if strings.HasPrefix(rest, "_") {
+		rest = rest[1:]
+	} else {
+		for _, other := range others {
+			if len(other) > len(plugin) && strings.HasPrefix(key, configEnvPrefix+other+"_") {
+				return nil, false
+			}
+		}
+	}
+	if rest == "" || strings.HasPrefix(rest, "_") {
+		return nil, false
+	}
+	return strings.Split(rest, "__"), true
+}
+
+// envName 将插件名称转换为环境变量名的一部分
+//
+//	字母转为大写，连续的其他字符替换为一个 _ 并去掉首尾的 _，结果中不包含双下划线。
+func envName(name string) string {
+	var b strings.Builder
+	separator := false
+	for _, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z':
+			r = r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		default:
+			separator = true
+			continue
+		}
+		if separator && b.Len() > 0 {
+			b.WriteByte('_')
+		}
+		separator = false
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// nestedValue 将按路径设置的单个值转换为嵌套对象
+//
+//	foldCase 为 true 时键名按 merged 中已有字段忽略大小写匹配。
+func nestedValue(merged map[string]any, keys []string, value any, foldCase bool) map[string]any {
+	root := make(map[string]any)
+	current, existing := root, merged
+	for i, key := range keys {
+		if foldCase {
+			key = matchKey(existing, key)
+		}
+		if i == len(keys)-1 {
+			current[key] = value
+			break
+		}
+		next := make(map[string]any)
+		current[key] = next
+		current = next
+		existing, _ = existing[key].(map[string]any)
+	}
+	return root
+}
+
+// matchKey 返回与 key 忽略大小写相同的已有字段名，不存在时返回小写的 key
+func matchKey(existing map[string]any, key string) string {
+	if _, ok := existing[key]; ok {
+		return key
+	}
+	names := make([]string, 0, len(existing))
+	for name := range existing {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if strings.EqualFold(name, key) {
+			return name
+		}
+	}
+	return strings.ToLower(key)
+}
+
+// mergeConfigLayer 将配置层合并到 dst 并记录叶子字段的来源
+func mergeConfigLayer(dst map[string]any, path string, src map[string]any, source ConfigSource, sources map[string]ConfigSource) {
+	for key, value := range src {
+		child := path + "/" + escapePointer(key)
+		if values, ok := value.(map[string]any); ok {
+			target, ok := dst[key].(map[string]any)
+			if !ok {
+				deleteSources(sources, child)
+				target = make(map[string]any)
+				dst[key] = target
+			}
+			if len(values) == 0 && !ok {
+				sources[child] = source
+			}
+			mergeConfigLayer(target, child, values, source, sources)
+			continue
+		}
+
+		deleteSources(sources, child)
+		dst[key] = value
+		sources[child] = source
+	}
+}
+
+// deleteSources 删除路径及其子字段的来源
+func deleteSources(sources map[string]ConfigSource, path string) {
+	for p := range sources {
+		if p == path || strings.HasPrefix(p, path+"/") {
+			delete(sources, p)
+		}
+	}
+}
+
+// collectSources 将 value 的所有叶子字段记录为同一个来源
+func collectSources(sources map[string]ConfigSource, path string, value any, source ConfigSource) {
+	if values, ok := value.(map[string]any); ok && len(values) > 0 {
+		for key, v := range values {
+			collectSources(sources, path+"/"+escapePointer(key), v, source)
+		}
+		return
+	}
+	sources[path] = source
+}
+
+// isTextConfig 检查序列化的配置是否为 JSON 文本，例如通过 HTTP 提交的请求体
+func isTextConfig(config []byte) bool {
+	var value any
+	if err := msgpack.Unmarshal(config, &value); err != nil {
+		return false
+	}
+	switch value.(type) {
+	case []byte, string:
+		return true
+	}
+	return false
+}
+
+// encodeConfigDocument 序列化 JSON 数据模型，text 为 true 时序列化为 JSON 文本
+func encodeConfigDocument(doc any, text bool) ([]byte, error) {
+	if text {
+		data, err := json.Marshal(doc)
+		if err != nil {
+			return nil, err
+		}
+		return Serializer(data)
+	}
+	return Serializer(msgpackValue(doc))
+}
+
+// msgpackValue 将 JSON 数据模型中的整数值还原为整数，使插件能解码到整数字段
+func msgpackValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for key, item := range v {
+			out[key] = msgpackValue(item)
+		}
+		return out
+	case []any:
+		out := make([]any, len(v))
+		for i, item := range v {
+			out[i] = msgpackValue(item)
+		}
+		return out
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+			return int64(v)
+		}
+	}
+	return value
+}
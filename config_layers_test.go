@@ -0,0 +1,215 @@
+package plugmgr
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestResolveConfigLayers(t *testing.T) {
+	dir := t.TempDir()
+	m, err := NewManagerWithOptions(t.TempDir(), "config.db", WithConfigDir(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored, _ := Serializer(map[string]any{
+		"host": "stored",
+		"port": 80,
+		"db":   map[string]any{"user": "app", "Password": "secret"},
+	})
+	if err := m.config.SetPluginConfig("my-app", stored); err != nil {
+		t.Fatal(err)
+	}
+
+	writeFile(t, filepath.Join(dir, "my-app.json"), `{"host": "file", "db": {"user": "json"}}`)
+	writeFile(t, filepath.Join(dir, "my-app.toml"), "[db]\nuser = \"toml\"\npool = 4\n")
+	t.Setenv("PLUGMGR_MY_APP__PORT", "8080")
+	t.Setenv("PLUGMGR_MY_APP__DB__PASSWORD", "from-env")
+	// 单下划线形式同样生效，与双下划线形式设置同一字段时双下划线形式优先
+	t.Setenv("PLUGMGR_MY_APP_TIMEOUT", "30")
+	t.Setenv("PLUGMGR_MY_APP_PORT", "9090")
+	// 已加载的插件 my-app-db 的变量不属于 my-app
+	addTestPlugin(m, "my-app-db", &fakePlugin{})
+	t.Setenv("PLUGMGR_MY_APP_DB__HOST", "other")
+	t.Setenv("PLUGMGR_MY_APP_DB_USER", "other")
+	if err := m.SetConfigOverride("my-app", "/debug", true); err != nil {
+		t.Fatal(err)
+	}
+
+	resolved, err := m.ResolveConfig("my-app")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]any{
+		"host":    "file",
+		"port":    8080.0,
+		"timeout": 30.0,
+		"debug":   true,
+		"db":      map[string]any{"user": "toml", "Password": RedactedValue, "pool": int64(4)},
+	}
+	if !reflect.DeepEqual(resolved.Values, want) {
+		t.Fatalf("期望合并结果 %v, 得到 %v", want, resolved.Values)
+	}
+
+	wantSources := map[string]ConfigSource{
+		"/host":        {Layer: ConfigLayerFile, Origin: filepath.Join(dir, "my-app.json")},
+		"/port":        {Layer: ConfigLayerEnv, Origin: "PLUGMGR_MY_APP__PORT"},
+		"/timeout":     {Layer: ConfigLayerEnv, Origin: "PLUGMGR_MY_APP_TIMEOUT"},
+		"/debug":       {Layer: ConfigLayerOverride, Origin: "/debug"},
+		"/db/user":     {Layer: ConfigLayerFile, Origin: filepath.Join(dir, "my-app.toml")},
+		"/db/pool":     {Layer: ConfigLayerFile, Origin: filepath.Join(dir, "my-app.toml")},
+		"/db/Password": {Layer: ConfigLayerEnv, Origin: "PLUGMGR_MY_APP__DB__PASSWORD"},
+	}
+	if !reflect.DeepEqual(resolved.Sources, wantSources) {
+		t.Fatalf("期望字段来源 %v, 得到 %v", wantSources, resolved.Sources)
+	}
+
+	// PreLoad 收到合并后的配置，持久化的配置保持不变
+	p := &fakePlugin{}
+	loadHostPlugin(t, m, "my-app", p)
+	var config struct {
+		Port int `msgpack:"port"`
+		DB   struct {
+			Password string `msgpack:"Password"`
+		} `msgpack:"db"`
+	}
+	if err := Deserializer(p.config, &config); err != nil || config.Port != 8080 || config.DB.Password != "from-env" {
+		t.Fatalf("PreLoad 应收到合并后的配置: %+v, %v", config, err)
+	}
+	if data, _ := m.config.GetPluginConfig("my-app"); string(data.Config) != string(stored) {
+		t.Fatal("配置层不应写入持久化存储")
+	}
+}
+
+func TestResolveConfigWithoutLayers(t *testing.T) {
+	m := newTestManager(t)
+	stored, _ := Serializer([]byte(`{"a": 1}`))
+	if err := m.config.SetPluginConfig("plain", stored); err != nil {
+		t.Fatal(err)
+	}
+
+	resolved, err := m.ResolveConfig("plain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(resolved.Config) != string(stored) {
+		t.Fatal("没有其他配置层时应原样使用持久化配置")
+	}
+	if resolved.Sources["/a"].Layer != ConfigLayerStored {
+		t.Fatalf("字段来源不正确: %v", resolved.Sources)
+	}
+
+	// JSON 文本形式的配置叠加后仍为 JSON 文本
+	m.SetConfigOverride("plain", "/b", "x")
+	resolved, err = m.ResolveConfig("plain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var text []byte
+	if err := Deserializer(resolved.Config, &text); err != nil || string(text) != `{"a":1,"b":"x"}` {
+		t.Fatalf("期望 JSON 文本, 得到 %q, %v", text, err)
+	}
+}
+
+func TestDecodeTOML(t *testing.T) {
+	doc, err := decodeTOML([]byte(`
+# 注释
+title = "demo" # 行尾注释
+"quoted key" = 'C:\path'
+server.port = 8_080
+ratio = 0.5
+hex = 0xff
+date = 1979-05-27 07:32:00
+list = [
+  1, 2, # 换行
+  3,
+]
+inline = { a = true, b.c = "d" }
+text = """
+line1 \
+  line2"""
+
+[owner]
+name = "Tom \"T\" \u00e9"
+
+[[items]]
+id = 1
+
+[[items]]
+id = 2
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]any{
+		"title":      "demo",
+		"quoted key": `C:\path`,
+		"server":     map[string]any{"port": int64(8080)},
+		"ratio":      0.5,
+		"hex":        int64(255),
+		"date":       "1979-05-27 07:32:00",
+		"list":       []any{int64(1), int64(2), int64(3)},
+		"inline":     map[string]any{"a": true, "b": map[string]any{"c": "d"}},
+		"text":       "line1 line2",
+		"owner":      map[string]any{"name": `Tom "T" é`},
+		"items":      []any{map[string]any{"id": int64(1)}, map[string]any{"id": int64(2)}},
+	}
+	if !reflect.DeepEqual(doc, want) {
+		t.Fatalf("期望 %#v, 得到 %#v", want, doc)
+	}
+
+	for _, invalid := range []string{"a = ", "a = 1\na = 2", "a = \"x", "[a\nb = 1", "a = [1 2]"} {
+		if _, err := decodeTOML([]byte(invalid)); err == nil {
+			t.Errorf("%q 应解析失败", invalid)
+		}
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEnvName(t *testing.T) {
+	for name, want := range map[string]string{
+		"db":       "DB",
+		"db_admin": "DB_ADMIN",
+		"my--app":  "MY_APP",
+		"-x.y_":    "X_Y",
+	} {
+		if got := envName(name); got != want {
+			t.Errorf("%s 期望 %s, 得到 %s", name, want, got)
+		}
+	}
+}
+
+func TestEnvKeys(t *testing.T) {
+	others := []string{"DB", "DB_ADMIN"}
+	tests := []struct {
+		key    string
+		plugin string
+		want   []string
+	}{
+		{"PLUGMGR_DB__HOST", "DB", []string{"HOST"}},
+		{"PLUGMGR_DB_HOST", "DB", []string{"HOST"}},
+		{"PLUGMGR_DB_POOL__SIZE", "DB", []string{"POOL", "SIZE"}},
+		{"PLUGMGR_DB_ADMIN_HOST", "DB", nil}, // 属于名称更长的 db_admin
+		{"PLUGMGR_DB_ADMIN__HOST", "DB", nil},
+		{"PLUGMGR_DB_ADMIN_HOST", "DB_ADMIN", []string{"HOST"}},
+		{"PLUGMGR_DB___HOST", "DB", nil},
+		{"PLUGMGR_DB_", "DB", nil},
+		{"PLUGMGR_DBX_HOST", "DB", nil},
+	}
+	for _, tt := range tests {
+		got, ok := envKeys(tt.key, tt.plugin, others)
+		if ok != (tt.want != nil) || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s(%s): 期望 %v, 得到 %v %v", tt.key, tt.plugin, tt.want, got, ok)
+		}
+	}
+}
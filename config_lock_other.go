@@ -0,0 +1,25 @@
+//go:build !windows
+// +build !windows
+
+package plugmgr
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile 获取文件的排他锁，返回释放锁的函数
+func lockFile(path string) (func(), error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, wrapf(err, "打开锁文件失败: %s", path)
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		f.Close()
+		return nil, wrapf(err, "获取文件锁失败: %s", path)
+	}
+	return func() {
+		_ = syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
@@ -0,0 +1,6 @@
+package plugmgr
+
+// lockFile Windows 平台不支持文件锁，仅在进程内互斥
+func lockFile(string) (func(), error) {
+	return func() {}, nil
+}
@@ -0,0 +1,536 @@
+package plugmgr
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"sync"
+
+	msgpack "github.com/vmihailenco/msgpack/v5"
+)
+
+// ConfigStore 配置的持久化存储
+//
+//	Save 在持有配置写锁时调用，实现必须在返回前完成对快照的序列化，不能保留快照的引用。
+//	Load 检测到数据损坏并回退到最后一个完好的快照时，同时返回快照和 ErrConfigRecovered。
+type ConfigStore interface {
+	// Load 读取配置快照，存储为空时返回空快照
+	Load() (*ConfigSnapshot, error)
+
+	// Save 保存配置修改
+	// 参数 snapshot: 修改后的完整配置
+	// 参数 change: 本次修改的内容，Plugin 和 Role 均为空表示保存完整快照
+	Save(snapshot *ConfigSnapshot, change ConfigChange) error
+
+	// Close 释放存储占用的资源
+	Close() error
+}
+
+// ConfigSnapshot 配置的完整状态
+type ConfigSnapshot struct {
+	Enabled map[string]bool        `msgpack:"enabled"`         // 插件启用状态
+	Configs map[string]*PluginData `msgpack:"configs"`         // 插件配置数据
+	Roles   map[string][]string    `msgpack:"roles,omitempty"` // 角色策略，值为 nil 表示删除内置角色的策略
+}
+
+func newConfigSnapshot() *ConfigSnapshot {
+	return &ConfigSnapshot{
+		Enabled: make(map[string]bool),
+		Configs: make(map[string]*PluginData),
+		Roles:   make(map[string][]string),
+	}
+}
+
+// apply 将修改应用到快照
+func (s *ConfigSnapshot) apply(change ConfigChange) {
+	if change.Enabled != nil {
+		s.Enabled[change.Plugin] = *change.Enabled
+	}
+	if change.Data != nil {
+		s.Configs[change.Plugin] = change.Data
+	}
+	if change.Role != "" {
+		s.Roles[change.Role] = change.Actions
+	}
+}
+
+// ConfigChange 单个插件或角色的一次配置修改
+type ConfigChange struct {
+	Plugin  string      `msgpack:"plugin"`            // 插件名称
+	Enabled *bool       `msgpack:"enabled,omitempty"` // 新的启用状态
+	Data    *PluginData `msgpack:"data,omitempty"`    // 插件的完整配置数据
+	Role    string      `msgpack:"role,omitempty"`    // 角色名称，不为空时将角色策略设置为 Actions
+	Actions []string    `msgpack:"actions,omitempty"` // 角色可以执行的操作，nil 表示删除
+}
+
+// full 是否保存完整快照
+func (c ConfigChange) full() bool {
+	return c.Plugin == "" && c.Role == ""
+}
+
+// snapshotMagic 快照文件头，后跟 4 字节 CRC32 和 msgpack 数据
+var snapshotMagic = []byte("PLUGMGR1")
+
+func encodeSnapshot(snapshot *ConfigSnapshot) ([]byte, error) {
+	payload, err := msgpack.Marshal(snapshot)
+	if err != nil {
+		return nil, wrap(err, "序列化配置失败")
+	}
+
+	data := make([]byte, len(snapshotMagic)+4+len(payload))
+	copy(data, snapshotMagic)
+	binary.BigEndian.PutUint32(data[len(snapshotMagic):], crc32.ChecksumIEEE(payload))
+	copy(data[len(snapshotMagic)+4:], payload)
+	return data, nil
+}
+
+// decodeSnapshot 解析快照，兼容没有文件头的旧版本配置文件
+func decodeSnapshot(data []byte) (*ConfigSnapshot, error) {
+	payload := data
+	if bytes.HasPrefix(data, snapshotMagic) {
+		if len(data) < len(snapshotMagic)+4 {
+			return nil, wrap(ErrConfigCorrupted, "快照数据不完整")
+		}
+		sum := binary.BigEndian.Uint32(data[len(snapshotMagic):])
+		payload = data[len(snapshotMagic)+4:]
+		if crc32.ChecksumIEEE(payload) != sum {
+			return nil, wrap(ErrConfigCorrupted, "快照校验和不匹配")
+		}
+	}
+
+	snapshot := newConfigSnapshot()
+	if err := msgpack.Unmarshal(payload, snapshot); err != nil {
+		return nil, wrapf(ErrConfigCorrupted, "解析配置失败: %v", err)
+	}
+	if snapshot.Enabled == nil {
+		snapshot.Enabled = make(map[string]bool)
+	}
+	if snapshot.Configs == nil {
+		snapshot.Configs = make(map[string]*PluginData)
+	}
+	if snapshot.Roles == nil {
+		snapshot.Roles = make(map[string][]string)
+	}
+	return snapshot, nil
+}
+
+// readSnapshotFile 读取快照文件，主文件缺失或损坏时回退到备份文件
+func readSnapshotFile(path string) (*ConfigSnapshot, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		snapshot, decodeErr := decodeSnapshot(data)
+		if decodeErr == nil {
+			return snapshot, nil
+		}
+		err = decodeErr
+	} else if !os.IsNotExist(err) {
+		return nil, wrapf(err, "读取配置文件失败: %s", path)
+	}
+
+	backup := path + ".bak"
+	data, backupErr := os.ReadFile(backup)
+	if backupErr != nil {
+		if os.IsNotExist(err) && os.IsNotExist(backupErr) {
+			return newConfigSnapshot(), nil
+		}
+		if os.IsNotExist(backupErr) {
+			return nil, wrapf(err, "配置文件 %s 已损坏且没有备份", path)
+		}
+		return nil, wrapf(backupErr, "读取配置备份失败: %s", backup)
+	}
+
+	snapshot, backupErr := decodeSnapshot(data)
+	if backupErr != nil {
+		return nil, wrapf(backupErr, "配置文件 %s 及其备份均已损坏", path)
+	}
+	if os.IsNotExist(err) {
+		return snapshot, wrapf(ErrConfigRecovered, "配置文件 %s 缺失，已回退到 %s", path, backup)
+	}
+	return snapshot, wrapf(ErrConfigRecovered, "配置文件 %s 已损坏(%v)，已回退到 %s", path, err, backup)
+}
+
+// writeSnapshotFile 原子地写入快照
+//
+//	数据先写入同目录的临时文件并 fsync，原文件保留为 .bak 后再重命名替换。
+//	配置中可能包含插件的密钥，文件仅允许所有者读写。
+func writeSnapshotFile(path string, snapshot *ConfigSnapshot) error {
+	data, err := encodeSnapshot(snapshot)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return wrap(err, "创建临时配置文件失败")
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return wrap(err, "写入临时配置文件失败")
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return wrap(err, "同步临时配置文件失败")
+	}
+	if err := tmp.Close(); err != nil {
+		return wrap(err, "关闭临时配置文件失败")
+	}
+	if err := os.Chmod(tmp.Name(), 0o600); err != nil {
+		return wrap(err, "设置配置文件权限失败")
+	}
+
+	if err := os.Rename(path, path+".bak"); err != nil && !os.IsNotExist(err) {
+		return wrap(err, "备份配置文件失败")
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return wrap(err, "替换配置文件失败")
+	}
+	return syncDir(dir)
+}
+
+// syncDir 同步目录项，保证重命名持久化
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return wrap(err, "打开配置目录失败")
+	}
+	defer d.Close()
+	// 部分文件系统不支持同步目录，忽略该错误
+	_ = d.Sync()
+	return nil
+}
+
+// WatchableConfigStore 数据保存在本地文件中的配置存储
+//
+//	ConfigWatcher 轮询 WatchPaths 返回的文件，文件变化时才重新加载存储。
+type WatchableConfigStore interface {
+	ConfigStore
+
+	// WatchPaths 返回存储读写的数据文件
+	WatchPaths() []string
+}
+
+// FileConfigStore 原子写入完整快照的文件存储
+//
+//	每次保存都重写整个文件：写入临时文件、fsync 后重命名替换，
+//	上一个快照保留为 <path>.bak，主文件损坏时 Load 回退到该快照。
+//	读写期间持有 <path>.lock 文件锁，多个进程共享同一文件时不会相互破坏；
+//	保存单个插件的修改时在锁内重新读取文件并合并，不会覆盖其他进程对其他插件的修改。
+type FileConfigStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewFileConfigStore 创建文件存储
+func NewFileConfigStore(path string) *FileConfigStore {
+	return &FileConfigStore{path: path}
+}
+
+// Load 读取配置快照
+func (s *FileConfigStore) Load() (*ConfigSnapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	unlock, err := lockFile(s.path + ".lock")
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	return readSnapshotFile(s.path)
+}
+
+// Save 保存快照，单个插件的修改与文件中的快照合并
+func (s *FileConfigStore) Save(snapshot *ConfigSnapshot, change ConfigChange) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	unlock, err := lockFile(s.path + ".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return writeSnapshotFile(s.path, mergeSnapshot(s.path, snapshot, change))
+}
+
+// mergeSnapshot 将单个插件或角色的修改合并到文件中的快照，调用方需持有文件锁
+//
+//	其他进程可能在本进程读取之后修改了文件，只写入自己的快照会覆盖这些修改。
+//	保存完整快照或文件无法读取时返回 snapshot。
+func mergeSnapshot(path string, snapshot *ConfigSnapshot, change ConfigChange) *ConfigSnapshot {
+	if change.full() {
+		return snapshot
+	}
+	current, _ := readSnapshotFile(path)
+	if current == nil {
+		return snapshot
+	}
+	current.apply(change)
+	return current
+}
+
+// Close 实现 ConfigStore 接口
+func (s *FileConfigStore) Close() error {
+	return nil
+}
+
+// WatchPaths 实现 WatchableConfigStore 接口
+func (s *FileConfigStore) WatchPaths() []string {
+	return []string{s.path}
+}
+
+// defaultCompactThreshold 日志存储默认的压缩阈值
+const defaultCompactThreshold = 1000
+
+// JournalConfigStore 追加写日志的存储
+//
+//	每次修改作为一条记录追加到 <path>.journal 并 fsync，
+//	记录数达到压缩阈值或保存完整快照时，将快照原子写入 <path> 并清空日志。
+//	每条记录带有长度和 CRC32，Load 在第一条损坏的记录处停止重放并截断日志。
+//	达到阈值压缩时先重放其他进程追加的记录，保存完整快照时以本进程的快照为准。
+type JournalConfigStore struct {
+	path      string
+	threshold int
+
+	mu      sync.Mutex
+	journal *os.File
+	entries int
+}
+
+// NewJournalConfigStore 创建日志存储
+//
+//	参数:
+//	- path: 快照文件路径，日志文件为 <path>.journal
+//	- compactThreshold: 触发压缩的记录数，小于等于 0 时使用默认值 1000
+func NewJournalConfigStore(path string, compactThreshold int) *JournalConfigStore {
+	if compactThreshold <= 0 {
+		compactThreshold = defaultCompactThreshold
+	}
+	return &JournalConfigStore{path: path, threshold: compactThreshold}
+}
+
+func (s *JournalConfigStore) journalPath() string {
+	return s.path + ".journal"
+}
+
+// Load 读取快照并重放日志
+func (s *JournalConfigStore) Load() (*ConfigSnapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	unlock, err := lockFile(s.path + ".lock")
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	snapshot, offset, size, entries, recovered := s.replay()
+	if snapshot == nil {
+		return nil, recovered
+	}
+	s.entries = entries
+
+	if offset < size {
+		if err := os.Truncate(s.journalPath(), int64(offset)); err != nil {
+			return nil, wrap(err, "截断配置日志失败")
+		}
+		if recovered == nil {
+			recovered = wrapf(ErrConfigRecovered, "配置日志 %s 第 %d 条记录已损坏，已回退到之前的状态", s.journalPath(), entries+1)
+		}
+	}
+	return snapshot, recovered
+}
+
+// replay 读取快照并重放日志，调用方需持有文件锁
+//
+//	返回重放后的快照、有效记录的结束偏移、日志长度和记录数，快照无法读取时返回 nil。
+func (s *JournalConfigStore) replay() (*ConfigSnapshot, int, int, int, error) {
+	snapshot, recovered := readSnapshotFile(s.path)
+	if snapshot == nil {
+		return nil, 0, 0, 0, recovered
+	}
+
+	data, err := os.ReadFile(s.journalPath())
+	if err != nil && !os.IsNotExist(err) {
+		return nil, 0, 0, 0, wrap(err, "读取配置日志失败")
+	}
+
+	offset, entries := 0, 0
+	for offset < len(data) {
+		change, n, ok := decodeJournalEntry(data[offset:])
+		if !ok {
+			break
+		}
+		snapshot.apply(change)
+		offset += n
+		entries++
+	}
+	return snapshot, offset, len(data), entries, recovered
+}
+
+// Save 追加修改记录，需要时压缩日志
+func (s *JournalConfigStore) Save(snapshot *ConfigSnapshot, change ConfigChange) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	unlock, err := lockFile(s.path + ".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if change.full() {
+		return s.compact(snapshot)
+	}
+	if s.entries+1 >= s.threshold {
+		// 其他进程可能追加了本进程未读取的记录，压缩前重放日志并合并本次修改
+		current, _, _, _, _ := s.replay()
+		if current == nil {
+			current = snapshot
+		} else {
+			current.apply(change)
+		}
+		return s.compact(current)
+	}
+
+	entry, err := encodeJournalEntry(change)
+	if err != nil {
+		return err
+	}
+	if s.journal == nil {
+		if s.journal, err = os.OpenFile(s.journalPath(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600); err != nil {
+			return wrap(err, "打开配置日志失败")
+		}
+	}
+	if _, err := s.journal.Write(entry); err != nil {
+		return wrap(err, "写入配置日志失败")
+	}
+	if err := s.journal.Sync(); err != nil {
+		return wrap(err, "同步配置日志失败")
+	}
+	s.entries++
+	return nil
+}
+
+// compact 写入完整快照并清空日志，调用方需持有锁
+func (s *JournalConfigStore) compact(snapshot *ConfigSnapshot) error {
+	if err := writeSnapshotFile(s.path, snapshot); err != nil {
+		return err
+	}
+	if s.journal != nil {
+		s.journal.Close()
+		s.journal = nil
+	}
+	if err := os.Truncate(s.journalPath(), 0); err != nil && !os.IsNotExist(err) {
+		return wrap(err, "清空配置日志失败")
+	}
+	s.entries = 0
+	return nil
+}
+
+// Close 关闭日志文件
+func (s *JournalConfigStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.journal == nil {
+		return nil
+	}
+	err := s.journal.Close()
+	s.journal = nil
+	return err
+}
+
+// WatchPaths 实现 WatchableConfigStore 接口
+func (s *JournalConfigStore) WatchPaths() []string {
+	return []string{s.path, s.journalPath()}
+}
+
+// 日志记录格式: 4 字节长度 + 4 字节 CRC32 + msgpack 编码的 ConfigChange
+const journalHeaderSize = 8
+
+func encodeJournalEntry(change ConfigChange) ([]byte, error) {
+	payload, err := msgpack.Marshal(change)
+	if err != nil {
+		return nil, wrap(err, "序列化配置修改失败")
+	}
+	entry := make([]byte, journalHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(entry, uint32(len(payload)))
+	binary.BigEndian.PutUint32(entry[4:], crc32.ChecksumIEEE(payload))
+	copy(entry[journalHeaderSize:], payload)
+	return entry, nil
+}
+
+func decodeJournalEntry(data []byte) (ConfigChange, int, bool) {
+	var change ConfigChange
+	if len(data) < journalHeaderSize {
+		return change, 0, false
+	}
+	size := int(binary.BigEndian.Uint32(data))
+	if size > len(data)-journalHeaderSize {
+		return change, 0, false
+	}
+	payload := data[journalHeaderSize : journalHeaderSize+size]
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(data[4:]) {
+		return change, 0, false
+	}
+	if err := msgpack.Unmarshal(payload, &change); err != nil || change.full() {
+		return change, 0, false
+	}
+	return change, journalHeaderSize + size, true
+}
+
+// MemoryConfigStore 只保存在内存中的存储，用于测试
+type MemoryConfigStore struct {
+	mu   sync.Mutex
+	data []byte
+}
+
+// NewMemoryConfigStore 创建内存存储
+func NewMemoryConfigStore() *MemoryConfigStore {
+	return &MemoryConfigStore{}
+}
+
+// Load 返回最后保存的快照副本
+func (s *MemoryConfigStore) Load() (*ConfigSnapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.data == nil {
+		return newConfigSnapshot(), nil
+	}
+	return decodeSnapshot(s.data)
+}
+
+// Save 保存快照副本
+func (s *MemoryConfigStore) Save(snapshot *ConfigSnapshot, _ ConfigChange) error {
+	data, err := encodeSnapshot(snapshot)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data = data
+	return nil
+}
+
+// Close 实现 ConfigStore 接口
+func (s *MemoryConfigStore) Close() error {
+	return nil
+}
+
+// 确保存储实现 ConfigStore 接口
+var (
+	_ ConfigStore = (*FileConfigStore)(nil)
+	_ ConfigStore = (*JournalConfigStore)(nil)
+	_ ConfigStore = (*MemoryConfigStore)(nil)
+
+	_ WatchableConfigStore = (*FileConfigStore)(nil)
+	_ WatchableConfigStore = (*JournalConfigStore)(nil)
+)
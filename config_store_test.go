@@ -0,0 +1,225 @@
+package plugmgr
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestFileConfigStoreRecovery(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.db")
+	c, err := loadConfig(NewFileConfigStore(path))
+	if err != nil {
+		t.Fatalf("加载空配置失败: %v", err)
+	}
+
+	if err := c.SetPluginConfig("demo", []byte("v1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetEnabled("demo", true); err != nil {
+		t.Fatal(err)
+	}
+
+	// 主文件损坏时回退到上一个快照
+	if err := os.WriteFile(path, []byte("PLUGMGR1garbage"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	recovered, err := loadConfig(NewFileConfigStore(path))
+	if !errors.Is(err, ErrConfigRecovered) {
+		t.Fatalf("期望 ErrConfigRecovered, 得到 %v", err)
+	}
+	if data, ok := recovered.GetPluginConfig("demo"); !ok || string(data.Config) != "v1" {
+		t.Fatal("应回退到上一个快照")
+	}
+	if recovered.IsEnabled("demo") {
+		t.Fatal("上一个快照中插件尚未启用")
+	}
+
+	// 主文件和备份均损坏时返回错误
+	if err := os.WriteFile(path+".bak", []byte{0xc1}, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadConfig(NewFileConfigStore(path)); !errors.Is(err, ErrConfigCorrupted) {
+		t.Fatalf("期望 ErrConfigCorrupted, 得到 %v", err)
+	}
+}
+
+func TestFileConfigStoreConcurrentWriters(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.db")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			c := NewConfig(path)
+			for j := 0; j < 20; j++ {
+				if err := c.SetPluginConfig("demo", []byte{byte(i), byte(j)}); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if _, err := loadConfig(NewFileConfigStore(path)); err != nil {
+		t.Fatalf("并发写入后配置应完好: %v", err)
+	}
+}
+
+func TestConfigStoresMergeOtherWriters(t *testing.T) {
+	stores := map[string]func(path string) ConfigStore{
+		"file":    func(path string) ConfigStore { return NewFileConfigStore(path) },
+		"journal": func(path string) ConfigStore { return NewJournalConfigStore(path, 2) },
+	}
+	for kind, newStore := range stores {
+		path := filepath.Join(t.TempDir(), "config.db")
+		a, err := loadConfig(newStore(path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := loadConfig(newStore(path))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// b 在 a 修改之前加载，保存时不能覆盖 a 的修改
+		if err := a.SetPluginConfig("a", []byte("1")); err != nil {
+			t.Fatal(err)
+		}
+		for _, v := range []string{"1", "2"} {
+			if err := b.SetPluginConfig("b", []byte(v)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		a.Close()
+		b.Close()
+
+		reloaded, err := loadConfig(newStore(path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data, ok := reloaded.GetPluginConfig("a"); !ok || string(data.Config) != "1" {
+			t.Fatalf("%s 存储丢失了其他写入方的修改", kind)
+		}
+		if data, ok := reloaded.GetPluginConfig("b"); !ok || string(data.Config) != "2" {
+			t.Fatalf("%s 存储丢失了自己的修改", kind)
+		}
+	}
+}
+
+func TestJournalConfigStoreRolePolicy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.db")
+	c, err := loadConfig(NewJournalConfigStore(path, 100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetRolePolicy("editor", []string{ActionRead}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetPluginConfig("a", []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+
+	reloaded, err := loadConfig(NewJournalConfigStore(path, 100))
+	if err != nil {
+		t.Fatalf("角色策略记录不应被视为损坏: %v", err)
+	}
+	if actions, ok := reloaded.RolePolicy("editor"); !ok || len(actions) != 1 || actions[0] != ActionRead {
+		t.Fatalf("重放日志后应恢复角色策略, 得到 %v %v", actions, ok)
+	}
+	if data, ok := reloaded.GetPluginConfig("a"); !ok || string(data.Config) != "1" {
+		t.Fatal("角色策略之后的插件修改应保留")
+	}
+}
+
+func TestJournalConfigStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.db")
+	store := NewJournalConfigStore(path, 4)
+	c, err := loadConfig(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.SetPluginConfig("a", []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetEnabled("a", true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatal("未达到压缩阈值时不应写入快照")
+	}
+
+	reloaded, err := loadConfig(NewJournalConfigStore(path, 4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, ok := reloaded.GetPluginConfig("a"); !ok || string(data.Config) != "1" || !reloaded.IsEnabled("a") {
+		t.Fatal("重放日志后配置不一致")
+	}
+
+	// 达到阈值后压缩为快照并清空日志
+	for _, v := range []string{"2", "3"} {
+		if err := c.SetPluginConfig("a", []byte(v)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if info, err := os.Stat(path + ".journal"); err != nil || info.Size() != 0 {
+		t.Fatalf("压缩后日志应为空: %v", err)
+	}
+	if err := c.SetPluginConfig("b", []byte("x")); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 日志末尾的不完整记录被丢弃
+	f, err := os.OpenFile(path+".journal", os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte{0, 0, 0, 9, 1, 2})
+	f.Close()
+
+	reloaded, err = loadConfig(NewJournalConfigStore(path, 4))
+	if !errors.Is(err, ErrConfigRecovered) {
+		t.Fatalf("期望 ErrConfigRecovered, 得到 %v", err)
+	}
+	if data, _ := reloaded.GetPluginConfig("a"); string(data.Config) != "3" {
+		t.Fatalf("期望 3, 得到 %q", data.Config)
+	}
+	if data, ok := reloaded.GetPluginConfig("b"); !ok || string(data.Config) != "x" {
+		t.Fatal("损坏记录之前的修改应保留")
+	}
+	if _, err := loadConfig(NewJournalConfigStore(path, 4)); err != nil {
+		t.Fatalf("截断损坏记录后应能正常加载: %v", err)
+	}
+}
+
+func TestManagerWithConfigStore(t *testing.T) {
+	store := NewMemoryConfigStore()
+	m, err := NewManagerWithOptions(t.TempDir(), "unused.db", WithConfigStore(store))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.config.SetPluginConfig("demo", []byte("cfg")); err != nil {
+		t.Fatal(err)
+	}
+
+	m2, err := NewManagerWithOptions(t.TempDir(), "unused.db", WithConfigStore(store))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, ok := m2.config.GetPluginConfig("demo"); !ok || string(data.Config) != "cfg" {
+		t.Fatal("内存存储应在管理器之间共享配置")
+	}
+	if _, err := os.Stat(filepath.Join(m.pluginDir, "unused.db")); !os.IsNotExist(err) {
+		t.Fatal("使用自定义存储时不应写入配置文件")
+	}
+}
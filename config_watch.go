@@ -0,0 +1,408 @@
+package plugmgr
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 配置监视的默认轮询间隔和防抖时间
+const (
+	defaultWatchInterval = time.Second
+	defaultWatchDebounce = 500 * time.Millisecond
+)
+
+// WatchOption 配置监视选项
+type WatchOption func(*watchOptions)
+
+type watchOptions struct {
+	interval time.Duration
+	debounce time.Duration
+}
+
+// WithWatchInterval 设置检查配置文件的轮询间隔，默认 1 秒
+func WithWatchInterval(interval time.Duration) WatchOption {
+	return func(o *watchOptions) {
+		o.interval = interval
+	}
+}
+
+// WithWatchDebounce 设置防抖时间，文件在该时间内没有再次变化才重新应用配置，默认 500 毫秒
+func WithWatchDebounce(debounce time.Duration) WatchOption {
+	return func(o *watchOptions) {
+		o.debounce = debounce
+	}
+}
+
+// ConfigWatcher 监视配置存储和配置覆盖文件的变化并重新应用到运行中的插件
+type ConfigWatcher struct {
+	manager  *Manager
+	interval time.Duration
+	debounce time.Duration
+
+	last *ConfigSnapshot // 上次检查时存储中的配置
+
+	stopOnce sync.Once
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// fileState 被监视文件的状态
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// WatchConfigFiles 开始监视配置文件
+//
+//	参数:
+//	- opts: 监视选项，例如 WithWatchInterval、WithWatchDebounce
+//	功能:
+//	- 轮询 WatchableConfigStore 的数据文件和 WithConfigDir 目录中的配置覆盖文件，
+//	  其他存储在每个轮询周期重新加载
+//	- 文件停止变化超过防抖时间后，找出其他进程修改的插件配置和启用状态
+//	- 配置变化的已加载插件按配置层合并、Schema 校验后调用插件的 ConfigUpdated，
+//	  未通过校验或插件拒绝时记录警告，运行中的插件和内存中的配置保持不变
+//	- 启用状态变化的插件被加载或卸载，仍被其他插件依赖时拒绝卸载；
+//	  存储中已经是新的状态，因此不会再次写入
+//	- 每个重新应用的插件发布一个 PluginConfigUpdated 事件
+//	- Shutdown 时自动停止
+//	返回:
+//	- *ConfigWatcher: 监视器，调用 Stop 停止监视
+//	- error: 已经在监视时返回错误
+func (m *Manager) WatchConfigFiles(opts ...WatchOption) (*ConfigWatcher, error) {
+	options := watchOptions{interval: defaultWatchInterval, debounce: defaultWatchDebounce}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if options.interval <= 0 {
+		return nil, newErrorf("无效的轮询间隔 %s", options.interval)
+	}
+
+	snapshot, err := m.config.store.Load()
+	if snapshot == nil {
+		return nil, wrap(err, "读取配置失败")
+	}
+
+	w := &ConfigWatcher{
+		manager:  m,
+		interval: options.interval,
+		debounce: options.debounce,
+		last:     snapshot,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	if !m.watcher.CompareAndSwap(nil, w) {
+		return nil, newError("配置监视已经启动")
+	}
+
+	go w.run(w.files())
+	return w, nil
+}
+
+// Stop 停止监视并等待正在进行的重新应用完成
+func (w *ConfigWatcher) Stop() {
+	w.stopOnce.Do(func() {
+		close(w.stop)
+	})
+	<-w.done
+	w.manager.watcher.CompareAndSwap(w, nil)
+}
+
+// run 轮询被监视的文件，applied 为启动时文件的状态
+func (w *ConfigWatcher) run(applied map[string]fileState) {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	_, pollStore := w.manager.config.store.(WatchableConfigStore)
+	pollStore = !pollStore
+
+	pending, since := applied, time.Now()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+		}
+
+		current := w.files()
+		if !sameFiles(current, pending) {
+			pending, since = current, time.Now()
+			continue
+		}
+		if sameFiles(current, applied) {
+			if pollStore {
+				w.apply(nil)
+			}
+			continue
+		}
+		if time.Since(since) < w.debounce {
+			continue
+		}
+
+		w.apply(changedOverlays(applied, current, w.manager.configDir))
+		applied = current
+	}
+}
+
+// files 返回所有被监视文件的当前状态，不存在的文件不包含在内
+func (w *ConfigWatcher) files() map[string]fileState {
+	var paths []string
+	if store, ok := w.manager.config.store.(WatchableConfigStore); ok {
+		paths = append(paths, store.WatchPaths()...)
+	}
+	if dir := w.manager.configDir; dir != "" {
+		for _, pattern := range []string{"*.json", "*.toml"} {
+			matches, _ := filepath.Glob(filepath.Join(dir, pattern))
+			paths = append(paths, matches...)
+		}
+	}
+
+	files := make(map[string]fileState, len(paths))
+	for _, path := range paths {
+		if info, err := os.Stat(path); err == nil {
+			files[path] = fileState{modTime: info.ModTime(), size: info.Size()}
+		}
+	}
+	return files
+}
+
+func sameFiles(a, b map[string]fileState) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for path, state := range a {
+		if other, ok := b[path]; !ok || !other.modTime.Equal(state.modTime) || other.size != state.size {
+			return false
+		}
+	}
+	return true
+}
+
+// changedOverlays 返回配置覆盖文件发生变化的插件
+func changedOverlays(before, after map[string]fileState, dir string) map[string]bool {
+	if dir == "" {
+		return nil
+	}
+	plugins := make(map[string]bool)
+	check := func(path string) {
+		if filepath.Dir(path) != filepath.Clean(dir) {
+			return
+		}
+		base := filepath.Base(path)
+		plugins[strings.TrimSuffix(base, filepath.Ext(base))] = true
+	}
+	for path, state := range after {
+		if old, ok := before[path]; !ok || !old.modTime.Equal(state.modTime) || old.size != state.size {
+			check(path)
+		}
+	}
+	for path := range before {
+		if _, ok := after[path]; !ok {
+			check(path)
+		}
+	}
+	return plugins
+}
+
+// storeChange 其他进程对单个插件的修改
+type storeChange struct {
+	name    string
+	data    *PluginData // 存储中新的配置数据，配置未修改时为 nil
+	current *PluginData // 检查时内存中的配置数据
+	enabled *bool       // 存储中新的启用状态，未修改时为 nil
+}
+
+// apply 重新读取存储，将其他进程的修改和配置覆盖文件的变化应用到运行中的插件
+func (w *ConfigWatcher) apply(overlays map[string]bool) {
+	m := w.manager
+
+	snapshot, changes, err := m.config.diffStore(w.last)
+	if snapshot == nil {
+		m.logger.Warn("重新读取配置失败", "error", err)
+		return
+	}
+	if err != nil {
+		m.logger.Warn("配置已损坏，使用最后一个完好的快照", "error", err)
+	}
+	w.last = snapshot
+
+	for _, change := range changes {
+		delete(overlays, change.name)
+	}
+	for name := range overlays {
+		if _, ok := m.plugins.Load(name); ok {
+			changes = append(changes, storeChange{name: name})
+		}
+	}
+
+	for _, change := range changes {
+		if m.applyStoreChange(change) {
+			config, _ := m.config.GetPluginConfig(change.name)
+			var data []byte
+			if config != nil {
+				data = m.RedactConfig(change.name, config.Config)
+			}
+			m.eventBus.PublishAsync(Event{
+				EventName: PluginConfigUpdated,
+				Data: EventData{
+					Name: change.name,
+					Data: PluginConfigUpdatedPayload{Config: data, External: true},
+				},
+			})
+		}
+	}
+}
+
+// applyStoreChange 将单个插件的修改应用到运行中的插件，返回是否有修改生效
+func (m *Manager) applyStoreChange(change storeChange) bool {
+	name := change.name
+	_, loaded := m.plugins.Load(name)
+
+	// 即将卸载的插件不需要重新应用配置
+	disabling := change.enabled != nil && !*change.enabled
+	if loaded && !disabling && (change.data != nil || change.enabled == nil) {
+		if err := m.reapplyConfig(name, change.data); err != nil {
+			m.logger.Warn("重新应用插件配置失败，保持当前配置", "plugin", name, "error", err)
+			return false
+		}
+	}
+	if change.data != nil {
+		m.config.replacePluginData(name, change.current, change.data)
+	}
+
+	if change.enabled == nil {
+		return true
+	}
+
+	// 启用状态已写入存储，这里只修改内存中的状态；被禁用插件的依赖方随之级联禁用
+	if *change.enabled && !loaded {
+		if err := m.enablePlugin(name, false); err != nil {
+			m.config.markEnabled(name, false)
+			m.logger.Warn("启用插件失败", "plugin", name, "error", err)
+			return false
+		}
+	} else if !*change.enabled && loaded {
+		if err := m.disablePlugin(name, false, WithCascade()); err != nil {
+			m.logger.Warn("禁用插件失败", "plugin", name, "error", err)
+			return false
+		}
+	} else {
+		m.config.markEnabled(name, *change.enabled)
+	}
+	return true
+}
+
+// reapplyConfig 合并配置层并校验后交给插件，data 为 nil 时使用内存中的配置
+func (m *Manager) reapplyConfig(name string, data *PluginData) error {
+	pluginInfo, ok := m.plugins.Load(name)
+	if !ok {
+		return ErrPluginNotFound
+	}
+	lazyPlug := pluginInfo.(*lazyPlugin)
+	if err := lazyPlug.load(); err != nil {
+		return wrapf(err, "加载插件 %s 失败", name)
+	}
+
+	var stored []byte
+	if data != nil {
+		stored = data.Config
+	} else if current, ok := m.config.GetPluginConfig(name); ok {
+		stored = current.Config
+	}
+
+	plain, err := m.openConfig(name, stored)
+	if err != nil {
+		return wrap(err, "解密插件配置失败")
+	}
+	resolved, err := m.resolveConfig(name, plain)
+	if err != nil {
+		return wrap(err, "合并插件配置层失败")
+	}
+	if err := validateConfig(name, lazyPlug.loaded, resolved.Config); err != nil {
+		return err
+	}
+
+	updated, err := lazyPlug.loaded.ConfigUpdated(resolved.Config)
+	if err != nil {
+		return wrapf(err, "更新插件 %s 的配置失败", name)
+	}
+	if host, ok := m.hosts.Load(name); ok {
+		go host.(*pluginHost).notifyConfig(updated)
+	}
+	m.logger.Info("插件配置已从文件重新加载", "plugin", name)
+	return nil
+}
+
+// diffStore 重新读取存储并找出 last 之后由其他进程做出的修改
+//
+//	只有存储中的值相对 last 发生变化且与内存中的值不同时才视为修改，
+//	管理器自身保存的修改和仅存在于内存中的状态都会被忽略。
+func (c *config) diffStore(last *ConfigSnapshot) (*ConfigSnapshot, []storeChange, error) {
+	// 持有读锁，避免读取存储期间内存中的配置被修改
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	snapshot, err := c.store.Load()
+	if snapshot == nil {
+		return nil, nil, err
+	}
+
+	names := make(map[string]bool)
+	for name := range snapshot.Configs {
+		names[name] = true
+	}
+	for name := range snapshot.Enabled {
+		names[name] = true
+	}
+
+	var changes []storeChange
+	for _, name := range sortedKeys(names) {
+		change := storeChange{name: name, current: c.pluginConfigs[name]}
+
+		if data := snapshot.Configs[name]; data != nil {
+			old := last.Configs[name]
+			if (old == nil || !bytes.Equal(old.Config, data.Config)) &&
+				(change.current == nil || !bytes.Equal(change.current.Config, data.Config)) {
+				change.data = data
+			}
+		}
+
+		if enabled, ok := snapshot.Enabled[name]; ok {
+			old, known := last.Enabled[name]
+			if (!known || old != enabled) && c.enabled[name] != enabled {
+				change.enabled = &enabled
+			}
+		}
+
+		if change.data != nil || change.enabled != nil {
+			changes = append(changes, change)
+		}
+	}
+	return snapshot, changes, err
+}
+
+// replacePluginData 将内存中的插件配置替换为存储中的配置，不写入存储
+//
+//	内存中的配置在检查之后已被修改时保留内存中的配置。
+func (c *config) replacePluginData(name string, current, data *PluginData) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.pluginConfigs[name] == current {
+		c.pluginConfigs[name] = data
+	}
+}
+
+// markEnabled 修改内存中的启用状态，不写入存储
+func (c *config) markEnabled(name string, enabled bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.enabled[name] = enabled
+}
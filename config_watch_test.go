@@ -0,0 +1,184 @@
+package plugmgr
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// watchEvents 订阅 PluginConfigUpdated 事件
+func watchEvents(m *Manager) chan string {
+	updated := make(chan string, 16)
+	m.SubscribeToEvent(PluginConfigUpdated, func(e Event) {
+		updated <- e.Data.Name
+	})
+	return updated
+}
+
+func waitEvent(t *testing.T, events chan string, want string) {
+	t.Helper()
+	select {
+	case name := <-events:
+		if name != want {
+			t.Fatalf("期望插件 %s 的配置更新事件, 得到 %s", want, name)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("等待插件 %s 的配置更新事件超时", want)
+	}
+}
+
+func startWatch(t *testing.T, m *Manager) {
+	t.Helper()
+	w, err := m.WatchConfigFiles(WithWatchInterval(5*time.Millisecond), WithWatchDebounce(20*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(w.Stop)
+}
+
+func TestWatchConfigFilesReappliesChanges(t *testing.T) {
+	m := newTestManager(t)
+	events := watchEvents(m)
+	server := &schemaPlugin{}
+	app := &fakePlugin{}
+	loadHostPlugin(t, m, "server", server)
+	loadHostPlugin(t, m, "app", app)
+	if err := m.config.SetEnabled("app", true); err != nil {
+		t.Fatal(err)
+	}
+	startWatch(t, m)
+
+	// 另一个进程修改同一个配置文件
+	other, err := LoadConfig("config.db", m.pluginDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	valid, _ := Serializer(map[string]any{"host": "x", "port": 80})
+	if err := other.SetPluginConfig("server", valid); err != nil {
+		t.Fatal(err)
+	}
+	waitEvent(t, events, "server")
+	if server.updates != 1 || string(server.config) != string(valid) {
+		t.Fatalf("插件应收到新配置: updates=%d", server.updates)
+	}
+
+	// 未通过校验的修改不影响运行中的插件和内存中的配置
+	invalid, _ := Serializer(map[string]any{"host": "x", "port": 0})
+	if err := other.SetPluginConfig("server", invalid); err != nil {
+		t.Fatal(err)
+	}
+	appConfig, _ := Serializer(map[string]any{"level": "debug"})
+	if err := other.SetPluginConfig("app", appConfig); err != nil {
+		t.Fatal(err)
+	}
+	waitEvent(t, events, "app")
+	if string(app.config) != string(appConfig) {
+		t.Fatal("插件 app 应收到新配置")
+	}
+	if server.updates != 1 {
+		t.Fatal("校验失败时不应调用插件的 ConfigUpdated")
+	}
+	if data, _ := m.config.GetPluginConfig("server"); string(data.Config) != string(valid) {
+		t.Fatal("校验失败时内存中的配置应保持不变")
+	}
+
+	// 启用状态变化时卸载和重新加载插件
+	if err := other.SetEnabled("app", false); err != nil {
+		t.Fatal(err)
+	}
+	waitEvent(t, events, "app")
+	if _, ok := m.plugins.Load("app"); ok || m.config.IsEnabled("app") {
+		t.Fatal("插件 app 应被卸载")
+	}
+
+	m.preloadedPlugins.Store("app", &lazyPlugin{path: filepath.Join(m.pluginDir, "app.so"), loaded: app})
+	if err := other.SetEnabled("app", true); err != nil {
+		t.Fatal(err)
+	}
+	waitEvent(t, events, "app")
+	if _, ok := m.plugins.Load("app"); !ok || !m.config.IsEnabled("app") {
+		t.Fatal("插件 app 应被重新加载")
+	}
+}
+
+func TestWatchConfigFilesOverlay(t *testing.T) {
+	dir := t.TempDir()
+	m, err := NewManagerWithOptions(t.TempDir(), "config.db", WithConfigDir(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.SetSandbox(nopSandbox{})
+	events := watchEvents(m)
+
+	stored, _ := Serializer(map[string]any{"host": "stored"})
+	if err := m.config.SetPluginConfig("app", stored); err != nil {
+		t.Fatal(err)
+	}
+	app := &fakePlugin{}
+	loadHostPlugin(t, m, "app", app)
+	startWatch(t, m)
+
+	if err := os.WriteFile(filepath.Join(dir, "app.json"), []byte(`{"host": "file"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	waitEvent(t, events, "app")
+
+	var config struct {
+		Host string `msgpack:"host"`
+	}
+	if err := Deserializer(app.config, &config); err != nil || config.Host != "file" {
+		t.Fatalf("插件应收到合并配置文件后的配置: %+v, %v", config, err)
+	}
+
+	if _, err := m.WatchConfigFiles(); err == nil {
+		t.Fatal("重复启动配置监视应返回错误")
+	}
+}
+
+func TestWatchConfigFilesEnabledEvents(t *testing.T) {
+	m := newTestManager(t)
+	addDependentTestPlugins(m)
+	for _, name := range m.ListPlugins() {
+		if err := m.config.SetEnabled(name, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	enabled := make(chan string, 8)
+	disabled := make(chan string, 8)
+	m.SubscribeToEvent(PluginEnabled, func(e Event) { enabled <- e.Data.Name })
+	m.SubscribeToEvent(PluginDisabled, func(e Event) { disabled <- e.Data.Name })
+	startWatch(t, m)
+
+	other, err := LoadConfig("config.db", m.pluginDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 外部禁用的插件级联禁用依赖方，并触发禁用事件
+	if err := other.SetEnabled("db", false); err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]bool{receive(t, disabled): true, receive(t, disabled): true}
+	if !got["db"] || !got["app"] {
+		t.Fatalf("应触发 db 和 app 的禁用事件, 得到 %v", got)
+	}
+	if _, ok := m.plugins.Load("app"); ok || m.config.IsEnabled("app") || m.config.IsEnabled("db") {
+		t.Fatal("依赖 db 的插件 app 应被卸载并禁用")
+	}
+	if !m.config.IsEnabled("log") || !m.config.IsEnabled("cache") {
+		t.Fatal("不应禁用依赖方以外的插件")
+	}
+
+	m.preloadedPlugins.Store("db", &lazyPlugin{path: filepath.Join(m.pluginDir, "db.so"), loaded: &fakePlugin{}})
+	if err := other.SetEnabled("db", true); err != nil {
+		t.Fatal(err)
+	}
+	if name := receive(t, enabled); name != "db" {
+		t.Fatalf("应触发 db 的启用事件, 得到 %s", name)
+	}
+	if _, ok := m.plugins.Load("db"); !ok {
+		t.Fatal("插件 db 应被重新加载")
+	}
+}
@@ -0,0 +1,356 @@
+package plugmgr
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// MissingDependency 描述一个缺失的插件依赖
+type MissingDependency struct {
+	Plugin     string // 声明依赖的插件
+	Dependency string // 缺失的依赖名称
+	Constraint string // 依赖的版本约束
+}
+
+// DependencyError 依赖解析错误
+//
+//	一次性报告依赖图中所有缺失的依赖和循环依赖，
+//	可以通过 errors.Is 判断是否包含 ErrMissingDependency 或 ErrCircularDependency。
+type DependencyError struct {
+	Missing []MissingDependency // 缺失的依赖
+	Cycles  [][]string          // 循环依赖路径，首尾为同一插件
+}
+
+// Error 实现 error 接口
+func (e *DependencyError) Error() string {
+	var parts []string
+	for _, m := range e.Missing {
+		parts = append(parts, fmt.Sprintf("%s 缺少依赖 %s(%s)", m.Plugin, m.Dependency, m.Constraint))
+	}
+	for _, cycle := range e.Cycles {
+		parts = append(parts, "循环依赖 "+strings.Join(cycle, " -> "))
+	}
+	return "依赖解析失败: " + strings.Join(parts, "; ")
+}
+
+// Unwrap 返回错误包含的依赖错误类型
+func (e *DependencyError) Unwrap() []error {
+	var errs []error
+	if len(e.Missing) > 0 {
+		errs = append(errs, ErrMissingDependency)
+	}
+	if len(e.Cycles) > 0 {
+		errs = append(errs, ErrCircularDependency)
+	}
+	return errs
+}
+
+// dependencyGraph 插件依赖图
+//
+//	节点为插件名称，边从插件指向其依赖，
+//	用于计算加载顺序(依赖在前)和卸载顺序(依赖在后)。
+type dependencyGraph struct {
+	nodes map[string]map[string]string // 插件名称 -> 依赖名称 -> 版本约束
+}
+
+func newDependencyGraph() *dependencyGraph {
+	return &dependencyGraph{nodes: make(map[string]map[string]string)}
+}
+
+// Add 添加插件节点及其依赖
+func (g *dependencyGraph) Add(name string, dependencies map[string]string) {
+	deps := make(map[string]string, len(dependencies))
+	for dep, constraint := range dependencies {
+		deps[dep] = constraint
+	}
+	g.nodes[name] = deps
+}
+
+// Waves 对依赖图进行拓扑排序并按层级分组
+//
+//	参数:
+//	- external: 判断不在图中的依赖是否已经满足(例如已加载的插件)，为 nil 时视为不满足
+//	返回:
+//	- [][]string: 按依赖顺序排列的层级，同一层级内的插件互不依赖，可以并行处理
+//	- error: 存在缺失依赖或循环依赖时返回 *DependencyError
+func (g *dependencyGraph) Waves(external func(name string) bool) ([][]string, error) {
+	depErr := &DependencyError{}
+	indegree := make(map[string]int, len(g.nodes))
+	dependents := make(map[string][]string)
+
+	for _, name := range g.sortedNodes() {
+		indegree[name] = 0
+		for _, dep := range sortedKeys(g.nodes[name]) {
+			if _, ok := g.nodes[dep]; ok {
+				indegree[name]++
+				dependents[dep] = append(dependents[dep], name)
+				continue
+			}
+			if external == nil || !external(dep) {
+				depErr.Missing = append(depErr.Missing, MissingDependency{
+					Plugin:     name,
+					Dependency: dep,
+					Constraint: g.nodes[name][dep],
+				})
+			}
+		}
+	}
+
+	var waves [][]string
+	var current []string
+	for _, name := range g.sortedNodes() {
+		if indegree[name] == 0 {
+			current = append(current, name)
+		}
+	}
+
+	resolved := 0
+	for len(current) > 0 {
+		waves = append(waves, current)
+		resolved += len(current)
+
+		var next []string
+		for _, name := range current {
+			for _, dependent := range dependents[name] {
+				indegree[dependent]--
+				if indegree[dependent] == 0 {
+					next = append(next, dependent)
+				}
+			}
+		}
+		sort.Strings(next)
+		current = next
+	}
+
+	if resolved < len(g.nodes) {
+		depErr.Cycles = g.findCycles(indegree)
+	}
+
+	if len(depErr.Missing) > 0 || len(depErr.Cycles) > 0 {
+		return waves, depErr
+	}
+	return waves, nil
+}
+
+// wavesWithRemainder 对依赖图进行拓扑排序，忽略缺失的依赖
+//
+//	存在循环依赖时，无法排序的插件作为最后一个层级返回，
+//	用于卸载等必须处理所有插件的场景。
+func (g *dependencyGraph) wavesWithRemainder() ([][]string, error) {
+	waves, err := g.Waves(func(string) bool { return true })
+	if err == nil {
+		return waves, nil
+	}
+
+	seen := make(map[string]bool)
+	for _, wave := range waves {
+		for _, name := range wave {
+			seen[name] = true
+		}
+	}
+	var rest []string
+	for _, name := range g.sortedNodes() {
+		if !seen[name] {
+			rest = append(rest, name)
+		}
+	}
+	if len(rest) > 0 {
+		waves = append(waves, rest)
+	}
+	return waves, err
+}
+
+// findCycles 在拓扑排序后剩余的节点中查找循环路径
+func (g *dependencyGraph) findCycles(indegree map[string]int) [][]string {
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+
+	state := make(map[string]int)
+	var stack []string
+	var cycles [][]string
+
+	var visit func(name string)
+	visit = func(name string) {
+		state[name] = visiting
+		stack = append(stack, name)
+
+		for _, dep := range sortedKeys(g.nodes[name]) {
+			if _, ok := g.nodes[dep]; !ok || indegree[dep] == 0 {
+				continue
+			}
+			switch state[dep] {
+			case unvisited:
+				visit(dep)
+			case visiting:
+				for i := len(stack) - 1; i >= 0; i-- {
+					if stack[i] == dep {
+						cycle := append([]string{}, stack[i:]...)
+						cycles = append(cycles, append(cycle, dep))
+						break
+					}
+				}
+			}
+		}
+
+		stack = stack[:len(stack)-1]
+		state[name] = done
+	}
+
+	for _, name := range g.sortedNodes() {
+		if indegree[name] > 0 && state[name] == unvisited {
+			visit(name)
+		}
+	}
+	return cycles
+}
+
+func (g *dependencyGraph) sortedNodes() []string {
+	return sortedKeys(g.nodes)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// DependentsError 插件仍被其他插件依赖时返回的错误
+//
+//	可以通过 errors.Is(err, ErrPluginHasDependents) 判断。
+type DependentsError struct {
+	Plugin     string   // 被依赖的插件
+	Dependents []string // 依赖该插件的已加载插件
+}
+
+// Error 实现 error 接口
+func (e *DependentsError) Error() string {
+	return fmt.Sprintf("插件 %s 仍被以下插件依赖: %s", e.Plugin, strings.Join(e.Dependents, ", "))
+}
+
+// Unwrap 返回错误类型
+func (e *DependentsError) Unwrap() error {
+	return ErrPluginHasDependents
+}
+
+// DependencyNode 依赖树节点
+type DependencyNode struct {
+	Name         string            `json:"name"`                   // 插件名称
+	Version      string            `json:"version,omitempty"`      // 已加载的版本
+	Constraint   string            `json:"constraint,omitempty"`   // 上级插件声明的版本约束
+	Loaded       bool              `json:"loaded"`                 // 插件是否已加载
+	Cycle        bool              `json:"cycle,omitempty"`        // 该节点是否构成循环
+	Dependencies []*DependencyNode `json:"dependencies,omitempty"` // 子依赖
+}
+
+// dependencyIndex 已加载插件的正向和反向依赖索引
+type dependencyIndex struct {
+	mu         sync.RWMutex
+	forward    map[string]map[string]string // 插件名称 -> 依赖名称 -> 版本约束
+	dependents map[string]map[string]bool   // 依赖名称 -> 依赖它的插件集合
+}
+
+func newDependencyIndex() *dependencyIndex {
+	return &dependencyIndex{
+		forward:    make(map[string]map[string]string),
+		dependents: make(map[string]map[string]bool),
+	}
+}
+
+// Set 设置插件的依赖，替换已有记录
+func (idx *dependencyIndex) Set(name string, dependencies map[string]string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.removeLocked(name)
+
+	deps := make(map[string]string, len(dependencies))
+	for dep, constraint := range dependencies {
+		deps[dep] = constraint
+		if idx.dependents[dep] == nil {
+			idx.dependents[dep] = make(map[string]bool)
+		}
+		idx.dependents[dep][name] = true
+	}
+	idx.forward[name] = deps
+}
+
+// Remove 移除插件的依赖记录
+func (idx *dependencyIndex) Remove(name string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.removeLocked(name)
+}
+
+func (idx *dependencyIndex) removeLocked(name string) {
+	for dep := range idx.forward[name] {
+		delete(idx.dependents[dep], name)
+		if len(idx.dependents[dep]) == 0 {
+			delete(idx.dependents, dep)
+		}
+	}
+	delete(idx.forward, name)
+}
+
+// Get 获取插件的依赖
+func (idx *dependencyIndex) Get(name string) (map[string]string, bool) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	deps, ok := idx.forward[name]
+	if !ok {
+		return nil, false
+	}
+	result := make(map[string]string, len(deps))
+	for dep, constraint := range deps {
+		result[dep] = constraint
+	}
+	return result, true
+}
+
+// Dependents 获取直接依赖指定插件的插件列表
+func (idx *dependencyIndex) Dependents(name string) []string {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return sortedKeys(idx.dependents[name])
+}
+
+// TransitiveDependents 获取直接或间接依赖指定插件的插件列表
+func (idx *dependencyIndex) TransitiveDependents(name string) []string {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	seen := map[string]bool{name: true}
+	queue := []string{name}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for dependent := range idx.dependents[current] {
+			if !seen[dependent] {
+				seen[dependent] = true
+				queue = append(queue, dependent)
+			}
+		}
+	}
+	delete(seen, name)
+	return sortedKeys(seen)
+}
+
+// Graph 构建包含所有已记录插件的依赖图
+func (idx *dependencyIndex) Graph() *dependencyGraph {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	graph := newDependencyGraph()
+	for name, deps := range idx.forward {
+		graph.Add(name, deps)
+	}
+	return graph
+}
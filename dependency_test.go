@@ -0,0 +1,245 @@
+package plugmgr
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestDependencyGraphWaves(t *testing.T) {
+	g := newDependencyGraph()
+	g.Add("app", map[string]string{"db": ">= 1.0", "cache": ">= 1.0"})
+	g.Add("db", map[string]string{"log": ">= 1.0"})
+	g.Add("cache", map[string]string{"log": ">= 1.0"})
+	g.Add("log", nil)
+	g.Add("metrics", map[string]string{"core": ">= 1.0"})
+
+	waves, err := g.Waves(func(name string) bool { return name == "core" })
+	if err != nil {
+		t.Fatalf("解析依赖失败: %v", err)
+	}
+
+	want := [][]string{{"log", "metrics"}, {"cache", "db"}, {"app"}}
+	if !reflect.DeepEqual(waves, want) {
+		t.Fatalf("期望 %v, 得到 %v", want, waves)
+	}
+}
+
+func TestDependencyGraphReportsAllErrors(t *testing.T) {
+	g := newDependencyGraph()
+	g.Add("a", map[string]string{"b": ">= 1.0"})
+	g.Add("b", map[string]string{"a": ">= 1.0"})
+	g.Add("c", map[string]string{"missing1": ">= 1.0"})
+	g.Add("d", map[string]string{"missing2": "== 2.0"})
+	g.Add("e", nil)
+
+	waves, err := g.Waves(nil)
+
+	var depErr *DependencyError
+	if !errors.As(err, &depErr) {
+		t.Fatalf("期望 *DependencyError, 得到 %v", err)
+	}
+	if !errors.Is(err, ErrMissingDependency) || !errors.Is(err, ErrCircularDependency) {
+		t.Fatalf("错误应同时包含缺失依赖和循环依赖: %v", err)
+	}
+	if len(depErr.Missing) != 2 {
+		t.Fatalf("期望 2 个缺失依赖, 得到 %+v", depErr.Missing)
+	}
+	if want := [][]string{{"a", "b", "a"}}; !reflect.DeepEqual(depErr.Cycles, want) {
+		t.Fatalf("期望循环 %v, 得到 %v", want, depErr.Cycles)
+	}
+	if len(waves) == 0 {
+		t.Fatal("无关插件仍应被排序")
+	}
+}
+
+func TestManagerShutdownReverseOrder(t *testing.T) {
+	m := newTestManager(t)
+
+	var mu sync.Mutex
+	var order []string
+	add := func(name string, deps map[string]string) {
+		addTestPlugin(m, name, &fakePlugin{
+			metadata: PluginMetadata{Name: name, Version: "1.0.0", Dependencies: deps},
+			onUnload: func() {
+				mu.Lock()
+				order = append(order, name)
+				mu.Unlock()
+			},
+		})
+		m.dependencies.Set(name, deps)
+	}
+	add("log", nil)
+	add("db", map[string]string{"log": ">= 1.0"})
+	add("app", map[string]string{"db": ">= 1.0"})
+
+	if err := m.Shutdown(); err != nil {
+		t.Fatalf("关闭失败: %v", err)
+	}
+	if want := []string{"app", "db", "log"}; !reflect.DeepEqual(order, want) {
+		t.Fatalf("期望卸载顺序 %v, 得到 %v", want, order)
+	}
+	if len(m.ListPlugins()) != 0 {
+		t.Fatalf("关闭后不应有插件: %v", m.ListPlugins())
+	}
+}
+
+func TestLoadEnabledPluginsDependencyOrder(t *testing.T) {
+	m := newTestManager(t)
+	linkTestProcessPlugins(t, m.pluginDir, "app", "db", "cache", "log")
+	defer m.Shutdown()
+
+	for _, name := range []string{"app", "db", "cache", "log"} {
+		if err := m.config.SetEnabled(name, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := m.LoadEnabledPlugins(m.pluginDir); err != nil {
+		t.Fatalf("按依赖顺序加载失败: %v", err)
+	}
+	if got := len(m.ListPlugins()); got != 4 {
+		t.Fatalf("期望加载 4 个插件, 得到 %d", got)
+	}
+}
+
+func TestLoadEnabledPluginsCircularDependency(t *testing.T) {
+	m := newTestManager(t)
+	linkTestProcessPlugins(t, m.pluginDir, "ping", "pong")
+
+	for _, name := range []string{"ping", "pong"} {
+		if err := m.config.SetEnabled(name, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := m.LoadEnabledPlugins(m.pluginDir)
+	if !errors.Is(err, ErrCircularDependency) {
+		t.Fatalf("期望循环依赖错误, 得到 %v", err)
+	}
+	if got := len(m.ListPlugins()); got != 0 {
+		t.Fatalf("存在循环依赖时不应加载任何插件, 得到 %d", got)
+	}
+}
+
+// addDependentTestPlugins 注册 log <- db <- app 和 log <- cache 的依赖链，并记录卸载顺序
+func addDependentTestPlugins(m *Manager) *[]string {
+	var mu sync.Mutex
+	order := new([]string)
+	add := func(name string, deps map[string]string) {
+		addTestPlugin(m, name, &fakePlugin{
+			metadata: PluginMetadata{Name: name, Version: "1.0.0", Dependencies: deps},
+			onUnload: func() {
+				mu.Lock()
+				*order = append(*order, name)
+				mu.Unlock()
+			},
+		})
+		m.dependencies.Set(name, deps)
+	}
+	add("log", nil)
+	add("db", map[string]string{"log": "< 2.0"})
+	add("cache", map[string]string{"log": ">= 1.0"})
+	add("app", map[string]string{"db": ">= 1.0"})
+	return order
+}
+
+func TestUnloadPluginWithDependents(t *testing.T) {
+	m := newTestManager(t)
+	addDependentTestPlugins(m)
+
+	err := m.UnloadPlugin("log")
+	var depErr *DependentsError
+	if !errors.As(err, &depErr) || !errors.Is(err, ErrPluginHasDependents) {
+		t.Fatalf("期望 *DependentsError, 得到 %v", err)
+	}
+	if want := []string{"cache", "db"}; !reflect.DeepEqual(depErr.Dependents, want) {
+		t.Fatalf("期望依赖方 %v, 得到 %v", want, depErr.Dependents)
+	}
+	if len(m.ListPlugins()) != 4 {
+		t.Fatal("拒绝卸载时不应卸载任何插件")
+	}
+
+	if err := m.DisablePlugin("db"); !errors.Is(err, ErrPluginHasDependents) {
+		t.Fatalf("禁用被依赖的插件应失败, 得到 %v", err)
+	}
+	if m.config.IsEnabled("db") {
+		t.Fatal("禁用失败时不应修改启用状态")
+	}
+}
+
+func TestUnloadPluginCascade(t *testing.T) {
+	m := newTestManager(t)
+	order := addDependentTestPlugins(m)
+
+	if err := m.UnloadPlugin("db", WithCascade()); err != nil {
+		t.Fatalf("级联卸载失败: %v", err)
+	}
+	if want := []string{"app", "db"}; !reflect.DeepEqual(*order, want) {
+		t.Fatalf("期望卸载顺序 %v, 得到 %v", want, *order)
+	}
+	if got := m.Dependents("log"); !reflect.DeepEqual(got, []string{"cache"}) {
+		t.Fatalf("卸载后依赖索引未更新: %v", got)
+	}
+}
+
+func TestDisablePluginCascade(t *testing.T) {
+	m := newTestManager(t)
+	addDependentTestPlugins(m)
+	for _, name := range m.ListPlugins() {
+		m.config.SetEnabled(name, true)
+	}
+
+	if err := m.DisablePlugin("db", WithCascade()); err != nil {
+		t.Fatalf("级联禁用失败: %v", err)
+	}
+	if m.config.IsEnabled("db") || m.config.IsEnabled("app") {
+		t.Fatal("级联卸载的依赖方应一并禁用")
+	}
+	if !m.config.IsEnabled("log") || !m.config.IsEnabled("cache") {
+		t.Fatal("不应禁用依赖方以外的插件")
+	}
+}
+
+func TestDependencyTree(t *testing.T) {
+	m := newTestManager(t)
+	addDependentTestPlugins(m)
+	m.dependencies.Set("cache", map[string]string{"log": ">= 1.0", "redis": ">= 6.0"})
+
+	tree, err := m.DependencyTree("app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tree.Name != "app" || len(tree.Dependencies) != 1 {
+		t.Fatalf("依赖树根节点不正确: %+v", tree)
+	}
+	db := tree.Dependencies[0]
+	if db.Name != "db" || db.Constraint != ">= 1.0" || !db.Loaded || db.Version != "1.0.0" {
+		t.Fatalf("依赖节点不正确: %+v", db)
+	}
+	if len(db.Dependencies) != 1 || db.Dependencies[0].Name != "log" {
+		t.Fatalf("子依赖不正确: %+v", db.Dependencies)
+	}
+
+	cacheTree, _ := m.DependencyTree("cache")
+	if redis := cacheTree.Dependencies[1]; redis.Name != "redis" || redis.Loaded {
+		t.Fatalf("未加载的依赖应标记为未加载: %+v", redis)
+	}
+
+	if _, err := m.DependencyTree("missing"); !errors.Is(err, ErrPluginNotFound) {
+		t.Fatalf("期望 ErrPluginNotFound, 得到 %v", err)
+	}
+}
+
+func TestCheckDependents(t *testing.T) {
+	m := newTestManager(t)
+	addDependentTestPlugins(m)
+
+	if err := m.checkDependents("log", "1.5.0"); err != nil {
+		t.Fatalf("兼容版本不应失败: %v", err)
+	}
+	if err := m.checkDependents("log", "2.1.0"); !errors.Is(err, ErrIncompatibleVersion) {
+		t.Fatalf("期望版本不兼容错误, 得到 %v", err)
+	}
+}
@@ -1,27 +1,15 @@
 package plugmgr
 
 import (
-	"crypto"
 	"crypto/rsa"
 	"crypto/sha256"
 	"crypto/x509"
 	"encoding/pem"
-	"io"
-	"net/http"
 	"os"
-	"os/exec"
-	"path/filepath"
-	"runtime"
 
 	"golang.org/x/crypto/ssh"
 )
 
-type PluginRepository struct {
-	URL       string
-	SSHKey    string
-	PublicKey ssh.PublicKey
-}
-
 // SetupRemoteRepository 设置远程插件仓库
 //
 //	参数:
@@ -51,71 +39,46 @@ func (m *Manager) SetupRemoteRepository(url, sshKeyPath string) (*PluginReposito
 	}, nil
 }
 
-// DeployRepository 部署插件仓库
+// DeployRepository 在本地目录部署插件仓库
 //
 //	参数:
-//	- repo: 插件仓库配置对象
-//	- localPath: 本地部署路径
+//	- repo: 插件仓库配置对象，URL 为空时设置为 localPath
+//	- localPath: 仓库目录
 //	返回:
 //	- error: 部署过程中的错误
 //	功能:
-//	- 下载 redbean 执行文件
-//	- 使用 SSH 或本地方式部署仓库
-//	- 验证部署结果
+//	- 创建仓库目录并生成索引
+//	- 之后可以通过 NewRepositoryServer 或 plugmgr-repo serve 提供 HTTP 服务，
+//	  也可以直接作为本地仓库使用
 func (m *Manager) DeployRepository(repo *PluginRepository, localPath string) error {
-	if err := m.downloadRedbean(localPath); err != nil {
-		return wrap(err, "下载 redbean 失败")
-	}
-
-	cmd := exec.Command(filepath.Join(localPath, "redbean.com"), "-v")
-	if repo.URL != "" {
-		cmd = exec.Command("ssh", "-i", repo.SSHKey, repo.URL, filepath.Join(localPath, "redbean.com"), "-v")
+	if _, err := NewRepositoryServer(localPath, WithServerLogger(m.logger)); err != nil {
+		return wrap(err, "部署仓库失败")
 	}
-
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return wrapf(err, "部署仓库失败: %s", output)
+	if repo.URL == "" {
+		repo.URL = localPath
 	}
 
-	m.logger.Info("仓库部署成功", "output", string(output))
+	m.logger.Info("仓库部署成功", "path", localPath)
 	return nil
 }
 
-// downloadRedbean 下载 redbean 执行文件
-//
-//	参数:
-//	- localPath: 下载文件的本地保存路径
-//	返回:
-//	- error: 下载过程中的错误
-//	功能:
-//	- 从官方地址下载最新版本的 redbean
-//	- 保存文件到指定路径
-//	- 设置适当的文件权限
-func (m *Manager) downloadRedbean(localPath string) error {
-	resp, err := http.Get("https://redbean.dev/redbean-latest.com")
-	if err != nil {
-		return wrap(err, "下载 redbean 失败")
-	}
-	defer resp.Body.Close()
-
-	out, err := os.Create(filepath.Join(localPath, "redbean.com"))
-	if err != nil {
-		return wrap(err, "创建 redbean 文件失败")
+// verifySignature 配置了公钥时验证插件签名，失败时触发 PluginSignatureFailed 事件
+func (m *Manager) verifySignature(name, path string) error {
+	if m.publicKeyPath == "" {
+		return nil
 	}
-	defer out.Close()
-
-	_, err = io.Copy(out, resp.Body)
+	err := m.VerifyPluginSignature(path, m.publicKeyPath)
 	if err != nil {
-		return wrap(err, "保存 redbean 文件失败")
-	}
-
-	if runtime.GOOS != "windows" {
-		if err := os.Chmod(filepath.Join(localPath, "redbean.com"), 0o755); err != nil {
-			return wrap(err, "设置 redbean 执行权限失败")
-		}
-	}
-
-	return nil
+		m.eventBus.PublishAsync(Event{
+			EventName: PluginSignatureFailed,
+			Data: EventData{
+				Name:  name,
+				Data:  PluginSignatureFailedPayload{Path: path},
+				Error: err,
+			},
+		})
+	}
+	return err
 }
 
 // VerifyPluginSignature 验证插件签名
@@ -146,31 +109,34 @@ func (m *Manager) VerifyPluginSignature(pluginPath string, publicKeyPath string)
 		return wrap(err, "读取签名文件失败")
 	}
 
-	publicKeyData, err := os.ReadFile(publicKeyPath)
+	rsaPublicKey, err := loadPublicKey(publicKeyPath)
 	if err != nil {
-		return wrap(err, "读取公钥文件失败")
+		return err
+	}
+
+	return verifyDigest(rsaPublicKey, sha256.Sum256(pluginData), signatureData)
+}
+
+// loadPublicKey 读取 PEM 格式的 RSA 公钥
+func loadPublicKey(path string) (*rsa.PublicKey, error) {
+	publicKeyData, err := os.ReadFile(path)
+	if err != nil {
+		return nil, wrap(err, "读取公钥文件失败")
 	}
 
 	block, _ := pem.Decode(publicKeyData)
 	if block == nil {
-		return newError("解析包含公钥的 PEM 块失败")
+		return nil, newError("解析包含公钥的 PEM 块失败")
 	}
 
 	publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
 	if err != nil {
-		return wrap(err, "解析公钥失败")
+		return nil, wrap(err, "解析公钥失败")
 	}
 
 	rsaPublicKey, ok := publicKey.(*rsa.PublicKey)
 	if !ok {
-		return newError("公钥不是 RSA 公钥")
+		return nil, newError("公钥不是 RSA 公钥")
 	}
-
-	hashed := sha256.Sum256(pluginData)
-	err = rsa.VerifyPKCS1v15(rsaPublicKey, crypto.SHA256, hashed[:], signatureData)
-	if err != nil {
-		return wrap(err, "验证签名失败")
-	}
-
-	return nil
+	return rsaPublicKey, nil
 }
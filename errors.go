@@ -22,7 +22,28 @@ var (
 	ErrIncompatibleVersion    = newPluginError("插件版本不兼容", errTypeValidation)
 	ErrMissingDependency      = newPluginError("缺少插件依赖", errTypeValidation)
 	ErrCircularDependency     = newPluginError("检测到循环依赖", errTypeValidation)
+	ErrPluginHasDependents    = newPluginError("插件仍被其他插件依赖", errTypeValidation)
+	ErrInvalidVersion         = newPluginError("无效的版本号", errTypeValidation)
+	ErrInvalidConstraint      = newPluginError("无效的版本约束", errTypeValidation)
 	ErrPluginSandboxViolation = newPluginError("插件违反沙箱规则", errTypeRuntime)
+	ErrExecutionTimeout       = newPluginError("插件执行超时", errTypeRuntime)
+	ErrPluginProcessExited    = newPluginError("插件进程已退出", errTypeRuntime)
+	ErrResourceLimitExceeded  = newPluginError("插件超出资源限制", errTypeRuntime)
+	ErrCgroupUnavailable      = newPluginError("cgroup 资源限制不可用", errTypeSystem)
+	ErrPermissionDenied       = newPluginError("没有操作权限", errTypeValidation)
+	ErrHostClosed             = newPluginError("宿主服务已失效", errTypeRuntime)
+	ErrInvalidConfig          = newPluginError("插件配置无效", errTypeValidation)
+	ErrConfigCorrupted        = newPluginError("配置数据已损坏", errTypeSystem)
+	ErrConfigRecovered        = newPluginError("配置已回退到最后一个完好的快照", errTypeSystem)
+	ErrRevisionNotFound       = newPluginError("未找到配置修订版本", errTypeValidation)
+	ErrSecretKeyNotFound      = newPluginError("未找到密钥", errTypeSystem)
+	ErrEventDropped           = newPluginError("事件已被丢弃", errTypeRuntime)
+	ErrChecksumMismatch       = newPluginError("插件文件校验和不匹配", errTypeValidation)
+	ErrInvalidSignature       = newPluginError("签名验证失败", errTypeValidation)
+	ErrReleaseExists          = newPluginError("插件版本已存在", errTypeValidation)
+	ErrManifestMismatch       = newPluginError("插件元数据与插件包清单不一致", errTypeValidation)
+	ErrNotLocked              = newPluginError("插件未在锁文件中固定", errTypeValidation)
+	ErrUnsupportedPluginFile  = newPluginError("不支持的插件文件类型", errTypeValidation)
 )
 
 // newError 返回一个带有提供消息的错误
@@ -164,3 +185,8 @@ func (w *withMessage) Error() string {
 func (w *withMessage) Cause() error {
 	return w.cause
 }
+
+// Unwrap 支持 errors.Is 和 errors.As 沿错误链查找
+func (w *withMessage) Unwrap() error {
+	return w.cause
+}
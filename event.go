@@ -1,13 +1,14 @@
 package plugmgr
 
 import (
-	"context"
-	"fmt"
+	"reflect"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 )
 
+// 管理器发布的内置事件，数据类型参见各事件对应的 Payload 结构，可以使用 SubscribeTyped 订阅
 const (
 	PluginLoaded         = "PluginLoaded"
 	PluginInitialized    = "PluginInitialized"
@@ -17,11 +18,25 @@ const (
 	PluginUnloaded       = "PluginUnloaded"
 	PluginExecutionError = "PluginExecutionError"
 	PluginHotReloaded    = "PluginHotReloaded"
+
+	PluginExecutionTimeout      = "PluginExecutionTimeout"
+	PluginResourceLimitExceeded = "PluginResourceLimitExceeded"
+
+	PluginEnabled           = "PluginEnabled"           // 插件被启用，数据为 PluginEnabledPayload
+	PluginDisabled          = "PluginDisabled"          // 插件被禁用，数据为 PluginDisabledPayload
+	PluginInstalled         = "PluginInstalled"         // 插件安装完成，数据为 PluginInstalledPayload
+	PluginRolledBack        = "PluginRolledBack"        // 插件回滚到其他版本，数据为 PluginRolledBackPayload
+	PluginPermissionChanged = "PluginPermissionChanged" // 插件权限被修改或删除，数据为 PluginPermissionChangedPayload
+	PluginSignatureFailed   = "PluginSignatureFailed"   // 插件签名验证失败，数据为 PluginSignatureFailedPayload
+
+	EventDropped = "EventDropped" // 事件未能交给订阅的处理函数，数据为 DroppedEvent
 )
 
 type Event struct {
 	EventName string
 	Data      EventData
+	Seq       uint64    // 事件日志中的序号，未启用事件日志时为 0
+	Time      time.Time // 发布时间
 }
 
 type EventData struct {
@@ -32,128 +47,339 @@ type EventData struct {
 
 type EventHandler func(Event)
 
+// EventFilter 事件过滤条件，返回 false 时不调用订阅的处理函数
+type EventFilter func(Event) bool
+
+// ForPlugins 只接收指定插件的事件
+func ForPlugins(names ...string) EventFilter {
+	set := make(map[string]bool, len(names))
+	for _, name := range names {
+		set[name] = true
+	}
+	return func(e Event) bool {
+		return set[e.Data.Name]
+	}
+}
+
+// OnlyErrors 只接收带有错误的事件
+func OnlyErrors() EventFilter {
+	return func(e Event) bool {
+		return e.Data.Error != nil
+	}
+}
+
+// Subscription 事件订阅
+//
+//	订阅的事件名称可以包含通配符 *，匹配任意长度的字符，例如 "Plugin*" 和 "*"。
+type Subscription struct {
+	bus      *eventBus
+	pattern  string
+	handler  EventHandler
+	filters  []EventFilter
+	canceled atomic.Bool
+
+	mu        sync.Mutex
+	notFull   *sync.Cond // 队列有空位时通知阻塞的发布者
+	queue     []Event    // 等待处理的事件，按发布顺序排列
+	scheduled bool       // 订阅已在待处理列表中或正在被处理
+	dropped   atomic.Uint64
+}
+
+// Pattern 返回订阅的事件名称或通配符模式
+func (s *Subscription) Pattern() string {
+	return s.pattern
+}
+
+// QueueDepth 返回等待处理的事件数量
+func (s *Subscription) QueueDepth() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.queue)
+}
+
+// Dropped 返回该订阅丢弃的事件数量
+func (s *Subscription) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// Cancel 取消订阅，可以重复调用
+//
+//	取消后不再调用处理函数，队列中尚未处理的事件被丢弃，已经开始执行的处理函数不受影响。
+func (s *Subscription) Cancel() {
+	if s.canceled.Swap(true) {
+		return
+	}
+	s.bus.remove(s)
+}
+
+// accepts 检查事件是否满足订阅的所有过滤条件
+func (s *Subscription) accepts(event Event) bool {
+	if s.canceled.Load() {
+		return false
+	}
+	for _, filter := range s.filters {
+		if !filter(event) {
+			return false
+		}
+	}
+	return true
+}
+
+// eventBus 事件总线
+//
+//	每个订阅拥有独立的 FIFO 队列，固定数量的工作协程轮流处理有事件的订阅，
+//	同一订阅同时只有一个工作协程处理，因此每个订阅按发布顺序收到事件。
 type eventBus struct {
-	mu       sync.RWMutex
-	closed   atomic.Bool
-	timeout  time.Duration
-	handlers map[string][]EventHandler
+	mu        sync.RWMutex
+	closed    atomic.Bool
+	timeout   atomic.Int64               // 处理函数超时时间
+	handlers  map[string][]*Subscription // 按事件名称精确订阅
+	wildcards []*Subscription            // 包含通配符的订阅
+
+	options eventBusOptions
+	start   sync.Once
+
+	journal   *EventJournal // 事件日志，未启用时为 nil
+	publishMu sync.Mutex    // 保证写入日志与获取订阅的原子性
+
+	readyMu  sync.Mutex
+	readyCnd *sync.Cond      // 有待处理的订阅或总线停止时通知工作协程
+	idleCnd  *sync.Cond      // 事件全部处理完成或总线停止时通知 Close
+	ready    []*Subscription // 有待处理事件的订阅
+	pending  int             // 队列中和正在处理的事件数量
+	stopping bool            // 工作协程停止领取新的订阅
+
+	delivered atomic.Uint64
+	dropped   atomic.Uint64
+	panics    atomic.Uint64
+	timeouts  atomic.Uint64
 }
 
 // newEventBus 创建新的事件总线
-func newEventBus() *eventBus {
-	return &eventBus{
-		handlers: make(map[string][]EventHandler),
-		timeout:  5 * time.Second, // 默认超时时间
+func newEventBus(opts ...EventBusOption) *eventBus {
+	options := eventBusOptions{
+		workers:        defaultEventWorkers,
+		queueSize:      defaultEventQueueSize,
+		overflow:       OverflowDropOldest,
+		handlerTimeout: defaultHandlerTimeout,
+		drainTimeout:   defaultDrainTimeout,
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	eb := &eventBus{
+		handlers: make(map[string][]*Subscription),
+		options:  options,
 	}
+	eb.readyCnd = sync.NewCond(&eb.readyMu)
+	eb.idleCnd = sync.NewCond(&eb.readyMu)
+	eb.timeout.Store(int64(options.handlerTimeout))
+	return eb
 }
 
-// SetTimeout 设置事件处理超时时间
+// SetTimeout 设置事件处理超时时间，0 表示不限制
 func (eb *eventBus) SetTimeout(timeout time.Duration) {
-	eb.timeout = timeout
+	eb.timeout.Store(int64(timeout))
 }
 
 // Subscribe 订阅事件
-func (eb *eventBus) Subscribe(eventName string, handler EventHandler) {
+//
+//	参数:
+//	- eventName: 事件名称，可以包含通配符 *
+//	- handler: 事件处理函数
+//	- filters: 过滤条件，全部满足时才调用处理函数
+//	返回:
+//	- *Subscription: 订阅句柄，调用 Cancel 取消订阅
+func (eb *eventBus) Subscribe(eventName string, handler EventHandler, filters ...EventFilter) *Subscription {
 	eb.mu.Lock()
 	defer eb.mu.Unlock()
-	eb.handlers[eventName] = append(eb.handlers[eventName], handler)
+
+	sub := &Subscription{
+		bus:     eb,
+		pattern: eventName,
+		handler: handler,
+		filters: filters,
+	}
+	sub.notFull = sync.NewCond(&sub.mu)
+	if strings.Contains(eventName, "*") {
+		eb.wildcards = append(eb.wildcards, sub)
+	} else {
+		eb.handlers[eventName] = append(eb.handlers[eventName], sub)
+	}
+	return sub
 }
 
 // Unsubscribe 取消订阅事件
+//
+//	按处理函数的代码地址查找订阅，同一函数字面量创建的多个闭包无法区分，
+//	此时取消最早的一个订阅。需要可靠地取消订阅时使用 Subscribe 返回的 Subscription。
 func (eb *eventBus) Unsubscribe(eventName string, handler EventHandler) {
+	target := reflect.ValueOf(handler).Pointer()
+
+	eb.mu.RLock()
+	subs := eb.handlers[eventName]
+	if strings.Contains(eventName, "*") {
+		subs = eb.wildcards
+	}
+	var found *Subscription
+	for _, sub := range subs {
+		if sub.pattern == eventName && reflect.ValueOf(sub.handler).Pointer() == target {
+			found = sub
+			break
+		}
+	}
+	eb.mu.RUnlock()
+
+	if found != nil {
+		found.Cancel()
+	}
+}
+
+// remove 删除订阅并丢弃队列中尚未处理的事件
+func (eb *eventBus) remove(sub *Subscription) {
+	defer eb.discard(sub, false)
+
 	eb.mu.Lock()
 	defer eb.mu.Unlock()
 
-	handlers := eb.handlers[eventName]
-	for i, h := range handlers {
-		if fmt.Sprintf("%p", h) == fmt.Sprintf("%p", handler) {
-			eb.handlers[eventName] = append(handlers[:i], handlers[i+1:]...)
-			break
+	if strings.Contains(sub.pattern, "*") {
+		eb.wildcards = removeSubscription(eb.wildcards, sub)
+		return
+	}
+	if subs := removeSubscription(eb.handlers[sub.pattern], sub); len(subs) > 0 {
+		eb.handlers[sub.pattern] = subs
+	} else {
+		delete(eb.handlers, sub.pattern)
+	}
+}
+
+// removeSubscription 返回删除 sub 后的新切片，不修改原切片
+func removeSubscription(subs []*Subscription, sub *Subscription) []*Subscription {
+	out := make([]*Subscription, 0, len(subs))
+	for _, s := range subs {
+		if s != sub {
+			out = append(out, s)
 		}
 	}
+	return out
+}
+
+// matchEventName 检查事件名称是否匹配订阅模式，* 匹配任意长度的字符
+func matchEventName(pattern, name string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == name
+	}
+	if !strings.HasPrefix(name, parts[0]) {
+		return false
+	}
+	name = name[len(parts[0]):]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(name, part)
+		if i < 0 {
+			return false
+		}
+		name = name[i+len(part):]
+	}
+	return strings.HasSuffix(name, parts[len(parts)-1])
 }
 
 // Close 关闭事件总线
+//
+//	关闭后不再接受新的事件，在 WithDrainTimeout 设置的时间内等待队列中的事件处理完成，
+//	超时后丢弃剩余的事件并返回 ErrEventDropped。
 func (eb *eventBus) Close() error {
 	if eb.closed.Swap(true) {
 		return newError("事件总线已经关闭")
 	}
+
+	drained := make(chan struct{})
+	go func() {
+		eb.readyMu.Lock()
+		for eb.pending > 0 && !eb.stopping {
+			eb.idleCnd.Wait()
+		}
+		eb.readyMu.Unlock()
+		close(drained)
+	}()
+
+	timer := time.NewTimer(eb.options.drainTimeout)
+	defer timer.Stop()
+	select {
+	case <-drained:
+	case <-timer.C:
+	}
+
+	before := eb.dropped.Load()
+	eb.stop()
+	<-drained
+	if n := eb.dropped.Load() - before; n > 0 {
+		return wrapf(ErrEventDropped, "关闭事件总线时丢弃了 %d 个未处理的事件", n)
+	}
 	return nil
 }
 
-// PublishAsync 异步发布事件，带超时控制
+// PublishAsync 异步发布事件
+//
+//	事件放入每个匹配订阅的队列后立即返回，队列已满时按 WithEventQueue 设置的策略处理。
 func (eb *eventBus) PublishAsync(event Event) error {
 	if eb.closed.Load() {
 		return newError("事件总线已经关闭")
 	}
 
-	handlers := eb.getHandlers(event.EventName)
-	if len(handlers) == 0 {
-		return nil
-	}
-
-	for _, handler := range handlers {
-		go eb.executeHandlerWithTimeout(handler, event)
+	event, subs, err := eb.record(event)
+	for _, sub := range subs {
+		if sub.accepts(event) {
+			eb.enqueue(sub, event, eb.options.overflow)
+		}
 	}
-	return nil
+	return err
 }
 
 // Publish 同步发布事件
+//
+//	在调用方的协程中依次调用处理函数，处理函数发生 panic 时报告为丢弃的事件。
 func (eb *eventBus) Publish(event Event) error {
 	if eb.closed.Load() {
 		return newError("事件总线已经关闭")
 	}
 
-	handlers := eb.getHandlers(event.EventName)
-	if len(handlers) == 0 {
-		return nil
-	}
-
-	for _, handler := range handlers {
-		handler(event)
-	}
-	return nil
-}
-
-// executeHandlerWithTimeout 带超时控制的事件处理
-func (eb *eventBus) executeHandlerWithTimeout(handler EventHandler, event Event) {
-	ctx, cancel := context.WithTimeout(context.Background(), eb.timeout)
-	defer cancel()
-
-	done := make(chan struct{}, 1)
-	go func() {
-		handler(event)
-		done <- struct{}{}
-	}()
-
-	select {
-	case <-done:
-		// 处理完成
-	case <-ctx.Done():
-		// 处理超时
+	event, subs, err := eb.record(event)
+	for _, sub := range subs {
+		if sub.accepts(event) {
+			if r := eb.call(sub, event); r != nil {
+				eb.panics.Add(1)
+				eb.reportDropped(sub, event, DropReasonPanic, newErrorf("事件处理函数发生 panic: %v", r))
+			} else {
+				eb.delivered.Add(1)
+			}
+		}
 	}
+	return err
 }
 
-// getHandlers 获取特定事件的处理器
-func (eb *eventBus) getHandlers(eventName string) []EventHandler {
+// subscribers 获取订阅了特定事件的订阅，精确订阅在前，通配符订阅在后
+func (eb *eventBus) subscribers(eventName string) []*Subscription {
 	eb.mu.RLock()
 	defer eb.mu.RUnlock()
 
-	handlers := make([]EventHandler, len(eb.handlers[eventName]))
-	copy(handlers, eb.handlers[eventName])
-	return handlers
+	subs := make([]*Subscription, len(eb.handlers[eventName]), len(eb.handlers[eventName])+len(eb.wildcards))
+	copy(subs, eb.handlers[eventName])
+	for _, sub := range eb.wildcards {
+		if matchEventName(sub.pattern, eventName) {
+			subs = append(subs, sub)
+		}
+	}
+	return subs
 }
 
-// HasSubscribers 检查事件是否有订阅者
+// HasSubscribers 检查事件是否有订阅者，包括匹配该事件的通配符订阅
 func (eb *eventBus) HasSubscribers(eventName string) bool {
-	eb.mu.RLock()
-	defer eb.mu.RUnlock()
-	return len(eb.handlers[eventName]) > 0
+	return eb.SubscribersCount(eventName) > 0
 }
 
-// SubscribersCount 获取事件订阅者数量
+// SubscribersCount 获取事件订阅者数量，包括匹配该事件的通配符订阅
 func (eb *eventBus) SubscribersCount(eventName string) int {
-	eb.mu.RLock()
-	defer eb.mu.RUnlock()
-	return len(eb.handlers[eventName])
+	return len(eb.subscribers(eventName))
 }
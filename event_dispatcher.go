@@ -0,0 +1,408 @@
+package plugmgr
+
+import "time"
+
+// 事件分发的默认配置
+const (
+	defaultEventWorkers   = 4
+	defaultEventQueueSize = 256
+	defaultHandlerTimeout = 5 * time.Second
+	defaultDrainTimeout   = 5 * time.Second
+)
+
+// OverflowPolicy 订阅队列已满时的处理策略
+type OverflowPolicy int
+
+const (
+	OverflowBlock      OverflowPolicy = iota // 阻塞发布者直到队列有空位，处理函数向自己的订阅发布事件时可能死锁
+	OverflowDropOldest                       // 丢弃队列中最早的事件
+	OverflowDropNewest                       // 丢弃新发布的事件
+)
+
+// 事件被丢弃的原因
+const (
+	DropReasonOverflow = "overflow" // 订阅队列已满
+	DropReasonTimeout  = "timeout"  // 处理函数超时
+	DropReasonPanic    = "panic"    // 处理函数发生 panic
+	DropReasonClosed   = "closed"   // 事件总线关闭时仍未处理
+)
+
+// DroppedEvent EventDropped 事件的数据
+type DroppedEvent struct {
+	Event   Event  // 被丢弃的事件
+	Pattern string // 订阅的事件名称或通配符模式
+	Reason  string // 丢弃原因，DropReason 常量之一
+}
+
+// EventBusStats 事件总线的运行指标
+type EventBusStats struct {
+	Workers    int    // 工作协程数量
+	QueueDepth int    // 所有订阅队列中等待处理的事件数量
+	Delivered  uint64 // 处理完成的事件数量
+	Dropped    uint64 // 丢弃的事件数量，包括超时和 panic
+	Timeouts   uint64 // 处理函数超时次数
+	Panics     uint64 // 处理函数 panic 次数
+}
+
+// EventBusOption 事件总线选项
+type EventBusOption func(*eventBusOptions)
+
+type eventBusOptions struct {
+	workers        int
+	queueSize      int
+	overflow       OverflowPolicy
+	handlerTimeout time.Duration
+	drainTimeout   time.Duration
+}
+
+// WithEventWorkers 设置处理事件的工作协程数量，默认 4
+func WithEventWorkers(n int) EventBusOption {
+	return func(o *eventBusOptions) {
+		if n > 0 {
+			o.workers = n
+		}
+	}
+}
+
+// WithEventQueue 设置每个订阅的队列长度和队列已满时的策略，默认 256 和 OverflowDropOldest
+//
+//	管理器在加载、执行插件和更新配置时发布事件，使用 OverflowBlock 时这些操作会等待处理慢的订阅。
+func WithEventQueue(size int, policy OverflowPolicy) EventBusOption {
+	return func(o *eventBusOptions) {
+		if size > 0 {
+			o.queueSize = size
+		}
+		o.overflow = policy
+	}
+}
+
+// WithHandlerTimeout 设置事件处理函数的超时时间，默认 5 秒，0 表示不限制
+//
+//	超时的事件报告为丢弃，工作协程继续处理其他订阅的事件，超时的处理函数在后台运行到结束，
+//	结束之前同一订阅的后续事件不会开始处理。
+func WithHandlerTimeout(timeout time.Duration) EventBusOption {
+	return func(o *eventBusOptions) {
+		o.handlerTimeout = timeout
+	}
+}
+
+// WithDrainTimeout 设置关闭事件总线时等待队列清空的时间，默认 5 秒
+func WithDrainTimeout(timeout time.Duration) EventBusOption {
+	return func(o *eventBusOptions) {
+		o.drainTimeout = timeout
+	}
+}
+
+// WithEventBus 设置管理器事件总线的选项
+func WithEventBus(opts ...EventBusOption) ManagerOption {
+	return func(o *managerOptions) {
+		o.eventBus = append(o.eventBus, opts...)
+	}
+}
+
+// Stats 返回事件总线的运行指标
+func (eb *eventBus) Stats() EventBusStats {
+	eb.mu.RLock()
+	subs := append([]*Subscription(nil), eb.wildcards...)
+	for _, handlers := range eb.handlers {
+		subs = append(subs, handlers...)
+	}
+	eb.mu.RUnlock()
+
+	stats := EventBusStats{
+		Workers:   eb.options.workers,
+		Delivered: eb.delivered.Load(),
+		Dropped:   eb.dropped.Load(),
+		Timeouts:  eb.timeouts.Load(),
+		Panics:    eb.panics.Load(),
+	}
+	for _, sub := range subs {
+		stats.QueueDepth += sub.QueueDepth()
+	}
+	return stats
+}
+
+// enqueue 将事件放入订阅的队列，需要时安排工作协程处理该订阅
+//
+//	锁的顺序为 Subscription.mu -> eventBus.readyMu。
+func (eb *eventBus) enqueue(sub *Subscription, event Event, policy OverflowPolicy) {
+	eb.start.Do(eb.startWorkers)
+
+	var dropped []Event
+	defer func() {
+		for _, e := range dropped {
+			eb.reportDropped(sub, e, DropReasonOverflow, nil)
+		}
+	}()
+
+	sub.mu.Lock()
+	for len(sub.queue) >= eb.options.queueSize && !sub.canceled.Load() {
+		if policy == OverflowBlock && eb.isStopping() {
+			policy = OverflowDropNewest
+		}
+		switch policy {
+		case OverflowDropOldest:
+			dropped = append(dropped, sub.queue[0])
+			sub.queue[0] = Event{}
+			sub.queue = sub.queue[1:]
+			eb.finish(1)
+		case OverflowDropNewest:
+			sub.mu.Unlock()
+			dropped = append(dropped, event)
+			return
+		default:
+			sub.notFull.Wait()
+		}
+	}
+	if sub.canceled.Load() {
+		sub.mu.Unlock()
+		return
+	}
+
+	sub.queue = append(sub.queue, event)
+	eb.readyMu.Lock()
+	eb.pending++
+	eb.readyMu.Unlock()
+
+	schedule := !sub.scheduled
+	sub.scheduled = true
+	sub.mu.Unlock()
+
+	if schedule && !eb.schedule(sub) {
+		eb.discard(sub, true)
+	}
+}
+
+// prefill 将回放的事件放入刚创建的订阅的队列，不受队列长度限制
+func (eb *eventBus) prefill(sub *Subscription, events []Event) {
+	eb.start.Do(eb.startWorkers)
+
+	sub.mu.Lock()
+	sub.queue = append(events, sub.queue...)
+	eb.readyMu.Lock()
+	eb.pending += len(events)
+	eb.readyMu.Unlock()
+
+	schedule := !sub.scheduled
+	sub.scheduled = true
+	sub.mu.Unlock()
+
+	if schedule && !eb.schedule(sub) {
+		eb.discard(sub, true)
+	}
+}
+
+// schedule 将订阅加入待处理列表，总线已停止时返回 false
+func (eb *eventBus) schedule(sub *Subscription) bool {
+	eb.readyMu.Lock()
+	defer eb.readyMu.Unlock()
+
+	if eb.stopping {
+		return false
+	}
+	eb.ready = append(eb.ready, sub)
+	eb.readyCnd.Signal()
+	return true
+}
+
+// finish 减少未完成的事件数量，全部完成时通知等待关闭的协程
+func (eb *eventBus) finish(n int) {
+	if n == 0 {
+		return
+	}
+	eb.readyMu.Lock()
+	defer eb.readyMu.Unlock()
+
+	eb.pending -= n
+	if eb.pending == 0 {
+		eb.idleCnd.Broadcast()
+	}
+}
+
+func (eb *eventBus) isStopping() bool {
+	eb.readyMu.Lock()
+	defer eb.readyMu.Unlock()
+	return eb.stopping
+}
+
+func (eb *eventBus) startWorkers() {
+	for i := 0; i < eb.options.workers; i++ {
+		go eb.worker()
+	}
+}
+
+// worker 每次从待处理列表取出一个订阅并处理其队列中最早的事件
+//
+//	订阅处理完一个事件后若仍有事件则重新排到列表末尾，各订阅轮流获得处理机会。
+func (eb *eventBus) worker() {
+	for {
+		eb.readyMu.Lock()
+		for len(eb.ready) == 0 && !eb.stopping {
+			eb.readyCnd.Wait()
+		}
+		if eb.stopping {
+			eb.readyMu.Unlock()
+			return
+		}
+		sub := eb.ready[0]
+		eb.ready[0] = nil
+		eb.ready = eb.ready[1:]
+		eb.readyMu.Unlock()
+
+		sub.mu.Lock()
+		if len(sub.queue) == 0 {
+			sub.scheduled = false
+			sub.mu.Unlock()
+			continue
+		}
+		event := sub.queue[0]
+		sub.queue[0] = Event{}
+		sub.queue = sub.queue[1:]
+		sub.notFull.Signal()
+		sub.mu.Unlock()
+
+		abandoned := eb.deliver(sub, event)
+		eb.finish(1)
+
+		if abandoned != nil {
+			// 超时的处理函数返回之前订阅保持已调度状态，后续事件不会与其并发执行
+			go func() {
+				<-abandoned
+				eb.release(sub)
+			}()
+			continue
+		}
+		eb.release(sub)
+	}
+}
+
+// release 订阅处理完一个事件后调用，队列中仍有事件时重新加入待处理列表
+func (eb *eventBus) release(sub *Subscription) {
+	sub.mu.Lock()
+	more := len(sub.queue) > 0
+	sub.scheduled = more
+	sub.mu.Unlock()
+
+	if more && !eb.schedule(sub) {
+		eb.discard(sub, true)
+	}
+}
+
+// deliver 调用订阅的处理函数，处理函数超时或 panic 时报告为丢弃的事件
+//
+//	处理函数超时后返回其结束时关闭的通道，工作协程不再等待，否则返回 nil。
+func (eb *eventBus) deliver(sub *Subscription, event Event) <-chan any {
+	if sub.canceled.Load() {
+		return nil
+	}
+
+	timeout := time.Duration(eb.timeout.Load())
+	if timeout <= 0 {
+		eb.handled(sub, event, eb.call(sub, event))
+		return nil
+	}
+
+	done := make(chan any, 1)
+	go func() {
+		done <- eb.call(sub, event)
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case r := <-done:
+		eb.handled(sub, event, r)
+		return nil
+	case <-timer.C:
+		eb.timeouts.Add(1)
+		eb.reportDropped(sub, event, DropReasonTimeout, newErrorf("事件处理函数超时(%s)", timeout))
+		return done
+	}
+}
+
+// handled 记录处理函数的执行结果，recovered 为处理函数 panic 的值
+func (eb *eventBus) handled(sub *Subscription, event Event, recovered any) {
+	if recovered == nil {
+		eb.delivered.Add(1)
+		return
+	}
+	eb.panics.Add(1)
+	eb.reportDropped(sub, event, DropReasonPanic, newErrorf("事件处理函数发生 panic: %v", recovered))
+}
+
+// call 调用处理函数并恢复 panic
+func (eb *eventBus) call(sub *Subscription, event Event) (recovered any) {
+	defer func() {
+		recovered = recover()
+	}()
+	sub.handler(event)
+	return nil
+}
+
+// reportDropped 记录丢弃的事件并发布 EventDropped 事件
+//
+//	EventDropped 事件本身被丢弃时只计数，不再发布，避免循环。
+//	EventDropped 事件在订阅队列已满时总是丢弃，不会阻塞工作协程。
+func (eb *eventBus) reportDropped(sub *Subscription, event Event, reason string, cause error) {
+	sub.dropped.Add(1)
+	eb.dropped.Add(1)
+	if event.EventName == EventDropped || eb.closed.Load() {
+		return
+	}
+
+	err := wrapf(ErrEventDropped, "订阅 %s 丢弃了事件 %s(%s)", sub.pattern, event.EventName, reason)
+	if cause != nil {
+		err = wrapf(ErrEventDropped, "订阅 %s 丢弃了事件 %s: %v", sub.pattern, event.EventName, cause)
+	}
+	dropped := Event{
+		EventName: EventDropped,
+		Data: EventData{
+			Name:  event.Data.Name,
+			Data:  DroppedEvent{Event: event, Pattern: sub.pattern, Reason: reason},
+			Error: err,
+		},
+	}
+	dropped, subs, _ := eb.record(dropped)
+	for _, s := range subs {
+		if s.accepts(dropped) {
+			eb.enqueue(s, dropped, OverflowDropNewest)
+		}
+	}
+}
+
+// discard 丢弃订阅队列中的所有事件，report 为 true 时计为因总线关闭而丢弃
+func (eb *eventBus) discard(sub *Subscription, report bool) {
+	sub.mu.Lock()
+	events := sub.queue
+	sub.queue = nil
+	sub.notFull.Broadcast()
+	sub.mu.Unlock()
+
+	if report {
+		for _, event := range events {
+			eb.reportDropped(sub, event, DropReasonClosed, nil)
+		}
+	}
+	eb.finish(len(events))
+}
+
+// stop 停止工作协程，丢弃所有订阅中尚未开始处理的事件并唤醒阻塞的发布者
+func (eb *eventBus) stop() {
+	eb.readyMu.Lock()
+	eb.stopping = true
+	eb.ready = nil
+	eb.readyCnd.Broadcast()
+	eb.idleCnd.Broadcast()
+	eb.readyMu.Unlock()
+
+	eb.mu.RLock()
+	subs := append([]*Subscription(nil), eb.wildcards...)
+	for _, handlers := range eb.handlers {
+		subs = append(subs, handlers...)
+	}
+	eb.mu.RUnlock()
+
+	for _, sub := range subs {
+		eb.discard(sub, true)
+	}
+}
@@ -0,0 +1,254 @@
+package plugmgr
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// blockingHandler 处理第一个事件时阻塞，直到 release 被关闭
+type blockingHandler struct {
+	mu       sync.Mutex
+	received []int
+	started  chan struct{}
+	release  chan struct{}
+}
+
+func newBlockingHandler() *blockingHandler {
+	return &blockingHandler{started: make(chan struct{}), release: make(chan struct{})}
+}
+
+func (h *blockingHandler) handle(e Event) {
+	h.mu.Lock()
+	h.received = append(h.received, e.Data.Data.(int))
+	first := len(h.received) == 1
+	h.mu.Unlock()
+	if first {
+		close(h.started)
+		<-h.release
+	}
+}
+
+func (h *blockingHandler) values() []int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]int(nil), h.received...)
+}
+
+func publishInts(eb *eventBus, values ...int) {
+	for _, v := range values {
+		eb.PublishAsync(Event{EventName: "test", Data: EventData{Data: v}})
+	}
+}
+
+func TestEventBusPerSubscriberOrder(t *testing.T) {
+	eb := newEventBus(WithEventWorkers(8))
+
+	var mu sync.Mutex
+	received := make(map[string][]int)
+	for _, name := range []string{"a", "b", "c"} {
+		name := name
+		eb.Subscribe("test", func(e Event) {
+			mu.Lock()
+			defer mu.Unlock()
+			received[name] = append(received[name], e.Data.Data.(int))
+		})
+	}
+
+	want := make([]int, 200)
+	for i := range want {
+		want[i] = i
+	}
+	publishInts(eb, want...)
+	if err := eb.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, got := range received {
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("订阅 %s 收到的事件顺序不正确: %v", name, got)
+		}
+	}
+	if stats := eb.Stats(); stats.Delivered != 600 || stats.QueueDepth != 0 {
+		t.Fatalf("指标不正确: %+v", stats)
+	}
+}
+
+func TestEventBusPanicAndTimeout(t *testing.T) {
+	eb := newEventBus(WithHandlerTimeout(20 * time.Millisecond))
+
+	dropped := make(chan DroppedEvent, 4)
+	eb.Subscribe(EventDropped, func(e Event) {
+		if !errors.Is(e.Data.Error, ErrEventDropped) {
+			t.Errorf("EventDropped 应带有 ErrEventDropped, 得到 %v", e.Data.Error)
+		}
+		dropped <- e.Data.Data.(DroppedEvent)
+	})
+
+	var mu sync.Mutex
+	var received []int
+	eb.Subscribe("test", func(e Event) {
+		switch v := e.Data.Data.(int); v {
+		case 1:
+			panic("boom")
+		case 2:
+			time.Sleep(200 * time.Millisecond)
+		default:
+			mu.Lock()
+			received = append(received, v)
+			mu.Unlock()
+		}
+	})
+
+	publishInts(eb, 1, 2, 3)
+	for _, reason := range []string{DropReasonPanic, DropReasonTimeout} {
+		select {
+		case d := <-dropped:
+			if d.Reason != reason || d.Pattern != "test" {
+				t.Fatalf("期望原因 %s, 得到 %+v", reason, d)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("等待 %s 的 EventDropped 事件超时", reason)
+		}
+	}
+	waitFor(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(received) == 1
+	})
+
+	stats := eb.Stats()
+	if stats.Panics != 1 || stats.Timeouts != 1 || stats.Dropped != 2 {
+		t.Fatalf("指标不正确: %+v", stats)
+	}
+}
+
+func TestEventBusTimeoutKeepsOrder(t *testing.T) {
+	eb := newEventBus(WithHandlerTimeout(20 * time.Millisecond))
+	h := newBlockingHandler()
+	eb.Subscribe("test", h.handle)
+
+	publishInts(eb, 1, 2)
+	<-h.started
+	waitFor(t, func() bool { return eb.Stats().Timeouts == 1 })
+
+	// 超时的处理函数返回之前不处理同一订阅的后续事件
+	time.Sleep(50 * time.Millisecond)
+	if got := h.values(); !reflect.DeepEqual(got, []int{1}) {
+		t.Fatalf("超时的处理函数返回前不应处理后续事件, 得到 %v", got)
+	}
+
+	close(h.release)
+	waitFor(t, func() bool { return reflect.DeepEqual(h.values(), []int{1, 2}) })
+}
+
+func TestEventBusOverflowPolicies(t *testing.T) {
+	tests := []struct {
+		policy OverflowPolicy
+		want   []int
+	}{
+		{OverflowDropOldest, []int{1, 4, 5}},
+		{OverflowDropNewest, []int{1, 2, 3}},
+	}
+	for _, tt := range tests {
+		eb := newEventBus(WithEventQueue(2, tt.policy))
+		h := newBlockingHandler()
+		sub := eb.Subscribe("test", h.handle)
+
+		publishInts(eb, 1)
+		<-h.started
+		publishInts(eb, 2, 3, 4, 5)
+		if sub.QueueDepth() != 2 || sub.Dropped() != 2 {
+			t.Fatalf("策略 %d: 队列长度 %d, 丢弃 %d", tt.policy, sub.QueueDepth(), sub.Dropped())
+		}
+
+		close(h.release)
+		if err := eb.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if got := h.values(); !reflect.DeepEqual(got, tt.want) {
+			t.Fatalf("策略 %d: 期望 %v, 得到 %v", tt.policy, tt.want, got)
+		}
+	}
+}
+
+func TestEventBusDefaultPolicyDoesNotBlock(t *testing.T) {
+	eb := newEventBus()
+	h := newBlockingHandler()
+	eb.Subscribe("test", h.handle)
+
+	publishInts(eb, 0)
+	<-h.started
+	published := make(chan struct{})
+	go func() {
+		for i := 1; i <= defaultEventQueueSize+10; i++ {
+			publishInts(eb, i)
+		}
+		close(published)
+	}()
+	select {
+	case <-published:
+	case <-time.After(time.Second):
+		t.Fatal("默认策略下处理慢的订阅不应阻塞发布者")
+	}
+	close(h.release)
+	if dropped := eb.Close(); dropped != nil {
+		t.Fatal(dropped)
+	}
+	if got := eb.Stats().Dropped; got != 10 {
+		t.Fatalf("期望丢弃最早的 10 个事件, 得到 %d", got)
+	}
+}
+
+func TestEventBusBlockPolicy(t *testing.T) {
+	eb := newEventBus(WithEventQueue(1, OverflowBlock))
+	h := newBlockingHandler()
+	eb.Subscribe("test", h.handle)
+
+	publishInts(eb, 1)
+	<-h.started
+	publishInts(eb, 2)
+
+	published := make(chan struct{})
+	go func() {
+		publishInts(eb, 3)
+		close(published)
+	}()
+	select {
+	case <-published:
+		t.Fatal("队列已满时发布者应被阻塞")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(h.release)
+	<-published
+	if err := eb.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := h.values(); !reflect.DeepEqual(got, []int{1, 2, 3}) {
+		t.Fatalf("期望按顺序收到所有事件, 得到 %v", got)
+	}
+}
+
+func TestEventBusCloseDeadline(t *testing.T) {
+	eb := newEventBus(WithDrainTimeout(20*time.Millisecond), WithHandlerTimeout(0))
+	h := newBlockingHandler()
+	sub := eb.Subscribe("test", h.handle)
+	defer close(h.release)
+
+	publishInts(eb, 1)
+	<-h.started
+	publishInts(eb, 2, 3)
+
+	if err := eb.Close(); !errors.Is(err, ErrEventDropped) {
+		t.Fatalf("超过等待时间时应返回 ErrEventDropped, 得到 %v", err)
+	}
+	if sub.Dropped() != 2 || sub.QueueDepth() != 0 {
+		t.Fatalf("未处理的事件应被丢弃: 丢弃 %d, 队列长度 %d", sub.Dropped(), sub.QueueDepth())
+	}
+	if err := eb.PublishAsync(Event{EventName: "test"}); err == nil {
+		t.Fatal("关闭后发布事件应返回错误")
+	}
+}
@@ -0,0 +1,556 @@
+package plugmgr
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 事件日志的默认配置
+const (
+	defaultJournalSegmentSize = 16 << 20 // 单个日志段的最大字节数
+	defaultJournalSegments    = 8        // 保留的日志段数量
+)
+
+// 日志段文件名: events-<第一条记录的序号>.jsonl
+const (
+	journalSegmentPrefix = "events-"
+	journalSegmentExt    = ".jsonl"
+)
+
+// EventError 事件日志中结构化保存的事件错误
+//
+//	回放的事件中 EventData.Error 为 *EventError，errors.Is 可以匹配错误链中的
+//	ErrExecutionTimeout 等插件错误。
+type EventError struct {
+	Message string   `json:"message"`         // 完整的错误信息
+	Type    string   `json:"type,omitempty"`  // 错误链中第一个 PluginError 的类型
+	Chain   []string `json:"chain,omitempty"` // 错误链中每一层附加的信息，从外到内
+}
+
+// newEventError 将错误转换为可序列化的结构
+func newEventError(err error) *EventError {
+	if err == nil {
+		return nil
+	}
+	if e, ok := err.(*EventError); ok {
+		return e
+	}
+
+	e := &EventError{Message: err.Error()}
+	for cur := err; cur != nil; cur = errors.Unwrap(cur) {
+		switch v := cur.(type) {
+		case *withMessage:
+			e.Chain = append(e.Chain, v.msg)
+		case *PluginError:
+			if e.Type == "" {
+				e.Type = v.Type()
+			}
+			e.Chain = append(e.Chain, v.Error())
+		default:
+			e.Chain = append(e.Chain, cur.Error())
+		}
+	}
+	return e
+}
+
+// Error 实现 error 接口
+func (e *EventError) Error() string {
+	return e.Message
+}
+
+// Is 检查错误链中是否包含 target，只用于匹配 ErrPluginNotFound 等插件错误
+func (e *EventError) Is(target error) bool {
+	pe, ok := target.(*PluginError)
+	if !ok {
+		return false
+	}
+	for _, msg := range e.Chain {
+		if msg == pe.Error() {
+			return true
+		}
+	}
+	return false
+}
+
+// journalRecord 日志中的一条事件记录，每条记录占一行
+type journalRecord struct {
+	Seq    uint64          `json:"seq"`
+	Time   time.Time       `json:"time"`
+	Event  string          `json:"event"`
+	Plugin string          `json:"plugin,omitempty"`
+	Data   json.RawMessage `json:"data,omitempty"`
+	Error  *EventError     `json:"error,omitempty"`
+}
+
+// event 将记录还原为事件，Data 为 JSON 解码后的值
+func (r *journalRecord) event() Event {
+	e := Event{
+		EventName: r.Event,
+		Seq:       r.Seq,
+		Time:      r.Time,
+		Data:      EventData{Name: r.Plugin},
+	}
+	if len(r.Data) > 0 {
+		_ = json.Unmarshal(r.Data, &e.Data.Data)
+	}
+	if r.Error != nil {
+		e.Data.Error = r.Error
+	}
+	return e
+}
+
+// EventQuery 事件日志的查询条件，零值字段不限制
+type EventQuery struct {
+	Plugin     string    // 插件名称
+	EventNames []string  // 事件名称，可以包含通配符 *
+	FromSeq    uint64    // 起始序号(包含)
+	Since      time.Time // 起始时间(包含)
+	Until      time.Time // 结束时间(不包含)
+	Limit      int       // 最多返回的事件数量
+}
+
+// match 检查事件是否满足查询条件
+func (q *EventQuery) match(r *journalRecord) bool {
+	if r.Seq < q.FromSeq {
+		return false
+	}
+	if q.Plugin != "" && r.Plugin != q.Plugin {
+		return false
+	}
+	if !q.Since.IsZero() && r.Time.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && !r.Time.Before(q.Until) {
+		return false
+	}
+	if len(q.EventNames) == 0 {
+		return true
+	}
+	for _, pattern := range q.EventNames {
+		if matchEventName(pattern, r.Event) {
+			return true
+		}
+	}
+	return false
+}
+
+// EventJournalOption 事件日志选项
+type EventJournalOption func(*EventJournal)
+
+// WithJournalSegmentSize 设置单个日志段的最大字节数，超过后切换到新的日志段，默认 16 MiB
+func WithJournalSegmentSize(size int64) EventJournalOption {
+	return func(j *EventJournal) {
+		if size > 0 {
+			j.segmentSize = size
+		}
+	}
+}
+
+// WithJournalRetention 设置日志的保留策略
+//
+//	参数:
+//	- segments: 最多保留的日志段数量，小于等于 0 时不限制，默认 8
+//	- maxAge: 最后写入时间早于该时长的日志段被删除，0 表示不限制
+func WithJournalRetention(segments int, maxAge time.Duration) EventJournalOption {
+	return func(j *EventJournal) {
+		j.maxSegments = segments
+		j.maxAge = maxAge
+	}
+}
+
+// WithEventJournal 将所有发布的事件记录到 dir 目录的事件日志
+func WithEventJournal(dir string, opts ...EventJournalOption) ManagerOption {
+	return func(o *managerOptions) {
+		o.journalDir = dir
+		o.journalOptions = opts
+	}
+}
+
+// EventJournal 只追加写的事件日志
+//
+//	事件按发布顺序分配递增的序号，以 JSON Lines 格式写入日志段文件，
+//	日志段达到大小上限时切换到新文件，并按保留策略删除最早的日志段。
+type EventJournal struct {
+	dir         string
+	segmentSize int64
+	maxSegments int
+	maxAge      time.Duration
+
+	mu      sync.Mutex
+	file    *os.File
+	size    int64
+	lastSeq uint64
+	closed  bool
+}
+
+// OpenEventJournal 打开或创建事件日志
+//
+//	最后一条记录不完整(例如进程崩溃时)会被截断，序号从最后一条完整的记录继续。
+func OpenEventJournal(dir string, opts ...EventJournalOption) (*EventJournal, error) {
+	j := &EventJournal{
+		dir:         dir,
+		segmentSize: defaultJournalSegmentSize,
+		maxSegments: defaultJournalSegments,
+	}
+	for _, opt := range opts {
+		opt(j)
+	}
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, wrap(err, "创建事件日志目录失败")
+	}
+	segments, err := j.segments()
+	if err != nil {
+		return nil, err
+	}
+	if len(segments) == 0 {
+		return j, nil
+	}
+
+	last := segments[len(segments)-1]
+	data, err := os.ReadFile(last)
+	if err != nil {
+		return nil, wrap(err, "读取事件日志失败")
+	}
+	complete := bytes.LastIndexByte(data, '\n') + 1
+	if complete < len(data) {
+		if err := os.Truncate(last, int64(complete)); err != nil {
+			return nil, wrap(err, "截断事件日志失败")
+		}
+		data = data[:complete]
+	}
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		var r journalRecord
+		if len(line) > 0 && json.Unmarshal(line, &r) == nil && r.Seq > j.lastSeq {
+			j.lastSeq = r.Seq
+		}
+	}
+	if j.lastSeq == 0 {
+		j.lastSeq = segmentSeq(last) - 1
+	}
+
+	if j.file, err = os.OpenFile(last, os.O_WRONLY|os.O_APPEND, 0o600); err != nil {
+		return nil, wrap(err, "打开事件日志失败")
+	}
+	j.size = int64(len(data))
+	return j, nil
+}
+
+// LastSeq 返回最后一条记录的序号，日志为空时返回 0
+func (j *EventJournal) LastSeq() uint64 {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.lastSeq
+}
+
+// append 为事件分配序号并写入日志，返回带有序号和时间的事件
+func (j *EventJournal) append(event Event) (Event, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.closed {
+		return event, newError("事件日志已经关闭")
+	}
+	event.Seq = j.lastSeq + 1
+	record := journalRecord{
+		Seq:    event.Seq,
+		Time:   event.Time,
+		Event:  event.EventName,
+		Plugin: event.Data.Name,
+		Error:  newEventError(event.Data.Error),
+	}
+	if event.Data.Data != nil {
+		data, err := json.Marshal(event.Data.Data)
+		if err != nil {
+			data, _ = json.Marshal(fmt.Sprintf("%v", event.Data.Data))
+		}
+		record.Data = data
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		return event, wrap(err, "序列化事件失败")
+	}
+	line = append(line, '\n')
+
+	if j.file == nil || j.size+int64(len(line)) > j.segmentSize && j.size > 0 {
+		if err := j.rotate(event.Seq); err != nil {
+			return event, err
+		}
+	}
+	if _, err := j.file.Write(line); err != nil {
+		return event, wrap(err, "写入事件日志失败")
+	}
+	j.size += int64(len(line))
+	j.lastSeq = event.Seq
+	return event, nil
+}
+
+// rotate 切换到以 seq 开始的新日志段并执行保留策略，调用方需持有锁
+func (j *EventJournal) rotate(seq uint64) error {
+	if j.file != nil {
+		_ = j.file.Sync()
+		j.file.Close()
+		j.file = nil
+	}
+
+	path := filepath.Join(j.dir, fmt.Sprintf("%s%020d%s", journalSegmentPrefix, seq, journalSegmentExt))
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return wrap(err, "创建事件日志段失败")
+	}
+	j.file, j.size = file, 0
+
+	segments, err := j.segments()
+	if err != nil {
+		return err
+	}
+	// 当前日志段总是保留
+	old := segments[:len(segments)-1]
+	if j.maxSegments > 0 && len(segments) > j.maxSegments {
+		for _, segment := range old[:len(segments)-j.maxSegments] {
+			os.Remove(segment)
+		}
+		old = old[len(segments)-j.maxSegments:]
+	}
+	if j.maxAge > 0 {
+		cutoff := time.Now().Add(-j.maxAge)
+		for _, segment := range old {
+			if info, err := os.Stat(segment); err == nil && info.ModTime().Before(cutoff) {
+				os.Remove(segment)
+			}
+		}
+	}
+	return nil
+}
+
+// segments 返回按序号排列的日志段路径
+func (j *EventJournal) segments() ([]string, error) {
+	matches, err := filepath.Glob(filepath.Join(j.dir, journalSegmentPrefix+"*"+journalSegmentExt))
+	if err != nil {
+		return nil, wrap(err, "读取事件日志目录失败")
+	}
+	sort.Slice(matches, func(a, b int) bool {
+		return segmentSeq(matches[a]) < segmentSeq(matches[b])
+	})
+	return matches, nil
+}
+
+// segmentSeq 从日志段文件名解析第一条记录的序号
+func segmentSeq(path string) uint64 {
+	name := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), journalSegmentPrefix), journalSegmentExt)
+	seq, _ := strconv.ParseUint(name, 10, 64)
+	return seq
+}
+
+// scan 按顺序读取序号不小于 from 的记录，fn 返回 false 时停止
+func (j *EventJournal) scan(from uint64, fn func(*journalRecord) bool) error {
+	j.mu.Lock()
+	segments, err := j.segments()
+	last := j.lastSeq
+	j.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	for i, segment := range segments {
+		// 下一个日志段的起始序号不大于 from 时跳过整个日志段
+		if i+1 < len(segments) && segmentSeq(segments[i+1]) <= from {
+			continue
+		}
+		more, err := scanSegment(segment, func(r *journalRecord) bool {
+			if r.Seq > last {
+				return false
+			}
+			if r.Seq < from {
+				return true
+			}
+			return fn(r)
+		})
+		if err != nil || !more {
+			return err
+		}
+	}
+	return nil
+}
+
+// scanSegment 读取日志段中的记录，跳过无法解析的行
+func scanSegment(path string, fn func(*journalRecord) bool) (bool, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		// 日志段可能在读取前被保留策略删除
+		return true, nil
+	}
+	if err != nil {
+		return false, wrap(err, "读取事件日志失败")
+	}
+	defer f.Close()
+
+	reader := bufio.NewReader(f)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 && line[len(line)-1] == '\n' {
+			var r journalRecord
+			if json.Unmarshal(line, &r) == nil && !fn(&r) {
+				return false, nil
+			}
+		}
+		if err == io.EOF {
+			return true, nil
+		}
+		if err != nil {
+			return false, wrap(err, "读取事件日志失败")
+		}
+	}
+}
+
+// Replay 按顺序回放序号不小于 from 的事件，fn 返回错误时停止并返回该错误
+func (j *EventJournal) Replay(from uint64, fn func(Event) error) error {
+	return j.replay(EventQuery{FromSeq: from}, fn)
+}
+
+// ReplaySince 按顺序回放时间不早于 since 的事件，fn 返回错误时停止并返回该错误
+func (j *EventJournal) ReplaySince(since time.Time, fn func(Event) error) error {
+	return j.replay(EventQuery{Since: since}, fn)
+}
+
+func (j *EventJournal) replay(q EventQuery, fn func(Event) error) error {
+	var fnErr error
+	err := j.scan(q.FromSeq, func(r *journalRecord) bool {
+		if q.match(r) {
+			fnErr = fn(r.event())
+		}
+		return fnErr == nil
+	})
+	if err != nil {
+		return err
+	}
+	return fnErr
+}
+
+// Query 查询满足条件的事件，用于审计
+//
+//	返回的事件按序号升序排列，EventData.Data 为 JSON 解码后的值，EventData.Error 为 *EventError。
+func (j *EventJournal) Query(q EventQuery) ([]Event, error) {
+	var events []Event
+	err := j.scan(q.FromSeq, func(r *journalRecord) bool {
+		if q.match(r) {
+			events = append(events, r.event())
+		}
+		return q.Limit <= 0 || len(events) < q.Limit
+	})
+	return events, err
+}
+
+// Close 同步并关闭当前日志段
+func (j *EventJournal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.closed = true
+	if j.file == nil {
+		return nil
+	}
+	err := j.file.Sync()
+	if closeErr := j.file.Close(); err == nil {
+		err = closeErr
+	}
+	j.file = nil
+	return wrap(err, "关闭事件日志失败")
+}
+
+// record 为事件设置发布时间并写入事件日志，返回写入后的事件和匹配的订阅
+//
+//	写入日志和获取订阅在同一个锁内完成，subscribeFrom 据此保证回放的事件与之后发布的事件
+//	不遗漏也不重复。写入日志失败时事件仍然分发给订阅，同时返回错误。
+func (eb *eventBus) record(event Event) (Event, []*Subscription, error) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	if eb.journal == nil {
+		return event, eb.subscribers(event.EventName), nil
+	}
+
+	eb.publishMu.Lock()
+	defer eb.publishMu.Unlock()
+
+	event, err := eb.journal.append(event)
+	return event, eb.subscribers(event.EventName), err
+}
+
+// subscribeFrom 创建订阅并将事件日志中从 from 开始的匹配事件放入订阅的队列
+func (eb *eventBus) subscribeFrom(eventName string, from ReplayFrom, handler EventHandler, filters []EventFilter) (*Subscription, error) {
+	q := EventQuery{EventNames: []string{eventName}, FromSeq: from.Seq}
+	if from.Seq == 0 {
+		q.Since = from.Time
+	}
+
+	eb.publishMu.Lock()
+	defer eb.publishMu.Unlock()
+
+	sub := eb.Subscribe(eventName, handler, filters...)
+	var events []Event
+	err := eb.journal.replay(q, func(e Event) error {
+		if sub.accepts(e) {
+			events = append(events, e)
+		}
+		return nil
+	})
+	if err != nil {
+		sub.Cancel()
+		return nil, err
+	}
+	if len(events) > 0 {
+		eb.prefill(sub, events)
+	}
+	return sub, nil
+}
+
+// ReplayFrom 订阅前回放的起点
+type ReplayFrom struct {
+	Seq  uint64    // 从该序号开始回放(包含)
+	Time time.Time // 从该时间开始回放(包含)，Seq 不为 0 时忽略
+}
+
+// EventJournal 返回管理器的事件日志，未使用 WithEventJournal 时返回 nil
+func (m *Manager) EventJournal() *EventJournal {
+	return m.eventBus.journal
+}
+
+// SubscribeToEventFrom 回放事件日志中的历史事件后继续订阅新事件
+//
+//	参数:
+//	- eventName: 事件名称，可以包含通配符 *
+//	- from: 回放的起点
+//	- handler: 事件处理函数
+//	- filters: 过滤条件
+//	功能:
+//	- 历史事件先于之后发布的事件放入订阅的队列，不遗漏也不重复
+//	- 回放的事件 Data 为 JSON 解码后的值，Error 为 *EventError
+//	返回:
+//	- *Subscription: 订阅句柄
+//	- error: 未启用事件日志或读取日志失败
+func (m *Manager) SubscribeToEventFrom(eventName string, from ReplayFrom, handler EventHandler, filters ...EventFilter) (*Subscription, error) {
+	if m.eventBus.journal == nil {
+		return nil, newError("未启用事件日志")
+	}
+	return m.eventBus.subscribeFrom(eventName, from, handler, filters)
+}
+
+// QueryEvents 按插件、事件名称和时间范围查询事件日志
+func (m *Manager) QueryEvents(q EventQuery) ([]Event, error) {
+	if m.eventBus.journal == nil {
+		return nil, newError("未启用事件日志")
+	}
+	return m.eventBus.journal.Query(q)
+}
@@ -0,0 +1,157 @@
+package plugmgr
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestEventJournalRotationAndRetention(t *testing.T) {
+	dir := t.TempDir()
+	j, err := OpenEventJournal(dir, WithJournalSegmentSize(256), WithJournalRetention(3, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 50; i++ {
+		if _, err := j.append(Event{EventName: PluginExecuted, Time: time.Now(), Data: EventData{Name: "a", Data: i}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	segments, _ := j.segments()
+	if len(segments) != 3 {
+		t.Fatalf("应只保留 3 个日志段, 得到 %d", len(segments))
+	}
+	events, err := j.Query(EventQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) == 0 || events[len(events)-1].Seq != 50 {
+		t.Fatalf("应保留最新的事件, 得到 %d 个", len(events))
+	}
+	for i, e := range events {
+		if e.Seq != events[0].Seq+uint64(i) || e.Data.Data.(float64) != float64(e.Seq) {
+			t.Fatalf("事件不连续: %+v", e)
+		}
+	}
+	if err := j.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 模拟写入一半时崩溃
+	last := segments[len(segments)-1]
+	f, _ := os.OpenFile(last, os.O_WRONLY|os.O_APPEND, 0o600)
+	f.WriteString(`{"seq":51,"event":"Plug`)
+	f.Close()
+
+	j, err = OpenEventJournal(dir, WithJournalSegmentSize(256), WithJournalRetention(3, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	if j.LastSeq() != 50 {
+		t.Fatalf("重新打开后应从序号 50 继续, 得到 %d", j.LastSeq())
+	}
+	e, err := j.append(Event{EventName: PluginLoaded, Time: time.Now()})
+	if err != nil || e.Seq != 51 {
+		t.Fatalf("追加事件失败: %d, %v", e.Seq, err)
+	}
+	events, _ = j.Query(EventQuery{FromSeq: 50})
+	if len(events) != 2 || events[1].EventName != PluginLoaded {
+		t.Fatalf("截断不完整的记录后应能继续追加: %+v", events)
+	}
+}
+
+func TestEventJournalQuery(t *testing.T) {
+	j, err := OpenEventJournal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+
+	start := time.Now()
+	publish := func(name, plugin string, err error, at time.Duration) {
+		if _, e := j.append(Event{EventName: name, Time: start.Add(at), Data: EventData{Name: plugin, Error: err}}); e != nil {
+			t.Fatal(e)
+		}
+	}
+	publish(PluginLoaded, "a", nil, 0)
+	publish(PluginExecutionTimeout, "a", wrapf(ErrExecutionTimeout, "插件 %s 执行超时", "a"), time.Second)
+	publish(PluginExecutionError, "b", errors.New("boom"), 2*time.Second)
+	publish(PluginExecutionError, "a", wrap(ErrPermissionDenied, "执行失败"), 3*time.Second)
+
+	events, err := j.Query(EventQuery{Plugin: "a", EventNames: []string{"PluginExecution*"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("期望 2 个事件, 得到 %d", len(events))
+	}
+	if !errors.Is(events[0].Data.Error, ErrExecutionTimeout) || errors.Is(events[0].Data.Error, ErrPermissionDenied) {
+		t.Fatalf("错误链未正确保存: %v", events[0].Data.Error)
+	}
+	var ee *EventError
+	if !errors.As(events[1].Data.Error, &ee) || ee.Type != errTypeValidation || len(ee.Chain) != 2 || ee.Chain[0] != "执行失败" {
+		t.Fatalf("结构化错误不正确: %+v", ee)
+	}
+
+	events, _ = j.Query(EventQuery{Since: start.Add(time.Second), Until: start.Add(3 * time.Second)})
+	if len(events) != 2 || events[0].Seq != 2 || events[1].Seq != 3 {
+		t.Fatalf("按时间范围查询结果不正确: %+v", events)
+	}
+	events, _ = j.Query(EventQuery{Limit: 1, FromSeq: 2})
+	if len(events) != 1 || events[0].Seq != 2 {
+		t.Fatalf("Limit 和 FromSeq 未生效: %+v", events)
+	}
+}
+
+func TestSubscribeToEventFrom(t *testing.T) {
+	dir := t.TempDir()
+	m, err := NewManagerWithOptions(dir, "config.db", WithEventJournal(filepath.Join(dir, "events")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 3; i++ {
+		m.eventBus.PublishAsync(Event{EventName: PluginLoaded, Data: EventData{Name: "a", Data: i}})
+	}
+	if err := m.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 重新创建的管理器可以回放之前的事件
+	m, err = NewManagerWithOptions(dir, "config.db", WithEventJournal(filepath.Join(dir, "events")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Shutdown()
+
+	var mu sync.Mutex
+	var seqs []uint64
+	_, err = m.SubscribeToEventFrom("Plugin*", ReplayFrom{Seq: 2}, func(e Event) {
+		mu.Lock()
+		seqs = append(seqs, e.Seq)
+		mu.Unlock()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.eventBus.PublishAsync(Event{EventName: PluginUnloaded, Data: EventData{Name: "a"}})
+
+	waitFor(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(seqs) == 3
+	})
+	mu.Lock()
+	defer mu.Unlock()
+	if seqs[0] != 2 || seqs[1] != 3 || seqs[2] != 4 {
+		t.Fatalf("回放后应按顺序收到新事件, 得到 %v", seqs)
+	}
+
+	if _, err := newTestManager(t).SubscribeToEventFrom("*", ReplayFrom{}, func(Event) {}); err == nil {
+		t.Fatal("未启用事件日志时应返回错误")
+	}
+}
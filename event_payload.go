@@ -0,0 +1,240 @@
+package plugmgr
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// PluginLoadedPayload PluginLoaded 事件的数据
+type PluginLoadedPayload struct {
+	Version  string        // 插件版本
+	Path     string        // 插件文件路径
+	Checksum string        // 插件文件的 SHA-256，文件不可读时为空
+	Duration time.Duration // 加载耗时，包括预加载钩子和初始化
+}
+
+// PluginInitializedPayload PluginInitialized 事件的数据
+type PluginInitializedPayload struct {
+	Path string // 插件文件路径
+}
+
+// PluginExecutedPayload PluginExecuted 事件的数据
+type PluginExecutedPayload struct {
+	Duration   time.Duration // 执行耗时
+	InputType  string        // 输入数据的类型
+	OutputType string        // 返回结果的类型
+	Caller     string        // 调用方，参见 WithCaller
+}
+
+// PluginExecutionErrorPayload PluginExecutionError 事件的数据，错误保存在 EventData.Error
+type PluginExecutionErrorPayload struct {
+	Duration  time.Duration // 执行耗时，未开始执行时为 0
+	InputType string        // 输入数据的类型
+	Caller    string        // 调用方，参见 WithCaller
+}
+
+// PluginExecutionTimeoutPayload PluginExecutionTimeout 事件的数据
+type PluginExecutionTimeoutPayload struct {
+	Elapsed time.Duration // 超时前已运行的时间
+	Timeout time.Duration // 插件的超时设置，0 表示由调用方的上下文截止
+}
+
+// PluginResourceLimitPayload PluginResourceLimitExceeded 事件的数据
+type PluginResourceLimitPayload struct {
+	Resource string       // 超出限制的资源
+	Limits   CgroupLimits // 插件的资源限制
+}
+
+// PluginConfigUpdatedPayload PluginConfigUpdated 事件的数据
+type PluginConfigUpdatedPayload struct {
+	Config   []byte // 更新后的配置，密钥字段已脱敏
+	Actor    string // 修改配置的调用方
+	Comment  string // 修改说明
+	External bool   // 配置由外部修改配置文件触发
+}
+
+// PluginUnloadPayload PluginPreUnload 和 PluginUnloaded 事件的数据
+type PluginUnloadPayload struct {
+	Version string // 卸载的插件版本
+}
+
+// PluginHotReloadedPayload PluginHotReloaded 事件的数据
+type PluginHotReloadedPayload struct {
+	OldVersion string        // 替换前的版本
+	NewVersion string        // 替换后的版本
+	Path       string        // 新插件文件路径
+	Checksum   string        // 新插件文件的 SHA-256
+	Duration   time.Duration // 热重载耗时
+}
+
+// PluginEnabledPayload PluginEnabled 事件的数据
+type PluginEnabledPayload struct {
+	Path string // 加载的插件文件路径
+}
+
+// PluginDisabledPayload PluginDisabled 事件的数据
+type PluginDisabledPayload struct {
+	Cascade bool // 是否级联卸载了依赖方
+}
+
+// PluginInstalledPayload PluginInstalled 事件的数据
+type PluginInstalledPayload struct {
+	Version string // 安装的版本
+	Path    string // 插件文件路径
+}
+
+// PluginRolledBackPayload PluginRolledBack 事件的数据
+type PluginRolledBackPayload struct {
+	FromVersion string // 回滚前的版本
+	ToVersion   string // 回滚后的版本
+}
+
+// PluginPermissionChangedPayload PluginPermissionChanged 事件的数据
+type PluginPermissionChangedPayload struct {
+	Old *PluginPermission // 修改前的权限，之前未设置时为 nil
+	New *PluginPermission // 修改后的权限，删除权限时为 nil
+}
+
+// PluginSignatureFailedPayload PluginSignatureFailed 事件的数据，错误保存在 EventData.Error
+type PluginSignatureFailedPayload struct {
+	Path string // 未通过验证的插件文件路径
+}
+
+// SubscribeTyped 订阅事件并将数据解码为 T
+//
+//	参数:
+//	- m: 插件管理器实例
+//	- eventName: 事件名称，可以包含通配符 *
+//	- handler: 事件处理函数，同时传入原始事件和解码后的数据
+//	- filters: 过滤条件
+//	功能:
+//	- 数据为 T 或 *T 时直接使用
+//	- 数据为 JSON 解码后的值时(例如从事件日志回放的事件)重新解码为 T
+//	- 数据无法解码为 T 的事件被跳过
+//	返回:
+//	- *Subscription: 订阅句柄
+func SubscribeTyped[T any](m *Manager, eventName string, handler func(Event, T), filters ...EventFilter) *Subscription {
+	return m.eventBus.Subscribe(eventName, func(e Event) {
+		if payload, ok := decodePayload[T](e.Data.Data); ok {
+			handler(e, payload)
+		}
+	}, filters...)
+}
+
+// decodePayload 将事件数据转换为 T
+func decodePayload[T any](data any) (T, bool) {
+	var payload T
+	switch v := data.(type) {
+	case T:
+		return v, true
+	case *T:
+		if v != nil {
+			return *v, true
+		}
+	case map[string]any:
+		raw, err := json.Marshal(v)
+		if err == nil && json.Unmarshal(raw, &payload) == nil {
+			return payload, true
+		}
+	}
+	return payload, false
+}
+
+// publishLoaded 发布 PluginLoaded 事件
+func (m *Manager) publishLoaded(name, path, version string, start time.Time) {
+	m.eventBus.PublishAsync(Event{
+		EventName: PluginLoaded,
+		Data: EventData{
+			Name: name,
+			Data: PluginLoadedPayload{
+				Version:  version,
+				Path:     path,
+				Checksum: fileChecksum(path),
+				Duration: time.Since(start),
+			},
+		},
+	})
+}
+
+// publishExecution 发布插件执行完成或失败的事件
+func (m *Manager) publishExecution(ctx context.Context, name string, input, output any, duration time.Duration, err error) {
+	if err != nil {
+		m.eventBus.PublishAsync(Event{
+			EventName: PluginExecutionError,
+			Data: EventData{
+				Name:  name,
+				Data:  PluginExecutionErrorPayload{Duration: duration, InputType: typeName(input), Caller: callerFromContext(ctx)},
+				Error: err,
+			},
+		})
+		return
+	}
+	m.eventBus.PublishAsync(Event{
+		EventName: PluginExecuted,
+		Data: EventData{
+			Name: name,
+			Data: PluginExecutedPayload{
+				Duration:   duration,
+				InputType:  typeName(input),
+				OutputType: typeName(output),
+				Caller:     callerFromContext(ctx),
+			},
+		},
+	})
+}
+
+// publishPermissionChanged 发布 PluginPermissionChanged 事件
+func (m *Manager) publishPermissionChanged(name string, old, updated *PluginPermission) {
+	m.eventBus.PublishAsync(Event{
+		EventName: PluginPermissionChanged,
+		Data: EventData{
+			Name: name,
+			Data: PluginPermissionChangedPayload{Old: old, New: updated},
+		},
+	})
+}
+
+// callerKey 上下文中保存调用方的键
+type callerKey struct{}
+
+// WithCaller 在上下文中记录调用方，PluginExecuted 和 PluginExecutionError 事件的 Caller 字段使用该值
+//
+//	Session 使用调用方的名称，插件通过 Host 调用其他插件时使用 "plugin:<插件名称>"。
+func WithCaller(ctx context.Context, caller string) context.Context {
+	return context.WithValue(ctx, callerKey{}, caller)
+}
+
+// callerFromContext 获取上下文中记录的调用方
+func callerFromContext(ctx context.Context) string {
+	caller, _ := ctx.Value(callerKey{}).(string)
+	return caller
+}
+
+// typeName 返回值的类型名称，nil 返回空字符串
+func typeName(v any) string {
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// fileChecksum 计算文件的 SHA-256，文件不可读时返回空字符串
+func fileChecksum(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,124 @@
+package plugmgr
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// typedEvents 订阅事件并将解码后的数据发送到通道
+func typedEvents[T any](m *Manager, eventName string) chan T {
+	ch := make(chan T, 8)
+	SubscribeTyped(m, eventName, func(_ Event, payload T) {
+		ch <- payload
+	})
+	return ch
+}
+
+func receive[T any](t *testing.T, ch chan T) T {
+	t.Helper()
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(2 * time.Second):
+		var zero T
+		t.Fatalf("等待 %T 事件超时", zero)
+		return zero
+	}
+}
+
+func TestLifecyclePayloads(t *testing.T) {
+	m := newTestManager(t)
+	loaded := typedEvents[PluginLoadedPayload](m, PluginLoaded)
+	executed := typedEvents[PluginExecutedPayload](m, PluginExecuted)
+	failed := typedEvents[PluginExecutionErrorPayload](m, PluginExecutionError)
+	unloaded := typedEvents[PluginUnloadPayload](m, PluginUnloaded)
+	changed := typedEvents[PluginPermissionChangedPayload](m, PluginPermissionChanged)
+
+	path := filepath.Join(m.pluginDir, "upper.so")
+	if err := os.WriteFile(path, []byte("plugin"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	loadHostPlugin(t, m, "upper", &fakePlugin{metadata: PluginMetadata{Version: "1.2.0"}})
+
+	p := receive(t, loaded)
+	if p.Version != "1.2.0" || p.Path != path || p.Checksum != fileChecksum(path) || p.Checksum == "" || p.Duration <= 0 {
+		t.Fatalf("PluginLoaded 数据不正确: %+v", p)
+	}
+
+	if _, err := m.ExecutePluginContext(WithCaller(context.Background(), "alice"), "upper", "hi"); err != nil {
+		t.Fatal(err)
+	}
+	e := receive(t, executed)
+	if e.Caller != "alice" || e.InputType != "string" || e.OutputType != "string" {
+		t.Fatalf("PluginExecuted 数据不正确: %+v", e)
+	}
+	if _, err := ExecutePluginGeneric[int, int](m, "missing", 1); err == nil {
+		t.Fatal("执行不存在的插件应返回错误")
+	}
+	if f := receive(t, failed); f.InputType != "int" {
+		t.Fatalf("PluginExecutionError 数据不正确: %+v", f)
+	}
+
+	if err := m.SetPluginPermission("upper", &PluginPermission{AllowedActions: map[string]bool{"execute": false}}); err != nil {
+		t.Fatal(err)
+	}
+	if c := receive(t, changed); c.Old == nil || !c.Old.AllowedActions["execute"] || c.New.AllowedActions["execute"] {
+		t.Fatalf("PluginPermissionChanged 数据不正确: %+v", c)
+	}
+
+	if err := m.UnloadPlugin("upper"); err != nil {
+		t.Fatal(err)
+	}
+	if u := receive(t, unloaded); u.Version != "1.2.0" {
+		t.Fatalf("PluginUnloaded 数据不正确: %+v", u)
+	}
+}
+
+func TestSignatureFailedEvent(t *testing.T) {
+	m := newTestManager(t)
+	m.publicKeyPath = filepath.Join(m.pluginDir, "missing.pem")
+
+	errs := make(chan error, 1)
+	SubscribeTyped(m, PluginSignatureFailed, func(e Event, p PluginSignatureFailedPayload) {
+		if p.Path == filepath.Join(m.pluginDir, "unsigned.so") {
+			errs <- e.Data.Error
+		}
+	})
+
+	if err := m.LoadPlugin(filepath.Join(m.pluginDir, "unsigned.so")); err == nil {
+		t.Fatal("签名验证失败时应拒绝加载")
+	}
+	if err := receive(t, errs); err == nil {
+		t.Fatal("PluginSignatureFailed 应带有验证错误")
+	}
+}
+
+func TestDecodeReplayedPayload(t *testing.T) {
+	j, err := OpenEventJournal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+
+	want := PluginLoadedPayload{Version: "1.0.0", Path: "a.so", Duration: time.Second}
+	if _, err := j.append(Event{EventName: PluginLoaded, Data: EventData{Name: "a", Data: want}}); err != nil {
+		t.Fatal(err)
+	}
+	events, err := j.Query(EventQuery{})
+	if err != nil || len(events) != 1 {
+		t.Fatalf("查询事件失败: %v", err)
+	}
+	got, ok := decodePayload[PluginLoadedPayload](events[0].Data.Data)
+	if !ok || got != want {
+		t.Fatalf("回放的数据应能解码为 PluginLoadedPayload, 得到 %+v", got)
+	}
+	if _, ok := decodePayload[PluginLoadedPayload]("other"); ok {
+		t.Fatal("无法解码的数据应被跳过")
+	}
+	if _, ok := decodePayload[PluginLoadedPayload](&want); !ok {
+		t.Fatal("指针类型的数据应能直接使用")
+	}
+}
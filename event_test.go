@@ -0,0 +1,87 @@
+package plugmgr
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMatchEventName(t *testing.T) {
+	tests := []struct {
+		pattern, name string
+		want          bool
+	}{
+		{"PluginLoaded", "PluginLoaded", true},
+		{"PluginLoaded", "PluginUnloaded", false},
+		{"*", "PluginLoaded", true},
+		{"Plugin*", "PluginExecutionError", true},
+		{"Plugin*", "Other", false},
+		{"*Error", "PluginExecutionError", true},
+		{"*Error", "PluginErrorHandled", false},
+		{"Plugin*Unload*", "PluginPreUnload", true},
+		{"Plugin*Unload*", "PluginLoaded", false},
+		{"a*a", "a", false},
+	}
+	for _, tt := range tests {
+		if got := matchEventName(tt.pattern, tt.name); got != tt.want {
+			t.Errorf("matchEventName(%q, %q) = %v, 期望 %v", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSubscribeWildcardAndFilters(t *testing.T) {
+	eb := newEventBus()
+
+	var all, plugin, errs []string
+	eb.Subscribe("*", func(e Event) { all = append(all, e.EventName) })
+	sub := eb.Subscribe("Plugin*", func(e Event) { plugin = append(plugin, e.Data.Name) }, ForPlugins("a"))
+	eb.Subscribe(PluginExecutionError, func(e Event) { errs = append(errs, e.Data.Name) }, OnlyErrors())
+
+	eb.Publish(Event{EventName: PluginLoaded, Data: EventData{Name: "a"}})
+	eb.Publish(Event{EventName: PluginLoaded, Data: EventData{Name: "b"}})
+	eb.Publish(Event{EventName: PluginExecutionError, Data: EventData{Name: "b"}})
+	eb.Publish(Event{EventName: PluginExecutionError, Data: EventData{Name: "a", Error: errors.New("x")}})
+
+	if len(all) != 4 {
+		t.Fatalf("通配符 * 应收到所有事件, 得到 %v", all)
+	}
+	if len(plugin) != 2 || plugin[0] != "a" || plugin[1] != "a" {
+		t.Fatalf("过滤后应只收到插件 a 的事件, 得到 %v", plugin)
+	}
+	if len(errs) != 1 || errs[0] != "a" {
+		t.Fatalf("应只收到带有错误的事件, 得到 %v", errs)
+	}
+	if n := eb.SubscribersCount(PluginExecutionError); n != 3 {
+		t.Fatalf("期望 3 个订阅者, 得到 %d", n)
+	}
+
+	sub.Cancel()
+	sub.Cancel()
+	eb.Publish(Event{EventName: PluginLoaded, Data: EventData{Name: "a"}})
+	if len(plugin) != 2 {
+		t.Fatal("取消订阅后不应再收到事件")
+	}
+	if n := eb.SubscribersCount(PluginLoaded); n != 1 {
+		t.Fatalf("取消订阅后期望 1 个订阅者, 得到 %d", n)
+	}
+}
+
+func TestUnsubscribe(t *testing.T) {
+	eb := newEventBus()
+
+	var calls int
+	handler := func(Event) { calls++ }
+	eb.Subscribe(PluginLoaded, handler)
+	eb.Subscribe("Plugin*", handler)
+
+	eb.Unsubscribe(PluginLoaded, handler)
+	eb.Publish(Event{EventName: PluginLoaded})
+	if calls != 1 {
+		t.Fatalf("只应取消精确订阅, 调用次数 %d", calls)
+	}
+
+	eb.Unsubscribe("Plugin*", handler)
+	eb.Publish(Event{EventName: PluginLoaded})
+	if calls != 1 || eb.HasSubscribers(PluginLoaded) {
+		t.Fatal("通配符订阅也应能取消")
+	}
+}
@@ -39,6 +39,7 @@ func main() {
 	mux.HandleFunc("/plugins/disable/", HttpHandlers.DisablePlugin())
 	mux.HandleFunc("/plugins/preload/", HttpHandlers.PreloadPlugin())
 	mux.HandleFunc("/plugins/hotreload/", HttpHandlers.HotReloadPlugin())
+	mux.HandleFunc("/plugins/dependencies/", HttpHandlers.GetPluginDependencies())
 
 	// 插件配置路由
 	mux.HandleFunc("/plugins/config/", HttpHandlers.GetPluginConfig())
@@ -78,3 +78,5 @@ func (p *HelloPlugin) ConfigUpdated(config []byte) ([]byte, error) {
 	p.config = newConfig
 	return pm.Serializer(p.config)
 }
+
+func main() {}
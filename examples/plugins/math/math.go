@@ -82,3 +82,5 @@ func (p *MathPlugin) ConfigUpdated(config []byte) ([]byte, error) {
 func (p *MathPlugin) Add(a, b int) int {
 	return a + b + p.config.DefaultValue
 }
+
+func main() {}
@@ -247,3 +247,5 @@ func (p *FileManagerPlugin) Shutdown() error {
 func init() {
 	Plugin = &FileManagerPlugin{}
 }
+
+func main() {}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	pm "github.com/darkit/plugmgr"
+	"github.com/darkit/plugmgr/sdk"
+)
+
+// 进程插件示例
+//
+// 编译后放入插件目录即可被管理器以子进程方式加载:
+//
+//	go build -o ../../plugins/upper.plugin .
+
+type UpperPluginConfig struct {
+	Prefix string
+}
+
+type UpperPlugin struct {
+	config UpperPluginConfig
+}
+
+func (p *UpperPlugin) Metadata() pm.PluginMetadata {
+	return pm.PluginMetadata{
+		Name:         "UpperPlugin",
+		Version:      "1.0.0",
+		Dependencies: map[string]string{},
+	}
+}
+
+func (p *UpperPlugin) PreLoad(config []byte) error {
+	if len(config) == 0 {
+		return nil
+	}
+	return pm.Deserializer(config, &p.config)
+}
+
+func (p *UpperPlugin) Init() error {
+	// 标准输出已被 SDK 重定向到标准错误，会出现在宿主日志中
+	fmt.Println("UpperPlugin initialized")
+	return nil
+}
+
+func (p *UpperPlugin) PostLoad() error  { return nil }
+func (p *UpperPlugin) PreUnload() error { return nil }
+func (p *UpperPlugin) Shutdown() error  { return nil }
+
+func (p *UpperPlugin) ConfigUpdated(config []byte) ([]byte, error) {
+	if err := pm.Deserializer(config, &p.config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+func (p *UpperPlugin) Execute(data any) (any, error) {
+	return p.ExecuteContext(context.Background(), data)
+}
+
+func (p *UpperPlugin) ExecuteContext(ctx context.Context, data any) (any, error) {
+	var input string
+	if err := sdk.Decode(data, &input); err != nil {
+		return nil, fmt.Errorf("invalid input: %w", err)
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-time.After(10 * time.Millisecond):
+	}
+	return p.config.Prefix + strings.ToUpper(input), nil
+}
+
+func main() {
+	if err := sdk.Serve(&UpperPlugin{}); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,358 @@
+package plugmgr
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// 宿主服务的权限操作名称
+//
+//	插件通过 Host 发起的每次调用都会使用对应的操作检查该插件的 PluginPermission。
+//	HostActionCall 允许调用任意插件，也可以使用 "host.call:<插件名称>" 只允许调用指定插件。
+const (
+	HostActionLog       = "host.log"
+	HostActionPublish   = "host.publish"
+	HostActionSubscribe = "host.subscribe"
+	HostActionConfig    = "host.config"
+	HostActionKVRead    = "host.kv.read"
+	HostActionKVWrite   = "host.kv.write"
+	HostActionCall      = "host.call"
+)
+
+// defaultHostActions 插件加载时默认授予的宿主服务权限
+var defaultHostActions = map[string]bool{
+	HostActionLog:        true,
+	HostActionPublish:    true,
+	HostActionSubscribe:  true,
+	HostActionConfig:     true,
+	HostActionKVRead:     true,
+	HostActionKVWrite:    true,
+	HostActionCall:       false,
+	TopicActionPublish:   true,
+	TopicActionSubscribe: false,
+}
+
+// builtinEvents 管理器发布的生命周期事件，插件不能通过 Host 伪造
+var builtinEvents = map[string]bool{
+	PluginLoaded:                true,
+	PluginInitialized:           true,
+	PluginExecuted:              true,
+	PluginConfigUpdated:         true,
+	PluginPreUnload:             true,
+	PluginUnloaded:              true,
+	PluginExecutionError:        true,
+	PluginHotReloaded:           true,
+	PluginExecutionTimeout:      true,
+	PluginResourceLimitExceeded: true,
+	PluginEnabled:               true,
+	PluginDisabled:              true,
+	PluginInstalled:             true,
+	PluginRolledBack:            true,
+	PluginPermissionChanged:     true,
+	PluginSignatureFailed:       true,
+	EventDropped:                true,
+}
+
+// Host 宿主为插件提供的服务
+//
+//	插件实现 HostAwarePlugin 后在 PreLoad 阶段获得 Host，
+//	无需导入管理器即可使用日志、事件、配置、键值存储和调用其他插件。
+//	Host 在插件卸载或被热重载替换后失效，之后的调用返回 ErrHostClosed。
+type Host interface {
+	// Logger 返回自动附带插件名称的日志记录器
+	Logger() Logger
+
+	// Publish 以插件的名义发布事件，不能发布管理器的内置事件
+	Publish(eventName string, data any) error
+
+	// Subscribe 订阅事件，eventName 可以包含通配符 *，返回的函数用于取消订阅，插件卸载时自动取消
+	Subscribe(eventName string, handler EventHandler) (func(), error)
+
+	// PublishTopic 向插件自己的主题 plugin.<插件名称>.<topic> 发布事件
+	PublishTopic(topic string, data any) error
+
+	// SubscribeTopic 订阅插件主题，eventName 以 plugin. 开头，返回的函数用于取消订阅，插件卸载时自动取消
+	SubscribeTopic(eventName string, handler EventHandler) (func(), error)
+
+	// Config 获取插件当前保存的配置
+	Config() ([]byte, error)
+
+	// WatchConfig 在插件配置更新后调用 handler，返回的函数用于取消监听
+	WatchConfig(handler func(config []byte)) (func(), error)
+
+	// Get 读取插件私有键值存储中的值
+	Get(key string) ([]byte, bool, error)
+
+	// Set 写入插件私有键值存储，数据随配置一起持久化
+	Set(key string, value []byte) error
+
+	// Delete 删除插件私有键值存储中的值
+	Delete(key string) error
+
+	// Call 调用其他插件
+	Call(plugin string, data any) (any, error)
+
+	// CallContext 在上下文控制下调用其他插件
+	CallContext(ctx context.Context, plugin string, data any) (any, error)
+}
+
+// HostAwarePlugin 需要使用宿主服务的插件
+//
+//	管理器在加载插件时调用 PreLoadWithHost 代替 PreLoad。
+//	目前只支持以 .so 方式加载的进程内插件。
+type HostAwarePlugin interface {
+	Plugin
+
+	// PreLoadWithHost 加载前处理，同时传入宿主服务
+	// 参数 host: 插件专属的宿主服务，在插件卸载前一直有效
+	// 参数 config: 插件的配置数据
+	PreLoadWithHost(host Host, config []byte) error
+}
+
+// pluginHost Host 的实现，绑定到单个插件
+type pluginHost struct {
+	manager *Manager
+	name    string
+	logger  Logger
+	closed  atomic.Bool
+
+	mu       sync.Mutex
+	cancels  map[uint64]func()
+	watchers map[uint64]func([]byte)
+	nextID   uint64
+}
+
+func newPluginHost(m *Manager, name string) *pluginHost {
+	h := &pluginHost{
+		manager:  m,
+		name:     name,
+		cancels:  make(map[uint64]func()),
+		watchers: make(map[uint64]func([]byte)),
+	}
+	h.logger = &hostLogger{host: h}
+	return h
+}
+
+// check 检查宿主服务是否可用以及插件是否拥有指定操作的权限
+func (h *pluginHost) check(action string) error {
+	if h.closed.Load() {
+		return wrapf(ErrHostClosed, "插件 %s 的宿主服务已失效", h.name)
+	}
+	if !h.manager.HasPermission(h.name, action) {
+		return wrapf(ErrPermissionDenied, "插件 %s 没有 %s 权限", h.name, action)
+	}
+	return nil
+}
+
+func (h *pluginHost) Logger() Logger {
+	return h.logger
+}
+
+func (h *pluginHost) Publish(eventName string, data any) error {
+	if err := h.check(HostActionPublish); err != nil {
+		return err
+	}
+	if builtinEvents[eventName] {
+		return wrapf(ErrPermissionDenied, "插件 %s 不能发布内置事件 %s", h.name, eventName)
+	}
+	if isTopicEvent(eventName) {
+		return wrapf(ErrPermissionDenied, "插件 %s 只能通过 PublishTopic 发布主题事件 %s", h.name, eventName)
+	}
+	return h.manager.eventBus.PublishAsync(Event{
+		EventName: eventName,
+		Data: EventData{
+			Name: h.name,
+			Data: data,
+		},
+	})
+}
+
+func (h *pluginHost) Subscribe(eventName string, handler EventHandler) (func(), error) {
+	if err := h.check(HostActionSubscribe); err != nil {
+		return nil, err
+	}
+
+	if isTopicEvent(eventName) {
+		return nil, wrapf(ErrPermissionDenied, "插件 %s 只能通过 SubscribeTopic 订阅主题事件 %s", h.name, eventName)
+	}
+
+	// 通配符模式可能匹配主题事件，投递前与 SubscribeTopic 一样检查主题订阅权限
+	allowed := func(e Event) bool {
+		return !isTopicEvent(e.EventName) || h.manager.topicAllowed(h.name, TopicActionSubscribe, eventName, e.EventName)
+	}
+	sub := h.manager.eventBus.Subscribe(eventName, handler, allowed)
+	return h.track(h.cancels, sub.Cancel), nil
+}
+
+func (h *pluginHost) PublishTopic(topic string, data any) error {
+	if h.closed.Load() {
+		return wrapf(ErrHostClosed, "插件 %s 的宿主服务已失效", h.name)
+	}
+	return h.manager.PublishTopic(h.name, topic, data)
+}
+
+// SubscribeTopic 订阅随宿主服务失效而取消，热重载后由新版本在 PreLoadWithHost 中重新订阅
+func (h *pluginHost) SubscribeTopic(eventName string, handler EventHandler) (func(), error) {
+	if h.closed.Load() {
+		return nil, wrapf(ErrHostClosed, "插件 %s 的宿主服务已失效", h.name)
+	}
+	sub, err := h.manager.SubscribeTopic(h.name, eventName, handler)
+	if err != nil {
+		return nil, err
+	}
+	return h.track(h.cancels, sub.Cancel), nil
+}
+
+func (h *pluginHost) Config() ([]byte, error) {
+	if err := h.check(HostActionConfig); err != nil {
+		return nil, err
+	}
+	return h.manager.pluginConfig(h.name)
+}
+
+func (h *pluginHost) WatchConfig(handler func(config []byte)) (func(), error) {
+	if err := h.check(HostActionConfig); err != nil {
+		return nil, err
+	}
+
+	h.mu.Lock()
+	h.nextID++
+	id := h.nextID
+	h.watchers[id] = handler
+	h.mu.Unlock()
+
+	return func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		delete(h.watchers, id)
+	}, nil
+}
+
+// track 记录取消函数，返回的函数可以重复调用
+func (h *pluginHost) track(cancels map[uint64]func(), cancel func()) func() {
+	h.mu.Lock()
+	h.nextID++
+	id := h.nextID
+	cancels[id] = cancel
+	h.mu.Unlock()
+
+	return func() {
+		h.mu.Lock()
+		_, ok := cancels[id]
+		delete(cancels, id)
+		h.mu.Unlock()
+		if ok {
+			cancel()
+		}
+	}
+}
+
+// notifyConfig 通知配置监听者
+func (h *pluginHost) notifyConfig(config []byte) {
+	if h.closed.Load() {
+		return
+	}
+
+	h.mu.Lock()
+	watchers := make([]func([]byte), 0, len(h.watchers))
+	for _, id := range sortedWatcherIDs(h.watchers) {
+		watchers = append(watchers, h.watchers[id])
+	}
+	h.mu.Unlock()
+
+	for _, watcher := range watchers {
+		watcher(config)
+	}
+}
+
+func sortedWatcherIDs(watchers map[uint64]func([]byte)) []uint64 {
+	ids := make([]uint64, 0, len(watchers))
+	for id := range watchers {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+func (h *pluginHost) Get(key string) ([]byte, bool, error) {
+	if err := h.check(HostActionKVRead); err != nil {
+		return nil, false, err
+	}
+	value, ok := h.manager.config.GetPluginValue(h.name, key)
+	return value, ok, nil
+}
+
+func (h *pluginHost) Set(key string, value []byte) error {
+	if err := h.check(HostActionKVWrite); err != nil {
+		return err
+	}
+	return h.manager.config.SetPluginValue(h.name, key, value)
+}
+
+func (h *pluginHost) Delete(key string) error {
+	if err := h.check(HostActionKVWrite); err != nil {
+		return err
+	}
+	return h.manager.config.DeletePluginValue(h.name, key)
+}
+
+func (h *pluginHost) Call(plugin string, data any) (any, error) {
+	return h.CallContext(context.Background(), plugin, data)
+}
+
+func (h *pluginHost) CallContext(ctx context.Context, plugin string, data any) (any, error) {
+	if h.closed.Load() {
+		return nil, wrapf(ErrHostClosed, "插件 %s 的宿主服务已失效", h.name)
+	}
+	if !h.manager.HasPermission(h.name, HostActionCall) && !h.manager.HasPermission(h.name, HostActionCall+":"+plugin) {
+		return nil, wrapf(ErrPermissionDenied, "插件 %s 没有调用插件 %s 的权限", h.name, plugin)
+	}
+	return h.manager.ExecutePluginContext(WithCaller(ctx, "plugin:"+h.name), plugin, data)
+}
+
+// close 使宿主服务失效并取消所有订阅和配置监听
+func (h *pluginHost) close() {
+	if h.closed.Swap(true) {
+		return
+	}
+
+	h.mu.Lock()
+	cancels := h.cancels
+	h.cancels = make(map[uint64]func())
+	h.watchers = make(map[uint64]func([]byte))
+	h.mu.Unlock()
+
+	for _, cancel := range cancels {
+		cancel()
+	}
+}
+
+// hostLogger 附带插件名称的日志记录器，没有 HostActionLog 权限时丢弃日志
+type hostLogger struct {
+	host *pluginHost
+}
+
+func (l *hostLogger) log(write func(string, ...any), msg string, args []any) {
+	if l.host.check(HostActionLog) != nil {
+		return
+	}
+	write(msg, append([]any{"plugin", l.host.name}, args...)...)
+}
+
+func (l *hostLogger) Debug(msg string, args ...any) {
+	l.log(l.host.manager.logger.Debug, msg, args)
+}
+
+func (l *hostLogger) Info(msg string, args ...any) {
+	l.log(l.host.manager.logger.Info, msg, args)
+}
+
+func (l *hostLogger) Warn(msg string, args ...any) {
+	l.log(l.host.manager.logger.Warn, msg, args)
+}
+
+func (l *hostLogger) Error(msg string, args ...any) {
+	l.log(l.host.manager.logger.Error, msg, args)
+}
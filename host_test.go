@@ -0,0 +1,216 @@
+package plugmgr
+
+import (
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// hostPlugin 测试用的 HostAwarePlugin
+type hostPlugin struct {
+	fakePlugin
+	host Host
+}
+
+func (p *hostPlugin) PreLoadWithHost(host Host, config []byte) error {
+	p.host = host
+	p.config = config
+	return nil
+}
+
+// recordLogger 记录日志参数的日志记录器
+type recordLogger struct {
+	mu      sync.Mutex
+	entries [][]any
+}
+
+func (l *recordLogger) record(msg string, args []any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, append([]any{msg}, args...))
+}
+
+func (l *recordLogger) Debug(msg string, args ...any) { l.record(msg, args) }
+func (l *recordLogger) Info(msg string, args ...any)  { l.record(msg, args) }
+func (l *recordLogger) Warn(msg string, args ...any)  { l.record(msg, args) }
+func (l *recordLogger) Error(msg string, args ...any) { l.record(msg, args) }
+
+// loadHostPlugin 通过 LoadPlugin 的完整流程加载内存插件
+func loadHostPlugin(t *testing.T, m *Manager, name string, p Plugin) {
+	t.Helper()
+	path := filepath.Join(m.pluginDir, name+".so")
+	m.preloadedPlugins.Store(name, &lazyPlugin{path: path, loaded: p})
+	if err := m.LoadPlugin(path); err != nil {
+		t.Fatalf("加载插件 %s 失败: %v", name, err)
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("等待条件超时")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestHostLoggerAndEvents(t *testing.T) {
+	m := newTestManager(t)
+	logs := &recordLogger{}
+	m.SetLogger(logs)
+
+	p := &hostPlugin{}
+	loadHostPlugin(t, m, "hosted", p)
+	if p.host == nil {
+		t.Fatal("PreLoadWithHost 未被调用")
+	}
+
+	p.host.Logger().Info("hello", "k", "v")
+	logs.mu.Lock()
+	last := logs.entries[len(logs.entries)-1]
+	logs.mu.Unlock()
+	if last[0] != "hello" || last[1] != "plugin" || last[2] != "hosted" || last[3] != "k" {
+		t.Fatalf("日志未附带插件名称: %v", last)
+	}
+
+	var mu sync.Mutex
+	var received []any
+	cancel, err := p.host.Subscribe("custom", func(e Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, e.Data.Data)
+	})
+	if err != nil {
+		t.Fatalf("订阅失败: %v", err)
+	}
+
+	if err := p.host.Publish("custom", 1); err != nil {
+		t.Fatalf("发布事件失败: %v", err)
+	}
+	waitFor(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(received) == 1
+	})
+
+	cancel()
+	cancel()
+	_ = p.host.Publish("custom", 2)
+	time.Sleep(20 * time.Millisecond)
+	mu.Lock()
+	if len(received) != 1 {
+		t.Fatalf("取消订阅后仍收到事件: %v", received)
+	}
+	mu.Unlock()
+
+	if err := p.host.Publish(PluginLoaded, nil); !errors.Is(err, ErrPermissionDenied) {
+		t.Fatalf("插件不应能发布内置事件, 得到 %v", err)
+	}
+}
+
+func TestHostConfigAndKV(t *testing.T) {
+	m := newTestManager(t)
+	p := &hostPlugin{}
+	loadHostPlugin(t, m, "hosted", p)
+
+	updates := make(chan []byte, 1)
+	if _, err := p.host.WatchConfig(func(config []byte) { updates <- config }); err != nil {
+		t.Fatalf("监听配置失败: %v", err)
+	}
+
+	updated, err := m.ConfigUpdated("hosted", map[string]any{"level": 2})
+	if err != nil {
+		t.Fatalf("更新配置失败: %v", err)
+	}
+	select {
+	case config := <-updates:
+		if string(config) != string(updated) {
+			t.Fatalf("监听者收到的配置不一致")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("未收到配置更新通知")
+	}
+	if config, err := p.host.Config(); err != nil || string(config) != string(updated) {
+		t.Fatalf("Config 返回 %q, %v", config, err)
+	}
+
+	if err := p.host.Set("counter", []byte("1")); err != nil {
+		t.Fatalf("写入键值失败: %v", err)
+	}
+	if value, ok, err := p.host.Get("counter"); err != nil || !ok || string(value) != "1" {
+		t.Fatalf("读取键值得到 %q, %v, %v", value, ok, err)
+	}
+
+	// 键值数据随配置持久化，且不影响插件配置
+	reloaded, err := loadConfig(m.config.store)
+	if err != nil {
+		t.Fatalf("重新加载配置失败: %v", err)
+	}
+	if value, ok := reloaded.GetPluginValue("hosted", "counter"); !ok || string(value) != "1" {
+		t.Fatalf("键值数据未持久化: %q, %v", value, ok)
+	}
+	if data, _ := reloaded.GetPluginConfig("hosted"); string(data.Config) != string(updated) {
+		t.Fatal("写入键值不应覆盖插件配置")
+	}
+
+	if err := p.host.Delete("counter"); err != nil {
+		t.Fatalf("删除键值失败: %v", err)
+	}
+	if _, ok, _ := p.host.Get("counter"); ok {
+		t.Fatal("键值删除后仍可读取")
+	}
+
+	m.permissions.Store("hosted", &PluginPermission{AllowedActions: map[string]bool{HostActionKVRead: true}})
+	if err := p.host.Set("counter", []byte("2")); !errors.Is(err, ErrPermissionDenied) {
+		t.Fatalf("期望没有写入权限, 得到 %v", err)
+	}
+}
+
+func TestHostCallPermission(t *testing.T) {
+	m := newTestManager(t)
+	p := &hostPlugin{}
+	loadHostPlugin(t, m, "caller", p)
+	loadHostPlugin(t, m, "target", &fakePlugin{})
+
+	if _, err := p.host.Call("target", "ping"); !errors.Is(err, ErrPermissionDenied) {
+		t.Fatalf("默认不应允许调用其他插件, 得到 %v", err)
+	}
+
+	perm, _ := m.getPermission("caller")
+	perm.AllowedActions[HostActionCall+":target"] = true
+	m.SetPluginPermission("caller", &perm)
+
+	result, err := p.host.Call("target", "ping")
+	if err != nil || result != "ping" {
+		t.Fatalf("期望 ping, 得到 %v, %v", result, err)
+	}
+}
+
+func TestHostClosedAfterUnload(t *testing.T) {
+	m := newTestManager(t)
+	p := &hostPlugin{}
+	loadHostPlugin(t, m, "hosted", p)
+
+	handled := make(chan struct{}, 1)
+	if _, err := p.host.Subscribe("custom", func(Event) { handled <- struct{}{} }); err != nil {
+		t.Fatalf("订阅失败: %v", err)
+	}
+
+	if err := m.UnloadPlugin("hosted"); err != nil {
+		t.Fatalf("卸载插件失败: %v", err)
+	}
+	if err := p.host.Publish("custom", nil); !errors.Is(err, ErrHostClosed) {
+		t.Fatalf("卸载后期望 ErrHostClosed, 得到 %v", err)
+	}
+
+	_ = m.eventBus.PublishAsync(Event{EventName: "custom"})
+	select {
+	case <-handled:
+		t.Fatal("卸载后订阅应被取消")
+	case <-time.After(20 * time.Millisecond):
+	}
+}
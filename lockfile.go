@@ -0,0 +1,387 @@
+package plugmgr
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// LockFileName 锁文件在插件目录中的文件名
+const LockFileName = "plugins.lock"
+
+// lockFormatVersion 锁文件的格式版本
+const lockFormatVersion = 1
+
+// LockedPlugin 锁文件中固定的插件
+type LockedPlugin struct {
+	Name    string `json:"name"`            // 插件名称
+	Version string `json:"version"`         // 插件版本
+	SHA256  string `json:"sha256"`          // 插件文件的 SHA-256，插件包为包内的插件文件
+	KeyID   string `json:"keyId,omitempty"` // 验证签名的公钥标识，未验证签名时为空
+	Path    string `json:"path,omitempty"`  // 插件文件相对于插件目录的路径
+}
+
+// Lockfile 插件锁文件
+//
+//	记录每个启用插件的确切版本、插件文件校验和与签名公钥标识，
+//	使用同一锁文件的主机通过 Sync 得到相同的插件集合。
+type Lockfile struct {
+	Version int            `json:"version"` // 锁文件格式版本
+	Plugins []LockedPlugin `json:"plugins"` // 按名称排序的插件
+}
+
+// Lookup 查找锁文件中固定的插件
+func (l *Lockfile) Lookup(name string) (*LockedPlugin, bool) {
+	if l == nil {
+		return nil, false
+	}
+	for i := range l.Plugins {
+		if l.Plugins[i].Name == name {
+			return &l.Plugins[i], true
+		}
+	}
+	return nil, false
+}
+
+// validate 检查锁文件的内容
+func (l *Lockfile) validate() error {
+	if l.Version != lockFormatVersion {
+		return newErrorf("不支持的锁文件版本 %d", l.Version)
+	}
+	seen := make(map[string]bool, len(l.Plugins))
+	for _, p := range l.Plugins {
+		if !validPluginName(p.Name) || seen[p.Name] {
+			return newErrorf("锁文件中的插件名称无效或重复: %q", p.Name)
+		}
+		seen[p.Name] = true
+		if _, err := ParseVersion(p.Version); err != nil {
+			return wrapf(err, "锁文件中插件 %s 的版本无效", p.Name)
+		}
+		if len(p.SHA256) != 64 {
+			return newErrorf("锁文件中插件 %s 的校验和无效", p.Name)
+		}
+		if p.Path != "" && !validPackagePath(p.Path) {
+			return newErrorf("锁文件中插件 %s 的路径无效: %s", p.Name, p.Path)
+		}
+	}
+	return nil
+}
+
+// ReadLockfile 读取锁文件
+//
+//	参数:
+//	- path: 锁文件路径
+//	返回:
+//	- *Lockfile: 锁文件内容
+//	- error: 文件不存在或格式无效时返回错误
+func ReadLockfile(path string) (*Lockfile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, wrap(err, "读取锁文件失败")
+	}
+	var lock Lockfile
+	if err := json.Unmarshal(data, &lock); err != nil {
+		return nil, wrap(err, "解析锁文件失败")
+	}
+	if err := lock.validate(); err != nil {
+		return nil, err
+	}
+	return &lock, nil
+}
+
+// WithStrictLock 启用锁文件的严格模式
+//
+//	创建管理器时读取 <pluginDir>/plugins.lock，锁文件不存在时创建失败。
+//	之后只加载锁文件中固定且校验和与签名公钥一致的插件，其他插件返回 ErrNotLocked 或 ErrChecksumMismatch。
+func WithStrictLock() ManagerOption {
+	return func(o *managerOptions) {
+		o.strictLock = true
+	}
+}
+
+// lockPath 返回锁文件路径
+func (m *Manager) lockPath() string {
+	return filepath.Join(m.pluginDir, LockFileName)
+}
+
+// Lockfile 返回管理器使用的锁文件，未启用严格模式且未调用 Lock 或 Sync 时返回 false
+func (m *Manager) Lockfile() (*Lockfile, bool) {
+	m.lockMu.RLock()
+	defer m.lockMu.RUnlock()
+	return m.lockfile, m.lockfile != nil
+}
+
+func (m *Manager) setLockfile(lock *Lockfile) {
+	m.lockMu.Lock()
+	m.lockfile = lock
+	m.lockMu.Unlock()
+}
+
+// publicKeyID 返回验证插件签名的公钥标识，未设置公钥时返回空字符串
+func (m *Manager) publicKeyID() (string, error) {
+	if m.publicKeyPath == "" {
+		return "", nil
+	}
+	key, err := loadPublicKey(m.publicKeyPath)
+	if err != nil {
+		return "", err
+	}
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return "", wrap(err, "编码公钥失败")
+	}
+	return keyID(der), nil
+}
+
+// checkLockKey 检查当前的公钥是否为锁文件记录的签名公钥
+func (m *Manager) checkLockKey(entry *LockedPlugin) error {
+	if entry.KeyID == "" {
+		return nil
+	}
+	id, err := m.publicKeyID()
+	if err != nil {
+		return err
+	}
+	if id != entry.KeyID {
+		return wrapf(ErrInvalidSignature, "插件 %s 应使用公钥 %s 验证签名，当前公钥为 %q", entry.Name, entry.KeyID, id)
+	}
+	return nil
+}
+
+// checkLocked 严格模式下检查插件文件是否为锁文件固定的版本
+func (m *Manager) checkLocked(name, path string) error {
+	if !m.strictLock {
+		return nil
+	}
+	lock, _ := m.Lockfile()
+	entry, ok := lock.Lookup(name)
+	if !ok {
+		return wrapf(ErrNotLocked, "插件 %s 未在锁文件中固定", name)
+	}
+	if sum := fileChecksum(path); sum != entry.SHA256 {
+		return wrapf(ErrChecksumMismatch, "插件文件 %s 与锁文件中的 %s %s 不一致", path, name, entry.Version)
+	}
+	return m.checkLockKey(entry)
+}
+
+// filterLocked 严格模式下移除未通过锁文件检查的插件，返回拒绝加载的原因
+func (m *Manager) filterLocked(paths map[string]string) error {
+	var errs []error
+	for _, name := range sortedKeys(paths) {
+		if err := m.checkLocked(name, paths[name]); err != nil {
+			delete(paths, name)
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Lock 根据当前状态写入锁文件
+//
+//	返回:
+//	- error: 启用的插件未加载或写入失败时返回错误
+//	功能:
+//	- 为每个启用的插件记录已加载的版本、插件文件的 SHA-256 和签名公钥标识
+//	- 写入 <pluginDir>/plugins.lock，插件按名称排序，相同状态生成相同的文件
+//	- 严格模式下之后的加载使用新的锁文件
+func (m *Manager) Lock() error {
+	keyID, err := m.publicKeyID()
+	if err != nil {
+		return wrap(err, "读取公钥失败")
+	}
+
+	enabled := m.config.GetEnabledPlugins()
+	sort.Strings(enabled)
+	lock := &Lockfile{Version: lockFormatVersion, Plugins: make([]LockedPlugin, 0, len(enabled))}
+	for _, name := range enabled {
+		v, ok := m.plugins.Load(name)
+		if !ok {
+			return wrapf(ErrPluginNotFound, "插件 %s 已启用但未加载", name)
+		}
+		lazyPlug := v.(*lazyPlugin)
+		real, err := filepath.EvalSymlinks(lazyPlug.path)
+		if err != nil {
+			return wrapf(err, "读取插件 %s 的文件失败", name)
+		}
+		sum := fileChecksum(real)
+		if sum == "" {
+			return newErrorf("计算插件 %s 的校验和失败", name)
+		}
+		entry := LockedPlugin{Name: name, Version: lazyPlug.loaded.Metadata().Version, SHA256: sum, KeyID: keyID}
+		if rel, err := filepath.Rel(m.pluginDir, real); err == nil && validPackagePath(filepath.ToSlash(rel)) {
+			entry.Path = filepath.ToSlash(rel)
+		}
+		lock.Plugins = append(lock.Plugins, entry)
+	}
+
+	data, err := json.MarshalIndent(lock, "", "  ")
+	if err != nil {
+		return wrap(err, "编码锁文件失败")
+	}
+	if err := writeFileAtomic(m.lockPath(), append(data, '\n'), 0o644); err != nil {
+		return wrap(err, "写入锁文件失败")
+	}
+	m.setLockfile(lock)
+	m.logger.Info("已写入锁文件", "path", m.lockPath(), "plugins", len(lock.Plugins))
+	return nil
+}
+
+// Sync 使插件目录与锁文件一致
+//
+//	功能:
+//	- 参见 SyncContext
+func (m *Manager) Sync() error {
+	return m.SyncContext(context.Background())
+}
+
+// SyncContext 使插件目录与锁文件一致
+//
+//	参数:
+//	- ctx: 上下文，用于取消下载
+//	返回:
+//	- error: 读取锁文件、下载或加载过程中的错误
+//	功能:
+//	- 读取 <pluginDir>/plugins.lock，本地没有校验和一致的插件文件时从仓库下载锁定的版本
+//	- 将 <pluginDir>/<name>.so 指向锁定的版本，删除未锁定插件的链接
+//	- 禁用并卸载未锁定的插件，卸载文件与锁文件不一致的插件
+//	- 启用锁定的插件并按依赖顺序加载
+func (m *Manager) SyncContext(ctx context.Context) error {
+	lock, err := ReadLockfile(m.lockPath())
+	if err != nil {
+		return err
+	}
+
+	// 在替换链接之前记录已加载插件的文件校验和
+	loaded := make(map[string]string)
+	m.plugins.Range(func(key, value any) bool {
+		loaded[key.(string)] = fileChecksum(value.(*lazyPlugin).path)
+		return true
+	})
+
+	paths := make(map[string]string, len(lock.Plugins))
+	for i := range lock.Plugins {
+		entry := &lock.Plugins[i]
+		path, err := m.syncLocked(ctx, entry)
+		if err != nil {
+			return wrapf(err, "同步插件 %s %s 失败", entry.Name, entry.Version)
+		}
+		paths[entry.Name] = path
+	}
+	m.setLockfile(lock)
+	m.removeUnlockedLinks(lock)
+
+	for _, name := range sortedKeys(loaded) {
+		entry, ok := lock.Lookup(name)
+		var err error
+		switch {
+		case !ok:
+			err = m.DisablePlugin(name, WithCascade())
+		case loaded[name] != entry.SHA256:
+			err = m.UnloadPlugin(name, WithCascade())
+		}
+		// 级联卸载可能已经卸载了后面的插件
+		if err != nil && !errors.Is(err, ErrPluginNotFound) {
+			return wrapf(err, "卸载插件 %s 失败", name)
+		}
+	}
+	for _, name := range m.config.GetEnabledPlugins() {
+		if _, ok := lock.Lookup(name); !ok {
+			if err := m.config.SetEnabled(name, false); err != nil {
+				return wrapf(err, "禁用插件 %s 失败", name)
+			}
+		}
+	}
+	for _, entry := range lock.Plugins {
+		if err := m.config.SetEnabled(entry.Name, true); err != nil {
+			return wrapf(err, "启用插件 %s 失败", entry.Name)
+		}
+		if err := m.versionManager.AddVersion(entry.Name, entry.Version); err == nil {
+			m.versionManager.SetActiveVersion(entry.Name, entry.Version)
+		}
+	}
+
+	return m.loadPluginsOrdered(paths, func(name, path string) error {
+		return m.LoadPlugin(path)
+	})
+}
+
+// syncLocked 准备锁定版本的插件文件并激活，返回插件文件路径
+func (m *Manager) syncLocked(ctx context.Context, entry *LockedPlugin) (string, error) {
+	if err := m.checkLockKey(entry); err != nil {
+		return "", err
+	}
+
+	var path string
+	if entry.Path != "" {
+		path = filepath.Join(m.pluginDir, filepath.FromSlash(entry.Path))
+	}
+	if path == "" || fileChecksum(path) != entry.SHA256 {
+		var err error
+		if path, err = m.downloadLocked(ctx, entry); err != nil {
+			return "", err
+		}
+	}
+	return path, m.activatePluginFile(entry.Name, path)
+}
+
+// downloadLocked 从仓库下载锁定的版本，并检查插件文件的校验和
+func (m *Manager) downloadLocked(ctx context.Context, entry *LockedPlugin) (string, error) {
+	lastErr := wrapf(ErrPluginNotFound, "本地和仓库中都没有 %s %s", entry.Name, entry.Version)
+	for _, repo := range m.Repositories() {
+		index, err := repo.Index(ctx)
+		if err != nil {
+			lastErr = wrapf(err, "读取仓库 %s 的索引失败", repo.URL)
+			continue
+		}
+		plugin, ok := index.Lookup(entry.Name)
+		if !ok {
+			continue
+		}
+		for i := range plugin.Releases {
+			release := &plugin.Releases[i]
+			if !release.Compatible() || compareVersionStrings(release.Version, entry.Version) != 0 {
+				continue
+			}
+			path, _, err := m.fetchRelease(ctx, repo, entry.Name, release)
+			if err != nil {
+				lastErr = err
+				continue
+			}
+			if fileChecksum(path) != entry.SHA256 {
+				lastErr = wrapf(ErrChecksumMismatch, "仓库 %s 中的 %s %s 与锁文件不一致", repo.URL, entry.Name, entry.Version)
+				continue
+			}
+			return path, nil
+		}
+	}
+	return "", lastErr
+}
+
+// removeUnlockedLinks 删除插件目录中未锁定插件的激活链接
+//
+//	只删除指向版本目录的符号链接，手动放置的插件文件保持不变。
+func (m *Manager) removeUnlockedLinks(lock *Lockfile) {
+	entries, err := os.ReadDir(m.pluginDir)
+	if err != nil {
+		m.logger.Warn("读取插件目录失败", "error", err)
+		return
+	}
+	for _, e := range entries {
+		ext := filepath.Ext(e.Name())
+		if e.Type()&os.ModeSymlink == 0 || (ext != ".so" && ext != ProcessPluginExt) {
+			continue
+		}
+		if _, ok := lock.Lookup(strings.TrimSuffix(e.Name(), ext)); ok {
+			continue
+		}
+		link := filepath.Join(m.pluginDir, e.Name())
+		os.Remove(link)
+		os.Remove(link + signatureExt)
+		m.logger.Info("已删除未锁定插件的链接", "path", link)
+	}
+}
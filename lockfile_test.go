@@ -0,0 +1,194 @@
+package plugmgr
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeLockfile 修改并写入锁文件
+func writeLockfile(t *testing.T, path string, lock *Lockfile) {
+	t.Helper()
+	data, err := json.Marshal(lock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLockAndStrictMode(t *testing.T) {
+	dir := t.TempDir()
+	m, err := NewManager(dir, "config.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.SetSandbox(nopSandbox{})
+
+	path := m.versionedPluginPath("greeter", "1.0.0", ".so")
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("greeter 1"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.activatePluginFile("greeter", path); err != nil {
+		t.Fatal(err)
+	}
+	preloadRelease(m, "greeter", "1.0.0", nil)
+	if err := m.LoadPlugin(path); err != nil {
+		t.Fatal(err)
+	}
+	m.config.SetEnabled("greeter", true)
+
+	m.config.SetEnabled("extra", true)
+	if err := m.Lock(); !errors.Is(err, ErrPluginNotFound) {
+		t.Fatalf("启用的插件未加载时应返回 ErrPluginNotFound, 得到 %v", err)
+	}
+	m.config.SetEnabled("extra", false)
+	if err := m.Lock(); err != nil {
+		t.Fatalf("写入锁文件失败: %v", err)
+	}
+	lock, err := ReadLockfile(filepath.Join(dir, LockFileName))
+	if err != nil {
+		t.Fatalf("读取锁文件失败: %v", err)
+	}
+	entry, ok := lock.Lookup("greeter")
+	if !ok || len(lock.Plugins) != 1 || entry.Version != "1.0.0" || entry.SHA256 != fileChecksumOf("greeter 1") ||
+		entry.Path != "versions/greeter/1.0.0/greeter.so" || entry.KeyID != "" {
+		t.Fatalf("锁文件内容不正确: %+v", lock)
+	}
+	m.Shutdown()
+
+	if _, err := NewManagerWithOptions(t.TempDir(), "config.db", WithStrictLock()); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("严格模式下没有锁文件时应创建失败, 得到 %v", err)
+	}
+
+	strict, err := NewManagerWithOptions(dir, "config.db", WithStrictLock())
+	if err != nil {
+		t.Fatalf("创建严格模式的管理器失败: %v", err)
+	}
+	defer strict.Shutdown()
+	strict.SetSandbox(nopSandbox{})
+
+	other := filepath.Join(dir, "other.so")
+	if err := os.WriteFile(other, []byte("other"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := strict.LoadPlugin(other); !errors.Is(err, ErrNotLocked) {
+		t.Fatalf("未固定的插件应返回 ErrNotLocked, 得到 %v", err)
+	}
+
+	link := filepath.Join(dir, "greeter.so")
+	strict.preloadedPlugins.Store("greeter", &lazyPlugin{path: link, loaded: &fakePlugin{metadata: PluginMetadata{Version: "1.0.0"}}})
+	if err := strict.LoadEnabledPlugins(dir); err != nil {
+		t.Fatalf("加载固定的插件失败: %v", err)
+	}
+	if _, ok := strict.plugins.Load("greeter"); !ok {
+		t.Fatal("固定的插件应被加载")
+	}
+
+	// 锁文件固定了插件文件的内容，其他版本无法替换
+	update := m.versionedPluginPath("greeter", "1.1.0", ".so")
+	if err := os.MkdirAll(filepath.Dir(update), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(update, []byte("greeter 1.1"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := strict.HotReload("greeter", update); !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("与锁文件不一致的插件文件应返回 ErrChecksumMismatch, 得到 %v", err)
+	}
+}
+
+func TestSyncFromLockfile(t *testing.T) {
+	repo := newTestRepository(t)
+	repo.add("greeter", PluginRelease{Version: "1.0.0"}, "v1.0.0")
+	repo.add("greeter", PluginRelease{Version: "1.1.0"}, "v1.1.0")
+
+	// 主机 A 安装 1.0.0 并写入锁文件
+	a := newResolverTestManager(t, repo)
+	preloadRelease(a, "greeter", "1.0.0", nil)
+	if err := a.InstallPlugin("greeter", "1.0.0"); err != nil {
+		t.Fatal(err)
+	}
+	a.config.SetEnabled("greeter", true)
+	if err := a.Lock(); err != nil {
+		t.Fatalf("写入锁文件失败: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(a.pluginDir, LockFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 主机 B 安装了 1.1.0 和未锁定的插件
+	b := newResolverTestManager(t, repo)
+	preloadRelease(b, "greeter", "1.1.0", nil)
+	if err := b.InstallPlugin("greeter", "1.1.0"); err != nil {
+		t.Fatal(err)
+	}
+	b.config.SetEnabled("greeter", true)
+	addLoadedPlugin(b, "extra", "1.0.0", nil)
+	b.config.SetEnabled("extra", true)
+	if err := os.Symlink("versions/extra/1.0.0/extra.so", filepath.Join(b.pluginDir, "extra.so")); err != nil {
+		t.Fatal(err)
+	}
+	lockPath := filepath.Join(b.pluginDir, LockFileName)
+	if err := os.WriteFile(lockPath, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	preloadRelease(b, "greeter", "1.0.0", nil)
+	if err := b.Sync(); err != nil {
+		t.Fatalf("同步锁文件失败: %v", err)
+	}
+	v, ok := b.plugins.Load("greeter")
+	if !ok || v.(*lazyPlugin).loaded.Metadata().Version != "1.0.0" {
+		t.Fatal("同步后应加载锁定的 greeter 1.0.0")
+	}
+	path := b.versionedPluginPath("greeter", "1.0.0", ".so")
+	if target, err := filepath.EvalSymlinks(filepath.Join(b.pluginDir, "greeter.so")); err != nil || target != path {
+		t.Fatalf("greeter.so 应指向锁定的版本, 得到 %q %v", target, err)
+	}
+	if content, _ := os.ReadFile(path); string(content) != "v1.0.0" {
+		t.Fatalf("应从仓库下载锁定的版本, 得到 %q", content)
+	}
+	if _, ok := b.plugins.Load("extra"); ok || b.config.IsEnabled("extra") {
+		t.Fatal("未锁定的插件应被禁用并卸载")
+	}
+	if _, err := os.Lstat(filepath.Join(b.pluginDir, "extra.so")); !os.IsNotExist(err) {
+		t.Fatalf("应删除未锁定插件的链接: %v", err)
+	}
+
+	lock, err := ReadLockfile(lockPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lock.Plugins[0].KeyID = "0000000000000000"
+	writeLockfile(t, lockPath, lock)
+	if err := b.Sync(); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("签名公钥与锁文件不一致时应返回 ErrInvalidSignature, 得到 %v", err)
+	}
+
+	lock.Plugins[0].KeyID, lock.Plugins[0].Path = "", ""
+	lock.Plugins[0].SHA256 = fileChecksumOf("other")
+	writeLockfile(t, lockPath, lock)
+	if err := b.Sync(); !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("仓库中的版本与锁文件不一致时应返回 ErrChecksumMismatch, 得到 %v", err)
+	}
+}
+
+func TestReadLockfileRejectsInvalidNames(t *testing.T) {
+	path := filepath.Join(t.TempDir(), LockFileName)
+	for _, name := range []string{"", "../x", "a/b", ".hidden"} {
+		writeLockfile(t, path, &Lockfile{Version: lockFormatVersion, Plugins: []LockedPlugin{
+			{Name: name, Version: "1.0.0", SHA256: fileChecksumOf("x")},
+		}})
+		if _, err := ReadLockfile(path); err == nil {
+			t.Fatalf("插件名称 %q 应被拒绝", name)
+		}
+	}
+}
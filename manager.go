@@ -1,12 +1,14 @@
 package plugmgr
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"os"
 	"path/filepath"
 	"plugin"
 	"runtime"
-	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -17,9 +19,12 @@ import (
 )
 
 // PluginPermission 插件权限定义
+//
+//	权限同时用于插件自身发起的操作和调用方对插件的操作，后者的检查规则见 Manager.Authorize。
 type PluginPermission struct {
-	AllowedActions map[string]bool // 允许的操作列表
-	Roles          []string        // 角色列表
+	AllowedActions map[string]bool     // 允许的操作列表
+	Roles          []string            // 角色列表
+	RoleActions    map[string][]string // 角色可以对插件执行的操作，覆盖 SetRolePolicy 设置的全局策略
 }
 
 // Manager 插件管理器
@@ -31,7 +36,7 @@ type PluginPermission struct {
 //	字段说明:
 //	- plugins: 已加载的插件映射
 //	- config: 插件配置管理器
-//	- dependencies: 插件依赖关系映射
+//	- dependencies: 已加载插件的正向和反向依赖索引
 //	- stats: 插件执行统计信息
 //	- eventBus: 事件总线，用于插件事件通知
 //	- sandbox: 插件沙箱环境
@@ -41,13 +46,17 @@ type PluginPermission struct {
 //	- versionManager: 插件版本管理器
 //	- pluginMarket: 插件市场接口
 //	- permissions: 插件权限配置映射
+//	- timeouts: 插件执行超时配置映射
+//	- defaultTimeout: 插件执行的全局默认超时时间
+//	- hosts: 插件当前使用的宿主服务
 type Manager struct {
 	plugins       sync.Map // map[string]*lazyPlugin
 	config        *config
-	dependencies  sync.Map // map[string]map[string]string
+	dependencies  *dependencyIndex
 	stats         sync.Map // map[string]*PluginStats
 	eventBus      *eventBus
 	sandbox       Sandbox
+	sandboxes     sync.Map // map[string]Sandbox
 	publicKeyPath string
 	pluginDir     string
 	logger        Logger
@@ -56,19 +65,73 @@ type Manager struct {
 	pluginMarket     *PluginMarket
 	permissions      sync.Map // map[string]*PluginPermission
 	preloadedPlugins sync.Map
+	timeouts         sync.Map // map[string]time.Duration
+	defaultTimeout   time.Duration
+
+	resourceLimits sync.Map // map[string]CgroupLimits
+	cgroupParent   string
+	cgroupOnce     sync.Once
+	cgroups        *cgroupManager
+	cgroupErr      error
+
+	hosts sync.Map // map[string]*pluginHost
+
+	configDir string   // 配置覆盖文件所在目录
+	overrides sync.Map // map[string]*configOverrides
+
+	keys KeyProvider // 加密配置中密钥字段的密钥提供者
+
+	watcher atomic.Pointer[ConfigWatcher] // 正在运行的配置文件监视器
+
+	topics topicRegistry // 插件的主题订阅
+
+	repoMu       sync.RWMutex
+	repositories []*PluginRepository // 插件仓库，按添加顺序查找
+
+	packages sync.Map // 从插件包加载的插件，值为 *loadedPackage
+
+	lockMu     sync.RWMutex
+	lockfile   *Lockfile // 锁文件，由严格模式、Lock 或 Sync 设置
+	strictLock bool      // 严格模式下只加载锁文件中固定的插件
 }
 
 type lazyPlugin struct {
-	path   string
-	loaded Plugin
-	mu     sync.Mutex
+	path      string
+	loaded    Plugin
+	logger    Logger
+	sandbox   Sandbox
+	newCgroup func() (*pluginCgroup, error)
+	mu        sync.Mutex
 }
 
 // load 加载插件实例
+//
+//	.so 文件通过 plugin.Open 加载到当前进程，.plugin 文件作为进程插件启动，
+//	其他文件返回 ErrUnsupportedPluginFile，不会被执行。
 func (lp *lazyPlugin) load() error {
 	lp.mu.Lock()
 	defer lp.mu.Unlock()
 
+	if lp.loaded == nil && !isProcessPlugin(lp.path) && filepath.Ext(lp.path) != ".so" {
+		return wrapf(ErrUnsupportedPluginFile, "插件文件 %s 的扩展名应为 .so 或 %s", lp.path, ProcessPluginExt)
+	}
+
+	if lp.loaded == nil && isProcessPlugin(lp.path) {
+		var cgroup *pluginCgroup
+		if lp.newCgroup != nil {
+			var err error
+			if cgroup, err = lp.newCgroup(); err != nil {
+				return err
+			}
+		}
+		p, err := startProcessPlugin(lp.path, lp.logger, lp.sandbox, cgroup)
+		if err != nil {
+			return wrapf(err, "启动进程插件失败: %s", lp.path)
+		}
+		lp.loaded = p
+		return nil
+	}
+
 	if lp.loaded == nil {
 		p, err := plugin.Open(lp.path)
 		if err != nil {
@@ -90,44 +153,182 @@ func (lp *lazyPlugin) load() error {
 	return nil
 }
 
+// execute 在上下文控制下执行插件
+//
+//	插件在独立的 goroutine 中运行，上下文结束时立即返回。
+//	未实现 ContextPlugin 的插件无法被中断，其 goroutine 会在插件返回后退出。
+func (lp *lazyPlugin) execute(ctx context.Context, data any) (any, error) {
+	type execResult struct {
+		value any
+		err   error
+	}
+
+	done := make(chan execResult, 1)
+	go func() {
+		var res execResult
+		defer func() {
+			if r := recover(); r != nil {
+				res.err = newErrorf("插件执行发生 panic: %v", r)
+			}
+			done <- res
+		}()
+
+		if cp, ok := lp.loaded.(ContextPlugin); ok {
+			res.value, res.err = cp.ExecuteContext(ctx, data)
+		} else {
+			res.value, res.err = lp.loaded.Execute(data)
+		}
+	}()
+
+	select {
+	case res := <-done:
+		return res.value, res.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// release 释放已打开但未被管理器使用的插件实例
+//
+//	.so 插件无法从进程中卸载，只有进程插件需要结束子进程。
+func (lp *lazyPlugin) release() {
+	lp.mu.Lock()
+	defer lp.mu.Unlock()
+
+	if p, ok := lp.loaded.(*processPlugin); ok {
+		_ = p.Shutdown()
+	}
+	lp.loaded = nil
+}
+
+// ManagerOption 插件管理器创建选项
+type ManagerOption func(*managerOptions)
+
+type managerOptions struct {
+	publicKeyPath string
+	store         ConfigStore
+	configDir     string
+	keys          KeyProvider
+	eventBus      []EventBusOption
+
+	journalDir     string
+	journalOptions []EventJournalOption
+
+	repositories []*PluginRepository
+
+	strictLock bool
+}
+
+// WithPublicKey 设置验证插件签名的公钥路径
+func WithPublicKey(path string) ManagerOption {
+	return func(o *managerOptions) {
+		o.publicKeyPath = path
+	}
+}
+
+// WithConfigStore 设置配置存储，默认使用插件目录下 configPath 对应的 FileConfigStore
+func WithConfigStore(store ConfigStore) ManagerOption {
+	return func(o *managerOptions) {
+		o.store = store
+	}
+}
+
 // NewManager 创建新的插件管理器实例
 //
 //	参数:
 //	- pluginDir: 插件目录路径
-//	- configPath: 配置文件路径
+//	- configPath: 配置文件路径，相对于插件目录
 //	- publicKeyPath: 可选的公钥路径，用于验证插件签名
 //	功能:
+//	- 等价于只传入 WithPublicKey 的 NewManagerWithOptions，需要其他选项时使用 NewManagerWithOptions
+//	返回:
+//	- *Manager: 插件管理器实例
+//	- error: 初始化过程中的错误信息
+func NewManager(pluginDir, configPath string, publicKeyPath ...string) (*Manager, error) {
+	var opts []ManagerOption
+	if len(publicKeyPath) > 0 {
+		opts = append(opts, WithPublicKey(publicKeyPath[0]))
+	}
+	return NewManagerWithOptions(pluginDir, configPath, opts...)
+}
+
+// NewManagerWithOptions 使用创建选项创建新的插件管理器实例
+//
+//	参数:
+//	- pluginDir: 插件目录路径
+//	- configPath: 配置文件路径，相对于插件目录，使用 WithConfigStore 时忽略
+//	- opts: 创建选项，例如 WithPublicKey、WithConfigStore、WithConfigDir、WithKeyProvider、WithEventBus
+//	功能:
 //	- 初始化插件管理器及其依赖组件
-//	- 加载配置文件
+//	- 加载配置，配置损坏时回退到最后一个完好的快照并记录警告
 //	- 设置沙箱环境
 //	- 初始化事件总线、版本管理器和插件市场
 //	- 如果未指定启用的插件，则加载所有插件
 //	返回:
 //	- *Manager: 插件管理器实例
 //	- error: 初始化过程中的错误信息
-func NewManager(pluginDir, configPath string, publicKeyPath ...string) (*Manager, error) {
+func NewManagerWithOptions(pluginDir, configPath string, opts ...ManagerOption) (*Manager, error) {
 	if runtime.GOOS == "windows" {
 		return nil, newError("插件系统暂不支持Windows环境下运行")
 	}
-	config, err := LoadConfig(configPath, pluginDir)
-	if err != nil {
+
+	var options managerOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if options.store == nil {
+		options.store = NewFileConfigStore(filepath.Join(pluginDir, configPath))
+	}
+
+	config, err := loadConfig(options.store)
+	if config == nil {
 		return nil, wrap(err, "加载配置失败")
 	}
 
-	sandboxDir := filepath.Join(pluginDir, "sandbox")
+	eventBus := newEventBus(options.eventBus...)
+	if options.journalDir != "" {
+		journal, openErr := OpenEventJournal(options.journalDir, options.journalOptions...)
+		if openErr != nil {
+			config.Close()
+			return nil, wrap(openErr, "打开事件日志失败")
+		}
+		eventBus.journal = journal
+	}
 
 	m := &Manager{
 		config:         config,
-		eventBus:       newEventBus(),
-		sandbox:        newSandbox(sandboxDir),
+		dependencies:   newDependencyIndex(),
+		eventBus:       eventBus,
+		sandbox:        nopSandbox{},
 		versionManager: newVersionManager(),
 		pluginMarket:   newPluginMarket(),
 		logger:         &logger{logger: slog.Default()},
 		pluginDir:      pluginDir,
+		publicKeyPath:  options.publicKeyPath,
+		configDir:      options.configDir,
+		keys:           options.keys,
 	}
 
-	if len(publicKeyPath) > 0 {
-		m.publicKeyPath = publicKeyPath[0]
+	if err != nil {
+		m.logger.Warn("配置已损坏，使用最后一个完好的快照", "error", err)
+	}
+
+	m.LoadPluginPermissions(m.config.PluginPermissions())
+
+	for _, repo := range options.repositories {
+		if err := m.AddRepository(repo); err != nil {
+			m.Shutdown()
+			return nil, err
+		}
+	}
+
+	if options.strictLock {
+		lock, err := ReadLockfile(m.lockPath())
+		if err != nil {
+			m.Shutdown()
+			return nil, wrap(err, "严格模式需要锁文件")
+		}
+		m.lockfile, m.strictLock = lock, true
 	}
 
 	if len(m.config.enabled) == 0 {
@@ -169,39 +370,66 @@ func (m *Manager) PreloadPlugins(names []string) error {
 //	path: 插件文件的完整路径
 //	功能:
 //	- 验证插件签名(如果启用)
-//	- 加载插件并初始化
 //	- 设置默认权限
+//	- 合并已保存的配置、配置文件、环境变量和运行时覆盖，见 ResolveConfig
+//	- 使用插件的 JSON Schema 校验合并后的配置
+//	- 加载插件并初始化，实现 HostAwarePlugin 的插件获得宿主服务
 //	- 触发加载事件
-func (m *Manager) LoadPlugin(path string) error {
-	if m.publicKeyPath != "" {
-		if err := m.VerifyPluginSignature(path, m.publicKeyPath); err != nil {
-			return wrap(err, "验证插件签名失败")
-		}
+func (m *Manager) LoadPlugin(path string) (err error) {
+	start := time.Now()
+	pluginName := pluginNameFromPath(path)
+	manifest, err := m.verifyPlugin(pluginName, path, true)
+	if err != nil {
+		return wrap(err, "验证插件签名失败")
 	}
 
-	pluginName := filepath.Base(path)
-	pluginName = strings.TrimSuffix(pluginName, ".so")
-
-	if _, loaded := m.plugins.LoadOrStore(pluginName, &lazyPlugin{path: path}); loaded {
+	lazyPlug := m.takePreloaded(pluginName, path)
+	if _, loaded := m.plugins.LoadOrStore(pluginName, lazyPlug); loaded {
+		lazyPlug.release()
 		return newErrorf("插件 %s 已加载", pluginName)
 	}
-
-	pluginInfo, _ := m.plugins.Load(pluginName)
-	lazyPlug := pluginInfo.(*lazyPlugin)
+	// 注册后的任何失败都撤销注册，释放插件实例并解除宿主服务和主题订阅
+	defer func() {
+		if err != nil {
+			m.abortLoad(pluginName, lazyPlug)
+		}
+	}()
 
 	if err := lazyPlug.load(); err != nil {
 		return wrapf(err, "加载插件 %s 失败", pluginName)
 	}
 
+	if err := manifest.checkMetadata(lazyPlug.loaded.Metadata()); err != nil {
+		return err
+	}
+
 	configToUse, err := m.loadPluginConfig(pluginName)
 	if err != nil {
 		return wrap(err, "加载插件配置失败")
 	}
 
-	if err := lazyPlug.loaded.PreLoad(configToUse); err != nil {
-		return wrapf(err, "%s 的预加载钩子失败", pluginName)
+	plainConfig, err := m.openConfig(pluginName, configToUse)
+	if err != nil {
+		return wrap(err, "解密插件配置失败")
+	}
+
+	resolved, err := m.resolveConfig(pluginName, plainConfig)
+	if err != nil {
+		return wrap(err, "合并插件配置层失败")
+	}
+
+	if err := validateConfig(pluginName, lazyPlug.loaded, resolved.Config); err != nil {
+		return err
 	}
 
+	m.initPluginPermission(pluginName, manifest.permissions()...)
+
+	host, err := m.preLoad(pluginName, lazyPlug.loaded, resolved.Config)
+	if err != nil {
+		return err
+	}
+	m.attachHost(pluginName, host)
+
 	if err := lazyPlug.loaded.Init(); err != nil {
 		return wrapf(err, "%s 的初始化失败", pluginName)
 	}
@@ -211,6 +439,7 @@ func (m *Manager) LoadPlugin(path string) error {
 		EventName: PluginInitialized,
 		Data: EventData{
 			Name: pluginName,
+			Data: PluginInitializedPayload{Path: path},
 		},
 	})
 
@@ -222,6 +451,9 @@ func (m *Manager) LoadPlugin(path string) error {
 
 	if configToUse != nil {
 		metadata.Config = configToUse
+		if configToUse, err = m.sealConfig(pluginName, configToUse); err != nil {
+			return err
+		}
 		err = m.config.SetPluginConfig(pluginName, configToUse)
 		if err != nil {
 			return wrap(err, "保存配置失败")
@@ -231,53 +463,170 @@ func (m *Manager) LoadPlugin(path string) error {
 	if err := m.checkDependencies(pluginName, metadata.Dependencies); err != nil {
 		return wrap(err, "检查插件依赖失败")
 	}
+	m.dependencies.Set(pluginName, metadata.Dependencies)
 
 	m.stats.Store(pluginName, &PluginStats{})
+	m.setPackage(pluginName, path, manifest)
 
-	// 使用 Notify 方法发布插件加载事件
-	m.eventBus.PublishAsync(Event{
-		EventName: PluginLoaded,
-		Data: EventData{
-			Name: pluginName,
-		},
-	})
+	m.publishLoaded(pluginName, path, metadata.Version, start)
 
 	m.logger.Info("插件已加载", "plugin", pluginName, "version", metadata.Version)
 
-	// 初始化默认权限
-	m.SetPluginPermission(pluginName, &PluginPermission{
-		AllowedActions: map[string]bool{
-			"execute": true,  // 默认允许执行
-			"read":    true,  // 默认允许读取
-			"write":   false, // 默认禁止写入
-			"admin":   false, // 默认禁止管理操作
-		},
-		Roles: []string{"user"}, // 默认用户角色
+	return nil
+}
+
+// abortLoad 撤销加载失败的插件
+//
+//	删除插件注册和加载过程中记录的状态，解除宿主服务和主题订阅，
+//	并释放插件实例，进程插件的子进程随之退出。
+func (m *Manager) abortLoad(name string, lazyPlug *lazyPlugin) {
+	m.plugins.CompareAndDelete(name, lazyPlug)
+	m.stats.Delete(name)
+	m.packages.Delete(name)
+	m.dependencies.Remove(name)
+	m.attachHost(name, nil)
+	m.removeTopics(name)
+	m.permissions.Delete(name)
+	lazyPlug.release()
+}
+
+// initPluginPermission 为尚未配置权限的插件设置权限
+//
+//	优先使用配置中保存的权限，否则使用默认权限：
+//	允许执行、读取和除 HostActionCall 以外的宿主服务，禁止写入和管理操作。
+//	插件包清单声明的 required 操作同样被允许。
+//	必须在 PreLoad 之前调用，插件在 PreLoad 中即可使用宿主服务。
+func (m *Manager) initPluginPermission(name string, required ...string) {
+	if permission, ok := m.config.GetPluginPermissions(name); ok {
+		m.permissions.LoadOrStore(name, permission)
+		return
+	}
+
+	// 写入和管理操作不设置为 false，由角色策略决定，显式禁止对所有角色生效
+	actions := map[string]bool{
+		"execute": true, // 默认允许执行
+		"read":    true, // 默认允许读取
+	}
+	for action, allowed := range defaultHostActions {
+		actions[action] = allowed
+	}
+	for _, action := range required {
+		actions[action] = true
+	}
+	m.permissions.LoadOrStore(name, &PluginPermission{
+		AllowedActions: actions,
+		Roles:          []string{RoleUser, RoleAdmin}, // 默认用户和管理员角色
 	})
+}
 
-	return nil
+// preLoad 执行插件的预加载钩子
+//
+//	实现 HostAwarePlugin 的插件通过 PreLoadWithHost 获得新的宿主服务，
+//	返回的宿主服务需要调用 attachHost 绑定到插件，其他插件返回 nil。
+func (m *Manager) preLoad(name string, p Plugin, config []byte) (*pluginHost, error) {
+	hostAware, ok := p.(HostAwarePlugin)
+	if !ok {
+		if err := p.PreLoad(config); err != nil {
+			return nil, wrapf(err, "%s 的预加载钩子失败", name)
+		}
+		return nil, nil
+	}
+
+	host := newPluginHost(m, name)
+	if err := hostAware.PreLoadWithHost(host, config); err != nil {
+		host.close()
+		return nil, wrapf(err, "%s 的预加载钩子失败", name)
+	}
+	return host, nil
+}
+
+// attachHost 绑定插件的宿主服务并使之前的宿主服务失效
+func (m *Manager) attachHost(name string, host *pluginHost) {
+	var old any
+	if host == nil {
+		old, _ = m.hosts.LoadAndDelete(name)
+	} else {
+		old, _ = m.hosts.Swap(name, host)
+	}
+	if old != nil {
+		old.(*pluginHost).close()
+	}
+}
+
+// UnloadOption 插件卸载选项
+type UnloadOption func(*unloadOptions)
+
+type unloadOptions struct {
+	cascade bool
+}
+
+// WithCascade 级联卸载所有直接或间接依赖目标插件的插件
+func WithCascade() UnloadOption {
+	return func(o *unloadOptions) {
+		o.cascade = true
+	}
 }
 
 // UnloadPlugin 卸载指定的插件
 //
 //	name: 插件名称
+//	opts: 卸载选项
 //	功能:
+//	- 插件仍被其他已加载插件依赖时拒绝卸载并返回 *DependentsError
+//	- 使用 WithCascade 时先按依赖逆序卸载所有依赖方，再卸载目标插件
 //	- 执行插件的预卸载和关闭钩子
-//	- 清理插件资源和权限
+//	- 清理插件资源、权限和主题订阅
 //	- 触发卸载事件
-func (m *Manager) UnloadPlugin(name string) error {
+func (m *Manager) UnloadPlugin(name string, opts ...UnloadOption) error {
+	var options unloadOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	if _, ok := m.plugins.Load(name); !ok {
+		return ErrPluginNotFound
+	}
+
+	if dependents := m.dependencies.Dependents(name); len(dependents) > 0 {
+		if !options.cascade {
+			return &DependentsError{Plugin: name, Dependents: dependents}
+		}
+
+		graph := newDependencyGraph()
+		for _, dependent := range m.dependencies.TransitiveDependents(name) {
+			deps, _ := m.dependencies.Get(dependent)
+			graph.Add(dependent, deps)
+		}
+
+		waves, _ := graph.wavesWithRemainder()
+		for i := len(waves) - 1; i >= 0; i-- {
+			for _, dependent := range waves[i] {
+				if err := m.unloadPlugin(dependent); err != nil {
+					return wrapf(err, "级联卸载插件 %s 失败", dependent)
+				}
+			}
+		}
+	}
+
+	return m.unloadPlugin(name)
+}
+
+// unloadPlugin 卸载插件，不检查依赖关系
+func (m *Manager) unloadPlugin(name string) error {
 	pluginInfo, ok := m.plugins.Load(name)
 	if !ok {
 		return ErrPluginNotFound
 	}
 
 	lazyPlug := pluginInfo.(*lazyPlugin)
+	unload := PluginUnloadPayload{Version: lazyPlug.loaded.Metadata().Version}
 
 	// 在插件卸载前触发事件
 	m.eventBus.PublishAsync(Event{
 		EventName: PluginPreUnload,
 		Data: EventData{
 			Name: name,
+			Data: unload,
 		},
 	})
 
@@ -290,19 +639,23 @@ func (m *Manager) UnloadPlugin(name string) error {
 	}
 
 	m.plugins.Delete(name)
-	m.dependencies.Delete(name)
+	m.dependencies.Remove(name)
 	m.stats.Delete(name)
+	m.packages.Delete(name)
+	m.attachHost(name, nil)
+	m.removeTopics(name)
 
 	m.eventBus.PublishAsync(Event{
 		EventName: PluginUnloaded,
 		Data: EventData{
 			Name: name,
+			Data: unload,
 		},
 	})
 	m.logger.Info("插件已卸载", "plugin", name)
 
-	// 清理插件权限
-	m.RemovePluginPermission(name)
+	// 清理内存中的插件权限，配置中保存的权限在重新加载时恢复
+	m.permissions.Delete(name)
 
 	return nil
 }
@@ -316,27 +669,24 @@ func (m *Manager) UnloadPlugin(name string) error {
 //	- 更新执行统计信息
 //	- 返回任意类型的结果
 func (m *Manager) ExecutePlugin(name string, data any) (any, error) {
-	result, err := ExecutePluginGeneric[any, any](m, name, data)
+	return m.ExecutePluginContext(context.Background(), name, data)
+}
+
+// ExecutePluginContext 在上下文控制下执行插件
+//
+//	参数:
+//	- ctx: 上下文，用于传递截止时间和取消信号
+//	- name: 插件名称
+//	- data: 传递给插件的数据
+//	功能:
+//	- 在上下文或插件默认超时的约束下执行插件
+//	- 超时时返回 ErrExecutionTimeout 并发布 PluginExecutionTimeout 事件
+//	- 发布执行成功或失败事件
+func (m *Manager) ExecutePluginContext(ctx context.Context, name string, data any) (any, error) {
+	result, err := ExecutePluginGenericContext[any, any](ctx, m, name, data)
 	if err != nil {
-		// 在插件执行错误时触发事件
-		m.eventBus.PublishAsync(Event{
-			EventName: PluginExecutionError,
-			Data: EventData{
-				Name:  name,
-				Error: err,
-			},
-		})
 		return nil, wrap(err, "执行插件失败")
 	}
-
-	// 在插件执行后触发事件
-	m.eventBus.PublishAsync(Event{
-		EventName: PluginExecuted,
-		Data: EventData{
-			Name: name,
-			Data: result,
-		},
-	})
 	return result, nil
 }
 
@@ -347,7 +697,12 @@ func (m *Manager) ExecutePlugin(name string, data any) (any, error) {
 //	功能:
 //	- 执行插件并确保返回字符串类型
 func (m *Manager) ExecutePluginString(name string, data any) (string, error) {
-	result, err := ExecutePluginGeneric[any, string](m, name, data)
+	return m.ExecutePluginStringContext(context.Background(), name, data)
+}
+
+// ExecutePluginStringContext 在上下文控制下执行插件并返回字符串结果
+func (m *Manager) ExecutePluginStringContext(ctx context.Context, name string, data any) (string, error) {
+	result, err := ExecutePluginGenericContext[any, string](ctx, m, name, data)
 	if err != nil {
 		return "", err
 	}
@@ -361,7 +716,12 @@ func (m *Manager) ExecutePluginString(name string, data any) (string, error) {
 //	功能:
 //	- 执行插件并确保返回整数类型
 func (m *Manager) ExecutePluginInt(name string, data any) (int, error) {
-	result, err := ExecutePluginGeneric[any, int](m, name, data)
+	return m.ExecutePluginIntContext(context.Background(), name, data)
+}
+
+// ExecutePluginIntContext 在上下文控制下执行插件并返回整数结果
+func (m *Manager) ExecutePluginIntContext(ctx context.Context, name string, data any) (int, error) {
+	result, err := ExecutePluginGenericContext[any, int](ctx, m, name, data)
 	if err != nil {
 		return 0, err
 	}
@@ -385,6 +745,34 @@ func (m *Manager) ExecutePluginInt(name string, data any) (int, error) {
 //	- R: 类型安全的执行结果
 //	- error: 执行过程中的错误信息
 func ExecutePluginGeneric[T any, R any](m *Manager, name string, data T) (R, error) {
+	return ExecutePluginGenericContext[T, R](context.Background(), m, name, data)
+}
+
+// ExecutePluginGenericContext 在上下文控制下的通用插件执行函数
+//
+//	类型参数:
+//	- T: 输入数据类型
+//	- R: 返回结果类型
+//	参数:
+//	- ctx: 上下文，用于传递截止时间和取消信号
+//	- m: 插件管理器实例
+//	- name: 插件名称
+//	- data: 传递给插件的数据
+//	功能:
+//	- 应用插件的默认超时时间(如果上下文未设置更早的截止时间)
+//	- 插件实现 ContextPlugin 时将上下文透传给插件
+//	- 超时或取消时立即返回，不等待插件结束
+//	- 执行完成后触发 PluginExecuted 事件，失败时触发 PluginExecutionError 事件
+//	返回:
+//	- R: 类型安全的执行结果
+//	- error: 执行过程中的错误信息，超时时可用 errors.Is(err, ErrExecutionTimeout) 判断
+func ExecutePluginGenericContext[T any, R any](ctx context.Context, m *Manager, name string, data T) (_ R, err error) {
+	var raw any
+	var executionTime time.Duration
+	defer func() {
+		m.publishExecution(ctx, name, data, raw, executionTime, err)
+	}()
+
 	var zero R
 	if !m.HasPermission(name, "execute") {
 		return zero, newErrorf("插件 %s 没有执行权限", name)
@@ -397,18 +785,29 @@ func ExecutePluginGeneric[T any, R any](m *Manager, name string, data T) (R, err
 
 	lazyPlug := pluginInfo.(*lazyPlugin)
 
+	if timeout := m.GetPluginTimeout(name); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	if err := ctx.Err(); err != nil {
+		return zero, m.contextError(ctx, name, 0)
+	}
+
 	m.logger.Info("开始执行插件",
 		"plugin", name,
 		"dataType", fmt.Sprintf("%T", data))
 
-	if err := m.sandbox.Enable(); err != nil {
+	sandbox := m.sandboxFor(name)
+	if err := sandbox.Enable(); err != nil {
 		m.logger.Error("启用沙箱失败",
 			"plugin", name,
 			"error", err)
 		return zero, wrapf(err, "为 %s 启用沙箱失败", name)
 	}
 	defer func() {
-		if err := m.sandbox.Disable(); err != nil {
+		if err := sandbox.Disable(); err != nil {
 			m.logger.Error("禁用沙箱失败",
 				"plugin", name,
 				"error", err)
@@ -420,10 +819,17 @@ func ExecutePluginGeneric[T any, R any](m *Manager, name string, data T) (R, err
 	}
 
 	start := time.Now()
-	result, err := lazyPlug.loaded.Execute(data)
-	executionTime := time.Since(start)
+	raw, err = lazyPlug.execute(ctx, data)
+	executionTime = time.Since(start)
 
 	m.updateStats(name, executionTime)
+	if limitErr := m.updateResourceUsage(name, lazyPlug, err); limitErr != nil && err != nil {
+		err = limitErr
+	}
+
+	if ctxErr := ctx.Err(); ctxErr != nil && err != nil && is(err, ctxErr) {
+		return zero, m.contextError(ctx, name, executionTime)
+	}
 
 	if err != nil {
 		m.logger.Error("插件执行失败",
@@ -436,16 +842,167 @@ func ExecutePluginGeneric[T any, R any](m *Manager, name string, data T) (R, err
 	m.logger.Info("插件执行完成",
 		"plugin", name,
 		"duration", executionTime,
-		"resultType", fmt.Sprintf("%T", result))
+		"resultType", fmt.Sprintf("%T", raw))
+
+	if raw == nil {
+		return zero, nil
+	}
 
-	typedResult, ok := result.(R)
+	typedResult, ok := raw.(R)
 	if !ok {
-		return zero, newErrorf("插件 %s 返回的结果类型不匹配: 期望 %T, 得到 %T", name, zero, result)
+		return zero, newErrorf("插件 %s 返回的结果类型不匹配: 期望 %T, 得到 %T", name, zero, raw)
 	}
 
 	return typedResult, nil
 }
 
+// contextError 将上下文结束原因转换为插件错误
+//
+//	截止时间到达时记录超时统计并发布 PluginExecutionTimeout 事件，
+//	调用方主动取消时返回包装后的 context.Canceled。
+func (m *Manager) contextError(ctx context.Context, name string, elapsed time.Duration) error {
+	if !is(ctx.Err(), context.DeadlineExceeded) {
+		m.logger.Warn("插件执行已取消", "plugin", name, "duration", elapsed)
+		return wrapf(ctx.Err(), "插件 %s 的执行已取消", name)
+	}
+
+	if stats, ok := m.stats.Load(name); ok {
+		atomic.AddInt64(&stats.(*PluginStats).TimeoutCount, 1)
+	}
+
+	err := wrapf(ErrExecutionTimeout, "插件 %s 执行超时(已运行 %s)", name, elapsed)
+	m.logger.Error("插件执行超时", "plugin", name, "duration", elapsed)
+	m.eventBus.PublishAsync(Event{
+		EventName: PluginExecutionTimeout,
+		Data: EventData{
+			Name:  name,
+			Data:  PluginExecutionTimeoutPayload{Elapsed: elapsed, Timeout: m.GetPluginTimeout(name)},
+			Error: err,
+		},
+	})
+	return err
+}
+
+// SetDefaultTimeout 设置插件执行的全局默认超时时间
+//
+//	timeout: 超时时间，0 表示不限制
+//	功能:
+//	- 对未单独配置超时时间的插件生效
+func (m *Manager) SetDefaultTimeout(timeout time.Duration) {
+	atomic.StoreInt64((*int64)(&m.defaultTimeout), int64(timeout))
+}
+
+// SetPluginTimeout 设置指定插件的默认执行超时时间
+//
+//	name: 插件名称
+//	timeout: 超时时间，0 表示不限制，负数表示移除单独配置并回退到全局默认值
+func (m *Manager) SetPluginTimeout(name string, timeout time.Duration) {
+	if timeout < 0 {
+		m.timeouts.Delete(name)
+		return
+	}
+	m.timeouts.Store(name, timeout)
+}
+
+// GetPluginTimeout 获取插件生效的默认执行超时时间
+func (m *Manager) GetPluginTimeout(name string) time.Duration {
+	if timeout, ok := m.timeouts.Load(name); ok {
+		return timeout.(time.Duration)
+	}
+	return time.Duration(atomic.LoadInt64((*int64)(&m.defaultTimeout)))
+}
+
+// updateResourceUsage 读取插件进程的 cgroup 资源使用情况并更新统计
+//
+//	发现新的资源限制事件时发布 PluginResourceLimitExceeded 事件，
+//	并返回包装了执行错误 execErr 的 *ResourceLimitError。
+func (m *Manager) updateResourceUsage(name string, lp *lazyPlugin, execErr error) error {
+	lp.mu.Lock()
+	p, ok := lp.loaded.(*processPlugin)
+	lp.mu.Unlock()
+	if !ok || p.cgroup == nil {
+		return nil
+	}
+
+	usage, err := p.resourceUsage()
+	if err != nil {
+		m.logger.Warn("读取插件资源使用情况失败", "plugin", name, "error", err)
+		return nil
+	}
+
+	v, ok := m.stats.Load(name)
+	if !ok {
+		return nil
+	}
+	stats := v.(*PluginStats)
+	atomic.StoreInt64((*int64)(&stats.CPUTime), int64(usage.CPUTime))
+	atomic.StoreInt64(&stats.PeakMemory, usage.PeakMemory)
+	atomic.StoreInt64(&stats.OOMKills, usage.OOMKills)
+
+	resource := p.cgroup.report(usage)
+	if resource == "" {
+		return nil
+	}
+
+	atomic.AddInt64(&stats.ResourceLimitCount, 1)
+	limitErr := &ResourceLimitError{Plugin: name, Resource: resource, Limits: p.cgroup.limits, Err: execErr}
+	m.logger.Error("插件超出资源限制", "plugin", name, "resource", resource, "error", execErr)
+	m.eventBus.PublishAsync(Event{
+		EventName: PluginResourceLimitExceeded,
+		Data: EventData{
+			Name:  name,
+			Data:  PluginResourceLimitPayload{Resource: resource, Limits: p.cgroup.limits},
+			Error: limitErr,
+		},
+	})
+	return limitErr
+}
+
+// SetPluginResourceLimits 设置进程插件的 cgroup v2 资源限制
+//
+//	参数:
+//	- name: 插件名称
+//	- limits: 资源限制，零值表示移除限制
+//	功能:
+//	- 插件进程启动时为其创建独立的 cgroup 并写入 memory.max、cpu.max 和 pids.max
+//	- 资源使用情况(CPU 时间、内存峰值、OOM 次数)更新到 PluginStats
+//	- 对之后加载或热重载的插件实例生效
+//	- cgroup v2 不可用时记录警告并关闭资源限制，插件照常运行
+func (m *Manager) SetPluginResourceLimits(name string, limits CgroupLimits) {
+	if limits == (CgroupLimits{}) {
+		m.resourceLimits.Delete(name)
+		return
+	}
+	m.resourceLimits.Store(name, limits)
+}
+
+// GetPluginResourceLimits 获取插件的 cgroup 资源限制
+func (m *Manager) GetPluginResourceLimits(name string) (CgroupLimits, bool) {
+	if limits, ok := m.resourceLimits.Load(name); ok {
+		return limits.(CgroupLimits), true
+	}
+	return CgroupLimits{}, false
+}
+
+// SetCgroupParent 设置插件 cgroup 的父 cgroup 目录
+//
+//	父 cgroup 需要委派 cpu、memory 和 pids 控制器且不能包含进程，
+//	例如 systemd 服务设置 Delegate=yes 后在服务 cgroup 下创建的子 cgroup。
+//	使用资源限制时必须设置，并在第一个配置了资源限制的插件启动前调用。
+func (m *Manager) SetCgroupParent(path string) {
+	m.cgroupParent = path
+}
+
+// cgroupManager 获取 cgroup 管理器，首次调用时检测 cgroup v2 是否可用
+//
+//	不可用时返回 ErrCgroupUnavailable，配置了资源限制的插件启动失败。
+func (m *Manager) cgroupManager() (*cgroupManager, error) {
+	m.cgroupOnce.Do(func() {
+		m.cgroups, m.cgroupErr = newCgroupManager(m.cgroupParent)
+	})
+	return m.cgroups, m.cgroupErr
+}
+
 func (m *Manager) updateStats(name string, executionTime time.Duration) {
 	if stats, ok := m.stats.Load(name); ok {
 		s := stats.(*PluginStats)
@@ -461,13 +1018,22 @@ func (m *Manager) updateStats(name string, executionTime time.Duration) {
 //	path: 新插件文件的路径
 //	功能:
 //	- 验证新插件签名
+//	- 检查新版本是否满足所有依赖方声明的版本约束
 //	- 保持原有配置的情况下更新插件
+//	- 替换期间暂停插件的主题订阅，完成后重新挂载
 //	- 触发热重载事件
 func (m *Manager) HotReload(name string, path string) error {
-	if m.publicKeyPath != "" {
-		if err := m.VerifyPluginSignature(path, m.publicKeyPath); err != nil {
-			return wrap(err, "验证新插件签名失败")
-		}
+	return m.hotReload(name, path, true)
+}
+
+// hotReload 热重载插件，checkDeps 为 false 时跳过依赖和依赖方的版本检查
+//
+//	安装计划在替换过程中依赖关系暂时不一致，由调用方在全部替换后统一检查。
+func (m *Manager) hotReload(name, path string, checkDeps bool) error {
+	start := time.Now()
+	manifest, err := m.verifyPlugin(name, path, checkDeps)
+	if err != nil {
+		return wrap(err, "验证新插件签名失败")
 	}
 
 	oldPlugin, ok := m.plugins.Load(name)
@@ -475,7 +1041,7 @@ func (m *Manager) HotReload(name string, path string) error {
 		return ErrPluginNotFound
 	}
 
-	newLazyPlugin := &lazyPlugin{path: path}
+	newLazyPlugin := m.newLazyPlugin(name, path)
 	if err := newLazyPlugin.load(); err != nil {
 		return wrapf(err, "加载 %s 的新版本失败", name)
 	}
@@ -483,15 +1049,56 @@ func (m *Manager) HotReload(name string, path string) error {
 	newPlugin := newLazyPlugin.loaded
 
 	metadata := newPlugin.Metadata()
-	if err := m.checkDependencies(name, metadata.Dependencies); err != nil {
-		return wrapf(err, "插件 %s 关联依赖检查未通过", name)
+	if err := manifest.checkMetadata(metadata); err != nil {
+		newLazyPlugin.release()
+		return err
+	}
+	if checkDeps {
+		if err := m.checkDependencies(name, metadata.Dependencies); err != nil {
+			newLazyPlugin.release()
+			return wrapf(err, "插件 %s 关联依赖检查未通过", name)
+		}
+		if err := m.checkDependents(name, metadata.Version); err != nil {
+			newLazyPlugin.release()
+			return err
+		}
+	}
+
+	// 新版本与 LoadPlugin 一样使用合并后的配置预加载，
+	// 实现 HostAwarePlugin 的新版本获得新的宿主服务，旧版本的订阅和配置监听在替换后失效
+	config, err := m.pluginConfig(name)
+	if err != nil {
+		newLazyPlugin.release()
+		return wrap(err, "解密插件配置失败")
+	}
+	resolved, err := m.resolveConfig(name, config)
+	if err != nil {
+		newLazyPlugin.release()
+		return wrap(err, "合并插件配置层失败")
+	}
+	if err := validateConfig(name, newPlugin, resolved.Config); err != nil {
+		newLazyPlugin.release()
+		return err
+	}
+	host, err := m.preLoad(name, newPlugin, resolved.Config)
+	if err != nil {
+		newLazyPlugin.release()
+		return err
 	}
 
 	if err := newPlugin.Init(); err != nil {
+		if host != nil {
+			host.close()
+		}
+		newLazyPlugin.release()
 		return wrapf(err, "%s 新版本的初始化失败", name)
 	}
 
+	// 替换期间暂停主题订阅，新版本就绪后重新挂载
+	m.detachTopics(name)
+
 	oldLazyPlugin := oldPlugin.(*lazyPlugin)
+	oldVersion := oldLazyPlugin.loaded.Metadata().Version
 	if err := oldLazyPlugin.loaded.PreUnload(); err != nil {
 		m.logger.Warn("旧版本的预卸载钩子失败", "plugin", name, "error", err)
 	}
@@ -500,12 +1107,22 @@ func (m *Manager) HotReload(name string, path string) error {
 	}
 
 	m.plugins.Store(name, newLazyPlugin)
-	m.dependencies.Store(name, metadata.Dependencies)
+	m.dependencies.Set(name, metadata.Dependencies)
+	m.setPackage(name, path, manifest)
+	m.attachHost(name, host)
+	m.attachTopics(name)
 
 	m.eventBus.PublishAsync(Event{
 		EventName: PluginHotReloaded,
 		Data: EventData{
 			Name: name,
+			Data: PluginHotReloadedPayload{
+				OldVersion: oldVersion,
+				NewVersion: metadata.Version,
+				Path:       path,
+				Checksum:   fileChecksum(path),
+				Duration:   time.Since(start),
+			},
 		},
 	})
 	m.logger.Info("插件热重载完成", "plugin", name)
@@ -517,11 +1134,25 @@ func (m *Manager) HotReload(name string, path string) error {
 //
 //	name: 插件名称
 //	config: 新的配置数据
+//	opts: 修改选项，用于记录修改者和修改说明
 //	功能:
 //	- 序列化配置数据
+//	- 使用插件的 JSON Schema 校验配置，未通过时返回 *ConfigValidationError 且不调用插件
 //	- 更新插件配置
-//	- 保存配置到持久化存储
-func (m *Manager) ConfigUpdated(name string, config any) ([]byte, error) {
+//	- 加密密钥字段后保存配置到持久化存储，并记录为新的修订版本
+//	返回:
+//	- []byte: 插件返回的明文配置，对外输出前应使用 RedactConfig 脱敏
+func (m *Manager) ConfigUpdated(name string, config any, opts ...ConfigOption) ([]byte, error) {
+	serializer, err := Serializer(config)
+	if err != nil {
+		return nil, wrap(err, "序列化配置失败")
+	}
+
+	return m.updateConfig(name, serializer, config != nil, newConfigOptions(opts))
+}
+
+// updateConfig 将序列化后的配置交给插件处理，save 为 true 时校验并保存插件返回的配置
+func (m *Manager) updateConfig(name string, serialized []byte, save bool, options configOptions) ([]byte, error) {
 	pluginInfo, ok := m.plugins.Load(name)
 	if !ok {
 		return nil, ErrPluginNotFound
@@ -533,28 +1164,41 @@ func (m *Manager) ConfigUpdated(name string, config any) ([]byte, error) {
 		return nil, wrapf(err, "加载插件 %s 失败", name)
 	}
 
-	serializer, err := Serializer(config)
-	if err != nil {
-		return nil, wrap(err, "序列化配置失败")
+	if save {
+		if err := validateConfig(name, lazyPlug.loaded, serialized); err != nil {
+			return nil, err
+		}
 	}
 
-	updatedConfig, err := lazyPlug.loaded.ConfigUpdated(serializer)
+	updatedConfig, err := lazyPlug.loaded.ConfigUpdated(serialized)
 	if err != nil {
 		return nil, wrapf(err, "更新插件 %s 的配置失败", name)
 	}
 
-	if config != nil {
-		if err = m.config.SetPluginConfig(name, updatedConfig); err != nil {
+	if save {
+		sealed, err := m.sealConfig(name, updatedConfig)
+		if err != nil {
+			return nil, err
+		}
+		err = m.config.SetPluginConfig(name, sealed, WithActor(options.actor), WithComment(options.comment))
+		if err != nil {
 			return nil, wrap(err, "保存配置失败")
 		}
-		// 在插件配置更新后触发事件
+		// 在插件配置更新后触发事件，事件中的密钥字段已脱敏
 		m.eventBus.PublishAsync(Event{
 			EventName: PluginConfigUpdated,
 			Data: EventData{
 				Name: name,
-				Data: updatedConfig,
+				Data: PluginConfigUpdatedPayload{
+					Config:  m.RedactConfig(name, updatedConfig),
+					Actor:   options.actor,
+					Comment: options.comment,
+				},
 			},
 		})
+		if host, ok := m.hosts.Load(name); ok {
+			go host.(*pluginHost).notifyConfig(updatedConfig)
+		}
 	}
 
 	m.logger.Info("插件配置已更新", "plugin", name)
@@ -567,44 +1211,112 @@ func (m *Manager) ConfigUpdated(name string, config any) ([]byte, error) {
 //	功能:
 //	- 更新插件启用状态
 //	- 加载插件
+//	- 触发启用事件
 func (m *Manager) EnablePlugin(name string) error {
-	if err := m.config.SetEnabled(name, true); err != nil {
+	return m.enablePlugin(name, true)
+}
+
+// enablePlugin 启用并加载插件，persist 为 false 时只修改内存中的启用状态
+func (m *Manager) enablePlugin(name string, persist bool) error {
+	if err := m.setEnabled(name, true, persist); err != nil {
 		return wrapf(err, "启用插件 %s 失败", name)
 	}
-	return m.LoadPlugin(filepath.Join(m.pluginDir, name+".so"))
+	path := m.resolvePluginPath(m.pluginDir, name)
+	if err := m.LoadPlugin(path); err != nil {
+		return err
+	}
+
+	m.eventBus.PublishAsync(Event{
+		EventName: PluginEnabled,
+		Data: EventData{
+			Name: name,
+			Data: PluginEnabledPayload{Path: path},
+		},
+	})
+	return nil
+}
+
+// DisablePlugin 禁用插件
+//
+//	name: 插件名称
+//	opts: 卸载选项，参见 UnloadPlugin
+//	功能:
+//	- 卸载插件，插件仍被依赖且未指定级联卸载时不修改启用状态
+//	- 更新插件禁用状态，级联卸载时同时禁用所有依赖方
+//	- 触发禁用事件
+func (m *Manager) DisablePlugin(name string, opts ...UnloadOption) error {
+	return m.disablePlugin(name, true, opts...)
+}
+
+// disablePlugin 卸载并禁用插件，persist 为 false 时只修改内存中插件自身的启用状态
+func (m *Manager) disablePlugin(name string, persist bool, opts ...UnloadOption) error {
+	var options unloadOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	// 级联卸载的依赖方同样禁用，否则下次启动时缺少依赖
+	var dependents []string
+	if options.cascade {
+		dependents = m.dependencies.TransitiveDependents(name)
+	}
+	if err := m.UnloadPlugin(name, opts...); err != nil {
+		return err
+	}
+	for _, dependent := range dependents {
+		if err := m.config.SetEnabled(dependent, false); err != nil {
+			return wrapf(err, "禁用插件 %s 失败", dependent)
+		}
+		m.eventBus.PublishAsync(Event{
+			EventName: PluginDisabled,
+			Data: EventData{
+				Name: dependent,
+				Data: PluginDisabledPayload{},
+			},
+		})
+	}
+	if err := m.setEnabled(name, false, persist); err != nil {
+		return wrapf(err, "禁用插件 %s 失败", name)
+	}
+
+	m.eventBus.PublishAsync(Event{
+		EventName: PluginDisabled,
+		Data: EventData{
+			Name: name,
+			Data: PluginDisabledPayload{Cascade: options.cascade},
+		},
+	})
+	return nil
 }
 
-// DisablePlugin 禁用插件
-//
-//	name: 插件名称
-//	功能:
-//	- 更新插件禁用状态
-//	- 卸载插件
-func (m *Manager) DisablePlugin(name string) error {
-	if err := m.config.SetEnabled(name, false); err != nil {
-		return wrapf(err, "禁用插件 %s 失败", name)
+// setEnabled 修改插件启用状态，persist 为 false 时不写入存储
+func (m *Manager) setEnabled(name string, enabled, persist bool) error {
+	if !persist {
+		m.config.markEnabled(name, enabled)
+		return nil
 	}
-	return m.UnloadPlugin(name)
+	return m.config.SetEnabled(name, enabled)
 }
 
 // LoadEnabledPlugins 加载所有启用的插件
 //
 //	pluginDir: 插件目录路径
 //	功能:
-//	- 并发加载所有启用的插件
+//	- 按依赖顺序分层加载所有启用的插件，互不依赖的插件并行加载
+//	- 缺失依赖或循环依赖时返回 *DependencyError
+//	- 严格模式下跳过未通过锁文件检查的插件，加载其余插件后一并返回拒绝的原因
 func (m *Manager) LoadEnabledPlugins(pluginDir string) error {
 	enabled := m.config.GetEnabledPlugins()
 
-	var eg errgroup.Group
+	paths := make(map[string]string, len(enabled))
 	for _, name := range enabled {
-		name := name // 创建局部变量避免闭包问题
-		eg.Go(func() error {
-			path := filepath.Join(pluginDir, name+".so")
-			return m.LoadPlugin(path)
-		})
+		paths[name] = m.resolvePluginPath(pluginDir, name)
 	}
 
-	return eg.Wait()
+	refused := m.filterLocked(paths)
+	return errors.Join(refused, m.loadPluginsOrdered(paths, func(name, path string) error {
+		return m.LoadPlugin(path)
+	}))
 }
 
 // ListPlugins 列出所有已加载的插件
@@ -630,18 +1342,25 @@ func (m *Manager) GetPluginStats(name string) (*PluginStats, error) {
 	if !ok {
 		return nil, ErrPluginNotFound
 	}
+	if lp, ok := m.plugins.Load(name); ok {
+		m.updateResourceUsage(name, lp.(*lazyPlugin), nil)
+	}
 	return stats.(*PluginStats), nil
 }
 
 // SubscribeToEvent 订阅插件事件
-// 参数:
-// - eventName: 事件名称
-// - handler: 事件处理函数
-// 功能:
-// - 注册事件处理器
-// - 当指定事件发生时触发处理函数
-func (m *Manager) SubscribeToEvent(eventName string, handler EventHandler) {
-	m.eventBus.Subscribe(eventName, handler)
+//
+//	参数:
+//	- eventName: 事件名称，可以包含通配符 *，例如 "Plugin*" 或 "*"
+//	- handler: 事件处理函数
+//	- filters: 过滤条件，例如 ForPlugins、OnlyErrors，全部满足时才调用处理函数
+//	功能:
+//	- 注册事件处理器
+//	- 当匹配的事件发生时触发处理函数
+//	返回:
+//	- *Subscription: 订阅句柄，调用 Cancel 取消订阅
+func (m *Manager) SubscribeToEvent(eventName string, handler EventHandler, filters ...EventFilter) *Subscription {
+	return m.eventBus.Subscribe(eventName, handler, filters...)
 }
 
 func (m *Manager) loadPluginConfig(pluginName string, data ...any) ([]byte, error) {
@@ -659,37 +1378,63 @@ func (m *Manager) loadPluginConfig(pluginName string, data ...any) ([]byte, erro
 //	data: 可选的初始配置数据
 //	功能:
 //	- 加载插件
+//	- 使用插件的 JSON Schema 校验初始配置，未通过时返回 *ConfigValidationError
 //	- 设置初始配置
 //	- 执行完整的插件初始化流程
-func (m *Manager) LoadPluginWithData(path string, data ...any) error {
-	if m.publicKeyPath != "" {
-		if err := m.VerifyPluginSignature(path, m.publicKeyPath); err != nil {
-			return wrap(err, "验证插件签名失败")
-		}
+func (m *Manager) LoadPluginWithData(path string, data ...any) (err error) {
+	start := time.Now()
+	pluginName := pluginNameFromPath(path)
+	manifest, err := m.verifyPlugin(pluginName, path, true)
+	if err != nil {
+		return wrap(err, "验证插件签名失败")
 	}
 
-	pluginName := filepath.Base(path)
-	pluginName = strings.TrimSuffix(pluginName, ".so")
-
-	if _, loaded := m.plugins.LoadOrStore(pluginName, &lazyPlugin{path: path}); loaded {
+	lazyPlug := m.takePreloaded(pluginName, path)
+	if _, loaded := m.plugins.LoadOrStore(pluginName, lazyPlug); loaded {
+		lazyPlug.release()
 		return newErrorf("插件 %s 已加载", pluginName)
 	}
-
-	pluginInfo, _ := m.plugins.Load(pluginName)
-	lazyPlug := pluginInfo.(*lazyPlugin)
+	// 注册后的任何失败都撤销注册，释放插件实例并解除宿主服务和主题订阅
+	defer func() {
+		if err != nil {
+			m.abortLoad(pluginName, lazyPlug)
+		}
+	}()
 
 	if err := lazyPlug.load(); err != nil {
 		return wrapf(err, "加载插件 %s 失败", pluginName)
 	}
 
+	if err := manifest.checkMetadata(lazyPlug.loaded.Metadata()); err != nil {
+		return err
+	}
+
 	configToUse, err := m.loadPluginConfig(pluginName, data...)
 	if err != nil {
 		return wrap(err, "加载插件配置失败")
 	}
 
-	if err = lazyPlug.loaded.PreLoad(configToUse); err != nil {
-		return wrapf(err, "%s 的预加载钩子失败", pluginName)
+	plainConfig, err := m.openConfig(pluginName, configToUse)
+	if err != nil {
+		return wrap(err, "解密插件配置失败")
+	}
+
+	resolved, err := m.resolveConfig(pluginName, plainConfig)
+	if err != nil {
+		return wrap(err, "合并插件配置层失败")
+	}
+
+	if err = validateConfig(pluginName, lazyPlug.loaded, resolved.Config); err != nil {
+		return err
+	}
+
+	m.initPluginPermission(pluginName, manifest.permissions()...)
+
+	host, err := m.preLoad(pluginName, lazyPlug.loaded, resolved.Config)
+	if err != nil {
+		return err
 	}
+	m.attachHost(pluginName, host)
 
 	if err = lazyPlug.loaded.Init(); err != nil {
 		return wrapf(err, "%s 的初始化失败", pluginName)
@@ -703,6 +1448,9 @@ func (m *Manager) LoadPluginWithData(path string, data ...any) error {
 
 	if configToUse != nil {
 		metadata.Config = configToUse
+		if configToUse, err = m.sealConfig(pluginName, configToUse); err != nil {
+			return err
+		}
 		if err = m.config.SetPluginConfig(pluginName, configToUse); err != nil {
 			return wrap(err, "保存插件配置失败")
 		}
@@ -711,15 +1459,12 @@ func (m *Manager) LoadPluginWithData(path string, data ...any) error {
 	if err = m.checkDependencies(pluginName, metadata.Dependencies); err != nil {
 		return wrap(err, "检查插件依赖失败")
 	}
+	m.dependencies.Set(pluginName, metadata.Dependencies)
 
 	m.stats.Store(pluginName, &PluginStats{})
+	m.setPackage(pluginName, path, manifest)
 
-	m.eventBus.PublishAsync(Event{
-		EventName: PluginLoaded,
-		Data: EventData{
-			Name: pluginName,
-		},
-	})
+	m.publishLoaded(pluginName, path, metadata.Version, start)
 
 	m.logger.Info("插件已加载", "plugin", pluginName, "version", metadata.Version)
 
@@ -730,7 +1475,7 @@ func (m *Manager) LoadPluginWithData(path string, data ...any) error {
 //
 //	name: 插件名称
 //	功能:
-//	- 返回插件的当前配置
+//	- 返回插件的当前配置和修订历史，密钥字段替换为 RedactedValue
 func (m *Manager) GetPluginConfig(name string) (*PluginData, error) {
 	pluginInfo, ok := m.plugins.Load(name)
 	if !ok {
@@ -742,27 +1487,52 @@ func (m *Manager) GetPluginConfig(name string) (*PluginData, error) {
 		return nil, wrapf(err, "加载插件 %s 失败", name)
 	}
 
-	if config, exists := m.config.GetPluginConfig(name); exists {
-		return config, nil
+	// config 返回的是副本，可以直接替换其中的密钥字段
+	if data, exists := m.config.GetPluginConfig(name); exists {
+		rules := m.secretRules(name)
+		data.Config, _ = rewriteConfig(data.Config, m.redactor(rules))
+		for i := range data.History {
+			data.History[i].Config, _ = rewriteConfig(data.History[i].Config, m.redactor(rules))
+		}
+		return data, nil
 	}
 
 	return nil, nil
 }
 
+// GetPluginSchema 获取插件配置的 JSON Schema
+//
+//	name: 插件名称
+//	功能:
+//	- 返回 SchemaProvider 或 PluginMetadata.ConfigSchema 提供的 Schema，插件没有 Schema 时返回 nil
+func (m *Manager) GetPluginSchema(name string) ([]byte, error) {
+	pluginInfo, ok := m.plugins.Load(name)
+	if !ok {
+		return nil, ErrPluginNotFound
+	}
+
+	lazyPlug := pluginInfo.(*lazyPlugin)
+	if err := lazyPlug.load(); err != nil {
+		return nil, wrapf(err, "加载插件 %s 失败", name)
+	}
+	return pluginSchema(lazyPlug.loaded), nil
+}
+
 func (m *Manager) checkDependencies(pluginName string, dependencies map[string]string) error {
-	visited := make(map[string]bool)
+	checked := make(map[string]bool)
 	var checkDep func(string, string, []string) error
 
 	checkDep = func(depName, constraint string, depChain []string) error {
-		if visited[depName] {
-			cycle := append(depChain, depName)
-			return newErrorf("检测到循环依赖: %s", strings.Join(cycle, " -> "))
+		for _, name := range depChain {
+			if name == depName {
+				cycle := append(depChain, depName)
+				return wrapf(ErrCircularDependency, "检测到循环依赖: %s", strings.Join(cycle, " -> "))
+			}
 		}
-		visited[depName] = true
 
 		depPlugin, ok := m.plugins.Load(depName)
 		if !ok {
-			return newErrorf("缺少依赖: %s", depName)
+			return wrapf(ErrMissingDependency, "缺少依赖: %s", depName)
 		}
 
 		lazyPlug := depPlugin.(*lazyPlugin)
@@ -771,9 +1541,19 @@ func (m *Manager) checkDependencies(pluginName string, dependencies map[string]s
 		}
 
 		depMetadata := lazyPlug.loaded.Metadata()
-		if !isVersionCompatible(depMetadata.Version, constraint) {
-			return newErrorf("依赖 %s 的版本不兼容: 需要 %s, 得到 %s", depName, constraint, depMetadata.Version)
+		ok, err := SatisfiesConstraint(depMetadata.Version, constraint)
+		if err != nil {
+			return wrapf(err, "检查依赖 %s 的版本失败", depName)
+		}
+		if !ok {
+			return wrapf(ErrIncompatibleVersion, "依赖 %s 的版本不兼容: 需要 %s, 得到 %s", depName, constraint, depMetadata.Version)
+		}
+
+		// 同一依赖的子依赖只需检查一次
+		if checked[depName] {
+			return nil
 		}
+		checked[depName] = true
 
 		for subDepName, subConstraint := range depMetadata.Dependencies {
 			if err := checkDep(subDepName, subConstraint, append(depChain, depName)); err != nil {
@@ -793,32 +1573,251 @@ func (m *Manager) checkDependencies(pluginName string, dependencies map[string]s
 	return nil
 }
 
+// checkDependents 检查插件的新版本是否满足所有依赖方的版本约束
+func (m *Manager) checkDependents(name, version string) error {
+	var violations []string
+	for _, dependent := range m.dependencies.Dependents(name) {
+		deps, _ := m.dependencies.Get(dependent)
+		constraint := deps[name]
+		ok, err := SatisfiesConstraint(version, constraint)
+		if err != nil {
+			return wrapf(err, "检查插件 %s 对 %s 的版本约束失败", dependent, name)
+		}
+		if !ok {
+			violations = append(violations, fmt.Sprintf("%s 需要 %s", dependent, constraint))
+		}
+	}
+
+	if len(violations) > 0 {
+		return wrapf(ErrIncompatibleVersion, "插件 %s 的版本 %s 不满足依赖方的约束: %s",
+			name, version, strings.Join(violations, ", "))
+	}
+	return nil
+}
+
+// Dependents 获取直接依赖指定插件的已加载插件
+//
+//	name: 插件名称
+//	返回:
+//	- []string: 按名称排序的依赖方列表
+func (m *Manager) Dependents(name string) []string {
+	return m.dependencies.Dependents(name)
+}
+
+// DependencyTree 获取插件的依赖树
+//
+//	name: 插件名称
+//	返回:
+//	- *DependencyNode: 以该插件为根的依赖树，未加载的依赖标记为 Loaded=false
+//	- error: 插件未加载时返回 ErrPluginNotFound
+func (m *Manager) DependencyTree(name string) (*DependencyNode, error) {
+	if _, ok := m.plugins.Load(name); !ok {
+		return nil, ErrPluginNotFound
+	}
+	return m.buildDependencyNode(name, "", make(map[string]bool)), nil
+}
+
+func (m *Manager) buildDependencyNode(name, constraint string, path map[string]bool) *DependencyNode {
+	node := &DependencyNode{Name: name, Constraint: constraint}
+
+	pluginInfo, ok := m.plugins.Load(name)
+	if !ok {
+		return node
+	}
+	node.Loaded = true
+	if lazyPlug := pluginInfo.(*lazyPlugin); lazyPlug.loaded != nil {
+		node.Version = lazyPlug.loaded.Metadata().Version
+	}
+
+	if path[name] {
+		node.Cycle = true
+		return node
+	}
+	path[name] = true
+	defer delete(path, name)
+
+	deps, _ := m.dependencies.Get(name)
+	for _, dep := range sortedKeys(deps) {
+		node.Dependencies = append(node.Dependencies, m.buildDependencyNode(dep, deps[dep], path))
+	}
+	return node
+}
+
 func (m *Manager) loadAllPlugins() error {
 	files, err := filepath.Glob(filepath.Join(m.pluginDir, "*.so"))
 	if err != nil {
 		return wrap(err, "读取插件目录失败")
 	}
+	processFiles, err := filepath.Glob(filepath.Join(m.pluginDir, "*"+ProcessPluginExt))
+	if err != nil {
+		return wrap(err, "读取插件目录失败")
+	}
+	files = append(files, processFiles...)
 
-	var eg errgroup.Group
+	paths := make(map[string]string, len(files))
 	for _, file := range files {
-		f := file // 创建局部变量避免闭包问题
-		eg.Go(func() error {
-			pluginName := strings.TrimSuffix(filepath.Base(f), ".so")
-			m.config.mu.Lock()
-			m.config.enabled[pluginName] = true
-			m.config.mu.Unlock()
-
-			return m.LoadPluginWithData(f)
-		})
+		paths[pluginNameFromPath(file)] = file
+	}
+
+	refused := m.filterLocked(paths)
+	return errors.Join(refused, m.loadPluginsOrdered(paths, func(name, path string) error {
+		m.config.markEnabled(name, true)
+		return m.LoadPluginWithData(path)
+	}))
+}
+
+// loadPluginsOrdered 按依赖顺序批量加载插件
+//
+//	参数:
+//	- paths: 插件名称到插件文件路径的映射
+//	- load: 加载单个插件的函数
+//	功能:
+//	- 跳过已经加载的插件
+//	- 并发打开所有插件以读取元数据，但不执行任何生命周期钩子
+//	- 根据元数据中的依赖关系构建依赖图并进行拓扑排序
+//	- 存在缺失依赖或循环依赖时不加载任何插件，并一次性返回 *DependencyError
+//	- 按层级加载插件，同一层级内的插件并行加载
+func (m *Manager) loadPluginsOrdered(paths map[string]string, load func(name, path string) error) error {
+	var eg errgroup.Group
+	opened := make(map[string]*lazyPlugin, len(paths))
+	for name, path := range paths {
+		if _, ok := m.plugins.Load(name); ok {
+			delete(paths, name)
+			continue
+		}
+		lp := m.takePreloaded(name, path)
+		opened[name] = lp
+		eg.Go(lp.load)
+	}
+
+	releaseAll := func() {
+		for name, lp := range opened {
+			m.preloadedPlugins.CompareAndDelete(name, lp)
+			lp.release()
+		}
+	}
+
+	if err := eg.Wait(); err != nil {
+		releaseAll()
+		return wrap(err, "读取插件元数据失败")
 	}
 
-	if err = eg.Wait(); err != nil {
+	graph := newDependencyGraph()
+	for name, lp := range opened {
+		graph.Add(name, lp.loaded.Metadata().Dependencies)
+	}
+
+	waves, err := graph.Waves(func(dep string) bool {
+		_, ok := m.plugins.Load(dep)
+		return ok
+	})
+	if err != nil {
+		releaseAll()
 		return err
 	}
 
+	for name, lp := range opened {
+		m.preloadedPlugins.Store(name, lp)
+	}
+
+	for i, wave := range waves {
+		var eg errgroup.Group
+		for _, name := range wave {
+			name := name // 创建局部变量避免闭包问题
+			eg.Go(func() error {
+				return load(name, paths[name])
+			})
+		}
+		if err := eg.Wait(); err != nil {
+			// 释放尚未使用的预加载实例
+			for _, rest := range waves[i+1:] {
+				for _, name := range rest {
+					if v, ok := m.preloadedPlugins.LoadAndDelete(name); ok {
+						v.(*lazyPlugin).release()
+					}
+				}
+			}
+			return err
+		}
+	}
+
 	return nil
 }
 
+// Shutdown 关闭插件管理器
+//
+//	功能:
+//	- 按依赖关系的逆序卸载所有插件，依赖其他插件的插件先卸载
+//	- 同一层级内的插件并行卸载
+//	- 卸载失败不会中断流程，所有错误合并后返回
+//	- 停止配置文件监视，关闭事件总线和事件日志
+func (m *Manager) Shutdown() error {
+	if w := m.watcher.Load(); w != nil {
+		w.Stop()
+	}
+
+	graph := newDependencyGraph()
+	m.plugins.Range(func(key, value any) bool {
+		name := key.(string)
+		deps, _ := m.dependencies.Get(name)
+		graph.Add(name, deps)
+		return true
+	})
+
+	waves, err := graph.wavesWithRemainder()
+	if err != nil {
+		m.logger.Warn("插件依赖关系异常，部分插件将无序卸载", "error", err)
+	}
+
+	var errs []error
+	var mu sync.Mutex
+	for i := len(waves) - 1; i >= 0; i-- {
+		var wg sync.WaitGroup
+		for _, name := range waves[i] {
+			wg.Add(1)
+			go func(name string) {
+				defer wg.Done()
+				if err := m.unloadPlugin(name); err != nil {
+					mu.Lock()
+					errs = append(errs, wrapf(err, "卸载插件 %s 失败", name))
+					mu.Unlock()
+				}
+			}(name)
+		}
+		wg.Wait()
+	}
+
+	m.preloadedPlugins.Range(func(key, value any) bool {
+		m.preloadedPlugins.Delete(key)
+		value.(*lazyPlugin).release()
+		return true
+	})
+
+	// 插件进程均已退出，删除管理器创建的父 cgroup；Do 保证与初始化之间的可见性
+	m.cgroupOnce.Do(func() {})
+	if m.cgroups != nil {
+		if err := m.cgroups.remove(); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, wrap(err, "删除 cgroup 失败"))
+		}
+	}
+
+	if err := m.eventBus.Close(); err != nil {
+		errs = append(errs, err)
+	}
+	if j := m.eventBus.journal; j != nil {
+		if err := j.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if err := m.config.Close(); err != nil {
+		errs = append(errs, wrap(err, "关闭配置存储失败"))
+	}
+
+	m.logger.Info("插件管理器已关闭")
+	return errors.Join(errs...)
+}
+
 // PublishPlugin 发布插件到插件市场
 //
 //	参数:
@@ -829,32 +1828,64 @@ func (m *Manager) loadAllPlugins() error {
 //	- 将插件信息添加到插件市场
 //	- 使插件对其他用户可见
 func (m *Manager) PublishPlugin(info PluginInfo) error {
-	m.pluginMarket.AddPlugin(info)
-	return nil
+	return m.pluginMarket.AddPlugin(info)
 }
 
 // InstallPlugin 下载并安装插件
 //
 //	参数:
 //	- name: 插件名称
-//	- version: 插件版本
+//	- version: 插件版本或版本约束，例如 "1.2.0"、"^1.2"，为空时安装最新版本
 //	返回:
 //	- error: 下载或安装过程中的错误
 //	功能:
-//	- 从插件市场下载指定版本的插件
-//	- 安装并初始化插件
-//	- 更新版本信息
+//	- 参见 InstallPluginContext
 func (m *Manager) InstallPlugin(name, version string) error {
-	// 这里我们假设插件已经在本地
-	pluginPath := filepath.Join(m.pluginDir, fmt.Sprintf("%s_v%s.so", name, version))
+	return m.InstallPluginContext(context.Background(), name, version)
+}
+
+// InstallPluginContext 从插件仓库下载并安装插件及其依赖
+//
+//	参数:
+//	- ctx: 上下文，用于取消下载
+//	- name: 插件名称
+//	- version: 插件版本或版本约束，为空时安装最新版本
+//	返回:
+//	- error: 解析依赖、下载或安装过程中的错误
+//	功能:
+//	- 通过 PlanInstall 为插件及其传递依赖选择一组一致的版本
+//	- 通过 ApplyInstallPlan 按依赖顺序下载、校验并加载，失败时回滚已安装的插件
+//	- 插件保存到 <pluginDir>/versions/<name>/<version>/，<pluginDir>/<name>.so 指向该版本
+//	- 未添加仓库时加载本地的 <pluginDir>/<name>_v<version>.so
+func (m *Manager) InstallPluginContext(ctx context.Context, name, version string) error {
+	if len(m.Repositories()) > 0 {
+		plan, err := m.PlanInstall(ctx, name, version)
+		if err != nil {
+			return wrapf(err, "安装插件 %s 失败", name)
+		}
+		return m.ApplyInstallPlan(ctx, plan)
+	}
 
+	if _, err := ParseVersion(version); err != nil {
+		return err
+	}
+	pluginPath := filepath.Join(m.pluginDir, fmt.Sprintf("%s_v%s.so", name, version))
 	if err := m.LoadPlugin(pluginPath); err != nil {
 		return err
 	}
 
-	m.versionManager.AddVersion(name, version)
+	if err := m.versionManager.AddVersion(name, version); err != nil {
+		return err
+	}
 	m.versionManager.SetActiveVersion(name, version)
 
+	m.eventBus.PublishAsync(Event{
+		EventName: PluginInstalled,
+		Data: EventData{
+			Name: name,
+			Data: PluginInstalledPayload{Version: version, Path: pluginPath},
+		},
+	})
 	return nil
 }
 
@@ -886,10 +1917,13 @@ func (m *Manager) HotUpdatePlugin(name, newVersion string) error {
 		return newErrorf("插件未激活")
 	}
 
-	newPath := filepath.Join(m.pluginDir, fmt.Sprintf("%s_v%s.so", name, newVersion))
+	newPath := m.findPluginVersion(name, newVersion)
 	if err := m.HotReload(name, newPath); err != nil {
 		return err
 	}
+	if err := m.activatePluginFile(name, newPath); err != nil {
+		return err
+	}
 
 	m.versionManager.SetActiveVersion(name, newVersion)
 	return nil
@@ -906,6 +1940,7 @@ func (m *Manager) HotUpdatePlugin(name, newVersion string) error {
 //	- 将插件回滚到指定版本
 //	- 恢复该版本的配置
 //	- 更新版本信息
+//	- 触发回滚事件
 func (m *Manager) RollbackPlugin(name, version string) error {
 	currentVersion, exists := m.versionManager.GetActiveVersion(name)
 	if !exists {
@@ -916,12 +1951,22 @@ func (m *Manager) RollbackPlugin(name, version string) error {
 		return nil
 	}
 
-	targetPath := filepath.Join(m.pluginDir, fmt.Sprintf("%s_v%s.so", name, version))
+	targetPath := m.findPluginVersion(name, version)
 	if err := m.HotReload(name, targetPath); err != nil {
 		return err
 	}
+	if err := m.activatePluginFile(name, targetPath); err != nil {
+		return err
+	}
 
 	m.versionManager.SetActiveVersion(name, version)
+	m.eventBus.PublishAsync(Event{
+		EventName: PluginRolledBack,
+		Data: EventData{
+			Name: name,
+			Data: PluginRolledBackPayload{FromVersion: currentVersion, ToVersion: version},
+		},
+	})
 	return nil
 }
 
@@ -933,22 +1978,58 @@ func (m *Manager) RollbackPlugin(name, version string) error {
 //	- 验证插件是否有权限执行指定操作
 func (m *Manager) HasPermission(pluginName, action string) bool {
 	// 获取插件权限配置
-	if perm, exists := m.permissions.Load(pluginName); exists {
-		permission := perm.(PluginPermission)
+	if permission, exists := m.getPermission(pluginName); exists {
 		return permission.AllowedActions[action]
 	}
 	// 默认不允许未配置的操作
 	return false
 }
 
+// getPermission 获取插件权限配置，兼容以值或指针形式保存的权限
+func (m *Manager) getPermission(pluginName string) (PluginPermission, bool) {
+	perm, exists := m.permissions.Load(pluginName)
+	if !exists {
+		return PluginPermission{}, false
+	}
+	switch permission := perm.(type) {
+	case *PluginPermission:
+		if permission == nil {
+			return PluginPermission{}, false
+		}
+		return *permission, true
+	case PluginPermission:
+		return permission, true
+	default:
+		return PluginPermission{}, false
+	}
+}
+
+// GetPluginPermission 获取插件权限
+//
+//	EventName: 插件名称
+//	功能:
+//	- 返回插件当前生效的权限配置副本
+func (m *Manager) GetPluginPermission(pluginName string) (*PluginPermission, bool) {
+	permission, ok := m.getPermission(pluginName)
+	if !ok {
+		return nil, false
+	}
+	return &permission, true
+}
+
 // SetPluginPermission 设置插件权限
 //
 //	EventName: 插件名称
 //	permission: 权限配置
 //	功能:
 //	- 更新插件的权限配置
-func (m *Manager) SetPluginPermission(pluginName string, permission *PluginPermission) {
+//	- 通过配置持久化，插件重新加载或管理器重启后继续生效
+//	- 触发权限修改事件
+func (m *Manager) SetPluginPermission(pluginName string, permission *PluginPermission) error {
+	old, _ := m.GetPluginPermission(pluginName)
 	m.permissions.Store(pluginName, permission)
+	m.publishPermissionChanged(pluginName, old, permission)
+	return wrap(m.config.SetPluginPermissions(pluginName, permission), "保存插件权限失败")
 }
 
 // RemovePluginPermission 移除插件权限
@@ -956,10 +2037,13 @@ func (m *Manager) SetPluginPermission(pluginName string, permission *PluginPermi
 //	参数:
 //	- EventName: 插件名称
 //	功能:
-//	- 从权限管理器中删除指定插件的所有权限配置
-//	- 用于插件卸载或权限重置场景
-func (m *Manager) RemovePluginPermission(pluginName string) {
+//	- 从权限管理器和配置中删除指定插件的所有权限配置
+//	- 用于权限重置场景，插件重新加载时使用默认权限
+func (m *Manager) RemovePluginPermission(pluginName string) error {
+	old, _ := m.GetPluginPermission(pluginName)
 	m.permissions.Delete(pluginName)
+	m.publishPermissionChanged(pluginName, old, nil)
+	return wrap(m.config.SetPluginPermissions(pluginName, nil), "删除插件权限失败")
 }
 
 // LoadPluginPermissions 从配置加载插件权限
@@ -984,6 +2068,31 @@ func (m *Manager) SetSandbox(sandbox Sandbox) {
 	m.sandbox = sandbox
 }
 
+// SetPluginSandbox 为单个插件设置沙箱
+//
+//	参数:
+//	- name: 插件名称
+//	- sandbox: 插件使用的沙箱，为 nil 时恢复使用全局沙箱
+//	功能:
+//	- 实现 ProcessSandbox 的沙箱(例如 NamespaceSandbox)在进程插件启动时生效，
+//	  该插件的执行不再切换宿主进程的状态，可以与其他插件并发执行
+//	- 对之后加载或热重载的插件实例生效
+func (m *Manager) SetPluginSandbox(name string, sandbox Sandbox) {
+	if sandbox == nil {
+		m.sandboxes.Delete(name)
+		return
+	}
+	m.sandboxes.Store(name, sandbox)
+}
+
+// sandboxFor 获取插件使用的沙箱
+func (m *Manager) sandboxFor(name string) Sandbox {
+	if sandbox, ok := m.sandboxes.Load(name); ok {
+		return sandbox.(Sandbox)
+	}
+	return m.sandbox
+}
+
 // GetEventBus 获取事件总线
 //
 //	功能:
@@ -1008,9 +2117,53 @@ func (m *Manager) GetPluginMarket() *PluginMarket {
 	return m.pluginMarket
 }
 
+// takePreloaded 取出预加载的插件实例
+//
+//	预加载实例的路径与请求路径不一致时释放该实例并创建新实例。
+func (m *Manager) takePreloaded(name, path string) *lazyPlugin {
+	if v, ok := m.preloadedPlugins.LoadAndDelete(name); ok {
+		lp := v.(*lazyPlugin)
+		if lp.path == path {
+			return lp
+		}
+		lp.release()
+	}
+	return m.newLazyPlugin(name, path)
+}
+
+// newLazyPlugin 创建使用插件沙箱和资源限制配置的延迟加载插件
+func (m *Manager) newLazyPlugin(name, path string) *lazyPlugin {
+	lp := &lazyPlugin{path: path, logger: m.logger, sandbox: m.sandboxFor(name)}
+	if v, ok := m.resourceLimits.Load(name); ok {
+		limits := v.(CgroupLimits)
+		lp.newCgroup = func() (*pluginCgroup, error) {
+			cgroups, err := m.cgroupManager()
+			if err != nil {
+				return nil, wrapf(err, "无法为插件 %s 设置资源限制", name)
+			}
+			return cgroups.create(name, limits)
+		}
+	}
+	return lp
+}
+
+// resolvePluginPath 根据插件名称查找插件文件
+//
+//	优先使用 <name>.so，不存在时查找进程插件 <name>.plugin。
+func (m *Manager) resolvePluginPath(dir, name string) string {
+	path := filepath.Join(dir, name+".so")
+	if _, err := os.Stat(path); err != nil {
+		processPath := filepath.Join(dir, name+ProcessPluginExt)
+		if _, err := os.Stat(processPath); err == nil {
+			return processPath
+		}
+	}
+	return path
+}
+
 func (m *Manager) preloadPlugin(name string) error {
-	path := filepath.Join(m.pluginDir, name+".so")
-	plugin := &lazyPlugin{path: path}
+	path := m.resolvePluginPath(m.pluginDir, name)
+	plugin := m.newLazyPlugin(name, path)
 
 	// 预加载但不初始化
 	if err := plugin.load(); err != nil {
@@ -1048,52 +2201,3 @@ func Serializer(data any) ([]byte, error) {
 func Deserializer(data []byte, v any) error {
 	return msgpack.Unmarshal(data, v)
 }
-
-func isVersionCompatible(currentVersion, constraint string) bool {
-	parts := strings.Split(constraint, " ")
-	if len(parts) != 2 {
-		return false
-	}
-
-	operator := parts[0]
-	requiredVersion := parts[1]
-
-	switch operator {
-	case ">=":
-		return compareVersions(currentVersion, requiredVersion) >= 0
-	case ">":
-		return compareVersions(currentVersion, requiredVersion) > 0
-	case "<=":
-		return compareVersions(currentVersion, requiredVersion) <= 0
-	case "<":
-		return compareVersions(currentVersion, requiredVersion) < 0
-	case "==":
-		return compareVersions(currentVersion, requiredVersion) == 0
-	default:
-		return false
-	}
-}
-
-func compareVersions(v1, v2 string) int {
-	parts1 := strings.Split(v1, ".")
-	parts2 := strings.Split(v2, ".")
-
-	for i := 0; i < len(parts1) && i < len(parts2); i++ {
-		n1, _ := strconv.Atoi(parts1[i])
-		n2, _ := strconv.Atoi(parts2[i])
-
-		if n1 < n2 {
-			return -1
-		} else if n1 > n2 {
-			return 1
-		}
-	}
-
-	if len(parts1) < len(parts2) {
-		return -1
-	} else if len(parts1) > len(parts2) {
-		return 1
-	}
-
-	return 0
-}
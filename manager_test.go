@@ -0,0 +1,162 @@
+package plugmgr
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakePlugin 测试用的内存插件
+type fakePlugin struct {
+	metadata PluginMetadata
+	execute  func(ctx context.Context, data any) (any, error)
+	onUnload func()
+	config   []byte
+}
+
+func (p *fakePlugin) Metadata() PluginMetadata { return p.metadata }
+func (p *fakePlugin) Init() error              { return nil }
+func (p *fakePlugin) PostLoad() error          { return nil }
+func (p *fakePlugin) Shutdown() error          { return nil }
+
+func (p *fakePlugin) PreUnload() error {
+	if p.onUnload != nil {
+		p.onUnload()
+	}
+	return nil
+}
+
+func (p *fakePlugin) PreLoad(config []byte) error {
+	p.config = config
+	return nil
+}
+
+func (p *fakePlugin) ConfigUpdated(config []byte) ([]byte, error) {
+	p.config = config
+	return config, nil
+}
+
+func (p *fakePlugin) Execute(data any) (any, error) {
+	return p.ExecuteContext(context.Background(), data)
+}
+
+func (p *fakePlugin) ExecuteContext(ctx context.Context, data any) (any, error) {
+	if p.execute == nil {
+		return data, nil
+	}
+	return p.execute(ctx, data)
+}
+
+// newTestManager 创建使用临时目录的管理器
+func newTestManager(t *testing.T) *Manager {
+	t.Helper()
+
+	m, err := NewManager(t.TempDir(), "config.db")
+	if err != nil {
+		t.Fatalf("创建管理器失败: %v", err)
+	}
+	m.SetSandbox(nopSandbox{})
+	return m
+}
+
+// addTestPlugin 直接注册一个已加载的内存插件
+func addTestPlugin(m *Manager, name string, p Plugin) {
+	m.plugins.Store(name, &lazyPlugin{path: name + ".so", loaded: p})
+	m.stats.Store(name, &PluginStats{})
+	m.permissions.Store(name, PluginPermission{AllowedActions: map[string]bool{"execute": true}})
+}
+
+func TestExecutePluginContextTimeout(t *testing.T) {
+	m := newTestManager(t)
+	addTestPlugin(m, "slow", &fakePlugin{
+		execute: func(ctx context.Context, data any) (any, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		},
+	})
+	m.SetPluginTimeout("slow", 20*time.Millisecond)
+
+	var events atomic.Int32
+	m.SubscribeToEvent(PluginExecutionTimeout, func(Event) { events.Add(1) })
+
+	_, err := m.ExecutePluginContext(context.Background(), "slow", nil)
+	if !errors.Is(err, ErrExecutionTimeout) {
+		t.Fatalf("期望超时错误, 得到 %v", err)
+	}
+
+	stats, _ := m.GetPluginStats("slow")
+	if stats.TimeoutCount != 1 {
+		t.Fatalf("期望超时计数为 1, 得到 %d", stats.TimeoutCount)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for events.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if events.Load() != 1 {
+		t.Fatalf("期望收到 1 个超时事件, 得到 %d", events.Load())
+	}
+}
+
+func TestExecutePluginContextCanceled(t *testing.T) {
+	m := newTestManager(t)
+	block := make(chan struct{})
+	defer close(block)
+	addTestPlugin(m, "blocking", &fakePlugin{
+		execute: func(ctx context.Context, data any) (any, error) {
+			<-block
+			return "late", nil
+		},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+
+	_, err := m.ExecutePluginContext(ctx, "blocking", nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("期望取消错误, 得到 %v", err)
+	}
+	if errors.Is(err, ErrExecutionTimeout) {
+		t.Fatalf("取消不应被报告为超时: %v", err)
+	}
+}
+
+func TestExecutePluginContextResult(t *testing.T) {
+	m := newTestManager(t)
+	addTestPlugin(m, "echo", &fakePlugin{})
+	m.SetDefaultTimeout(time.Second)
+
+	result, err := ExecutePluginGenericContext[string, string](context.Background(), m, "echo", "hi")
+	if err != nil {
+		t.Fatalf("执行失败: %v", err)
+	}
+	if result != "hi" {
+		t.Fatalf("期望 hi, 得到 %q", result)
+	}
+}
+
+func TestLoadPluginCleansUpOnFailure(t *testing.T) {
+	m := newTestManager(t)
+	path := filepath.Join(m.pluginDir, "report.so")
+	m.preloadedPlugins.Store("report", &lazyPlugin{path: path, loaded: &fakePlugin{
+		metadata: PluginMetadata{Version: "1.0.0", Dependencies: map[string]string{"storage": "^1"}},
+	}})
+	if err := m.LoadPlugin(path); !errors.Is(err, ErrMissingDependency) {
+		t.Fatalf("缺少依赖时应返回 ErrMissingDependency, 得到 %v", err)
+	}
+	if _, ok := m.plugins.Load("report"); ok {
+		t.Fatal("加载失败后不应保留插件注册")
+	}
+	if _, ok := m.hosts.Load("report"); ok {
+		t.Fatal("加载失败后不应保留宿主服务")
+	}
+
+	// 注册已撤销，可以再次加载
+	m.preloadedPlugins.Store("report", &lazyPlugin{path: path, loaded: &fakePlugin{metadata: PluginMetadata{Version: "1.0.0"}}})
+	if err := m.LoadPlugin(path); err != nil {
+		t.Fatalf("再次加载失败: %v", err)
+	}
+}
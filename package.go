@@ -0,0 +1,701 @@
+package plugmgr
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// 插件包的约定
+const (
+	// PackageManifestFile 插件包的清单文件，PackageManifestFile + ".sig" 为清单的签名
+	PackageManifestFile = "plugin.json"
+	// PackageAssetsDir 插件包中静态资源的目录
+	PackageAssetsDir = "assets"
+	// maxPackageSize 解压后的插件包大小限制
+	maxPackageSize = 1 << 30
+)
+
+// PackageManifest 插件包清单
+//
+//	清单签名覆盖 Files 中记录的每个文件的 SHA-256，因此验证清单签名即可保证插件和资源未被修改。
+type PackageManifest struct {
+	Name          string            `json:"name"`
+	Version       string            `json:"version"`
+	Description   string            `json:"description,omitempty"`
+	Author        string            `json:"author,omitempty"`
+	Dependencies  map[string]string `json:"dependencies,omitempty"`  // 依赖的插件及版本约束
+	Permissions   []string          `json:"permissions,omitempty"`   // 插件需要的操作权限，首次加载且未配置权限时授予
+	GoVersion     string            `json:"goVersion,omitempty"`     // 编译 .so 插件的 Go 版本
+	OS            string            `json:"os,omitempty"`            // 适用的操作系统
+	Arch          string            `json:"arch,omitempty"`          // 适用的处理器架构
+	Binary        string            `json:"binary,omitempty"`        // 插件文件，为 <name>.so 或 <name>.plugin，默认 <name>.so
+	ConfigSchema  json.RawMessage   `json:"configSchema,omitempty"`  // 配置的 JSON Schema
+	DefaultConfig json.RawMessage   `json:"defaultConfig,omitempty"` // 没有已保存的配置时使用的默认配置
+	Files         map[string]string `json:"files"`                   // 包内文件的路径到 SHA-256 的映射
+}
+
+// binary 返回插件文件名
+func (pm *PackageManifest) binary() string {
+	if pm.Binary == "" {
+		return pm.Name + ".so"
+	}
+	return pm.Binary
+}
+
+// permissions 返回清单声明的权限，清单为 nil 时返回 nil
+func (pm *PackageManifest) permissions() []string {
+	if pm == nil {
+		return nil
+	}
+	return pm.Permissions
+}
+
+// validate 检查清单字段
+func (pm *PackageManifest) validate() error {
+	if !validPluginName(pm.Name) {
+		return newPluginError("插件包清单中的名称无效: "+pm.Name, errTypeValidation)
+	}
+	if _, err := ParseVersion(pm.Version); err != nil {
+		return wrap(err, "插件包清单中的版本无效")
+	}
+	for name, constraint := range pm.Dependencies {
+		if _, err := ParseConstraint(constraint); err != nil {
+			return wrapf(err, "依赖 %s 的版本约束无效", name)
+		}
+	}
+	binary := pm.binary()
+	if binary != pm.Name+".so" && binary != pm.Name+ProcessPluginExt {
+		return newPluginError("插件文件名必须为 <name>.so 或 <name>"+ProcessPluginExt+": "+binary, errTypeValidation)
+	}
+	if _, ok := pm.Files[binary]; !ok {
+		return newPluginError("插件包清单未记录插件文件 "+binary, errTypeValidation)
+	}
+	for name := range pm.Files {
+		if !validPackagePath(name) {
+			return newPluginError("插件包中的文件路径无效: "+name, errTypeValidation)
+		}
+	}
+	if len(pm.ConfigSchema) > 0 {
+		schema, err := compileSchema(pm.ConfigSchema)
+		if err != nil {
+			return wrap(err, "插件包清单中的配置 Schema 无效")
+		}
+		if len(pm.DefaultConfig) > 0 {
+			doc, err := decodeJSON(pm.DefaultConfig)
+			if err != nil {
+				return wrap(err, "插件包清单中的默认配置无效")
+			}
+			if fields := schema.validate(doc); len(fields) > 0 {
+				return &ConfigValidationError{Plugin: pm.Name, Fields: fields}
+			}
+		}
+	}
+	return nil
+}
+
+// Compatible 检查插件包是否适用于当前平台，Go 版本只对 .so 插件检查
+func (pm *PackageManifest) Compatible() bool {
+	return (pm.OS == "" || pm.OS == runtime.GOOS) &&
+		(pm.Arch == "" || pm.Arch == runtime.GOARCH) &&
+		(pm.GoVersion == "" || filepath.Ext(pm.binary()) != ".so" || pm.GoVersion == runtime.Version())
+}
+
+// checkMetadata 检查插件元数据与清单是否一致，元数据中未设置的字段不检查
+func (pm *PackageManifest) checkMetadata(metadata PluginMetadata) error {
+	if pm == nil {
+		return nil
+	}
+	var diffs []string
+	if metadata.Name != "" && metadata.Name != pm.Name {
+		diffs = append(diffs, "名称 "+metadata.Name+" != "+pm.Name)
+	}
+	if metadata.Version != "" && compareVersionStrings(metadata.Version, pm.Version) != 0 {
+		diffs = append(diffs, "版本 "+metadata.Version+" != "+pm.Version)
+	}
+	if metadata.GoVersion != "" && pm.GoVersion != "" && metadata.GoVersion != pm.GoVersion {
+		diffs = append(diffs, "Go 版本 "+metadata.GoVersion+" != "+pm.GoVersion)
+	}
+	if len(metadata.Dependencies) > 0 && !maps.Equal(metadata.Dependencies, pm.Dependencies) {
+		diffs = append(diffs, "依赖不一致")
+	}
+	if len(metadata.ConfigSchema) > 0 && len(pm.ConfigSchema) > 0 && !jsonEqual(metadata.ConfigSchema, pm.ConfigSchema) {
+		diffs = append(diffs, "配置 Schema 不一致")
+	}
+	if len(diffs) > 0 {
+		return wrapf(ErrManifestMismatch, "插件 %s: %s", pm.Name, strings.Join(diffs, "; "))
+	}
+	return nil
+}
+
+// jsonEqual 比较两个 JSON 文档的内容
+func jsonEqual(a, b []byte) bool {
+	var va, vb any
+	if json.Unmarshal(a, &va) != nil || json.Unmarshal(b, &vb) != nil {
+		return bytes.Equal(a, b)
+	}
+	ca, _ := json.Marshal(va)
+	cb, _ := json.Marshal(vb)
+	return bytes.Equal(ca, cb)
+}
+
+// validPackagePath 检查包内路径是否为不含 .. 的相对路径
+func validPackagePath(name string) bool {
+	return name != "" && !path.IsAbs(name) && path.Clean(name) == name &&
+		name != ".." && !strings.HasPrefix(name, "../") && !strings.Contains(name, `\`)
+}
+
+// isPackageFile 检查文件是否为插件包
+func isPackageFile(name string) bool {
+	return strings.HasSuffix(name, ".tar.gz") || strings.HasSuffix(name, ".tgz") || strings.HasSuffix(name, ".zip")
+}
+
+// ReadPackageManifest 读取并检查目录中的插件包清单
+func ReadPackageManifest(dir string) (*PackageManifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, PackageManifestFile))
+	if err != nil {
+		return nil, wrap(err, "读取插件包清单失败")
+	}
+	var manifest PackageManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, wrap(err, "解析插件包清单失败")
+	}
+	if err := manifest.validate(); err != nil {
+		return nil, err
+	}
+	return &manifest, nil
+}
+
+// packageDir 返回插件文件所在的插件包目录，插件文件为符号链接时使用链接的目标
+func packageDir(pluginPath string) (string, bool) {
+	real, err := filepath.EvalSymlinks(pluginPath)
+	if err != nil {
+		return "", false
+	}
+	dir := filepath.Dir(real)
+	if _, err := os.Stat(filepath.Join(dir, PackageManifestFile)); err != nil {
+		return "", false
+	}
+	return dir, true
+}
+
+// verifyPackage 验证解压后的插件包
+//
+//	功能:
+//	- 配置了公钥时验证清单签名 plugin.json.sig
+//	- 检查每个文件的 SHA-256，包内不能有清单未记录的文件
+//	- 检查插件包是否适用于当前平台
+func (m *Manager) verifyPackage(dir string) (*PackageManifest, error) {
+	manifest, err := ReadPackageManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if m.publicKeyPath != "" {
+		manifestPath := filepath.Join(dir, PackageManifestFile)
+		if err := m.VerifyPluginSignature(manifestPath, m.publicKeyPath); err != nil {
+			m.eventBus.PublishAsync(Event{
+				EventName: PluginSignatureFailed,
+				Data: EventData{
+					Name:  manifest.Name,
+					Data:  PluginSignatureFailedPayload{Path: manifestPath},
+					Error: err,
+				},
+			})
+			return nil, wrap(err, "验证插件包清单签名失败")
+		}
+	}
+
+	err = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == PackageManifestFile || rel == PackageManifestFile+signatureExt {
+			return nil
+		}
+		if _, ok := manifest.Files[rel]; !ok {
+			return wrapf(ErrChecksumMismatch, "插件包中有清单未记录的文件 %s", rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for name, sum := range manifest.Files {
+		if !strings.EqualFold(fileChecksum(filepath.Join(dir, filepath.FromSlash(name))), sum) {
+			return nil, wrapf(ErrChecksumMismatch, "插件包中的文件 %s 与清单不一致", name)
+		}
+	}
+
+	if !manifest.Compatible() {
+		return nil, wrapf(ErrIncompatibleVersion, "插件包 %s %s 不适用于 %s/%s %s",
+			manifest.Name, manifest.Version, runtime.GOOS, runtime.GOARCH, runtime.Version())
+	}
+	return manifest, nil
+}
+
+// verifyPlugin 在打开插件文件前验证插件
+//
+//	严格模式下先检查锁文件。插件文件属于插件包时验证插件包并在 checkDeps 为 true 时检查依赖，返回清单；
+//	否则验证插件签名，返回 nil。
+func (m *Manager) verifyPlugin(name, pluginPath string, checkDeps bool) (*PackageManifest, error) {
+	if err := m.checkLocked(name, pluginPath); err != nil {
+		return nil, err
+	}
+	dir, ok := packageDir(pluginPath)
+	if !ok {
+		return nil, m.verifySignature(name, pluginPath)
+	}
+
+	manifest, err := m.verifyPackage(dir)
+	if err != nil {
+		return nil, err
+	}
+	real, _ := filepath.EvalSymlinks(pluginPath)
+	if manifest.Name != name || filepath.Base(real) != manifest.binary() {
+		return nil, wrapf(ErrManifestMismatch, "插件文件 %s 不是插件包 %s 的插件文件", pluginPath, manifest.Name)
+	}
+	if !checkDeps {
+		return manifest, nil
+	}
+	if err := m.checkDependencies(name, manifest.Dependencies); err != nil {
+		return nil, wrap(err, "检查插件依赖失败")
+	}
+	return manifest, nil
+}
+
+// loadedPackage 已加载的插件包
+type loadedPackage struct {
+	dir      string
+	manifest *PackageManifest
+}
+
+// setPackage 记录插件加载的插件包，manifest 为 nil 时删除记录
+func (m *Manager) setPackage(name, pluginPath string, manifest *PackageManifest) {
+	if manifest == nil {
+		m.packages.Delete(name)
+		return
+	}
+	dir, _ := packageDir(pluginPath)
+	m.packages.Store(name, &loadedPackage{dir: dir, manifest: manifest})
+}
+
+// PackageManifest 返回已加载插件的插件包清单，插件不是从插件包加载时返回 false
+func (m *Manager) PackageManifest(name string) (*PackageManifest, bool) {
+	if v, ok := m.packages.Load(name); ok {
+		return v.(*loadedPackage).manifest, true
+	}
+	return nil, false
+}
+
+// PluginAssetsDir 返回已加载插件的静态资源目录
+func (m *Manager) PluginAssetsDir(name string) (string, bool) {
+	if v, ok := m.packages.Load(name); ok {
+		return filepath.Join(v.(*loadedPackage).dir, PackageAssetsDir), true
+	}
+	return "", false
+}
+
+// unpackPackage 将插件包解压到 <pluginDir>/versions/<name>/<version>/
+//
+//	先解压到临时目录并验证，通过后再移动到版本目录。版本目录已存在且内容相同时直接使用。
+//	check 不为 nil 时在清单验证通过后、写入版本目录前检查清单。
+func (m *Manager) unpackPackage(pkgPath string, check func(*PackageManifest) error) (string, *PackageManifest, error) {
+	versionsDir := filepath.Join(m.pluginDir, "versions")
+	if err := os.MkdirAll(versionsDir, 0o755); err != nil {
+		return "", nil, wrap(err, "创建插件版本目录失败")
+	}
+	tmp, err := os.MkdirTemp(versionsDir, ".unpack-*")
+	if err != nil {
+		return "", nil, wrap(err, "创建临时目录失败")
+	}
+	defer os.RemoveAll(tmp)
+
+	if err := extractPackage(pkgPath, tmp); err != nil {
+		return "", nil, wrapf(err, "解压插件包 %s 失败", pkgPath)
+	}
+	manifest, err := m.verifyPackage(tmp)
+	if err != nil {
+		return "", nil, err
+	}
+	if check != nil {
+		if err := check(manifest); err != nil {
+			return "", nil, err
+		}
+	}
+
+	target := filepath.Join(versionsDir, manifest.Name, manifest.Version)
+	if existing, err := ReadPackageManifest(target); err == nil {
+		if !maps.Equal(existing.Files, manifest.Files) {
+			return "", nil, wrapf(ErrReleaseExists, "插件 %s 的版本 %s 已安装且内容不同", manifest.Name, manifest.Version)
+		}
+		return target, existing, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return "", nil, wrap(err, "创建插件版本目录失败")
+	}
+	os.RemoveAll(target)
+	if err := os.Rename(tmp, target); err != nil {
+		return "", nil, wrap(err, "移动插件包失败")
+	}
+	return target, manifest, nil
+}
+
+// loadPackageDir 加载解压后的插件包，插件已加载时热重载
+func (m *Manager) loadPackageDir(dir string, manifest *PackageManifest, reload bool) (string, error) {
+	pluginPath := filepath.Join(dir, manifest.binary())
+	if _, loaded := m.plugins.Load(manifest.Name); loaded && reload {
+		return pluginPath, m.HotReload(manifest.Name, pluginPath)
+	}
+	if len(manifest.DefaultConfig) == 0 {
+		return pluginPath, m.LoadPlugin(pluginPath)
+	}
+	config, err := decodeJSON(manifest.DefaultConfig)
+	if err != nil {
+		return "", wrap(err, "解析默认配置失败")
+	}
+	return pluginPath, m.LoadPluginWithData(pluginPath, config)
+}
+
+// LoadPackage 解压并加载插件包
+//
+//	参数:
+//	- pkgPath: 插件包路径，支持 .tar.gz、.tgz 和 .zip
+//	功能:
+//	- 解压到 <pluginDir>/versions/<name>/<version>/，验证清单签名、文件校验和及适用平台
+//	- 在打开插件文件前检查清单声明的依赖
+//	- 没有已保存的配置时使用清单中的默认配置
+//	- 加载后检查插件元数据与清单是否一致，不一致时返回 ErrManifestMismatch
+//	返回:
+//	- error: 解压、验证或加载失败
+func (m *Manager) LoadPackage(pkgPath string) error {
+	dir, manifest, err := m.unpackPackage(pkgPath, nil)
+	if err != nil {
+		return err
+	}
+	_, err = m.loadPackageDir(dir, manifest, false)
+	return err
+}
+
+// InstallPackage 安装插件包
+//
+//	参数:
+//	- pkgPath: 插件包路径，支持 .tar.gz、.tgz 和 .zip
+//	功能:
+//	- 与 LoadPackage 相同地解压、验证并加载插件，插件已加载时热重载
+//	- 将 <pluginDir>/<name>.so 指向该版本，重启后加载该版本
+//	- 更新版本信息并触发安装事件
+//	返回:
+//	- error: 安装过程中的错误
+func (m *Manager) InstallPackage(pkgPath string) error {
+	return m.installPackage(pkgPath, nil)
+}
+
+// installPackage 安装插件包，check 参见 unpackPackage
+func (m *Manager) installPackage(pkgPath string, check func(*PackageManifest) error) error {
+	dir, manifest, err := m.unpackPackage(pkgPath, check)
+	if err != nil {
+		return err
+	}
+	pluginPath, err := m.loadPackageDir(dir, manifest, true)
+	if err != nil {
+		return err
+	}
+	if err := m.activatePluginFile(manifest.Name, pluginPath); err != nil {
+		return err
+	}
+
+	if err := m.versionManager.AddVersion(manifest.Name, manifest.Version); err != nil {
+		return err
+	}
+	m.versionManager.SetActiveVersion(manifest.Name, manifest.Version)
+
+	m.eventBus.PublishAsync(Event{
+		EventName: PluginInstalled,
+		Data: EventData{
+			Name: manifest.Name,
+			Data: PluginInstalledPayload{Version: manifest.Version, Path: pluginPath},
+		},
+	})
+	return nil
+}
+
+// extractPackage 按扩展名解压插件包
+func extractPackage(pkgPath, dst string) error {
+	switch {
+	case strings.HasSuffix(pkgPath, ".zip"):
+		return extractZip(pkgPath, dst)
+	case strings.HasSuffix(pkgPath, ".tar.gz"), strings.HasSuffix(pkgPath, ".tgz"):
+		return extractTarGz(pkgPath, dst)
+	default:
+		return newErrorf("不支持的插件包格式: %s", filepath.Base(pkgPath))
+	}
+}
+
+// packageWriter 将包内文件写入目录，拒绝不安全的路径并限制总大小
+type packageWriter struct {
+	dst     string
+	written int64
+}
+
+func (w *packageWriter) write(name string, r io.Reader) error {
+	name = strings.TrimPrefix(name, "./")
+	if !validPackagePath(name) {
+		return newPluginError("插件包中的文件路径无效: "+name, errTypeValidation)
+	}
+	target := filepath.Join(w.dst, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(f, io.LimitReader(r, maxPackageSize-w.written+1))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if w.written += n; w.written > maxPackageSize {
+		return newErrorf("插件包解压后超过 %d 字节", maxPackageSize)
+	}
+	if ext := filepath.Ext(name); ext == ".so" || ext == ProcessPluginExt {
+		return os.Chmod(target, 0o755)
+	}
+	return nil
+}
+
+func extractTarGz(pkgPath, dst string) error {
+	f, err := os.Open(pkgPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	w := &packageWriter{dst: dst}
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+		case tar.TypeReg:
+			if err := w.write(header.Name, tr); err != nil {
+				return err
+			}
+		default:
+			return newPluginError("插件包中只能包含普通文件和目录: "+header.Name, errTypeValidation)
+		}
+	}
+}
+
+func extractZip(pkgPath, dst string) error {
+	zr, err := zip.OpenReader(pkgPath)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	w := &packageWriter{dst: dst}
+	for _, file := range zr.File {
+		mode := file.Mode()
+		if mode.IsDir() {
+			continue
+		}
+		if !mode.IsRegular() {
+			return newPluginError("插件包中只能包含普通文件和目录: "+file.Name, errTypeValidation)
+		}
+		r, err := file.Open()
+		if err != nil {
+			return err
+		}
+		err = w.write(file.Name, r)
+		r.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CreatePackage 将目录打包为插件包
+//
+//	参数:
+//	- srcDir: 包含 plugin.json、插件文件和 assets 目录的源目录
+//	- dst: 插件包路径，扩展名为 .zip 时生成 zip，否则生成 tar.gz
+//	- signingKeyPath: 签名清单的 RSA 私钥路径，为空时不签名
+//	功能:
+//	- 计算源目录中所有文件的 SHA-256 并写入清单的 Files
+//	- 检查清单后写入插件包
+func CreatePackage(srcDir, dst, signingKeyPath string) error {
+	data, err := os.ReadFile(filepath.Join(srcDir, PackageManifestFile))
+	if err != nil {
+		return wrap(err, "读取插件包清单失败")
+	}
+	var manifest PackageManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return wrap(err, "解析插件包清单失败")
+	}
+
+	manifest.Files = make(map[string]string)
+	err = filepath.WalkDir(srcDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(srcDir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel != PackageManifestFile && rel != PackageManifestFile+signatureExt {
+			manifest.Files[rel] = fileChecksum(p)
+		}
+		return nil
+	})
+	if err != nil {
+		return wrap(err, "读取插件包目录失败")
+	}
+	if err := manifest.validate(); err != nil {
+		return err
+	}
+
+	files := map[string][]byte{}
+	if files[PackageManifestFile], err = json.MarshalIndent(manifest, "", "  "); err != nil {
+		return wrap(err, "序列化插件包清单失败")
+	}
+	if signingKeyPath != "" {
+		key, err := loadPrivateKey(signingKeyPath)
+		if err != nil {
+			return err
+		}
+		signature, err := signDigest(key, sha256.Sum256(files[PackageManifestFile]))
+		if err != nil {
+			return err
+		}
+		files[PackageManifestFile+signatureExt] = signature
+	}
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return wrap(err, "创建插件包失败")
+	}
+	if strings.HasSuffix(dst, ".zip") {
+		err = writeZipPackage(out, srcDir, &manifest, files)
+	} else {
+		err = writeTarGzPackage(out, srcDir, &manifest, files)
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(dst)
+		return wrap(err, "写入插件包失败")
+	}
+	return nil
+}
+
+// packageEntries 返回插件包中文件的写入顺序：清单、签名、其他文件
+func packageEntries(manifest *PackageManifest, generated map[string][]byte) []string {
+	names := []string{PackageManifestFile}
+	if _, ok := generated[PackageManifestFile+signatureExt]; ok {
+		names = append(names, PackageManifestFile+signatureExt)
+	}
+	return append(names, sortedKeys(manifest.Files)...)
+}
+
+// openEntry 打开插件包中的文件
+func openEntry(srcDir, name string, generated map[string][]byte) (io.ReadCloser, int64, error) {
+	if data, ok := generated[name]; ok {
+		return io.NopCloser(bytes.NewReader(data)), int64(len(data)), nil
+	}
+	f, err := os.Open(filepath.Join(srcDir, filepath.FromSlash(name)))
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	return f, info.Size(), nil
+}
+
+func writeTarGzPackage(out io.Writer, srcDir string, manifest *PackageManifest, generated map[string][]byte) error {
+	gz := gzip.NewWriter(out)
+	tw := tar.NewWriter(gz)
+	for _, name := range packageEntries(manifest, generated) {
+		r, size, err := openEntry(srcDir, name, generated)
+		if err != nil {
+			return err
+		}
+		mode := int64(0o644)
+		if name == manifest.binary() {
+			mode = 0o755
+		}
+		err = tw.WriteHeader(&tar.Header{Name: name, Mode: mode, Size: size, ModTime: time.Now(), Typeflag: tar.TypeReg})
+		if err == nil {
+			_, err = io.Copy(tw, r)
+		}
+		r.Close()
+		if err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+func writeZipPackage(out io.Writer, srcDir string, manifest *PackageManifest, generated map[string][]byte) error {
+	zw := zip.NewWriter(out)
+	for _, name := range packageEntries(manifest, generated) {
+		r, _, err := openEntry(srcDir, name, generated)
+		if err != nil {
+			return err
+		}
+		header := &zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()}
+		if name == manifest.binary() {
+			header.SetMode(0o755)
+		}
+		w, err := zw.CreateHeader(header)
+		if err == nil {
+			_, err = io.Copy(w, r)
+		}
+		r.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
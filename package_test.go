@@ -0,0 +1,226 @@
+package plugmgr
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writePackageSource 写入插件包的源目录
+func writePackageSource(t *testing.T, manifest PackageManifest, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files[PackageManifestFile] = string(data)
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestInstallPackage(t *testing.T) {
+	repo := newTestRepository(t)
+	src := writePackageSource(t, PackageManifest{
+		Name:          "greeter",
+		Version:       "1.0.0",
+		Permissions:   []string{"write"},
+		ConfigSchema:  json.RawMessage(`{"type":"object","properties":{"greeting":{"type":"string"}}}`),
+		DefaultConfig: json.RawMessage(`{"greeting":"hi"}`),
+	}, map[string]string{
+		"greeter.so":         "binary",
+		"assets/index.html":  "<h1>hi</h1>",
+		"assets/css/app.css": "body{}",
+	})
+	pkg := filepath.Join(t.TempDir(), "greeter-1.0.0.tar.gz")
+	if err := CreatePackage(src, pkg, repo.privateKeyPath()); err != nil {
+		t.Fatalf("创建插件包失败: %v", err)
+	}
+
+	m := newTestManager(t)
+	m.publicKeyPath = repo.keyPath
+	p := &fakePlugin{metadata: PluginMetadata{Name: "greeter", Version: "1.0.0"}}
+	path := m.versionedPluginPath("greeter", "1.0.0", ".so")
+	m.preloadedPlugins.Store("greeter", &lazyPlugin{path: path, loaded: p})
+
+	if err := m.InstallPackage(pkg); err != nil {
+		t.Fatalf("安装插件包失败: %v", err)
+	}
+	if manifest, ok := m.PackageManifest("greeter"); !ok || manifest.Version != "1.0.0" {
+		t.Fatal("应记录插件的清单")
+	}
+	assets, _ := m.PluginAssetsDir("greeter")
+	if data, err := os.ReadFile(filepath.Join(assets, "css", "app.css")); err != nil || string(data) != "body{}" {
+		t.Fatalf("静态资源未解压: %v", err)
+	}
+	if !m.HasPermission("greeter", "write") {
+		t.Fatal("应授予清单声明的权限")
+	}
+	var config map[string]any
+	if err := Deserializer(p.config, &config); err != nil || config["greeting"] != "hi" {
+		t.Fatalf("应使用清单中的默认配置, 得到 %v %v", config, err)
+	}
+	if target, err := filepath.EvalSymlinks(filepath.Join(m.pluginDir, "greeter.so")); err != nil || target != path {
+		t.Fatalf("greeter.so 应指向安装的版本, 得到 %q %v", target, err)
+	}
+	if v, _ := m.versionManager.GetActiveVersion("greeter"); v != "1.0.0" {
+		t.Fatalf("激活版本应为 1.0.0, 得到 %q", v)
+	}
+
+	// 相同内容可以重复解压，卸载后通过激活链接重新加载时再次验证插件包
+	if err := m.UnloadPlugin("greeter"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m.PackageManifest("greeter"); ok {
+		t.Fatal("卸载后应删除插件包记录")
+	}
+	if err := os.WriteFile(filepath.Join(assets, "index.html"), []byte("changed"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.LoadPlugin(filepath.Join(m.pluginDir, "greeter.so")); !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("插件包被修改时应返回 ErrChecksumMismatch, 得到 %v", err)
+	}
+}
+
+func TestLoadPackageChecksManifest(t *testing.T) {
+	manifest := PackageManifest{Name: "greeter", Version: "1.0.0"}
+	pkg := filepath.Join(t.TempDir(), "greeter.zip")
+	if err := CreatePackage(writePackageSource(t, manifest, map[string]string{"greeter.so": "binary"}), pkg, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	m := newTestManager(t)
+	path := m.versionedPluginPath("greeter", "1.0.0", ".so")
+	m.preloadedPlugins.Store("greeter", &lazyPlugin{path: path, loaded: &fakePlugin{metadata: PluginMetadata{Version: "2.0.0"}}})
+	if err := m.LoadPackage(pkg); !errors.Is(err, ErrManifestMismatch) {
+		t.Fatalf("元数据与清单不一致时应返回 ErrManifestMismatch, 得到 %v", err)
+	}
+	if _, ok := m.plugins.Load("greeter"); ok {
+		t.Fatal("不一致的插件不应被加载")
+	}
+
+	// 依赖在打开插件文件前检查
+	manifest = PackageManifest{Name: "reporter", Version: "1.0.0", Dependencies: map[string]string{"storage": "^1.0"}}
+	pkg = filepath.Join(t.TempDir(), "reporter.tgz")
+	if err := CreatePackage(writePackageSource(t, manifest, map[string]string{"reporter.so": "binary"}), pkg, ""); err != nil {
+		t.Fatal(err)
+	}
+	preloaded := &lazyPlugin{path: m.versionedPluginPath("reporter", "1.0.0", ".so"), loaded: &fakePlugin{}}
+	m.preloadedPlugins.Store("reporter", preloaded)
+	if err := m.LoadPackage(pkg); !errors.Is(err, ErrMissingDependency) {
+		t.Fatalf("缺少依赖时应返回 ErrMissingDependency, 得到 %v", err)
+	}
+	if v, ok := m.preloadedPlugins.Load("reporter"); !ok || v != preloaded {
+		t.Fatal("依赖检查失败时不应打开插件文件")
+	}
+}
+
+func TestPackageRejectsUnsafeContent(t *testing.T) {
+	m := newTestManager(t)
+	writeZip := func(files map[string]string) string {
+		t.Helper()
+		pkg := filepath.Join(t.TempDir(), "evil.zip")
+		f, err := os.Create(pkg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		zw := zip.NewWriter(f)
+		for name, content := range files {
+			w, err := zw.Create(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w.Write([]byte(content))
+		}
+		zw.Close()
+		f.Close()
+		return pkg
+	}
+
+	manifest := `{"name":"evil","version":"1.0.0","files":{"evil.so":"` + fileChecksumOf("binary") + `"}}`
+	if err := m.LoadPackage(writeZip(map[string]string{PackageManifestFile: manifest, "evil.so": "binary", "../escape": "x"})); err == nil {
+		t.Fatal("应拒绝包含 .. 的路径")
+	}
+	if _, err := os.Stat(filepath.Join(m.pluginDir, "versions", "escape")); err == nil {
+		t.Fatal("不应写出版本目录之外的文件")
+	}
+	if err := m.LoadPackage(writeZip(map[string]string{PackageManifestFile: manifest, "evil.so": "binary", "extra.txt": "x"})); !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("清单未记录的文件应返回 ErrChecksumMismatch, 得到 %v", err)
+	}
+
+	// 使用其他密钥签名的插件包
+	repo, other := newTestRepository(t), newTestRepository(t)
+	pkg := filepath.Join(t.TempDir(), "greeter.tar.gz")
+	src := writePackageSource(t, PackageManifest{Name: "greeter", Version: "1.0.0"}, map[string]string{"greeter.so": "binary"})
+	if err := CreatePackage(src, pkg, other.privateKeyPath()); err != nil {
+		t.Fatal(err)
+	}
+	m.publicKeyPath = repo.keyPath
+	if err := m.LoadPackage(pkg); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("签名无效时应返回 ErrInvalidSignature, 得到 %v", err)
+	}
+}
+
+func fileChecksumOf(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestInstallPackageFromRepository(t *testing.T) {
+	repo, ts := newTestRepositoryServer(t)
+	pkg := filepath.Join(t.TempDir(), "greeter-1.2.0.tar.gz")
+	src := writePackageSource(t, PackageManifest{Name: "greeter", Version: "1.2.0"}, map[string]string{"greeter.so": "binary"})
+	if err := CreatePackage(src, pkg, repo.privateKeyPath()); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(pkg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	client, err := NewPluginRepository(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	release, err := client.Upload(context.Background(), "secret", &RepositoryUpload{
+		Name:     "greeter",
+		Release:  PluginRelease{Version: "1.2.0"},
+		FileName: filepath.Base(pkg),
+		Artifact: f,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Base(release.Path) != "greeter.tar.gz" {
+		t.Fatalf("插件包应保留扩展名, 得到 %s", release.Path)
+	}
+
+	m := newTestManager(t)
+	m.publicKeyPath = repo.keyPath
+	if err := m.AddRepository(client); err != nil {
+		t.Fatal(err)
+	}
+	path := m.versionedPluginPath("greeter", "1.2.0", ".so")
+	m.preloadedPlugins.Store("greeter", &lazyPlugin{path: path, loaded: &fakePlugin{metadata: PluginMetadata{Version: "1.2.0"}}})
+	if err := m.InstallPlugin("greeter", "^1"); err != nil {
+		t.Fatalf("从仓库安装插件包失败: %v", err)
+	}
+	if _, ok := m.PackageManifest("greeter"); !ok {
+		t.Fatal("应从插件包加载插件")
+	}
+}
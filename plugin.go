@@ -1,6 +1,7 @@
 package plugmgr
 
 import (
+	"context"
 	"plugin"
 	"sync"
 	"time"
@@ -18,6 +19,7 @@ type PluginMetadata struct {
 	GoVersion    string
 	Signature    []byte
 	Config       any
+	ConfigSchema []byte // 配置的 JSON Schema，管理器在加载和更新配置前校验
 }
 
 // Plugin 定义了插件必须实现的接口
@@ -60,10 +62,34 @@ type Plugin interface {
 	Execute(data any) (any, error)
 }
 
+// ContextPlugin 支持上下文的插件接口
+//
+//	插件可选实现该接口以感知调用方的截止时间和取消信号，
+//	管理器在执行时优先调用 ExecuteContext 而不是 Execute。
+type ContextPlugin interface {
+	Plugin
+
+	// ExecuteContext 在上下文控制下执行插件功能
+	// 参数 ctx: 携带截止时间和取消信号的上下文
+	// 参数 data: 输入数据
+	// 返回: 处理结果和可能的错误
+	ExecuteContext(ctx context.Context, data any) (any, error)
+}
+
+// PluginStats 插件统计信息
+//
+//	CPUTime、PeakMemory、OOMKills 和 ResourceLimitCount 只对配置了
+//	cgroup 资源限制的进程插件有效，反映当前插件进程的资源使用情况。
 type PluginStats struct {
 	ExecutionCount     int64
+	TimeoutCount       int64
 	LastExecutionTime  time.Duration
 	TotalExecutionTime time.Duration
+
+	CPUTime            time.Duration // 插件进程累计使用的 CPU 时间
+	PeakMemory         int64         // 插件进程的内存使用峰值(字节)
+	OOMKills           int64         // 因超出内存限制被结束的次数
+	ResourceLimitCount int64         // 触发资源限制的次数
 }
 
 // LoadPlugin 加载插件
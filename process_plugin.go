@@ -0,0 +1,392 @@
+package plugmgr
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// ProcessPluginExt 进程插件可执行文件的约定扩展名
+	ProcessPluginExt = ".plugin"
+
+	// processCallTimeout 生命周期方法(Execute 除外)的默认调用超时
+	processCallTimeout = 30 * time.Second
+
+	// processExitTimeout 关闭插件后等待子进程退出的时间
+	processExitTimeout = 5 * time.Second
+)
+
+// isProcessPlugin 判断路径是否指向进程插件
+//
+//	只有 .plugin 扩展名的文件作为可执行文件以子进程方式运行。
+func isProcessPlugin(path string) bool {
+	return filepath.Ext(path) == ProcessPluginExt
+}
+
+// pluginNameFromPath 从插件文件路径中提取插件名称
+func pluginNameFromPath(path string) string {
+	name := filepath.Base(path)
+	for _, ext := range []string{".so", ProcessPluginExt} {
+		if strings.HasSuffix(name, ext) {
+			return strings.TrimSuffix(name, ext)
+		}
+	}
+	return name
+}
+
+// processPlugin 以子进程方式运行的插件
+//
+//	功能:
+//	- 通过标准输入输出与子进程交换长度前缀的 RPC 消息帧
+//	- 将 Plugin 接口的生命周期方法映射为 RPC 调用
+//	- 子进程崩溃时只影响该插件，所有等待中的调用返回 ErrPluginProcessExited
+//	- Shutdown 后子进程退出，插件可以被真正卸载
+type processPlugin struct {
+	path   string
+	codec  RPCCodec
+	logger Logger
+
+	cmd    *exec.Cmd
+	writer io.WriteCloser
+
+	writeMu sync.Mutex
+	mu      sync.Mutex
+	pending map[uint64]chan *RPCResponse
+	nextID  atomic.Uint64
+
+	metadata   PluginMetadata
+	done       chan struct{}
+	stderrDone chan struct{}
+	exitErr    error
+	cleanup    func()
+
+	cgroup     *pluginCgroup
+	finalUsage cgroupUsage
+	usageErr   error
+}
+
+// startProcessPlugin 启动进程插件并完成握手
+//
+//	参数:
+//	- path: 插件可执行文件路径
+//	- logger: 用于转发子进程标准错误输出的日志记录器
+//	- sandbox: 插件使用的沙箱，实现 ProcessSandbox 时在沙箱中启动子进程
+//	- cgroup: 子进程所属的 cgroup，为 nil 时不限制资源
+//	返回:
+//	- *processPlugin: 已启动的进程插件
+//	- error: 启动或握手过程中的错误
+func startProcessPlugin(path string, logger Logger, sandbox Sandbox, cgroup *pluginCgroup) (*processPlugin, error) {
+	codec, err := NewRPCCodec(os.Getenv(RPCCodecEnv))
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command(path)
+	cleanup := func() {}
+	if ps, ok := sandbox.(ProcessSandbox); ok {
+		if cmd, cleanup, err = ps.Command(path); err != nil {
+			return nil, wrapf(err, "创建插件沙箱失败: %s", path)
+		}
+	}
+	if cgroup != nil {
+		sandboxCleanup := cleanup
+		cleanup = func() {
+			sandboxCleanup()
+			if err := cgroup.remove(); err != nil {
+				logger.Warn("删除插件 cgroup 失败", "plugin", path, "error", err)
+			}
+		}
+		if err := cgroup.apply(cmd); err != nil {
+			cleanup()
+			return nil, err
+		}
+	}
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	cmd.Env = append(cmd.Env, RPCCodecEnv+"="+codec.Name())
+
+	stdin, stdout, stderr, err := processPipes(cmd)
+	if err != nil {
+		cleanup()
+		return nil, err
+	}
+
+	err = cmd.Start()
+	if cgroup != nil {
+		cgroup.closeFD()
+	}
+	if err != nil {
+		cleanup()
+		return nil, wrapf(err, "启动插件进程失败: %s", path)
+	}
+
+	p := newProcessPlugin(path, codec, logger)
+	p.cmd = cmd
+	p.cleanup = cleanup
+	p.cgroup = cgroup
+	p.stderrDone = make(chan struct{})
+	go p.forwardStderr(stderr)
+
+	if err := p.attach(stdout, stdin); err != nil {
+		p.kill()
+		return nil, err
+	}
+	return p, nil
+}
+
+// processPipes 创建与子进程通信的标准输入、输出和错误管道
+func processPipes(cmd *exec.Cmd) (io.WriteCloser, io.ReadCloser, io.ReadCloser, error) {
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, nil, nil, wrap(err, "创建插件标准输入失败")
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, nil, nil, wrap(err, "创建插件标准输出失败")
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, nil, nil, wrap(err, "创建插件标准错误失败")
+	}
+	return stdin, stdout, stderr, nil
+}
+
+func newProcessPlugin(path string, codec RPCCodec, logger Logger) *processPlugin {
+	return &processPlugin{
+		path:    path,
+		codec:   codec,
+		logger:  logger,
+		pending: make(map[uint64]chan *RPCResponse),
+		done:    make(chan struct{}),
+	}
+}
+
+// attach 绑定通信管道，启动读取循环并获取插件元数据
+func (p *processPlugin) attach(r io.Reader, w io.WriteCloser) error {
+	p.writer = w
+	go p.readLoop(r)
+
+	ctx, cancel := context.WithTimeout(context.Background(), processCallTimeout)
+	defer cancel()
+
+	resp, err := p.call(ctx, &RPCRequest{Method: RPCMethodMetadata})
+	if err != nil {
+		return wrapf(err, "获取插件 %s 的元数据失败", p.path)
+	}
+	if resp.Metadata == nil {
+		return newErrorf("插件 %s 未返回元数据", p.path)
+	}
+	p.metadata = *resp.Metadata
+	return nil
+}
+
+// readLoop 持续读取子进程的响应并分发给等待中的调用
+func (p *processPlugin) readLoop(r io.Reader) {
+	var readErr error
+	for {
+		resp := new(RPCResponse)
+		if readErr = ReadRPCFrame(r, p.codec, resp); readErr != nil {
+			break
+		}
+
+		p.mu.Lock()
+		ch, ok := p.pending[resp.ID]
+		delete(p.pending, resp.ID)
+		p.mu.Unlock()
+
+		if ok {
+			ch <- resp
+		}
+	}
+
+	var exitErr error = ErrPluginProcessExited
+	if readErr != io.EOF {
+		exitErr = wrapf(ErrPluginProcessExited, "读取插件 %s 的响应失败: %v", p.path, readErr)
+	}
+	if p.cmd != nil {
+		if readErr != io.EOF {
+			// 消息帧损坏后无法继续通信，结束子进程以免 Wait 阻塞等待中的调用
+			p.kill()
+		}
+		// Wait 会关闭管道，需要等待标准错误读取完毕
+		<-p.stderrDone
+		if err := p.cmd.Wait(); err != nil && readErr == io.EOF {
+			exitErr = wrapf(ErrPluginProcessExited, "插件进程 %s 异常退出: %v", p.path, err)
+		}
+		if p.cgroup != nil {
+			// cgroup 删除后无法再读取，在进程退出时保存最终的使用情况
+			p.finalUsage, p.usageErr = p.cgroup.usage()
+		}
+		if p.cleanup != nil {
+			p.cleanup()
+		}
+	}
+
+	p.mu.Lock()
+	p.exitErr = exitErr
+	p.pending = nil
+	p.mu.Unlock()
+	close(p.done)
+}
+
+// forwardStderr 将子进程的标准错误输出转发到日志
+func (p *processPlugin) forwardStderr(r io.Reader) {
+	defer close(p.stderrDone)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		p.logger.Info("插件进程输出", "plugin", p.path, "line", scanner.Text())
+	}
+}
+
+// call 发送请求并等待响应
+func (p *processPlugin) call(ctx context.Context, req *RPCRequest) (*RPCResponse, error) {
+	req.ID = p.nextID.Add(1)
+	ch := make(chan *RPCResponse, 1)
+
+	p.mu.Lock()
+	if p.pending == nil {
+		err := p.exitErr
+		p.mu.Unlock()
+		return nil, err
+	}
+	p.pending[req.ID] = ch
+	p.mu.Unlock()
+
+	if err := p.send(req); err != nil {
+		p.forget(req.ID)
+		return nil, err
+	}
+
+	select {
+	case resp := <-ch:
+		if resp.Error != "" {
+			return nil, newError(resp.Error)
+		}
+		return resp, nil
+	case <-ctx.Done():
+		p.forget(req.ID)
+		if err := p.send(&RPCRequest{ID: req.ID, Method: RPCMethodCancel}); err != nil {
+			p.logger.Warn("发送取消通知失败", "plugin", p.path, "error", err)
+		}
+		return nil, ctx.Err()
+	case <-p.done:
+		return nil, p.exitErr
+	}
+}
+
+// callLifecycle 以默认超时调用生命周期方法
+func (p *processPlugin) callLifecycle(req *RPCRequest) (*RPCResponse, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), processCallTimeout)
+	defer cancel()
+	return p.call(ctx, req)
+}
+
+func (p *processPlugin) send(req *RPCRequest) error {
+	p.writeMu.Lock()
+	defer p.writeMu.Unlock()
+	return WriteRPCFrame(p.writer, p.codec, req)
+}
+
+func (p *processPlugin) forget(id uint64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.pending != nil {
+		delete(p.pending, id)
+	}
+}
+
+// kill 强制结束子进程
+func (p *processPlugin) kill() {
+	if p.cmd != nil && p.cmd.Process != nil {
+		_ = p.cmd.Process.Kill()
+	}
+	_ = p.writer.Close()
+}
+
+// resourceUsage 读取插件进程的 cgroup 资源使用情况
+//
+//	进程退出后返回退出时的最终使用情况。
+func (p *processPlugin) resourceUsage() (cgroupUsage, error) {
+	select {
+	case <-p.done:
+		return p.finalUsage, p.usageErr
+	default:
+		return p.cgroup.usage()
+	}
+}
+
+func (p *processPlugin) Metadata() PluginMetadata {
+	return p.metadata
+}
+
+func (p *processPlugin) PreLoad(config []byte) error {
+	_, err := p.callLifecycle(&RPCRequest{Method: RPCMethodPreLoad, Config: config})
+	return err
+}
+
+func (p *processPlugin) Init() error {
+	_, err := p.callLifecycle(&RPCRequest{Method: RPCMethodInit})
+	return err
+}
+
+func (p *processPlugin) PostLoad() error {
+	_, err := p.callLifecycle(&RPCRequest{Method: RPCMethodPostLoad})
+	return err
+}
+
+func (p *processPlugin) PreUnload() error {
+	_, err := p.callLifecycle(&RPCRequest{Method: RPCMethodPreUnload})
+	return err
+}
+
+func (p *processPlugin) ConfigUpdated(config []byte) ([]byte, error) {
+	resp, err := p.callLifecycle(&RPCRequest{Method: RPCMethodConfigUpdated, Config: config})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Config, nil
+}
+
+func (p *processPlugin) Execute(data any) (any, error) {
+	return p.ExecuteContext(context.Background(), data)
+}
+
+// ExecuteContext 执行插件，上下文结束时向子进程发送取消通知
+func (p *processPlugin) ExecuteContext(ctx context.Context, data any) (any, error) {
+	resp, err := p.call(ctx, &RPCRequest{Method: RPCMethodExecute, Data: data})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Result, nil
+}
+
+// Shutdown 通知插件关闭并等待子进程退出
+//
+//	子进程在超时时间内未退出时将被强制结束。
+func (p *processPlugin) Shutdown() error {
+	_, err := p.callLifecycle(&RPCRequest{Method: RPCMethodShutdown})
+	_ = p.writer.Close()
+
+	select {
+	case <-p.done:
+	case <-time.After(processExitTimeout):
+		p.logger.Warn("插件进程未按时退出，强制结束", "plugin", p.path)
+		p.kill()
+		<-p.done
+	}
+
+	// 子进程已经退出时视为关闭成功
+	if is(err, ErrPluginProcessExited) {
+		return nil
+	}
+	return err
+}
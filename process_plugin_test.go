@@ -0,0 +1,295 @@
+package plugmgr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// processPluginEnv 设置后测试二进制作为进程插件运行
+const processPluginEnv = "PLUGMGR_TEST_PROCESS_PLUGIN"
+
+func TestMain(m *testing.M) {
+	SandboxMain()
+	if os.Getenv(processPluginEnv) == "1" {
+		serveTestProcessPlugin()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// testProcessPluginDeps 按可执行文件名称声明的测试插件依赖
+var testProcessPluginDeps = map[string]map[string]string{
+	"app":   {"db": ">= 1.0", "cache": ">= 1.0"},
+	"db":    {"log": ">= 1.0"},
+	"cache": {"log": ">= 1.0"},
+	"ping":  {"pong": ">= 1.0"},
+	"pong":  {"ping": ">= 1.0"},
+}
+
+// serveTestProcessPlugin 直接基于消息帧实现的最小进程插件
+//
+//	插件名称取自可执行文件名称，便于通过符号链接模拟多个插件。
+func serveTestProcessPlugin() {
+	codec, _ := NewRPCCodec(os.Getenv(RPCCodecEnv))
+	name := pluginNameFromPath(os.Args[0])
+	var config []byte
+	for {
+		var req RPCRequest
+		if err := ReadRPCFrame(os.Stdin, codec, &req); err != nil {
+			return
+		}
+
+		resp := RPCResponse{ID: req.ID}
+		switch req.Method {
+		case RPCMethodMetadata:
+			resp.Metadata = &PluginMetadata{
+				Name:         name,
+				Version:      "1.0.0",
+				Dependencies: testProcessPluginDeps[name],
+			}
+		case RPCMethodExecute:
+			switch req.Data {
+			case "crash":
+				os.Exit(3)
+			case "hang":
+				continue
+			case "garbage":
+				// 写入无法解码的消息帧后保持运行
+				_, _ = os.Stdout.Write([]byte{0, 0, 0, 1, 0xc1})
+				time.Sleep(time.Minute)
+				return
+			case "fail":
+				resp.Error = "执行失败"
+			case "config":
+				resp.Result = string(config)
+			default:
+				resp.Result = probeTestProcessPlugin(req.Data)
+			}
+		case RPCMethodCancel:
+			continue
+		case RPCMethodPreLoad:
+			config = req.Config
+		case RPCMethodConfigUpdated:
+			resp.Config = req.Config
+		}
+
+		_ = WriteRPCFrame(os.Stdout, codec, &resp)
+		if req.Method == RPCMethodShutdown {
+			return
+		}
+	}
+}
+
+// probeTestProcessPlugin 返回沙箱测试需要的进程环境信息，其他输入原样返回
+func probeTestProcessPlugin(data any) any {
+	s, _ := data.(string)
+	switch {
+	case s == "pid":
+		return os.Getpid()
+	case s == "nofile":
+		var limit syscall.Rlimit
+		_ = syscall.Getrlimit(syscall.RLIMIT_NOFILE, &limit)
+		return limit.Cur
+	case s == "interfaces":
+		ifaces, _ := net.Interfaces()
+		return len(ifaces)
+	case s == "sleep":
+		time.Sleep(200 * time.Millisecond)
+		return s
+	case strings.HasPrefix(s, "stat:"):
+		_, err := os.Stat(strings.TrimPrefix(s, "stat:"))
+		return fmt.Sprint(err == nil)
+	case strings.HasPrefix(s, "write:"):
+		err := os.WriteFile(strings.TrimPrefix(s, "write:"), []byte(s), 0o644)
+		return fmt.Sprint(err == nil)
+	}
+	return data
+}
+
+// linkTestProcessPlugins 在插件目录中为测试二进制创建多个进程插件链接
+func linkTestProcessPlugins(t *testing.T, dir string, names ...string) {
+	t.Helper()
+	t.Setenv(processPluginEnv, "1")
+
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		if err := os.Symlink(exe, filepath.Join(dir, name+ProcessPluginExt)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func startTestProcessPlugin(t *testing.T) *processPlugin {
+	t.Helper()
+	t.Setenv(processPluginEnv, "1")
+
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := startProcessPlugin(exe, &logger{logger: slog.New(slog.NewTextHandler(io.Discard, nil))}, nopSandbox{}, nil)
+	if err != nil {
+		t.Fatalf("启动进程插件失败: %v", err)
+	}
+	return p
+}
+
+func TestProcessPluginLifecycle(t *testing.T) {
+	p := startTestProcessPlugin(t)
+
+	if got := p.Metadata().Version; got != "1.0.0" {
+		t.Fatalf("期望版本 1.0.0, 得到 %s", got)
+	}
+	if err := p.PreLoad([]byte("cfg")); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := p.Execute("hello")
+	if err != nil || result != "hello" {
+		t.Fatalf("期望 hello, 得到 %v, %v", result, err)
+	}
+
+	if _, err := p.Execute("fail"); err == nil || err.Error() != "执行失败" {
+		t.Fatalf("期望插件返回的错误, 得到 %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := p.ExecuteContext(ctx, "hang"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("期望超时, 得到 %v", err)
+	}
+
+	if err := p.Shutdown(); err != nil {
+		t.Fatalf("关闭插件失败: %v", err)
+	}
+	select {
+	case <-p.done:
+	default:
+		t.Fatal("关闭后子进程应已退出")
+	}
+}
+
+func TestProcessPluginCrash(t *testing.T) {
+	p := startTestProcessPlugin(t)
+
+	if _, err := p.Execute("crash"); !errors.Is(err, ErrPluginProcessExited) {
+		t.Fatalf("期望进程退出错误, 得到 %v", err)
+	}
+	if _, err := p.Execute("hello"); !errors.Is(err, ErrPluginProcessExited) {
+		t.Fatalf("进程退出后调用应失败, 得到 %v", err)
+	}
+	if err := p.Shutdown(); err != nil {
+		t.Fatalf("关闭已退出的插件不应失败: %v", err)
+	}
+}
+
+func TestProcessPluginMalformedFrame(t *testing.T) {
+	p := startTestProcessPlugin(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := p.ExecuteContext(ctx, "garbage"); !errors.Is(err, ErrPluginProcessExited) {
+		t.Fatalf("收到无效消息帧时应结束子进程, 得到 %v", err)
+	}
+	select {
+	case <-p.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("子进程应已被结束")
+	}
+	if _, err := p.Execute("hello"); !errors.Is(err, ErrPluginProcessExited) {
+		t.Fatalf("进程结束后调用应失败, 得到 %v", err)
+	}
+}
+
+func TestManagerExecuteProcessPlugin(t *testing.T) {
+	m := newTestManager(t)
+	p := startTestProcessPlugin(t)
+	addTestPlugin(m, "echo", p)
+	defer p.Shutdown()
+
+	result, err := m.ExecutePlugin("echo", "ping")
+	if err != nil || result != "ping" {
+		t.Fatalf("期望 ping, 得到 %v, %v", result, err)
+	}
+}
+
+func TestRPCFrameRoundTrip(t *testing.T) {
+	for _, name := range []string{"msgpack", "json"} {
+		codec, err := NewRPCCodec(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r, w := io.Pipe()
+		go func() {
+			_ = WriteRPCFrame(w, codec, &RPCRequest{ID: 7, Method: RPCMethodPreLoad, Config: []byte{1, 2}})
+		}()
+
+		var req RPCRequest
+		if err := ReadRPCFrame(r, codec, &req); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if req.ID != 7 || req.Method != RPCMethodPreLoad || string(req.Config) != "\x01\x02" {
+			t.Fatalf("%s: 消息不一致: %+v", name, req)
+		}
+	}
+}
+
+func TestLoadPluginRejectsUnknownExtension(t *testing.T) {
+	m := newTestManager(t)
+	marker := filepath.Join(t.TempDir(), "executed")
+	script := filepath.Join(m.pluginDir, "evil.sh")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\ntouch "+marker+"\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.LoadPlugin(script); !errors.Is(err, ErrUnsupportedPluginFile) {
+		t.Fatalf("未知扩展名应返回 ErrUnsupportedPluginFile, 得到 %v", err)
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Fatal("未知扩展名的文件不应被执行")
+	}
+	if _, ok := m.plugins.Load("evil.sh"); ok {
+		t.Fatal("加载失败的插件不应保留注册")
+	}
+}
+
+func TestHotReloadPreloadsProcessPluginConfig(t *testing.T) {
+	m := newTestManager(t)
+	linkTestProcessPlugins(t, m.pluginDir, "echo")
+	if err := m.LoadPluginWithData(filepath.Join(m.pluginDir, "echo"+ProcessPluginExt), map[string]any{"greeting": "hi"}); err != nil {
+		t.Fatalf("加载进程插件失败: %v", err)
+	}
+	defer m.UnloadPlugin("echo")
+	loaded, err := m.ExecutePlugin("echo", "config")
+	if err != nil || loaded == "" {
+		t.Fatalf("进程插件应收到配置, 得到 %q %v", loaded, err)
+	}
+
+	dir := filepath.Join(t.TempDir(), "v2")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	linkTestProcessPlugins(t, dir, "echo")
+	if err := m.HotReload("echo", filepath.Join(dir, "echo"+ProcessPluginExt)); err != nil {
+		t.Fatalf("热重载进程插件失败: %v", err)
+	}
+	if reloaded, err := m.ExecutePlugin("echo", "config"); err != nil || reloaded != loaded {
+		t.Fatalf("新的子进程应收到相同的配置, 得到 %q %v", reloaded, err)
+	}
+}
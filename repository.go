@@ -0,0 +1,610 @@
+package plugmgr
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// 仓库索引文件名，签名保存在 index.json.sig
+const (
+	RepositoryIndexFile = "index.json"
+	signatureExt        = ".sig"
+)
+
+// RepositoryIndex 插件仓库索引
+//
+//	索引文件 index.json 列出仓库中所有插件的版本，index.json.sig 为索引的 RSA-SHA256 签名。
+type RepositoryIndex struct {
+	Generated time.Time       `json:"generated"`
+	Plugins   []IndexedPlugin `json:"plugins"`
+}
+
+// IndexedPlugin 索引中的插件
+type IndexedPlugin struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Author      string          `json:"author,omitempty"`
+	Releases    []PluginRelease `json:"releases"`
+}
+
+// PluginRelease 插件的一个发布版本
+type PluginRelease struct {
+	Version      string            `json:"version"`
+	Path         string            `json:"path"`                   // 制品相对于仓库根目录的路径
+	Size         int64             `json:"size,omitempty"`         // 制品大小
+	SHA256       string            `json:"sha256"`                 // 制品的 SHA-256，十六进制编码
+	Signature    string            `json:"signature,omitempty"`    // 制品 SHA-256 的 RSA 签名，Base64 编码
+	OS           string            `json:"os,omitempty"`           // 适用的操作系统，为空时不限制
+	Arch         string            `json:"arch,omitempty"`         // 适用的处理器架构，为空时不限制
+	GoVersion    string            `json:"goVersion,omitempty"`    // 编译 .so 插件的 Go 版本，必须与宿主一致
+	Dependencies map[string]string `json:"dependencies,omitempty"` // 依赖的插件及版本约束
+}
+
+// Compatible 检查发布版本是否适用于当前平台
+func (r *PluginRelease) Compatible() bool {
+	return (r.OS == "" || r.OS == runtime.GOOS) &&
+		(r.Arch == "" || r.Arch == runtime.GOARCH) &&
+		(r.GoVersion == "" || r.GoVersion == runtime.Version())
+}
+
+// Lookup 查找插件
+func (idx *RepositoryIndex) Lookup(name string) (*IndexedPlugin, bool) {
+	for i := range idx.Plugins {
+		if idx.Plugins[i].Name == name {
+			return &idx.Plugins[i], true
+		}
+	}
+	return nil, false
+}
+
+// Resolve 获取适用于当前平台且满足约束的最高版本
+//
+//	参数:
+//	- name: 插件名称
+//	- constraint: 版本约束，为空时匹配任意正式版本
+//	返回:
+//	- *PluginRelease: 满足约束的最高版本
+//	- error: 插件不存在返回 ErrPluginNotFound，没有满足约束的版本返回 ErrIncompatibleVersion
+func (idx *RepositoryIndex) Resolve(name, constraint string) (*PluginRelease, error) {
+	c, err := ParseConstraint(constraint)
+	if err != nil {
+		return nil, err
+	}
+	plugin, ok := idx.Lookup(name)
+	if !ok {
+		return nil, wrapf(ErrPluginNotFound, "仓库中没有插件 %s", name)
+	}
+
+	var best *PluginRelease
+	var bestVersion *Version
+	for i := range plugin.Releases {
+		release := &plugin.Releases[i]
+		v, err := ParseVersion(release.Version)
+		if err != nil || !release.Compatible() || !c.Check(v) {
+			continue
+		}
+		if best == nil || v.Compare(bestVersion) > 0 {
+			best, bestVersion = release, v
+		}
+	}
+	if best == nil {
+		return nil, wrapf(ErrIncompatibleVersion, "插件 %s 没有满足约束 %q 且适用于 %s/%s 的版本", name, constraint, runtime.GOOS, runtime.GOARCH)
+	}
+	return best, nil
+}
+
+// RepositoryOption 插件仓库选项
+type RepositoryOption func(*PluginRepository)
+
+// WithRepositoryKey 设置验证索引和制品签名的公钥路径
+//
+//	未设置时使用管理器的 WithPublicKey，二者都未设置时跳过签名验证。
+func WithRepositoryKey(path string) RepositoryOption {
+	return func(r *PluginRepository) {
+		r.keyPath = path
+	}
+}
+
+// WithHTTPClient 设置访问 HTTP 仓库使用的客户端
+func WithHTTPClient(client *http.Client) RepositoryOption {
+	return func(r *PluginRepository) {
+		r.client = client
+	}
+}
+
+// PluginRepository 插件仓库
+//
+//	URL 为 http(s) 地址时通过 HTTP 读取，否则作为本地目录(可以带 file:// 前缀)读取。
+type PluginRepository struct {
+	URL       string
+	SSHKey    string
+	PublicKey ssh.PublicKey
+
+	keyPath string
+	key     *rsa.PublicKey
+	client  *http.Client
+
+	mu    sync.Mutex
+	etag  string           // 最近一次读取的索引的 ETag
+	index *RepositoryIndex // 最近一次读取的索引
+}
+
+// NewPluginRepository 创建插件仓库客户端
+//
+//	参数:
+//	- rawURL: 仓库地址，http(s) URL 或本地目录
+//	- opts: 仓库选项
+//	返回:
+//	- *PluginRepository: 插件仓库
+//	- error: 读取公钥失败时返回
+func NewPluginRepository(rawURL string, opts ...RepositoryOption) (*PluginRepository, error) {
+	r := &PluginRepository{URL: strings.TrimSuffix(rawURL, "/"), client: http.DefaultClient}
+	for _, opt := range opts {
+		opt(r)
+	}
+	if r.keyPath != "" {
+		key, err := loadPublicKey(r.keyPath)
+		if err != nil {
+			return nil, wrap(err, "读取仓库公钥失败")
+		}
+		r.key = key
+	}
+	return r, nil
+}
+
+// isHTTP 检查仓库是否通过 HTTP 访问
+func (r *PluginRepository) isHTTP() bool {
+	return strings.HasPrefix(r.URL, "http://") || strings.HasPrefix(r.URL, "https://")
+}
+
+// open 读取仓库中的文件，HTTP 仓库的文件与 etag 一致(未修改)时 body 为 nil
+func (r *PluginRepository) open(ctx context.Context, name, etag string) (body io.ReadCloser, newETag string, err error) {
+	name = path.Clean("/" + name)[1:]
+	if !r.isHTTP() {
+		f, err := os.Open(filepath.Join(strings.TrimPrefix(r.URL, "file://"), filepath.FromSlash(name)))
+		if err != nil {
+			return nil, "", wrapf(err, "读取仓库文件 %s 失败", name)
+		}
+		return f, "", nil
+	}
+
+	target, err := url.JoinPath(r.URL, name)
+	if err != nil {
+		return nil, "", wrap(err, "无效的仓库地址")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, "", wrap(err, "创建仓库请求失败")
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, "", wrapf(err, "请求仓库文件 %s 失败", name)
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.Body, resp.Header.Get("ETag"), nil
+	case http.StatusNotModified:
+		resp.Body.Close()
+		return nil, etag, nil
+	default:
+		resp.Body.Close()
+		return nil, "", newErrorf("请求仓库文件 %s 失败: %s", name, resp.Status)
+	}
+}
+
+// readFile 读取仓库中的小文件
+func (r *PluginRepository) readFile(ctx context.Context, name string) ([]byte, error) {
+	body, _, err := r.open(ctx, name, "")
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return io.ReadAll(body)
+}
+
+// Index 读取并验证仓库索引
+//
+//	配置了公钥时使用 index.json.sig 验证索引签名。HTTP 仓库的索引未修改(ETag 相同)时返回缓存的索引。
+func (r *PluginRepository) Index(ctx context.Context) (*RepositoryIndex, error) {
+	r.mu.Lock()
+	etag, cached := r.etag, r.index
+	r.mu.Unlock()
+
+	body, newETag, err := r.open(ctx, RepositoryIndexFile, etag)
+	if err != nil {
+		return nil, err
+	}
+	if body == nil {
+		return cached, nil
+	}
+	data, err := io.ReadAll(body)
+	body.Close()
+	if err != nil {
+		return nil, wrap(err, "读取仓库索引失败")
+	}
+
+	if r.key != nil {
+		signature, err := r.readFile(ctx, RepositoryIndexFile+signatureExt)
+		if err != nil {
+			return nil, wrap(err, "读取仓库索引签名失败")
+		}
+		if err := verifyDigest(r.key, sha256.Sum256(data), signature); err != nil {
+			return nil, wrap(err, "仓库索引签名无效")
+		}
+	}
+
+	var index RepositoryIndex
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, wrap(err, "解析仓库索引失败")
+	}
+	if err := index.validate(); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	r.etag, r.index = newETag, &index
+	r.mu.Unlock()
+	return &index, nil
+}
+
+// validate 检查索引中的插件名称、版本和依赖名称
+//
+//	这些值会成为插件目录下的文件和链接名称，未签名的索引同样需要检查。
+func (idx *RepositoryIndex) validate() error {
+	for _, plugin := range idx.Plugins {
+		if !validPluginName(plugin.Name) {
+			return newErrorf("仓库索引中的插件名称无效: %q", plugin.Name)
+		}
+		for _, release := range plugin.Releases {
+			if _, err := ParseVersion(release.Version); err != nil {
+				return wrapf(err, "仓库索引中插件 %s 的版本无效", plugin.Name)
+			}
+			for dep := range release.Dependencies {
+				if !validPluginName(dep) {
+					return newErrorf("仓库索引中插件 %s %s 的依赖名称无效: %q", plugin.Name, release.Version, dep)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Download 下载发布版本的制品到 dst
+//
+//	参数:
+//	- ctx: 上下文
+//	- release: 发布版本
+//	- dst: 目标文件路径，所在目录不存在时自动创建
+//	功能:
+//	- 先写入临时文件，校验 SHA-256 和签名通过后再重命名为 dst
+//	- 配置了公钥时签名同时写入 dst.sig，供加载插件时验证
+//	返回:
+//	- error: 下载失败，校验和不匹配时返回 ErrChecksumMismatch，签名无效时返回 ErrInvalidSignature
+func (r *PluginRepository) Download(ctx context.Context, release *PluginRelease, dst string) error {
+	var signature []byte
+	if r.key != nil {
+		var err error
+		if signature, err = base64.StdEncoding.DecodeString(release.Signature); err != nil || len(signature) == 0 {
+			return wrapf(ErrInvalidSignature, "插件版本 %s 缺少有效的签名", release.Version)
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return wrap(err, "创建插件目录失败")
+	}
+	body, _, err := r.open(ctx, release.Path, "")
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(dst), filepath.Base(dst)+".*.tmp")
+	if err != nil {
+		return wrap(err, "创建临时文件失败")
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return wrapf(err, "下载插件 %s 失败", release.Path)
+	}
+
+	var digest [sha256.Size]byte
+	hash.Sum(digest[:0])
+	if release.Size > 0 && size != release.Size {
+		return wrapf(ErrChecksumMismatch, "插件 %s 的大小为 %d, 索引记录为 %d", release.Path, size, release.Size)
+	}
+	if !strings.EqualFold(hex.EncodeToString(digest[:]), release.SHA256) {
+		return wrapf(ErrChecksumMismatch, "插件 %s 的 SHA-256 与索引不一致", release.Path)
+	}
+	if r.key != nil {
+		if err := verifyDigest(r.key, digest, signature); err != nil {
+			return wrapf(err, "插件 %s 的签名无效", release.Path)
+		}
+		if err := os.WriteFile(dst+signatureExt, signature, 0o644); err != nil {
+			return wrap(err, "保存插件签名失败")
+		}
+	}
+
+	if err := os.Chmod(tmp.Name(), 0o755); err != nil {
+		return wrap(err, "设置插件文件权限失败")
+	}
+	return wrap(os.Rename(tmp.Name(), dst), "保存插件文件失败")
+}
+
+// RepositoryUpload 上传到仓库服务器的插件版本
+type RepositoryUpload struct {
+	Name        string
+	Description string
+	Author      string
+	Release     PluginRelease // 使用 Version、OS、Arch、GoVersion、Dependencies 和可选的 Signature
+	FileName    string        // 制品文件名，扩展名决定插件类型(.so 或 .plugin)
+	Artifact    io.Reader     // 制品内容
+}
+
+// Upload 上传插件版本到 RepositoryServer
+//
+//	参数:
+//	- ctx: 上下文
+//	- token: 上传令牌
+//	- upload: 上传的插件版本
+//	返回:
+//	- *PluginRelease: 服务器记录的版本，包括制品路径、SHA-256 和签名
+//	- error: 令牌无效返回 ErrPermissionDenied，版本已存在返回 ErrReleaseExists
+func (r *PluginRepository) Upload(ctx context.Context, token string, upload *RepositoryUpload) (*PluginRelease, error) {
+	if !r.isHTTP() {
+		return nil, newErrorf("仓库 %s 不是 HTTP 仓库", r.URL)
+	}
+	target, err := url.JoinPath(r.URL, RepositoryUploadPath)
+	if err != nil {
+		return nil, wrap(err, "无效的仓库地址")
+	}
+
+	body, writer := io.Pipe()
+	form := multipart.NewWriter(writer)
+	go func() {
+		writer.CloseWithError(writeUploadForm(form, upload))
+	}()
+	defer body.Close()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, body)
+	if err != nil {
+		return nil, wrap(err, "创建上传请求失败")
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, wrap(err, "上传插件失败")
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusCreated:
+		var release PluginRelease
+		if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
+			return nil, wrap(err, "解析上传结果失败")
+		}
+		return &release, nil
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return nil, wrapf(ErrPermissionDenied, "上传插件 %s 被拒绝: %s", upload.Name, resp.Status)
+	case http.StatusConflict:
+		return nil, wrapf(ErrReleaseExists, "插件 %s 的版本 %s 已存在", upload.Name, upload.Release.Version)
+	default:
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, newErrorf("上传插件 %s 失败: %s %s", upload.Name, resp.Status, strings.TrimSpace(string(message)))
+	}
+}
+
+// writeUploadForm 写入上传请求的表单
+func writeUploadForm(form *multipart.Writer, upload *RepositoryUpload) error {
+	fields := [][2]string{
+		{"name", upload.Name},
+		{"version", upload.Release.Version},
+		{"description", upload.Description},
+		{"author", upload.Author},
+		{"os", upload.Release.OS},
+		{"arch", upload.Release.Arch},
+		{"goVersion", upload.Release.GoVersion},
+		{"signature", upload.Release.Signature},
+	}
+	if len(upload.Release.Dependencies) > 0 {
+		deps, err := json.Marshal(upload.Release.Dependencies)
+		if err != nil {
+			return err
+		}
+		fields = append(fields, [2]string{"dependencies", string(deps)})
+	}
+	for _, field := range fields {
+		if field[1] == "" {
+			continue
+		}
+		if err := form.WriteField(field[0], field[1]); err != nil {
+			return err
+		}
+	}
+
+	fileName := upload.FileName
+	if fileName == "" {
+		fileName = upload.Name + ".so"
+	}
+	part, err := form.CreateFormFile("artifact", fileName)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(part, upload.Artifact); err != nil {
+		return err
+	}
+	return form.Close()
+}
+
+// verifyDigest 验证 SHA-256 摘要的 RSA PKCS#1 v1.5 签名
+func verifyDigest(key *rsa.PublicKey, digest [sha256.Size]byte, signature []byte) error {
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		return wrap(ErrInvalidSignature, err.Error())
+	}
+	return nil
+}
+
+// WithRepository 添加插件仓库，InstallPlugin 按添加顺序在仓库中查找插件
+func WithRepository(repo *PluginRepository) ManagerOption {
+	return func(o *managerOptions) {
+		o.repositories = append(o.repositories, repo)
+	}
+}
+
+// AddRepository 添加插件仓库
+//
+//	仓库未设置公钥时使用管理器的公钥验证签名。
+func (m *Manager) AddRepository(repo *PluginRepository) error {
+	if repo.key == nil && m.publicKeyPath != "" {
+		key, err := loadPublicKey(m.publicKeyPath)
+		if err != nil {
+			return wrap(err, "读取仓库公钥失败")
+		}
+		repo.key = key
+	}
+	if repo.key == nil {
+		m.logger.Warn("插件仓库未配置公钥，跳过签名验证", "repository", repo.URL)
+	}
+
+	m.repoMu.Lock()
+	defer m.repoMu.Unlock()
+	m.repositories = append(m.repositories, repo)
+	return nil
+}
+
+// Repositories 返回已添加的插件仓库
+func (m *Manager) Repositories() []*PluginRepository {
+	m.repoMu.RLock()
+	defer m.repoMu.RUnlock()
+	return append([]*PluginRepository(nil), m.repositories...)
+}
+
+// RefreshRepositories 读取所有仓库的索引并更新插件市场
+func (m *Manager) RefreshRepositories(ctx context.Context) error {
+	for _, repo := range m.Repositories() {
+		index, err := repo.Index(ctx)
+		if err != nil {
+			return wrapf(err, "读取仓库 %s 的索引失败", repo.URL)
+		}
+		for _, plugin := range index.Plugins {
+			for _, release := range plugin.Releases {
+				if !release.Compatible() {
+					continue
+				}
+				info := PluginInfo{Name: plugin.Name, Description: plugin.Description, Author: plugin.Author, Version: release.Version}
+				if err := m.pluginMarket.AddPlugin(info); err != nil {
+					m.logger.Warn("忽略版本号无效的插件", "plugin", plugin.Name, "version", release.Version, "error", err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// versionedPluginPath 返回仓库安装的插件版本的保存路径
+//
+//	路径为 <pluginDir>/versions/<name>/<version>/<name><ext>，文件名与插件名称一致，
+//	因此可以直接通过该路径加载插件。
+func (m *Manager) versionedPluginPath(name, version, ext string) string {
+	return filepath.Join(m.pluginDir, "versions", name, version, name+ext)
+}
+
+// findPluginVersion 查找已安装的插件版本文件
+//
+//	优先使用仓库安装的版本目录，不存在时使用旧的 <name>_v<version>.so 文件。
+func (m *Manager) findPluginVersion(name, version string) string {
+	for _, ext := range []string{".so", ProcessPluginExt} {
+		path := m.versionedPluginPath(name, version, ext)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return filepath.Join(m.pluginDir, name+"_v"+version+".so")
+}
+
+// activatePluginFile 将 <pluginDir>/<name><ext> 指向插件版本文件，使重启后加载该版本
+func (m *Manager) activatePluginFile(name, path string) error {
+	versionsDir := filepath.Join(m.pluginDir, "versions")
+	rel, err := filepath.Rel(m.pluginDir, path)
+	if err != nil || !strings.HasPrefix(path, versionsDir+string(filepath.Separator)) {
+		return nil
+	}
+
+	link := filepath.Join(m.pluginDir, name+filepath.Ext(path))
+	tmp := link + ".tmp"
+	os.Remove(tmp)
+	if err := os.Symlink(rel, tmp); err != nil {
+		return wrap(err, "创建插件链接失败")
+	}
+	if err := os.Rename(tmp, link); err != nil {
+		os.Remove(tmp)
+		return wrap(err, "替换插件链接失败")
+	}
+	if data, err := os.ReadFile(path + signatureExt); err == nil {
+		return wrap(os.WriteFile(link+signatureExt, data, 0o644), "保存插件签名失败")
+	}
+	return nil
+}
+
+// fetchRelease 从仓库下载发布版本到版本目录
+//
+//	插件包格式的发布版本解压后返回其中的插件文件和清单，其他发布版本返回下载的插件文件和 nil。
+func (m *Manager) fetchRelease(ctx context.Context, repo *PluginRepository, name string, release *PluginRelease) (string, *PackageManifest, error) {
+	if !validPluginName(name) {
+		return "", nil, newErrorf("无效的插件名称: %q", name)
+	}
+	if _, err := ParseVersion(release.Version); err != nil {
+		return "", nil, wrapf(err, "插件 %s 的版本无效", name)
+	}
+	if !isPackageFile(release.Path) {
+		ext := filepath.Ext(release.Path)
+		if ext != ProcessPluginExt {
+			ext = ".so"
+		}
+		pluginPath := m.versionedPluginPath(name, release.Version, ext)
+		return pluginPath, nil, repo.Download(ctx, release, pluginPath)
+	}
+
+	archive := filepath.Join(m.pluginDir, "versions", "."+name+"-"+release.Version+"-"+path.Base(release.Path))
+	defer os.Remove(archive + signatureExt)
+	defer os.Remove(archive)
+	if err := repo.Download(ctx, release, archive); err != nil {
+		return "", nil, err
+	}
+
+	dir, manifest, err := m.unpackPackage(archive, nil)
+	if err != nil {
+		return "", nil, err
+	}
+	if manifest.Name != name || compareVersionStrings(manifest.Version, release.Version) != 0 {
+		return "", nil, wrapf(ErrManifestMismatch, "仓库中的 %s %s 是插件包 %s %s", name, release.Version, manifest.Name, manifest.Version)
+	}
+	return filepath.Join(dir, manifest.binary()), manifest, nil
+}
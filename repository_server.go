@@ -0,0 +1,510 @@
+package plugmgr
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 仓库服务器的约定
+const (
+	// RepositoryUploadPath 上传插件版本的地址
+	RepositoryUploadPath = "/upload"
+	// releaseFile 每个版本目录中保存版本信息的文件，重建索引时读取
+	releaseFile = "release.json"
+	// defaultMaxUploadSize 默认的上传大小限制
+	defaultMaxUploadSize = 512 << 20
+)
+
+// releaseManifest 版本目录中的 release.json
+type releaseManifest struct {
+	Name        string        `json:"name"`
+	Description string        `json:"description,omitempty"`
+	Author      string        `json:"author,omitempty"`
+	Release     PluginRelease `json:"release"`
+}
+
+// RepositoryServerOption 仓库服务器选项
+type RepositoryServerOption func(*RepositoryServer)
+
+// WithSigningKey 设置签名索引和制品的 RSA 私钥路径(PEM 格式，PKCS#1 或 PKCS#8)
+func WithSigningKey(path string) RepositoryServerOption {
+	return func(s *RepositoryServer) {
+		s.keyPath = path
+	}
+}
+
+// WithUploadToken 设置上传使用的令牌，未设置时禁止上传
+func WithUploadToken(token string) RepositoryServerOption {
+	return func(s *RepositoryServer) {
+		s.token = token
+	}
+}
+
+// WithMaxUploadSize 设置单次上传的大小限制，默认 512MiB
+func WithMaxUploadSize(size int64) RepositoryServerOption {
+	return func(s *RepositoryServer) {
+		s.maxUpload = size
+	}
+}
+
+// WithServerLogger 设置仓库服务器的日志记录器
+func WithServerLogger(l Logger) RepositoryServerOption {
+	return func(s *RepositoryServer) {
+		s.logger = l
+	}
+}
+
+// RepositoryServer 插件仓库服务器
+//
+//	从目录提供 index.json、index.json.sig 和插件制品，目录结构为:
+//
+//	<dir>/index.json
+//	<dir>/index.json.sig
+//	<dir>/<name>/<version>/<name>.so
+//	<dir>/<name>/<version>/release.json
+//
+//	GET 和 HEAD 请求支持 ETag 和 Range。POST /upload 上传新版本，需要 Bearer 令牌。
+//	PluginRepository 可以直接使用服务器地址作为仓库。
+type RepositoryServer struct {
+	dir       string
+	keyPath   string
+	key       *rsa.PrivateKey
+	token     string
+	maxUpload int64
+	logger    Logger
+
+	mu        sync.RWMutex
+	index     []byte            // 当前索引内容
+	indexSig  []byte            // 当前索引签名
+	indexTime time.Time         // 索引生成时间
+	etags     map[string]string // 制品路径到 ETag 的映射
+}
+
+// NewRepositoryServer 创建插件仓库服务器
+//
+//	参数:
+//	- dir: 仓库目录，不存在时自动创建
+//	- opts: 服务器选项
+//	功能:
+//	- 读取签名私钥
+//	- 根据目录中的 release.json 重建并签名索引
+//	返回:
+//	- *RepositoryServer: 仓库服务器
+//	- error: 创建目录、读取私钥或重建索引失败时返回
+func NewRepositoryServer(dir string, opts ...RepositoryServerOption) (*RepositoryServer, error) {
+	s := &RepositoryServer{
+		dir:       dir,
+		maxUpload: defaultMaxUploadSize,
+		logger:    &logger{logger: slog.Default()},
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, wrap(err, "创建仓库目录失败")
+	}
+	if s.keyPath != "" {
+		key, err := loadPrivateKey(s.keyPath)
+		if err != nil {
+			return nil, err
+		}
+		s.key = key
+	} else {
+		s.logger.Warn("仓库服务器未配置签名私钥，索引和制品不签名", "dir", dir)
+	}
+	if err := s.Rebuild(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Rebuild 根据目录中的 release.json 重建索引
+//
+//	功能:
+//	- 遍历仓库目录，读取每个版本目录中的 release.json
+//	- 插件按名称排序，版本按从低到高排序
+//	- 配置了私钥时签名索引，写入 index.json 和 index.json.sig
+func (s *RepositoryServer) Rebuild() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rebuild()
+}
+
+// rebuild 重建索引，调用方持有写锁
+func (s *RepositoryServer) rebuild() error {
+	plugins := make(map[string]*IndexedPlugin)
+	etags := make(map[string]string)
+	err := filepath.WalkDir(s.dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || d.Name() != releaseFile {
+			return err
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		var manifest releaseManifest
+		if err := json.Unmarshal(data, &manifest); err != nil {
+			s.logger.Warn("忽略无效的版本信息", "path", p, "error", err)
+			return nil
+		}
+		plugin, ok := plugins[manifest.Name]
+		if !ok {
+			plugin = &IndexedPlugin{Name: manifest.Name}
+			plugins[manifest.Name] = plugin
+		}
+		if manifest.Description != "" {
+			plugin.Description = manifest.Description
+		}
+		if manifest.Author != "" {
+			plugin.Author = manifest.Author
+		}
+		plugin.Releases = append(plugin.Releases, manifest.Release)
+		etags[manifest.Release.Path] = `"` + manifest.Release.SHA256 + `"`
+		return nil
+	})
+	if err != nil {
+		return wrap(err, "读取仓库目录失败")
+	}
+
+	index := RepositoryIndex{Generated: time.Now().UTC(), Plugins: make([]IndexedPlugin, 0, len(plugins))}
+	for _, plugin := range plugins {
+		sort.Slice(plugin.Releases, func(i, j int) bool {
+			return compareVersionStrings(plugin.Releases[i].Version, plugin.Releases[j].Version) < 0
+		})
+		index.Plugins = append(index.Plugins, *plugin)
+	}
+	sort.Slice(index.Plugins, func(i, j int) bool {
+		return index.Plugins[i].Name < index.Plugins[j].Name
+	})
+
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return wrap(err, "序列化仓库索引失败")
+	}
+	var signature []byte
+	if s.key != nil {
+		if signature, err = signDigest(s.key, sha256.Sum256(data)); err != nil {
+			return err
+		}
+		if err := writeFileAtomic(filepath.Join(s.dir, RepositoryIndexFile+signatureExt), signature, 0o644); err != nil {
+			return wrap(err, "写入索引签名失败")
+		}
+	}
+	if err := writeFileAtomic(filepath.Join(s.dir, RepositoryIndexFile), data, 0o644); err != nil {
+		return wrap(err, "写入仓库索引失败")
+	}
+
+	s.index, s.indexSig, s.indexTime, s.etags = data, signature, index.Generated, etags
+	return nil
+}
+
+// ServeHTTP 处理仓库请求
+func (s *RepositoryServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == RepositoryUploadPath:
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		s.handleUpload(w, r)
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		s.handleGet(w, r)
+	default:
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleGet 提供索引和制品，由 http.ServeContent 处理 ETag、Range 和 HEAD
+func (s *RepositoryServer) handleGet(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+
+	s.mu.RLock()
+	index, indexSig, indexTime, etag := s.index, s.indexSig, s.indexTime, s.etags[name]
+	s.mu.RUnlock()
+
+	switch name {
+	case RepositoryIndexFile:
+		digest := sha256.Sum256(index)
+		w.Header().Set("ETag", `"`+hex.EncodeToString(digest[:])+`"`)
+		w.Header().Set("Content-Type", "application/json")
+		http.ServeContent(w, r, name, indexTime, bytes.NewReader(index))
+		return
+	case RepositoryIndexFile + signatureExt:
+		if indexSig == nil {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		http.ServeContent(w, r, name, indexTime, bytes.NewReader(indexSig))
+		return
+	}
+
+	f, err := os.Open(filepath.Join(s.dir, filepath.FromSlash(name)))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || info.IsDir() || strings.HasSuffix(name, ".tmp") {
+		http.NotFound(w, r)
+		return
+	}
+	if etag != "" {
+		w.Header().Set("ETag", etag)
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	http.ServeContent(w, r, name, info.ModTime(), f)
+}
+
+// authorized 检查上传请求的 Bearer 令牌
+func (s *RepositoryServer) authorized(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && s.token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) == 1
+}
+
+// handleUpload 处理上传的新版本
+//
+//	请求为 multipart/form-data，字段 name、version、description、author、os、arch、goVersion、
+//	dependencies(JSON 对象)、signature(Base64，可选)和文件 artifact。
+//	已存在的版本不可覆盖，返回 409。
+func (s *RepositoryServer) handleUpload(w http.ResponseWriter, r *http.Request) {
+	if s.token == "" {
+		http.Error(w, "uploads are disabled", http.StatusForbidden)
+		return
+	}
+	if !s.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="plugmgr"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, s.maxUpload)
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		http.Error(w, "invalid upload: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	manifest := releaseManifest{
+		Name:        r.FormValue("name"),
+		Description: r.FormValue("description"),
+		Author:      r.FormValue("author"),
+		Release: PluginRelease{
+			Version:   r.FormValue("version"),
+			OS:        r.FormValue("os"),
+			Arch:      r.FormValue("arch"),
+			GoVersion: r.FormValue("goVersion"),
+			Signature: r.FormValue("signature"),
+		},
+	}
+	if deps := r.FormValue("dependencies"); deps != "" {
+		if err := json.Unmarshal([]byte(deps), &manifest.Release.Dependencies); err != nil {
+			http.Error(w, "invalid dependencies: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	file, header, err := r.FormFile("artifact")
+	if err != nil {
+		http.Error(w, "missing artifact", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	release, err := s.store(manifest, artifactExt(header.Filename), file)
+	switch {
+	case errors.Is(err, ErrReleaseExists):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		var pe *PluginError
+		if errors.As(err, &pe) && pe.Type() == errTypeValidation {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		} else {
+			s.logger.Error("保存上传的插件失败", "plugin", manifest.Name, "error", err)
+			http.Error(w, "internal error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	s.logger.Info("已发布插件版本", "plugin", manifest.Name, "version", release.Version)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(release)
+}
+
+// artifactExt 返回制品保存时使用的扩展名：插件包保留原扩展名，进程插件为 .plugin，其他为 .so
+func artifactExt(fileName string) string {
+	for _, ext := range []string{".tar.gz", ".tgz", ".zip", ProcessPluginExt} {
+		if strings.HasSuffix(fileName, ext) {
+			return ext
+		}
+	}
+	return ".so"
+}
+
+// validPluginName 检查插件名称能否用作目录名
+func validPluginName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, `/\`) && !strings.HasPrefix(name, ".")
+}
+
+// store 保存上传的制品并重建索引
+func (s *RepositoryServer) store(manifest releaseManifest, ext string, artifact io.Reader) (*PluginRelease, error) {
+	release := &manifest.Release
+	if !validPluginName(manifest.Name) {
+		return nil, newPluginError("无效的插件名称: "+manifest.Name, errTypeValidation)
+	}
+	v, err := ParseVersion(release.Version)
+	if err != nil {
+		return nil, err
+	}
+	release.Version = v.String()
+	for name, constraint := range release.Dependencies {
+		if _, err := ParseConstraint(constraint); err != nil {
+			return nil, wrapf(err, "依赖 %s 的版本约束无效", name)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	versionDir := filepath.Join(s.dir, manifest.Name, release.Version)
+	if _, err := os.Stat(filepath.Join(versionDir, releaseFile)); err == nil {
+		return nil, wrapf(ErrReleaseExists, "插件 %s 的版本 %s 已存在", manifest.Name, release.Version)
+	}
+	if err := os.MkdirAll(versionDir, 0o755); err != nil {
+		return nil, wrap(err, "创建版本目录失败")
+	}
+
+	tmp, err := os.CreateTemp(versionDir, manifest.Name+".*.tmp")
+	if err != nil {
+		return nil, wrap(err, "创建临时文件失败")
+	}
+	defer os.Remove(tmp.Name())
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), artifact)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, wrap(err, "保存制品失败")
+	}
+
+	var digest [sha256.Size]byte
+	hash.Sum(digest[:0])
+	release.SHA256 = hex.EncodeToString(digest[:])
+	release.Size = size
+	release.Path = path.Join(manifest.Name, release.Version, manifest.Name+ext)
+	if err := s.signRelease(release, digest); err != nil {
+		return nil, err
+	}
+
+	if err := os.Rename(tmp.Name(), filepath.Join(versionDir, manifest.Name+ext)); err != nil {
+		return nil, wrap(err, "保存制品失败")
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, wrap(err, "序列化版本信息失败")
+	}
+	if err := writeFileAtomic(filepath.Join(versionDir, releaseFile), data, 0o644); err != nil {
+		return nil, wrap(err, "写入版本信息失败")
+	}
+	if err := s.rebuild(); err != nil {
+		return nil, err
+	}
+	return release, nil
+}
+
+// signRelease 签名制品，上传时已带签名则使用私钥对应的公钥验证
+func (s *RepositoryServer) signRelease(release *PluginRelease, digest [sha256.Size]byte) error {
+	if release.Signature != "" {
+		signature, err := base64.StdEncoding.DecodeString(release.Signature)
+		if err != nil {
+			return wrap(ErrInvalidSignature, "签名不是有效的 Base64")
+		}
+		if s.key != nil {
+			return verifyDigest(&s.key.PublicKey, digest, signature)
+		}
+		return nil
+	}
+	if s.key == nil {
+		return nil
+	}
+	signature, err := signDigest(s.key, digest)
+	if err != nil {
+		return err
+	}
+	release.Signature = base64.StdEncoding.EncodeToString(signature)
+	return nil
+}
+
+// signDigest 使用 RSA PKCS#1 v1.5 签名 SHA-256 摘要
+func signDigest(key *rsa.PrivateKey, digest [sha256.Size]byte) ([]byte, error) {
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return nil, wrap(err, "签名失败")
+	}
+	return signature, nil
+}
+
+// loadPrivateKey 读取 PEM 格式的 RSA 私钥，支持 PKCS#1 和 PKCS#8
+func loadPrivateKey(path string) (*rsa.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, wrap(err, "读取私钥文件失败")
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, newError("解析包含私钥的 PEM 块失败")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, wrap(err, "解析私钥失败")
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, newError("私钥不是 RSA 私钥")
+	}
+	return rsaKey, nil
+}
+
+// compareVersionStrings 比较两个版本号，无法解析的版本排在最前
+func compareVersionStrings(a, b string) int {
+	va, errA := ParseVersion(a)
+	vb, errB := ParseVersion(b)
+	switch {
+	case errA != nil && errB != nil:
+		return strings.Compare(a, b)
+	case errA != nil:
+		return -1
+	case errB != nil:
+		return 1
+	}
+	return va.Compare(vb)
+}
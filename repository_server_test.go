@@ -0,0 +1,142 @@
+package plugmgr
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// privateKeyPath 将测试私钥写入 PEM 文件
+func (r *testRepository) privateKeyPath() string {
+	path := filepath.Join(r.t.TempDir(), "private.pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(r.key)})
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		r.t.Fatal(err)
+	}
+	return path
+}
+
+// newTestRepositoryServer 创建使用测试密钥签名的仓库服务器
+func newTestRepositoryServer(t *testing.T) (*testRepository, *httptest.Server) {
+	t.Helper()
+	repo := newTestRepository(t)
+	server, err := NewRepositoryServer(repo.dir, WithSigningKey(repo.privateKeyPath()), WithUploadToken("secret"))
+	if err != nil {
+		t.Fatalf("创建仓库服务器失败: %v", err)
+	}
+	ts := httptest.NewServer(server)
+	t.Cleanup(ts.Close)
+	return repo, ts
+}
+
+func TestRepositoryServerUpload(t *testing.T) {
+	repo, ts := newTestRepositoryServer(t)
+	client, err := NewPluginRepository(ts.URL, WithRepositoryKey(repo.keyPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	upload := func(token, version string) (*PluginRelease, error) {
+		return client.Upload(ctx, token, &RepositoryUpload{
+			Name:     "greeter",
+			Release:  PluginRelease{Version: version, Dependencies: map[string]string{"storage": "^2.0"}},
+			Artifact: strings.NewReader("greeter " + version),
+		})
+	}
+	if _, err := upload("wrong", "1.0.0"); !errors.Is(err, ErrPermissionDenied) {
+		t.Fatalf("令牌错误时应返回 ErrPermissionDenied, 得到 %v", err)
+	}
+	if _, err := upload("secret", "1.0.0"); err != nil {
+		t.Fatalf("上传失败: %v", err)
+	}
+	if _, err := upload("secret", "1.0.0"); !errors.Is(err, ErrReleaseExists) {
+		t.Fatalf("重复上传应返回 ErrReleaseExists, 得到 %v", err)
+	}
+	if _, err := upload("secret", "1.1.0"); err != nil {
+		t.Fatalf("上传失败: %v", err)
+	}
+
+	index, err := client.Index(ctx)
+	if err != nil {
+		t.Fatalf("读取签名的索引失败: %v", err)
+	}
+	release, err := index.Resolve("greeter", "")
+	if err != nil || release.Version != "1.1.0" || release.Dependencies["storage"] != "^2.0" {
+		t.Fatalf("索引中的版本不正确: %+v %v", release, err)
+	}
+	dst := filepath.Join(t.TempDir(), "greeter.so")
+	if err := client.Download(ctx, release, dst); err != nil {
+		t.Fatalf("下载服务器签名的制品失败: %v", err)
+	}
+	if data, _ := os.ReadFile(dst); string(data) != "greeter 1.1.0" {
+		t.Fatalf("下载的内容不正确: %q", data)
+	}
+
+	// 未修改的索引使用缓存
+	if cached, err := client.Index(ctx); err != nil || cached != index {
+		t.Fatalf("索引未修改时应返回缓存: %v", err)
+	}
+}
+
+func TestRepositoryServerConditionalAndRange(t *testing.T) {
+	_, ts := newTestRepositoryServer(t)
+	client, err := NewPluginRepository(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	release, err := client.Upload(context.Background(), "secret", &RepositoryUpload{
+		Name:     "greeter",
+		Release:  PluginRelease{Version: "1.0.0"},
+		Artifact: strings.NewReader("0123456789"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(path string, header http.Header) *http.Response {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, ts.URL+"/"+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	resp := get(release.Path, nil)
+	etag := resp.Header.Get("ETag")
+	if resp.StatusCode != http.StatusOK || etag != `"`+release.SHA256+`"` {
+		t.Fatalf("制品的 ETag 应为 SHA-256, 得到 %d %s", resp.StatusCode, etag)
+	}
+	if resp := get(release.Path, http.Header{"If-None-Match": {etag}}); resp.StatusCode != http.StatusNotModified {
+		t.Fatalf("ETag 匹配时应返回 304, 得到 %d", resp.StatusCode)
+	}
+	resp = get(release.Path, http.Header{"Range": {"bytes=2-5"}})
+	if body, _ := io.ReadAll(resp.Body); resp.StatusCode != http.StatusPartialContent || string(body) != "2345" {
+		t.Fatalf("Range 请求应返回部分内容, 得到 %d %q", resp.StatusCode, body)
+	}
+
+	resp = get(RepositoryIndexFile, nil)
+	if resp := get(RepositoryIndexFile, http.Header{"If-None-Match": {resp.Header.Get("ETag")}}); resp.StatusCode != http.StatusNotModified {
+		t.Fatalf("索引未修改时应返回 304, 得到 %d", resp.StatusCode)
+	}
+	if resp := get("../"+RepositoryIndexFile+".tmp", nil); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("不应提供临时文件, 得到 %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,234 @@
+package plugmgr
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testRepository 测试用的插件仓库目录
+type testRepository struct {
+	t       *testing.T
+	dir     string
+	key     *rsa.PrivateKey
+	keyPath string
+	index   RepositoryIndex
+}
+
+func newTestRepository(t *testing.T) *testRepository {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPath := filepath.Join(t.TempDir(), "public.pem")
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return &testRepository{t: t, dir: t.TempDir(), key: key, keyPath: keyPath}
+}
+
+func (r *testRepository) sign(data []byte) []byte {
+	digest := sha256.Sum256(data)
+	signature, err := rsa.SignPKCS1v15(rand.Reader, r.key, crypto.SHA256, digest[:])
+	if err != nil {
+		r.t.Fatal(err)
+	}
+	return signature
+}
+
+// add 添加插件版本的制品，返回索引中的记录
+func (r *testRepository) add(name string, release PluginRelease, content string) *PluginRelease {
+	release.Path = filepath.ToSlash(filepath.Join(name, release.Version, name+".so"))
+	path := filepath.Join(r.dir, filepath.FromSlash(release.Path))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		r.t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		r.t.Fatal(err)
+	}
+	digest := sha256.Sum256([]byte(content))
+	release.SHA256 = hex.EncodeToString(digest[:])
+	release.Size = int64(len(content))
+	release.Signature = base64.StdEncoding.EncodeToString(r.sign([]byte(content)))
+
+	plugin, ok := r.index.Lookup(name)
+	if !ok {
+		r.index.Plugins = append(r.index.Plugins, IndexedPlugin{Name: name})
+		plugin = &r.index.Plugins[len(r.index.Plugins)-1]
+	}
+	plugin.Releases = append(plugin.Releases, release)
+	return &plugin.Releases[len(plugin.Releases)-1]
+}
+
+// publish 写入并签名索引
+func (r *testRepository) publish() {
+	data, err := json.Marshal(r.index)
+	if err != nil {
+		r.t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(r.dir, RepositoryIndexFile), data, 0o644); err != nil {
+		r.t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(r.dir, RepositoryIndexFile+signatureExt), r.sign(data), 0o644); err != nil {
+		r.t.Fatal(err)
+	}
+}
+
+func TestInstallPluginFromRepository(t *testing.T) {
+	repo := newTestRepository(t)
+	repo.add("greeter", PluginRelease{Version: "1.0.0"}, "v1.0.0")
+	repo.add("greeter", PluginRelease{Version: "1.1.0"}, "v1.1.0")
+	repo.add("greeter", PluginRelease{Version: "2.0.0", OS: "plan9"}, "v2.0.0")
+	repo.publish()
+	server := httptest.NewServer(http.FileServer(http.Dir(repo.dir)))
+	defer server.Close()
+
+	m := newTestManager(t)
+	m.publicKeyPath = repo.keyPath
+	client, err := NewPluginRepository(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AddRepository(client); err != nil {
+		t.Fatal(err)
+	}
+
+	path := m.versionedPluginPath("greeter", "1.1.0", ".so")
+	m.preloadedPlugins.Store("greeter", &lazyPlugin{path: path, loaded: &fakePlugin{metadata: PluginMetadata{Version: "1.1.0"}}})
+	if err := m.InstallPlugin("greeter", "^1.0"); err != nil {
+		t.Fatalf("安装插件失败: %v", err)
+	}
+
+	// 2.0.0 不适用于当前平台，应安装 1.1.0
+	if data, err := os.ReadFile(path); err != nil || string(data) != "v1.1.0" {
+		t.Fatalf("下载的插件内容不正确: %q %v", data, err)
+	}
+	if target, err := filepath.EvalSymlinks(filepath.Join(m.pluginDir, "greeter.so")); err != nil || target != path {
+		t.Fatalf("greeter.so 应指向安装的版本, 得到 %q %v", target, err)
+	}
+	if v, ok := m.versionManager.GetActiveVersion("greeter"); !ok || v != "1.1.0" {
+		t.Fatalf("激活版本应为 1.1.0, 得到 %q", v)
+	}
+	if m.findPluginVersion("greeter", "1.1.0") != path {
+		t.Fatal("应优先使用版本目录中的插件")
+	}
+
+	if err := m.RefreshRepositories(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if info, ok := m.pluginMarket.GetPlugin("greeter"); !ok || info.Version != "1.1.0" || len(info.Versions) != 2 {
+		t.Fatalf("插件市场应只包含适用于当前平台的版本: %+v", info)
+	}
+	if err := m.InstallPlugin("greeter", "^3"); !errors.Is(err, ErrIncompatibleVersion) {
+		t.Fatalf("没有满足约束的版本时应返回 ErrIncompatibleVersion, 得到 %v", err)
+	}
+}
+
+func TestRepositoryVerification(t *testing.T) {
+	repo := newTestRepository(t)
+	release := repo.add("greeter", PluginRelease{Version: "1.0.0"}, "v1.0.0")
+	repo.publish()
+
+	client, err := NewPluginRepository("file://"+repo.dir, WithRepositoryKey(repo.keyPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	index, err := client.Index(context.Background())
+	if err != nil {
+		t.Fatalf("读取本地仓库索引失败: %v", err)
+	}
+	resolved, err := index.Resolve("greeter", "")
+	if err != nil || resolved.Version != "1.0.0" {
+		t.Fatalf("解析版本失败: %v", err)
+	}
+
+	dst := filepath.Join(t.TempDir(), "greeter.so")
+	if err := client.Download(context.Background(), resolved, dst); err != nil {
+		t.Fatalf("下载插件失败: %v", err)
+	}
+	if _, err := os.Stat(dst + signatureExt); err != nil {
+		t.Fatal("下载时应保存插件签名")
+	}
+
+	// 制品被篡改
+	if err := os.WriteFile(filepath.Join(repo.dir, filepath.FromSlash(release.Path)), []byte("evil!!"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Download(context.Background(), resolved, filepath.Join(t.TempDir(), "greeter.so")); !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("校验和不匹配时应返回 ErrChecksumMismatch, 得到 %v", err)
+	}
+
+	// 签名无效
+	bad := *resolved
+	bad.Signature = base64.StdEncoding.EncodeToString([]byte("invalid"))
+	if err := os.WriteFile(filepath.Join(repo.dir, filepath.FromSlash(release.Path)), []byte("v1.0.0"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Download(context.Background(), &bad, filepath.Join(t.TempDir(), "greeter.so")); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("签名无效时应返回 ErrInvalidSignature, 得到 %v", err)
+	}
+
+	// 索引被篡改
+	if err := os.WriteFile(filepath.Join(repo.dir, RepositoryIndexFile), []byte(`{"plugins":[]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Index(context.Background()); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("索引签名无效时应返回 ErrInvalidSignature, 得到 %v", err)
+	}
+}
+
+func TestRepositoryIndexRejectsUnsafeNames(t *testing.T) {
+	cases := map[string]func(repo *testRepository){
+		"插件名称": func(repo *testRepository) {
+			repo.add("greeter", PluginRelease{Version: "1.0.0"}, "v1.0.0")
+			repo.index.Plugins[0].Name = "../../evil"
+		},
+		"依赖名称": func(repo *testRepository) {
+			repo.add("greeter", PluginRelease{Version: "1.0.0", Dependencies: map[string]string{"../evil": "^1"}}, "v1.0.0")
+		},
+	}
+	for name, setup := range cases {
+		t.Run(name, func(t *testing.T) {
+			repo := newTestRepository(t)
+			setup(repo)
+			repo.publish()
+
+			client, err := NewPluginRepository("file://" + repo.dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := client.Index(context.Background()); err == nil {
+				t.Fatal("索引包含不安全的名称时应返回错误")
+			}
+
+			m := newTestManager(t)
+			if err := m.AddRepository(client); err != nil {
+				t.Fatal(err)
+			}
+			if err := m.InstallPlugin("greeter", ""); err == nil {
+				t.Fatal("索引包含不安全的名称时安装应失败")
+			}
+			if _, err := os.Stat(filepath.Join(filepath.Dir(m.pluginDir), "evil")); !os.IsNotExist(err) {
+				t.Fatalf("不应在插件目录之外创建文件: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,522 @@
+package plugmgr
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// maxResolveSteps 依赖解析的最大尝试次数，避免回溯在病态的索引上耗时过长
+const maxResolveSteps = 10000
+
+// InstallAction 安装计划中的操作类型
+type InstallAction string
+
+const (
+	InstallActionInstall   InstallAction = "install"   // 安装新插件
+	InstallActionUpgrade   InstallAction = "upgrade"   // 升级已加载的插件
+	InstallActionDowngrade InstallAction = "downgrade" // 降级已加载的插件
+)
+
+// InstallStep 安装计划中的一个步骤
+type InstallStep struct {
+	Name        string            // 插件名称
+	Version     string            // 安装的版本
+	FromVersion string            // 当前加载的版本，安装新插件时为空
+	Action      InstallAction     // 操作类型
+	Release     *PluginRelease    // 仓库中的发布版本
+	Repository  *PluginRepository // 提供该版本的仓库
+}
+
+// String 返回步骤的描述
+func (s InstallStep) String() string {
+	switch s.Action {
+	case InstallActionUpgrade:
+		return fmt.Sprintf("升级 %s %s -> %s", s.Name, s.FromVersion, s.Version)
+	case InstallActionDowngrade:
+		return fmt.Sprintf("降级 %s %s -> %s", s.Name, s.FromVersion, s.Version)
+	default:
+		return fmt.Sprintf("安装 %s %s", s.Name, s.Version)
+	}
+}
+
+// InstallPlan 安装计划
+//
+//	由 PlanInstall 计算，包含安装插件及其传递依赖需要执行的全部步骤，依赖在前。
+//	已加载且满足所有约束的插件保持不变，不出现在计划中。
+type InstallPlan struct {
+	Name       string        // 请求安装的插件
+	Constraint string        // 请求的版本约束
+	Steps      []InstallStep // 按依赖顺序排列的步骤
+}
+
+// String 返回安装计划的描述，每行一个步骤
+func (p *InstallPlan) String() string {
+	if len(p.Steps) == 0 {
+		return fmt.Sprintf("%s 已满足约束 %q，无需安装", p.Name, p.Constraint)
+	}
+	lines := make([]string, len(p.Steps))
+	for i, step := range p.Steps {
+		lines[i] = step.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// resolveCandidate 依赖解析中插件的一个候选版本
+type resolveCandidate struct {
+	version      *Version
+	dependencies map[string]string
+	release      *PluginRelease // 已加载的版本为 nil
+	repo         *PluginRepository
+}
+
+// requirement 依赖解析中的一个版本约束
+type requirement struct {
+	name       string
+	constraint string
+	from       string // 声明约束的插件，安装请求为空
+}
+
+// source 返回约束的来源描述
+func (r requirement) source() string {
+	if r.from == "" {
+		return "安装请求"
+	}
+	return r.from
+}
+
+// repositoryIndex 仓库及其索引
+type repositoryIndex struct {
+	repo  *PluginRepository
+	index *RepositoryIndex
+}
+
+// installResolver 安装时的依赖解析器
+//
+//	按深度优先依次满足约束，请求的插件优先尝试最高的版本，依赖优先保留已加载的版本，
+//	约束冲突时回溯到上一个选择。满足所有约束后检查已加载插件对被替换插件的约束，
+//	不满足时将依赖方也加入解析。
+type installResolver struct {
+	indexes    []repositoryIndex
+	loaded     map[string]*resolveCandidate
+	candidates map[string][]*resolveCandidate
+	chosen     map[string]*resolveCandidate
+	reasons    map[string]requirement // 选择插件版本时满足的约束
+	steps      int
+	err        error // 最近一次失败的原因
+}
+
+func newInstallResolver(indexes []repositoryIndex, loaded map[string]*resolveCandidate) *installResolver {
+	return &installResolver{
+		indexes:    indexes,
+		loaded:     loaded,
+		candidates: make(map[string][]*resolveCandidate),
+		chosen:     make(map[string]*resolveCandidate),
+		reasons:    make(map[string]requirement),
+	}
+}
+
+// candidatesFor 返回插件的候选版本，从高到低排列
+//
+//	多个仓库提供同一版本时使用先添加的仓库，与已加载版本相同的发布版本被已加载的版本代替。
+func (r *installResolver) candidatesFor(name string, preferLoaded bool) []*resolveCandidate {
+	list, ok := r.candidates[name]
+	if !ok {
+		seen := make(map[string]bool)
+		if c := r.loaded[name]; c != nil {
+			list = append(list, c)
+			seen[c.version.String()] = true
+		}
+		for _, ri := range r.indexes {
+			plugin, ok := ri.index.Lookup(name)
+			if !ok {
+				continue
+			}
+			for i := range plugin.Releases {
+				release := &plugin.Releases[i]
+				v, err := ParseVersion(release.Version)
+				if err != nil || !release.Compatible() || seen[v.String()] {
+					continue
+				}
+				seen[v.String()] = true
+				list = append(list, &resolveCandidate{version: v, dependencies: release.Dependencies, release: release, repo: ri.repo})
+			}
+		}
+		sort.SliceStable(list, func(i, j int) bool { return list[i].version.Compare(list[j].version) > 0 })
+		r.candidates[name] = list
+	}
+
+	loaded := r.loaded[name]
+	if !preferLoaded || loaded == nil {
+		return list
+	}
+	ordered := make([]*resolveCandidate, 0, len(list))
+	ordered = append(ordered, loaded)
+	for _, c := range list {
+		if c != loaded {
+			ordered = append(ordered, c)
+		}
+	}
+	return ordered
+}
+
+// solve 为待处理的约束选择版本，找到一致的版本组合时返回 true
+func (r *installResolver) solve(pending []requirement) bool {
+	if len(pending) == 0 {
+		if req, ok := r.brokenDependent(); ok {
+			return r.solve([]requirement{req})
+		}
+		return true
+	}
+	if r.steps++; r.steps > maxResolveSteps {
+		r.err = wrapf(ErrIncompatibleVersion, "依赖解析超过 %d 步仍未找到一致的版本组合", maxResolveSteps)
+		return false
+	}
+
+	req, rest := pending[0], pending[1:]
+	c, err := ParseConstraint(req.constraint)
+	if err != nil {
+		r.err = wrapf(err, "%s 对 %s 的版本约束无效", req.source(), req.name)
+		return false
+	}
+	if chosen := r.chosen[req.name]; chosen != nil {
+		if c.Check(chosen.version) {
+			return r.solve(rest)
+		}
+		r.err = wrapf(ErrIncompatibleVersion, "%s 需要 %s %s，与 %s 选择的 %s 冲突",
+			req.source(), req.name, req.constraint, r.reasons[req.name].source(), chosen.version)
+		return false
+	}
+
+	candidates := r.candidatesFor(req.name, req.from != "")
+	if len(candidates) == 0 {
+		r.err = wrapf(ErrMissingDependency, "%s 需要的插件 %s 未加载且不在任何仓库中", req.source(), req.name)
+		return false
+	}
+	matched := false
+	for _, candidate := range candidates {
+		if !c.Check(candidate.version) {
+			continue
+		}
+		matched = true
+		r.chosen[req.name], r.reasons[req.name] = candidate, req
+		next := make([]requirement, len(rest), len(rest)+len(candidate.dependencies))
+		copy(next, rest)
+		for _, dep := range sortedKeys(candidate.dependencies) {
+			next = append(next, requirement{name: dep, constraint: candidate.dependencies[dep], from: req.name})
+		}
+		if r.solve(next) {
+			return true
+		}
+		delete(r.chosen, req.name)
+		delete(r.reasons, req.name)
+		if r.steps > maxResolveSteps {
+			return false
+		}
+	}
+	if !matched {
+		r.err = wrapf(ErrIncompatibleVersion, "%s 需要 %s %s，但没有满足约束且适用于 %s/%s 的版本",
+			req.source(), req.name, req.constraint, runtime.GOOS, runtime.GOARCH)
+	}
+	return false
+}
+
+// brokenDependent 查找依赖了被替换插件且约束不再满足的已加载插件
+//
+//	返回的约束要求为该插件重新选择版本。
+func (r *installResolver) brokenDependent() (requirement, bool) {
+	for _, name := range sortedKeys(r.loaded) {
+		if _, ok := r.chosen[name]; ok {
+			continue
+		}
+		deps := r.loaded[name].dependencies
+		for _, dep := range sortedKeys(deps) {
+			chosen := r.chosen[dep]
+			if chosen == nil {
+				continue
+			}
+			if c, err := ParseConstraint(deps[dep]); err == nil && c.Check(chosen.version) {
+				continue
+			}
+			return requirement{name: name, from: dep}, true
+		}
+	}
+	return requirement{}, false
+}
+
+// plan 根据选择的版本生成安装计划
+func (r *installResolver) plan(name, constraint string) (*InstallPlan, error) {
+	graph := newDependencyGraph()
+	for n, c := range r.chosen {
+		if c.release != nil {
+			graph.Add(n, c.dependencies)
+		}
+	}
+	waves, err := graph.Waves(func(dep string) bool {
+		_, ok := r.chosen[dep]
+		return ok
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &InstallPlan{Name: name, Constraint: constraint}
+	for _, wave := range waves {
+		for _, n := range wave {
+			c := r.chosen[n]
+			step := InstallStep{Name: n, Version: c.release.Version, Action: InstallActionInstall, Release: c.release, Repository: c.repo}
+			if loaded := r.loaded[n]; loaded != nil {
+				step.FromVersion = loaded.version.String()
+				step.Action = InstallActionUpgrade
+				if c.version.Compare(loaded.version) < 0 {
+					step.Action = InstallActionDowngrade
+				}
+			}
+			plan.Steps = append(plan.Steps, step)
+		}
+	}
+	return plan, nil
+}
+
+// loadedCandidates 返回已加载插件的当前版本及其依赖
+func (m *Manager) loadedCandidates() map[string]*resolveCandidate {
+	loaded := make(map[string]*resolveCandidate)
+	m.plugins.Range(func(key, value any) bool {
+		name := key.(string)
+		lazyPlug := value.(*lazyPlugin)
+		if lazyPlug.loaded == nil {
+			return true
+		}
+		v, err := ParseVersion(lazyPlug.loaded.Metadata().Version)
+		if err != nil {
+			m.logger.Warn("插件版本无效，依赖解析时忽略", "plugin", name, "error", err)
+			return true
+		}
+		deps, _ := m.dependencies.Get(name)
+		loaded[name] = &resolveCandidate{version: v, dependencies: deps}
+		return true
+	})
+	return loaded
+}
+
+// PlanInstall 计算安装插件的计划
+//
+//	参数:
+//	- ctx: 上下文，用于取消读取索引
+//	- name: 插件名称
+//	- constraint: 版本约束，为空时选择最高的版本
+//	返回:
+//	- *InstallPlan: 按依赖顺序排列的安装步骤
+//	- error: 读取索引失败或无法找到一致的版本组合时返回错误
+//	功能:
+//	- 从仓库索引读取每个版本声明的依赖约束，为整个传递闭包选择一组一致的版本
+//	- 请求的插件优先选择最高的版本，依赖优先保留已加载的版本，冲突时回溯
+//	- 替换已加载的插件时同时检查依赖它的已加载插件，必要时一并升级或降级
+//	- 只计算计划，不下载或加载插件
+func (m *Manager) PlanInstall(ctx context.Context, name, constraint string) (*InstallPlan, error) {
+	if _, err := ParseConstraint(constraint); err != nil {
+		return nil, err
+	}
+
+	var indexes []repositoryIndex
+	var lastErr error
+	for _, repo := range m.Repositories() {
+		index, err := repo.Index(ctx)
+		if err != nil {
+			lastErr = wrapf(err, "读取仓库 %s 的索引失败", repo.URL)
+			m.logger.Warn("读取仓库索引失败", "url", repo.URL, "error", err)
+			continue
+		}
+		indexes = append(indexes, repositoryIndex{repo: repo, index: index})
+	}
+	if len(indexes) == 0 {
+		if lastErr == nil {
+			lastErr = newError("没有可用的插件仓库")
+		}
+		return nil, lastErr
+	}
+
+	r := newInstallResolver(indexes, m.loadedCandidates())
+	if !r.solve([]requirement{{name: name, constraint: constraint}}) {
+		return nil, wrapf(r.err, "无法解析插件 %s 的依赖", name)
+	}
+	return r.plan(name, constraint)
+}
+
+// installSnapshot 执行安装步骤前插件的状态，用于回滚
+type installSnapshot struct {
+	name     string
+	prevPath string            // 之前加载的插件文件，安装新插件时为空
+	links    map[string]string // 激活链接 -> 之前的链接目标，不存在时为空
+	backups  map[string]string // 被替换的普通文件 -> 备份路径
+}
+
+// snapshotInstall 记录插件当前加载的文件和激活链接
+func (m *Manager) snapshotInstall(name string) *installSnapshot {
+	s := &installSnapshot{name: name, links: make(map[string]string), backups: make(map[string]string)}
+	if v, ok := m.plugins.Load(name); ok {
+		s.prevPath = v.(*lazyPlugin).path
+	}
+	for _, ext := range []string{".so", ProcessPluginExt} {
+		link := filepath.Join(m.pluginDir, name+ext)
+		for _, path := range []string{link, link + signatureExt} {
+			info, err := os.Lstat(path)
+			switch {
+			case err != nil:
+				s.links[path] = ""
+			case info.Mode()&os.ModeSymlink != 0:
+				s.links[path], _ = os.Readlink(path)
+			default:
+				backup := path + ".rollback"
+				os.Remove(backup)
+				if err := os.Link(path, backup); err != nil {
+					m.logger.Warn("备份插件文件失败，回滚时无法恢复", "path", path, "error", err)
+					continue
+				}
+				s.backups[path] = backup
+			}
+		}
+	}
+	return s
+}
+
+// restore 恢复激活链接和被替换的文件
+func (s *installSnapshot) restore(logger Logger) {
+	for path, target := range s.links {
+		os.Remove(path)
+		if target == "" {
+			continue
+		}
+		if err := os.Symlink(target, path); err != nil {
+			logger.Warn("恢复插件链接失败", "path", path, "error", err)
+		}
+	}
+	for path, backup := range s.backups {
+		if err := os.Rename(backup, path); err != nil {
+			logger.Warn("恢复插件文件失败", "path", path, "error", err)
+		}
+	}
+}
+
+// cleanup 删除备份文件
+func (s *installSnapshot) cleanup() {
+	for _, backup := range s.backups {
+		os.Remove(backup)
+	}
+}
+
+// applyInstallStep 下载并加载安装步骤的版本，返回插件文件路径
+//
+//	已加载的插件热重载时跳过版本检查，由 ApplyInstallPlan 在全部步骤完成后统一检查。
+func (m *Manager) applyInstallStep(ctx context.Context, step *InstallStep) (string, error) {
+	pluginPath, manifest, err := m.fetchRelease(ctx, step.Repository, step.Name, step.Release)
+	if err != nil {
+		return "", err
+	}
+
+	if _, loaded := m.plugins.Load(step.Name); loaded {
+		err = m.hotReload(step.Name, pluginPath, false)
+	} else if manifest != nil {
+		dir, _ := packageDir(pluginPath)
+		_, err = m.loadPackageDir(dir, manifest, false)
+	} else {
+		err = m.LoadPlugin(pluginPath)
+	}
+	if err != nil {
+		return "", err
+	}
+	return pluginPath, m.activatePluginFile(step.Name, pluginPath)
+}
+
+// revertInstallStep 将插件恢复到执行安装步骤前的状态
+func (m *Manager) revertInstallStep(s *installSnapshot) {
+	s.restore(m.logger)
+
+	v, ok := m.plugins.Load(s.name)
+	if !ok {
+		return
+	}
+	switch current := v.(*lazyPlugin).path; {
+	case s.prevPath == "":
+		if err := m.UnloadPlugin(s.name); err != nil {
+			m.logger.Error("回滚时卸载插件失败", "plugin", s.name, "error", err)
+		}
+	case current != s.prevPath:
+		if err := m.hotReload(s.name, s.prevPath, false); err != nil {
+			m.logger.Error("回滚时恢复插件失败", "plugin", s.name, "path", s.prevPath, "error", err)
+		}
+	}
+}
+
+// ApplyInstallPlan 执行安装计划
+//
+//	参数:
+//	- ctx: 上下文，用于取消下载
+//	- plan: PlanInstall 计算的安装计划
+//	返回:
+//	- error: 任一步骤失败时返回错误，此时已执行的步骤全部回滚
+//	功能:
+//	- 按依赖顺序下载并校验每个版本，安装新插件或热重载已加载的插件
+//	- 将 <pluginDir>/<name>.so 指向安装的版本
+//	- 全部步骤完成后检查所有插件的依赖约束
+//	- 失败时按相反顺序卸载新安装的插件，恢复被替换插件之前的版本和链接
+//	- 成功后更新版本信息并为每个插件触发安装事件
+func (m *Manager) ApplyInstallPlan(ctx context.Context, plan *InstallPlan) error {
+	if len(plan.Steps) == 0 {
+		return nil
+	}
+	m.logger.Info("执行安装计划", "plugin", plan.Name, "plan", plan.String())
+
+	snapshots := make([]*installSnapshot, 0, len(plan.Steps))
+	paths := make([]string, len(plan.Steps))
+	rollback := func(err error) error {
+		for i := len(snapshots) - 1; i >= 0; i-- {
+			m.revertInstallStep(snapshots[i])
+		}
+		m.logger.Warn("安装计划执行失败，已回滚", "plugin", plan.Name, "error", err)
+		return wrapf(err, "安装 %s 失败，已回滚", plan.Name)
+	}
+
+	for i := range plan.Steps {
+		step := &plan.Steps[i]
+		if err := ctx.Err(); err != nil {
+			return rollback(err)
+		}
+		snapshots = append(snapshots, m.snapshotInstall(step.Name))
+		path, err := m.applyInstallStep(ctx, step)
+		if err != nil {
+			return rollback(wrapf(err, "%s 失败", step))
+		}
+		paths[i] = path
+	}
+
+	// 替换过程中跳过了版本检查，全部完成后检查最终的依赖关系
+	for _, step := range plan.Steps {
+		deps, _ := m.dependencies.Get(step.Name)
+		if err := m.checkDependencies(step.Name, deps); err != nil {
+			return rollback(wrapf(err, "插件 %s 的依赖检查未通过", step.Name))
+		}
+		if err := m.checkDependents(step.Name, step.Version); err != nil {
+			return rollback(err)
+		}
+	}
+
+	for i, step := range plan.Steps {
+		snapshots[i].cleanup()
+		if err := m.versionManager.AddVersion(step.Name, step.Version); err == nil {
+			m.versionManager.SetActiveVersion(step.Name, step.Version)
+		}
+		m.eventBus.PublishAsync(Event{
+			EventName: PluginInstalled,
+			Data: EventData{
+				Name: step.Name,
+				Data: PluginInstalledPayload{Version: step.Version, Path: paths[i]},
+			},
+		})
+	}
+	return nil
+}
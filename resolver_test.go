@@ -0,0 +1,190 @@
+package plugmgr
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newResolverTestManager 创建使用测试仓库的管理器
+func newResolverTestManager(t *testing.T, repo *testRepository) *Manager {
+	t.Helper()
+	repo.publish()
+	server := httptest.NewServer(http.FileServer(http.Dir(repo.dir)))
+	t.Cleanup(server.Close)
+
+	m := newTestManager(t)
+	m.publicKeyPath = repo.keyPath
+	client, err := NewPluginRepository(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AddRepository(client); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+// preloadRelease 为仓库中的版本预加载内存插件
+func preloadRelease(m *Manager, name, version string, deps map[string]string) *fakePlugin {
+	p := &fakePlugin{metadata: PluginMetadata{Name: name, Version: version, Dependencies: deps}}
+	m.preloadedPlugins.Store(name, &lazyPlugin{path: m.versionedPluginPath(name, version, ".so"), loaded: p})
+	return p
+}
+
+// addLoadedPlugin 注册一个已加载的插件及其依赖
+func addLoadedPlugin(m *Manager, name, version string, deps map[string]string) {
+	addTestPlugin(m, name, &fakePlugin{metadata: PluginMetadata{Name: name, Version: version, Dependencies: deps}})
+	m.dependencies.Set(name, deps)
+}
+
+func planSteps(plan *InstallPlan) []string {
+	steps := make([]string, len(plan.Steps))
+	for i, step := range plan.Steps {
+		steps[i] = step.String()
+	}
+	return steps
+}
+
+func TestInstallResolvesTransitiveDependencies(t *testing.T) {
+	repo := newTestRepository(t)
+	repo.add("app", PluginRelease{Version: "1.0.0", Dependencies: map[string]string{"storage": "^1"}}, "app 1")
+	repo.add("app", PluginRelease{Version: "2.0.0", Dependencies: map[string]string{"storage": "^2", "cache": "^1"}}, "app 2")
+	repo.add("app", PluginRelease{Version: "3.0.0", Dependencies: map[string]string{"storage": "^3"}}, "app 3")
+	repo.add("storage", PluginRelease{Version: "1.0.0"}, "storage 1")
+	repo.add("storage", PluginRelease{Version: "2.0.0", Dependencies: map[string]string{"codec": "~1.2"}}, "storage 2")
+	repo.add("cache", PluginRelease{Version: "1.0.0", Dependencies: map[string]string{"codec": ">=1.0"}}, "cache 1.0")
+	repo.add("cache", PluginRelease{Version: "1.1.0", Dependencies: map[string]string{"codec": "^1.3"}}, "cache 1.1")
+	repo.add("codec", PluginRelease{Version: "1.2.0"}, "codec 1.2")
+	repo.add("codec", PluginRelease{Version: "1.3.0"}, "codec 1.3")
+	m := newResolverTestManager(t, repo)
+	ctx := context.Background()
+
+	// app 3.0.0 需要不存在的 storage ^3，cache 1.1.0 与 storage 2.0.0 对 codec 的约束冲突
+	plan, err := m.PlanInstall(ctx, "app", "")
+	if err != nil {
+		t.Fatalf("计算安装计划失败: %v", err)
+	}
+	want := []string{"安装 codec 1.2.0", "安装 cache 1.0.0", "安装 storage 2.0.0", "安装 app 2.0.0"}
+	if got := planSteps(plan); len(got) != len(want) || got[0] != want[0] || got[1] != want[1] || got[2] != want[2] || got[3] != want[3] {
+		t.Fatalf("安装计划应为 %v, 得到 %v", want, got)
+	}
+
+	preloadRelease(m, "codec", "1.2.0", nil)
+	preloadRelease(m, "cache", "1.0.0", map[string]string{"codec": ">=1.0"})
+	preloadRelease(m, "storage", "2.0.0", map[string]string{"codec": "~1.2"})
+	preloadRelease(m, "app", "2.0.0", map[string]string{"storage": "^2", "cache": "^1"})
+	events := typedEvents[PluginInstalledPayload](m, PluginInstalled)
+	if err := m.ApplyInstallPlan(ctx, plan); err != nil {
+		t.Fatalf("执行安装计划失败: %v", err)
+	}
+	for _, step := range plan.Steps {
+		if v, _ := m.versionManager.GetActiveVersion(step.Name); v != step.Version {
+			t.Fatalf("%s 的激活版本应为 %s, 得到 %q", step.Name, step.Version, v)
+		}
+		target, err := filepath.EvalSymlinks(filepath.Join(m.pluginDir, step.Name+".so"))
+		if err != nil || target != m.versionedPluginPath(step.Name, step.Version, ".so") {
+			t.Fatalf("%s.so 应指向安装的版本, 得到 %q %v", step.Name, target, err)
+		}
+	}
+	installed := make(map[string]bool)
+	for range plan.Steps {
+		installed[receive(t, events).Path] = true
+	}
+	for _, step := range plan.Steps {
+		if !installed[m.versionedPluginPath(step.Name, step.Version, ".so")] {
+			t.Fatalf("应为 %s 触发安装事件", step.Name)
+		}
+	}
+
+	// 已满足约束时不需要任何步骤
+	if plan, err := m.PlanInstall(ctx, "app", "^2"); err != nil || len(plan.Steps) != 0 {
+		t.Fatalf("已安装的插件不应产生安装步骤: %v %v", plan, err)
+	}
+	if _, err := m.PlanInstall(ctx, "app", "^4"); !errors.Is(err, ErrIncompatibleVersion) {
+		t.Fatalf("没有满足约束的版本时应返回 ErrIncompatibleVersion, 得到 %v", err)
+	}
+}
+
+func TestPlanInstallUpdatesLoadedDependents(t *testing.T) {
+	repo := newTestRepository(t)
+	repo.add("app", PluginRelease{Version: "1.0.0", Dependencies: map[string]string{"storage": "^2"}}, "app")
+	repo.add("storage", PluginRelease{Version: "1.0.0"}, "storage 1")
+	repo.add("storage", PluginRelease{Version: "2.0.0"}, "storage 2")
+	repo.add("reporter", PluginRelease{Version: "1.5.0", Dependencies: map[string]string{"storage": "^1"}}, "reporter 1.5")
+	repo.add("reporter", PluginRelease{Version: "2.0.0", Dependencies: map[string]string{"storage": "^2"}}, "reporter 2")
+	m := newResolverTestManager(t, repo)
+	addLoadedPlugin(m, "storage", "1.0.0", nil)
+	addLoadedPlugin(m, "reporter", "1.0.0", map[string]string{"storage": "^1"})
+
+	// 升级 storage 后 reporter 的约束不再满足，需要一并升级
+	plan, err := m.PlanInstall(context.Background(), "app", "")
+	if err != nil {
+		t.Fatalf("计算安装计划失败: %v", err)
+	}
+	want := []string{"升级 storage 1.0.0 -> 2.0.0", "安装 app 1.0.0", "升级 reporter 1.0.0 -> 2.0.0"}
+	if got := planSteps(plan); len(got) != len(want) || got[0] != want[0] || got[1] != want[1] || got[2] != want[2] {
+		t.Fatalf("安装计划应为 %v, 得到 %v", want, got)
+	}
+
+	// 依赖已加载版本的插件优先保留已加载的版本
+	plan, err = m.PlanInstall(context.Background(), "reporter", "~1.5")
+	if err != nil || len(plan.Steps) != 1 || plan.Steps[0].String() != "升级 reporter 1.0.0 -> 1.5.0" {
+		t.Fatalf("应只升级 reporter, 得到 %v %v", plan, err)
+	}
+	if _, err := m.PlanInstall(context.Background(), "missing", ""); !errors.Is(err, ErrMissingDependency) {
+		t.Fatalf("仓库中没有插件时应返回 ErrMissingDependency, 得到 %v", err)
+	}
+}
+
+func TestApplyInstallPlanRollsBack(t *testing.T) {
+	repo := newTestRepository(t)
+	repo.add("app", PluginRelease{Version: "1.0.0", Dependencies: map[string]string{"storage": "^1"}}, "app")
+	repo.add("storage", PluginRelease{Version: "1.0.0"}, "storage")
+	repo.add("codec", PluginRelease{Version: "2.0.0"}, "codec 2")
+	repo.add("viewer", PluginRelease{Version: "1.0.0", Dependencies: map[string]string{"codec": "^2", "storage": "^1"}}, "viewer")
+	m := newResolverTestManager(t, repo)
+
+	// app 的元数据声明了索引中没有的依赖，加载失败后卸载已安装的 storage
+	preloadRelease(m, "storage", "1.0.0", nil)
+	preloadRelease(m, "app", "1.0.0", map[string]string{"missing": "^1"})
+	err := m.InstallPlugin("app", "")
+	if !errors.Is(err, ErrMissingDependency) {
+		t.Fatalf("加载失败时应返回原始错误, 得到 %v", err)
+	}
+	for _, name := range []string{"app", "storage"} {
+		if _, ok := m.plugins.Load(name); ok {
+			t.Fatalf("回滚后 %s 不应保持加载", name)
+		}
+		if _, err := os.Lstat(filepath.Join(m.pluginDir, name+".so")); !os.IsNotExist(err) {
+			t.Fatalf("回滚后应删除 %s.so 的链接: %v", name, err)
+		}
+		if _, ok := m.versionManager.GetActiveVersion(name); ok {
+			t.Fatalf("回滚后不应记录 %s 的版本", name)
+		}
+	}
+
+	// 替换已加载的插件失败时恢复之前的版本和链接
+	addLoadedPlugin(m, "codec", "1.0.0", nil)
+	addLoadedPlugin(m, "storage", "1.0.0", nil)
+	link := filepath.Join(m.pluginDir, "codec.so")
+	if err := os.Symlink("codec-1.0.0.so", link); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.InstallPlugin("viewer", ""); err == nil {
+		t.Fatal("新版本无法打开时安装应失败")
+	}
+	if v, ok := m.plugins.Load("codec"); !ok || v.(*lazyPlugin).loaded.Metadata().Version != "1.0.0" {
+		t.Fatal("回滚后应保留 codec 1.0.0")
+	}
+	if target, err := os.Readlink(link); err != nil || target != "codec-1.0.0.so" {
+		t.Fatalf("回滚后应恢复 codec.so 的链接, 得到 %q %v", target, err)
+	}
+	if _, ok := m.plugins.Load("viewer"); ok {
+		t.Fatal("回滚后 viewer 不应被加载")
+	}
+}
@@ -0,0 +1,162 @@
+package plugmgr
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// 进程插件协议的方法名称，与 Plugin 接口的生命周期一一对应
+const (
+	RPCMethodMetadata      = "Metadata"
+	RPCMethodPreLoad       = "PreLoad"
+	RPCMethodInit          = "Init"
+	RPCMethodPostLoad      = "PostLoad"
+	RPCMethodExecute       = "Execute"
+	RPCMethodConfigUpdated = "ConfigUpdated"
+	RPCMethodPreUnload     = "PreUnload"
+	RPCMethodShutdown      = "Shutdown"
+
+	// RPCMethodCancel 取消通知，ID 为需要取消的请求 ID，插件无需回复
+	RPCMethodCancel = "$cancel"
+)
+
+const (
+	// RPCCodecEnv 宿主通过该环境变量告知子进程使用的编码格式
+	RPCCodecEnv = "PLUGMGR_RPC_CODEC"
+
+	// maxRPCFrameSize 单个消息帧的最大长度
+	maxRPCFrameSize = 64 << 20
+)
+
+// RPCRequest 进程插件协议的请求消息
+//
+//	字段说明:
+//	- ID: 请求 ID，响应中原样返回
+//	- Method: 调用的方法名称
+//	- Config: PreLoad 和 ConfigUpdated 的配置数据
+//	- Data: Execute 的输入数据
+type RPCRequest struct {
+	ID     uint64 `json:"id" msgpack:"id"`
+	Method string `json:"method" msgpack:"method"`
+	Config []byte `json:"config,omitempty" msgpack:"config,omitempty"`
+	Data   any    `json:"data,omitempty" msgpack:"data,omitempty"`
+}
+
+// RPCResponse 进程插件协议的响应消息
+//
+//	字段说明:
+//	- ID: 对应的请求 ID
+//	- Metadata: Metadata 方法返回的插件元数据
+//	- Config: ConfigUpdated 方法返回的配置数据
+//	- Result: Execute 方法返回的结果
+//	- Error: 错误信息，为空表示调用成功
+type RPCResponse struct {
+	ID       uint64          `json:"id" msgpack:"id"`
+	Metadata *PluginMetadata `json:"metadata,omitempty" msgpack:"metadata,omitempty"`
+	Config   []byte          `json:"config,omitempty" msgpack:"config,omitempty"`
+	Result   any             `json:"result,omitempty" msgpack:"result,omitempty"`
+	Error    string          `json:"error,omitempty" msgpack:"error,omitempty"`
+}
+
+// RPCCodec 进程插件协议的消息编码接口
+type RPCCodec interface {
+	// Name 返回编码名称，通过 RPCCodecEnv 传递给子进程
+	Name() string
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+// NewRPCCodec 根据名称创建消息编码器
+//
+//	参数:
+//	- name: 编码名称，支持 "msgpack" 和 "json"，为空时使用 msgpack
+//	返回:
+//	- RPCCodec: 编码器实例
+//	- error: 不支持的编码名称
+func NewRPCCodec(name string) (RPCCodec, error) {
+	switch name {
+	case "", "msgpack":
+		return msgpackCodec{}, nil
+	case "json":
+		return jsonCodec{}, nil
+	default:
+		return nil, newErrorf("不支持的 RPC 编码: %s", name)
+	}
+}
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) Name() string { return "msgpack" }
+
+func (msgpackCodec) Marshal(v any) ([]byte, error) {
+	return msgpack.Marshal(v)
+}
+
+func (msgpackCodec) Unmarshal(data []byte, v any) error {
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	dec.UseLooseInterfaceDecoding(true)
+	return dec.Decode(v)
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string { return "json" }
+
+func (jsonCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+// WriteRPCFrame 写入一个消息帧
+//
+//	帧格式为 4 字节大端序长度前缀加编码后的消息体。
+func WriteRPCFrame(w io.Writer, codec RPCCodec, v any) error {
+	payload, err := codec.Marshal(v)
+	if err != nil {
+		return wrap(err, "编码 RPC 消息失败")
+	}
+	if len(payload) > maxRPCFrameSize {
+		return newErrorf("RPC 消息过大: %d 字节", len(payload))
+	}
+
+	frame := make([]byte, 4+len(payload))
+	binary.BigEndian.PutUint32(frame, uint32(len(payload)))
+	copy(frame[4:], payload)
+
+	if _, err := w.Write(frame); err != nil {
+		return wrap(err, "写入 RPC 消息失败")
+	}
+	return nil
+}
+
+// ReadRPCFrame 读取一个消息帧并解码到 v
+//
+//	对端关闭连接时返回 io.EOF。
+func ReadRPCFrame(r io.Reader, codec RPCCodec, v any) error {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return err
+	}
+
+	size := binary.BigEndian.Uint32(header[:])
+	if size > maxRPCFrameSize {
+		return newErrorf("RPC 消息过大: %d 字节", size)
+	}
+
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return wrap(err, "读取 RPC 消息失败")
+	}
+
+	if err := codec.Unmarshal(payload, v); err != nil {
+		return wrap(err, "解码 RPC 消息失败")
+	}
+	return nil
+}
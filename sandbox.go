@@ -1,8 +1,11 @@
 package plugmgr
 
 import (
+	"os"
+	"os/exec"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
 type Sandbox interface {
@@ -12,8 +15,20 @@ type Sandbox interface {
 }
 
 type ISandbox struct {
-	chrootDir   string
-	originalDir string
+	chrootDir     string
+	originalDir   string
+	originalUmask int
+}
+
+// NewChrootSandbox 创建在每次执行时对整个宿主进程 chroot 的沙箱
+//
+//	参数:
+//	- chrootDir: 切换到的根目录，为空时使用 ./sandbox
+//	功能:
+//	- 执行期间切换整个宿主进程的根目录，需要 root 权限，执行无法并发进行
+//	- 不再是默认沙箱，需要时通过 Manager.SetSandbox 显式启用
+func NewChrootSandbox(chrootDir string) *ISandbox {
+	return newSandbox(chrootDir)
 }
 
 func newSandbox(chrootDir string) *ISandbox {
@@ -25,6 +40,15 @@ func newSandbox(chrootDir string) *ISandbox {
 	}
 }
 
+// nopSandbox 默认沙箱，不改变宿主进程的状态
+//
+//	进程插件的隔离通过 SetPluginSandbox 设置的 ProcessSandbox 实现。
+type nopSandbox struct{}
+
+func (nopSandbox) Enable() error                 { return nil }
+func (nopSandbox) Disable() error                { return nil }
+func (nopSandbox) VerifyPluginPath(string) error { return nil }
+
 // VerifyPluginPath 验证插件路径是否在沙箱目录内
 //
 //	参数:
@@ -50,3 +74,88 @@ func (s *ISandbox) VerifyPluginPath(path string) error {
 
 	return nil
 }
+
+// ProcessSandbox 进程插件沙箱
+//
+//	与 Sandbox 在每次执行时切换宿主进程状态不同，ProcessSandbox 在启动进程插件时
+//	为子进程配置隔离环境，隔离只作用于该插件进程，不同插件的执行可以并发进行。
+//	Enable 和 Disable 对宿主进程没有影响。
+type ProcessSandbox interface {
+	Sandbox
+
+	// Command 创建在沙箱中运行插件可执行文件的命令
+	//
+	//	返回的清理函数在子进程退出后调用。
+	Command(path string) (*exec.Cmd, func(), error)
+}
+
+// ResourceLimits 通过 setrlimit 为插件进程设置的资源限制
+//
+//	字段说明:
+//	- CPUTime: CPU 时间上限(RLIMIT_CPU)，按秒向上取整，超出后进程被内核结束
+//	- Memory: 虚拟内存字节数上限(RLIMIT_AS)
+//	- OpenFiles: 打开文件数上限(RLIMIT_NOFILE)
+//
+//	零值表示不限制。
+type ResourceLimits struct {
+	CPUTime   time.Duration `json:"cpu_time,omitempty"`
+	Memory    uint64        `json:"memory,omitempty"`
+	OpenFiles uint64        `json:"open_files,omitempty"`
+}
+
+// NamespaceSandboxConfig 命名空间沙箱配置
+//
+//	字段说明:
+//	- ReadOnlyPaths: 以只读方式出现在插件文件系统视图中的宿主路径
+//	- WritablePaths: 以读写方式出现在插件文件系统视图中的宿主路径
+//	- Network: 为 true 时共享宿主网络，否则插件在只有回环接口的独立网络命名空间中运行
+//	- Limits: 插件进程的资源限制
+//	- TempDir: 创建私有根目录的位置，为空时使用 os.TempDir()
+//
+//	插件可执行文件本身、/dev 下的基本设备、独立的 /proc 和 /tmp 总是可用，
+//	其余路径(包括动态链接库所在目录)都需要显式声明，可以使用 SystemLibraryPaths。
+type NamespaceSandboxConfig struct {
+	ReadOnlyPaths []string
+	WritablePaths []string
+	Network       bool
+	Limits        ResourceLimits
+	TempDir       string
+}
+
+// SystemLibraryPaths 动态链接的插件通常需要的系统库目录
+var SystemLibraryPaths = []string{"/lib", "/lib64", "/usr/lib", "/usr/lib64"}
+
+// NamespaceSandbox 基于 Linux 命名空间的进程插件沙箱
+//
+//	功能:
+//	- 插件进程运行在独立的 mount、PID、IPC、UTS 和网络命名空间中
+//	- 根据允许列表构建私有的只读文件系统视图
+//	- 通过 setrlimit 限制 CPU 时间、内存和打开文件数
+//	- 非 root 用户运行时额外使用用户命名空间
+//
+//	通过 Manager.SetPluginSandbox 为单个插件启用，只对进程插件生效。
+type NamespaceSandbox struct {
+	config NamespaceSandboxConfig
+}
+
+// Enable 命名空间沙箱在插件进程启动时生效，无需切换宿主进程状态
+func (s *NamespaceSandbox) Enable() error {
+	return nil
+}
+
+// Disable 命名空间沙箱随插件进程退出而销毁，无需恢复宿主进程状态
+func (s *NamespaceSandbox) Disable() error {
+	return nil
+}
+
+// VerifyPluginPath 验证插件路径是否为可执行的普通文件
+func (s *NamespaceSandbox) VerifyPluginPath(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return wrapf(err, "获取插件文件信息失败: %s", path)
+	}
+	if !info.Mode().IsRegular() || info.Mode().Perm()&0o111 == 0 {
+		return wrapf(ErrPluginSandboxViolation, "插件 %s 不是可执行文件", path)
+	}
+	return nil
+}
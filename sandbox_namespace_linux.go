@@ -0,0 +1,321 @@
+//go:build linux
+// +build linux
+
+package plugmgr
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"sync/atomic"
+	"syscall"
+)
+
+// sandboxSpecEnv 沙箱初始化进程通过该环境变量接收沙箱配置
+const sandboxSpecEnv = "PLUGMGR_SANDBOX_SPEC"
+
+// sandboxSpec 传递给沙箱初始化进程的配置
+type sandboxSpec struct {
+	Root   string         `json:"root"`
+	Path   string         `json:"path"`
+	Mounts []sandboxMount `json:"mounts"`
+	Limits ResourceLimits `json:"limits"`
+}
+
+// sandboxMount 私有文件系统视图中的一个绑定挂载
+type sandboxMount struct {
+	Source   string `json:"source"`
+	Writable bool   `json:"writable,omitempty"`
+}
+
+// sandboxMainEnabled 程序是否调用了 SandboxMain
+var sandboxMainEnabled atomic.Bool
+
+// SandboxMain 作为命名空间沙箱的初始化进程运行
+//
+//	使用 NamespaceSandbox 的程序必须在 main 函数开头调用。NamespaceSandbox 通过重新执行
+//	当前程序启动插件，设置了沙箱配置的进程在新的命名空间中构建文件系统视图、设置资源限制，
+//	然后替换为插件进程，不会返回；普通启动时立即返回。
+func SandboxMain() {
+	sandboxMainEnabled.Store(true)
+
+	spec, ok := os.LookupEnv(sandboxSpecEnv)
+	if !ok {
+		return
+	}
+	_ = os.Unsetenv(sandboxSpecEnv)
+
+	if err := runSandboxInit(spec); err != nil {
+		fmt.Fprintln(os.Stderr, "沙箱初始化失败:", err)
+		os.Exit(1)
+	}
+}
+
+// NewNamespaceSandbox 创建命名空间沙箱
+//
+//	参数:
+//	- config: 沙箱配置
+//	返回:
+//	- *NamespaceSandbox: 沙箱实例
+//	- error: 允许列表中的路径无效时返回
+func NewNamespaceSandbox(config NamespaceSandboxConfig) (*NamespaceSandbox, error) {
+	for _, paths := range [][]string{config.ReadOnlyPaths, config.WritablePaths} {
+		for _, path := range paths {
+			if !filepath.IsAbs(path) {
+				return nil, newErrorf("沙箱允许列表中的路径必须是绝对路径: %s", path)
+			}
+		}
+	}
+	return &NamespaceSandbox{config: config}, nil
+}
+
+// Command 创建在独立命名空间中运行插件的命令
+//
+//	命令实际启动的是当前可执行文件，由 SandboxMain 构建文件系统视图并设置资源限制后再执行插件，
+//	程序没有调用 SandboxMain 时返回错误。
+func (s *NamespaceSandbox) Command(path string) (*exec.Cmd, func(), error) {
+	if !sandboxMainEnabled.Load() {
+		return nil, nil, newError("使用命名空间沙箱需要在 main 函数开头调用 plugmgr.SandboxMain")
+	}
+
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, nil, wrap(err, "获取插件绝对路径失败")
+	}
+	if err := s.VerifyPluginPath(absPath); err != nil {
+		return nil, nil, err
+	}
+
+	self, err := os.Executable()
+	if err != nil {
+		return nil, nil, wrap(err, "获取当前可执行文件路径失败")
+	}
+
+	root, err := os.MkdirTemp(s.config.TempDir, "plugmgr-sandbox-")
+	if err != nil {
+		return nil, nil, wrap(err, "创建沙箱根目录失败")
+	}
+	cleanup := func() { _ = os.RemoveAll(root) }
+
+	spec := sandboxSpec{Root: root, Path: absPath, Limits: s.config.Limits}
+	for _, p := range s.config.ReadOnlyPaths {
+		spec.Mounts = append(spec.Mounts, sandboxMount{Source: p})
+	}
+	for _, p := range s.config.WritablePaths {
+		spec.Mounts = append(spec.Mounts, sandboxMount{Source: p, Writable: true})
+	}
+	spec.Mounts = append(spec.Mounts, sandboxMount{Source: absPath})
+
+	data, err := json.Marshal(spec)
+	if err != nil {
+		cleanup()
+		return nil, nil, wrap(err, "编码沙箱配置失败")
+	}
+
+	cmd := exec.Command(self)
+	cmd.Env = append(os.Environ(), sandboxSpecEnv+"="+string(data))
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags: syscall.CLONE_NEWNS | syscall.CLONE_NEWPID | syscall.CLONE_NEWIPC | syscall.CLONE_NEWUTS,
+	}
+	if !s.config.Network {
+		cmd.SysProcAttr.Cloneflags |= syscall.CLONE_NEWNET
+	}
+	if uid, gid := os.Geteuid(), os.Getegid(); uid != 0 {
+		// 非 root 用户需要在用户命名空间中才能创建其他命名空间
+		cmd.SysProcAttr.Cloneflags |= syscall.CLONE_NEWUSER
+		cmd.SysProcAttr.UidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: uid, Size: 1}}
+		cmd.SysProcAttr.GidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: gid, Size: 1}}
+		cmd.SysProcAttr.GidMappingsEnableSetgroups = false
+	}
+
+	return cmd, cleanup, nil
+}
+
+// runSandboxInit 在沙箱初始化进程中构建隔离环境并执行插件
+func runSandboxInit(data string) error {
+	var spec sandboxSpec
+	if err := json.Unmarshal([]byte(data), &spec); err != nil {
+		return wrap(err, "解析沙箱配置失败")
+	}
+
+	// 阻止挂载事件传播回宿主
+	if err := syscall.Mount("", "/", "", syscall.MS_REC|syscall.MS_PRIVATE, ""); err != nil {
+		return wrap(err, "设置挂载传播失败")
+	}
+	if err := syscall.Mount("tmpfs", spec.Root, "tmpfs", syscall.MS_NOSUID|syscall.MS_NODEV, "mode=0755"); err != nil {
+		return wrap(err, "挂载沙箱根目录失败")
+	}
+
+	// 先挂载 /tmp 等系统目录，避免遮盖允许列表中位于其下的路径
+	if err := mountSandboxSystem(spec.Root); err != nil {
+		return err
+	}
+	if err := mountSandboxPaths(spec.Root, spec.Mounts); err != nil {
+		return err
+	}
+	if err := pivotSandboxRoot(spec.Root); err != nil {
+		return err
+	}
+	if err := setSandboxLimits(spec.Limits); err != nil {
+		return err
+	}
+
+	return syscall.Exec(spec.Path, []string{spec.Path}, os.Environ())
+}
+
+// mountSandboxPaths 将允许列表中的路径绑定挂载到私有根目录
+//
+//	先完成所有绑定挂载再重新挂载为只读，避免父目录只读后无法创建子挂载点。
+func mountSandboxPaths(root string, mounts []sandboxMount) error {
+	sort.SliceStable(mounts, func(i, j int) bool {
+		return len(mounts[i].Source) < len(mounts[j].Source)
+	})
+
+	var bound []sandboxMount
+	for _, m := range mounts {
+		info, err := os.Stat(m.Source)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return wrapf(err, "获取沙箱路径信息失败: %s", m.Source)
+		}
+
+		target := filepath.Join(root, m.Source)
+		if err := createMountPoint(target, info.IsDir()); err != nil {
+			return wrapf(err, "创建挂载点失败: %s", target)
+		}
+		if err := syscall.Mount(m.Source, target, "", syscall.MS_BIND|syscall.MS_REC, ""); err != nil {
+			return wrapf(err, "绑定挂载失败: %s", m.Source)
+		}
+		bound = append(bound, m)
+	}
+
+	for _, m := range bound {
+		if m.Writable {
+			continue
+		}
+		if err := remountReadOnly(m.Source, filepath.Join(root, m.Source)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// remountReadOnly 将绑定挂载重新挂载为只读
+//
+//	在用户命名空间中必须保留源挂载点被锁定的标志，否则内核会拒绝重新挂载。
+func remountReadOnly(source, target string) error {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(source, &st); err != nil {
+		return wrapf(err, "获取挂载信息失败: %s", source)
+	}
+
+	const locked = syscall.MS_NOSUID | syscall.MS_NODEV | syscall.MS_NOEXEC |
+		syscall.MS_NOATIME | syscall.MS_NODIRATIME | syscall.MS_RELATIME
+	flags := uintptr(syscall.MS_REMOUNT|syscall.MS_BIND|syscall.MS_RDONLY) | uintptr(st.Flags)&locked
+	if err := syscall.Mount("", target, "", flags, ""); err != nil {
+		return wrapf(err, "重新挂载为只读失败: %s", source)
+	}
+	return nil
+}
+
+// mountSandboxSystem 挂载 /dev 下的基本设备、/tmp 和新 PID 命名空间的 /proc
+func mountSandboxSystem(root string) error {
+	for _, dev := range []string{"/dev/null", "/dev/zero", "/dev/random", "/dev/urandom"} {
+		target := filepath.Join(root, dev)
+		if err := createMountPoint(target, false); err != nil {
+			return wrapf(err, "创建挂载点失败: %s", target)
+		}
+		if err := syscall.Mount(dev, target, "", syscall.MS_BIND, ""); err != nil {
+			return wrapf(err, "挂载设备失败: %s", dev)
+		}
+	}
+
+	tmp := filepath.Join(root, "tmp")
+	if err := createMountPoint(tmp, true); err != nil {
+		return wrapf(err, "创建挂载点失败: %s", tmp)
+	}
+	if err := syscall.Mount("tmpfs", tmp, "tmpfs", syscall.MS_NOSUID|syscall.MS_NODEV, "mode=1777"); err != nil {
+		return wrap(err, "挂载 /tmp 失败")
+	}
+
+	proc := filepath.Join(root, "proc")
+	if err := createMountPoint(proc, true); err != nil {
+		return wrapf(err, "创建挂载点失败: %s", proc)
+	}
+	if err := syscall.Mount("proc", proc, "proc", syscall.MS_NOSUID|syscall.MS_NODEV|syscall.MS_NOEXEC, ""); err != nil {
+		// 宿主的 /proc 存在被遮盖的路径时，用户命名空间中无法挂载新的 proc
+		fmt.Fprintln(os.Stderr, "沙箱中挂载 /proc 失败，插件将没有 /proc:", err)
+	}
+	return nil
+}
+
+// pivotSandboxRoot 切换到私有根目录并卸载宿主文件系统
+func pivotSandboxRoot(root string) error {
+	oldRoot := filepath.Join(root, ".oldroot")
+	if err := os.Mkdir(oldRoot, 0o700); err != nil {
+		return wrap(err, "创建旧根目录挂载点失败")
+	}
+	if err := syscall.PivotRoot(root, oldRoot); err != nil {
+		return wrap(err, "切换根目录失败")
+	}
+	if err := os.Chdir("/"); err != nil {
+		return wrap(err, "切换到新的根目录失败")
+	}
+	if err := syscall.Unmount("/.oldroot", syscall.MNT_DETACH); err != nil {
+		return wrap(err, "卸载宿主文件系统失败")
+	}
+	if err := os.Remove("/.oldroot"); err != nil {
+		return wrap(err, "删除旧根目录挂载点失败")
+	}
+
+	// 根目录本身只读，插件只能写入 /tmp 和声明为可写的路径
+	if err := syscall.Mount("", "/", "", syscall.MS_REMOUNT|syscall.MS_BIND|syscall.MS_RDONLY|syscall.MS_NOSUID|syscall.MS_NODEV, ""); err != nil {
+		return wrap(err, "重新挂载根目录为只读失败")
+	}
+	return nil
+}
+
+// setSandboxLimits 设置资源限制，执行插件后继续生效
+func setSandboxLimits(limits ResourceLimits) error {
+	if limits.CPUTime > 0 {
+		seconds := uint64((limits.CPUTime + 999999999) / 1000000000)
+		if err := setrlimit(syscall.RLIMIT_CPU, seconds); err != nil {
+			return wrap(err, "设置 CPU 时间限制失败")
+		}
+	}
+	if limits.Memory > 0 {
+		if err := setrlimit(syscall.RLIMIT_AS, limits.Memory); err != nil {
+			return wrap(err, "设置内存限制失败")
+		}
+	}
+	if limits.OpenFiles > 0 {
+		if err := setrlimit(syscall.RLIMIT_NOFILE, limits.OpenFiles); err != nil {
+			return wrap(err, "设置打开文件数限制失败")
+		}
+	}
+	return nil
+}
+
+func setrlimit(resource int, value uint64) error {
+	return syscall.Setrlimit(resource, &syscall.Rlimit{Cur: value, Max: value})
+}
+
+// createMountPoint 在私有根目录中创建目录或空文件作为挂载点
+func createMountPoint(path string, dir bool) error {
+	if dir {
+		return os.MkdirAll(path, 0o755)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,153 @@
+//go:build linux
+// +build linux
+
+package plugmgr
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestSandboxManager 创建为指定插件启用命名空间沙箱的管理器
+//
+//	当前环境不允许创建命名空间时跳过测试。
+func newTestSandboxManager(t *testing.T, config NamespaceSandboxConfig, names ...string) *Manager {
+	t.Helper()
+
+	m := newTestManager(t)
+	linkTestProcessPlugins(t, m.pluginDir, names...)
+
+	config.ReadOnlyPaths = append(config.ReadOnlyPaths, SystemLibraryPaths...)
+	sandbox, err := NewNamespaceSandbox(config)
+	if err != nil {
+		t.Fatalf("创建沙箱失败: %v", err)
+	}
+	for _, name := range names {
+		m.SetPluginSandbox(name, sandbox)
+	}
+
+	for _, name := range names {
+		err := m.LoadPlugin(filepath.Join(m.pluginDir, name+ProcessPluginExt))
+		if err != nil && strings.Contains(err.Error(), "operation not permitted") {
+			t.Skipf("当前环境不支持命名空间: %v", err)
+		}
+		if err != nil {
+			t.Fatalf("加载沙箱插件 %s 失败: %v", name, err)
+		}
+		m.permissions.Store(name, PluginPermission{AllowedActions: map[string]bool{"execute": true}})
+	}
+	t.Cleanup(func() { _ = m.Shutdown() })
+	return m
+}
+
+func TestNamespaceSandboxIsolation(t *testing.T) {
+	allowed := t.TempDir()
+	writable := t.TempDir()
+	hidden := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(hidden, []byte("secret"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	m := newTestSandboxManager(t, NamespaceSandboxConfig{
+		ReadOnlyPaths: []string{allowed},
+		WritablePaths: []string{writable},
+		Limits:        ResourceLimits{OpenFiles: 64, CPUTime: 10 * time.Second},
+	}, "isolated")
+
+	probe := func(data string) string {
+		t.Helper()
+		result, err := m.ExecutePlugin("isolated", data)
+		if err != nil {
+			t.Fatalf("执行 %s 失败: %v", data, err)
+		}
+		return fmt.Sprint(result)
+	}
+
+	if got := probe("pid"); got != "1" {
+		t.Errorf("期望插件在独立 PID 命名空间中为 1 号进程, 得到 %s", got)
+	}
+	if got := probe("nofile"); got != "64" {
+		t.Errorf("期望打开文件数限制为 64, 得到 %s", got)
+	}
+	if got := probe("interfaces"); got != "1" {
+		t.Errorf("期望独立网络命名空间中只有回环接口, 得到 %s 个接口", got)
+	}
+	if got := probe("stat:" + allowed); got != "true" {
+		t.Errorf("允许列表中的路径应当可见")
+	}
+	if got := probe("stat:" + hidden); got != "false" {
+		t.Errorf("允许列表外的路径不应可见")
+	}
+	if got := probe("write:" + filepath.Join(allowed, "x")); got != "false" {
+		t.Errorf("只读路径不应可写")
+	}
+	if got := probe("write:" + filepath.Join(writable, "x")); got != "true" {
+		t.Errorf("可写路径应当可写")
+	}
+	if _, err := os.Stat(filepath.Join(writable, "x")); err != nil {
+		t.Errorf("写入可写路径的文件应当对宿主可见: %v", err)
+	}
+}
+
+func TestNamespaceSandboxConcurrentExecution(t *testing.T) {
+	m := newTestSandboxManager(t, NamespaceSandboxConfig{}, "left", "right")
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	errs := make(chan error, 2)
+	for _, name := range []string{"left", "right"} {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			_, err := m.ExecutePlugin(name, "sleep")
+			errs <- err
+		}(name)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("执行失败: %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed >= 400*time.Millisecond {
+		t.Fatalf("不同插件的执行应当并发进行, 耗时 %s", elapsed)
+	}
+}
+
+func TestNewNamespaceSandboxRejectsRelativePath(t *testing.T) {
+	if _, err := NewNamespaceSandbox(NamespaceSandboxConfig{ReadOnlyPaths: []string{"relative"}}); err == nil {
+		t.Fatal("期望相对路径被拒绝")
+	}
+}
+
+func TestNamespaceSandboxRequiresSandboxMain(t *testing.T) {
+	sandboxMainEnabled.Store(false)
+	defer sandboxMainEnabled.Store(true)
+
+	sandbox, err := NewNamespaceSandbox(NamespaceSandboxConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := sandbox.Command(exe); err == nil || !strings.Contains(err.Error(), "SandboxMain") {
+		t.Fatalf("没有调用 SandboxMain 时应拒绝启动沙箱插件, 得到 %v", err)
+	}
+	m, err := NewManager(t.TempDir(), "config.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Shutdown()
+	if _, ok := m.sandboxFor("any").(nopSandbox); !ok {
+		t.Fatal("默认沙箱不应改变宿主进程的状态")
+	}
+}
@@ -0,0 +1,19 @@
+//go:build !linux
+// +build !linux
+
+package plugmgr
+
+import "os/exec"
+
+// SandboxMain 命名空间沙箱仅支持 Linux 平台，立即返回
+func SandboxMain() {}
+
+// NewNamespaceSandbox 创建命名空间沙箱，仅支持 Linux 平台
+func NewNamespaceSandbox(config NamespaceSandboxConfig) (*NamespaceSandbox, error) {
+	return nil, newError("命名空间沙箱仅支持 Linux 平台")
+}
+
+// Command 命名空间沙箱仅支持 Linux 平台
+func (s *NamespaceSandbox) Command(path string) (*exec.Cmd, func(), error) {
+	return nil, nil, newError("命名空间沙箱仅支持 Linux 平台")
+}
@@ -0,0 +1,555 @@
+package plugmgr
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	msgpack "github.com/vmihailenco/msgpack/v5"
+)
+
+// SchemaProvider 提供配置 JSON Schema 的插件
+//
+//	优先于 PluginMetadata.ConfigSchema，适用于 Schema 需要动态生成的插件。
+type SchemaProvider interface {
+	// ConfigSchema 返回插件配置的 JSON Schema，为空表示不校验
+	ConfigSchema() []byte
+}
+
+// FieldError 配置中单个字段的校验错误
+type FieldError struct {
+	Path    string `json:"path"`    // 字段的 JSON Pointer，根节点为空字符串
+	Message string `json:"message"` // 错误说明
+}
+
+// ConfigValidationError 配置未通过 JSON Schema 校验
+//
+//	可以通过 errors.Is(err, ErrInvalidConfig) 判断，Fields 包含所有字段级错误。
+type ConfigValidationError struct {
+	Plugin string       // 插件名称
+	Fields []FieldError // 字段级错误，按路径排序
+}
+
+// Error 实现 error 接口
+func (e *ConfigValidationError) Error() string {
+	msgs := make([]string, len(e.Fields))
+	for i, field := range e.Fields {
+		path := field.Path
+		if path == "" {
+			path = "/"
+		}
+		msgs[i] = path + ": " + field.Message
+	}
+	return fmt.Sprintf("插件 %s 的配置无效: %s", e.Plugin, strings.Join(msgs, "; "))
+}
+
+// Unwrap 返回错误类型
+func (e *ConfigValidationError) Unwrap() error {
+	return ErrInvalidConfig
+}
+
+// pluginSchema 获取插件的配置 Schema
+func pluginSchema(p Plugin) []byte {
+	if provider, ok := p.(SchemaProvider); ok {
+		if schema := provider.ConfigSchema(); len(schema) > 0 {
+			return schema
+		}
+	}
+	return p.Metadata().ConfigSchema
+}
+
+// validateConfig 使用插件的 Schema 校验序列化后的配置，插件没有 Schema 时不校验
+func validateConfig(name string, p Plugin, config []byte) error {
+	raw := pluginSchema(p)
+	if len(raw) == 0 || config == nil {
+		return nil
+	}
+
+	schema, err := compileSchema(raw)
+	if err != nil {
+		return wrapf(err, "插件 %s 的配置 Schema 无效", name)
+	}
+
+	doc, err := configDocument(config)
+	if err != nil {
+		return &ConfigValidationError{Plugin: name, Fields: []FieldError{{Message: err.Error()}}}
+	}
+
+	if fields := schema.validate(doc); len(fields) > 0 {
+		return &ConfigValidationError{Plugin: name, Fields: fields}
+	}
+	return nil
+}
+
+// configDocument 将 msgpack 序列化的配置转换为 JSON 数据模型
+//
+//	配置本身是 JSON 文本时(例如通过 HTTP 提交的请求体)直接解析该文本。
+func configDocument(config []byte) (any, error) {
+	var value any
+	if err := msgpack.Unmarshal(config, &value); err != nil {
+		return nil, fmt.Errorf("无法解析配置: %v", err)
+	}
+
+	var data []byte
+	switch v := value.(type) {
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	}
+	if data != nil {
+		if !json.Valid(data) {
+			return nil, fmt.Errorf("配置不是有效的 JSON")
+		}
+		return decodeJSON(data)
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("配置无法转换为 JSON: %v", err)
+	}
+	return decodeJSON(data)
+}
+
+func decodeJSON(data []byte) (any, error) {
+	var value any
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// jsonSchema 编译后的 JSON Schema
+//
+//	支持 draft 2020-12 的常用校验关键字: type、enum、const、properties、required、
+//	additionalProperties、minProperties、maxProperties、items、minItems、maxItems、uniqueItems、
+//	minimum、maximum、exclusiveMinimum、exclusiveMaximum、multipleOf、minLength、maxLength、
+//	pattern、allOf、anyOf、oneOf、not 以及指向 $defs/definitions 的本地 $ref。
+//	format 等注解关键字被忽略。
+type jsonSchema struct {
+	root   *jsonSchema
+	always *bool // 布尔 Schema
+
+	Ref         string                 `json:"$ref"`
+	Defs        map[string]*jsonSchema `json:"$defs"`
+	Definitions map[string]*jsonSchema `json:"definitions"`
+
+	Type  schemaTypes     `json:"type"`
+	Enum  []any           `json:"enum"`
+	Const json.RawMessage `json:"const"`
+
+	Properties           map[string]*jsonSchema `json:"properties"`
+	Required             []string               `json:"required"`
+	AdditionalProperties *jsonSchema            `json:"additionalProperties"`
+	MinProperties        *int                   `json:"minProperties"`
+	MaxProperties        *int                   `json:"maxProperties"`
+
+	Items       *jsonSchema `json:"items"`
+	MinItems    *int        `json:"minItems"`
+	MaxItems    *int        `json:"maxItems"`
+	UniqueItems bool        `json:"uniqueItems"`
+
+	Minimum          *float64        `json:"minimum"`
+	Maximum          *float64        `json:"maximum"`
+	ExclusiveMinimum json.RawMessage `json:"exclusiveMinimum"`
+	ExclusiveMaximum json.RawMessage `json:"exclusiveMaximum"`
+	MultipleOf       *float64        `json:"multipleOf"`
+
+	MinLength *int   `json:"minLength"`
+	MaxLength *int   `json:"maxLength"`
+	Pattern   string `json:"pattern"`
+	pattern   *regexp.Regexp
+
+	AllOf []*jsonSchema `json:"allOf"`
+	AnyOf []*jsonSchema `json:"anyOf"`
+	OneOf []*jsonSchema `json:"oneOf"`
+	Not   *jsonSchema   `json:"not"`
+
+	Secret bool `json:"secret"` // 扩展关键字，标记需要加密保存的密钥字段
+}
+
+// schemaTypes type 关键字，可以是字符串或字符串数组
+type schemaTypes []string
+
+func (t *schemaTypes) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*t = schemaTypes{single}
+		return nil
+	}
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return fmt.Errorf("type 必须是字符串或字符串数组")
+	}
+	*t = multiple
+	return nil
+}
+
+func (s *jsonSchema) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if bytes.Equal(data, []byte("true")) || bytes.Equal(data, []byte("false")) {
+		always := data[0] == 't'
+		s.always = &always
+		return nil
+	}
+
+	type plain jsonSchema
+	return json.Unmarshal(data, (*plain)(s))
+}
+
+// compileSchema 解析 JSON Schema 并编译其中的正则表达式
+func compileSchema(data []byte) (*jsonSchema, error) {
+	var schema jsonSchema
+	if err := json.Unmarshal(data, &schema); err != nil {
+		return nil, wrap(err, "解析 JSON Schema 失败")
+	}
+	if err := schema.compile(&schema); err != nil {
+		return nil, err
+	}
+	return &schema, nil
+}
+
+func (s *jsonSchema) compile(root *jsonSchema) error {
+	if s == nil {
+		return nil
+	}
+	s.root = root
+
+	if s.Pattern != "" {
+		pattern, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return wrapf(err, "无效的 pattern %q", s.Pattern)
+		}
+		s.pattern = pattern
+	}
+
+	children := []*jsonSchema{s.AdditionalProperties, s.Items, s.Not}
+	children = append(children, s.AllOf...)
+	children = append(children, s.AnyOf...)
+	children = append(children, s.OneOf...)
+	for _, schemas := range []map[string]*jsonSchema{s.Properties, s.Defs, s.Definitions} {
+		for _, child := range schemas {
+			children = append(children, child)
+		}
+	}
+	for _, child := range children {
+		if err := child.compile(root); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolve 解析本地 $ref
+func (s *jsonSchema) resolve() (*jsonSchema, error) {
+	if s.Ref == "" {
+		return s, nil
+	}
+	for _, prefix := range []string{"#/$defs/", "#/definitions/"} {
+		if name, ok := strings.CutPrefix(s.Ref, prefix); ok {
+			defs := s.root.Defs
+			if prefix == "#/definitions/" {
+				defs = s.root.Definitions
+			}
+			if target, ok := defs[unescapePointer(name)]; ok {
+				return target, nil
+			}
+		}
+	}
+	if s.Ref == "#" {
+		return s.root, nil
+	}
+	return nil, fmt.Errorf("无法解析 $ref %q", s.Ref)
+}
+
+// validate 校验数据并返回按路径排序的字段错误
+func (s *jsonSchema) validate(value any) []FieldError {
+	var errs []FieldError
+	s.validateAt(value, "", &errs, 0)
+	sort.SliceStable(errs, func(i, j int) bool { return errs[i].Path < errs[j].Path })
+	return errs
+}
+
+// maxSchemaDepth 防止递归 $ref 导致无限循环
+const maxSchemaDepth = 64
+
+func (s *jsonSchema) validateAt(value any, path string, errs *[]FieldError, depth int) {
+	add := func(format string, args ...any) {
+		*errs = append(*errs, FieldError{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if s == nil {
+		return
+	}
+	if depth > maxSchemaDepth {
+		add("Schema 嵌套过深")
+		return
+	}
+	if s.always != nil {
+		if !*s.always {
+			add("不允许出现该字段")
+		}
+		return
+	}
+	if s.Ref != "" {
+		target, err := s.resolve()
+		if err != nil {
+			add("%v", err)
+			return
+		}
+		target.validateAt(value, path, errs, depth+1)
+	}
+
+	if len(s.Type) > 0 && !matchesAnyType(value, s.Type) {
+		add("类型应为 %s，实际为 %s", strings.Join(s.Type, " 或 "), jsonType(value))
+		return
+	}
+	if len(s.Enum) > 0 && !containsValue(s.Enum, value) {
+		add("值必须是 %s 之一", formatValues(s.Enum))
+	}
+	if len(s.Const) > 0 {
+		if expected, err := decodeJSON(s.Const); err == nil && !reflect.DeepEqual(expected, value) {
+			add("值必须等于 %s", string(s.Const))
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]any:
+		s.validateObject(v, path, errs, depth, add)
+	case []any:
+		s.validateArray(v, path, errs, depth, add)
+	case float64:
+		s.validateNumber(v, add)
+	case string:
+		s.validateString(v, add)
+	}
+
+	for _, sub := range s.AllOf {
+		sub.validateAt(value, path, errs, depth+1)
+	}
+	if len(s.AnyOf) > 0 {
+		matched := false
+		for _, sub := range s.AnyOf {
+			if len(sub.check(value, depth+1)) == 0 {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			add("不满足 anyOf 中的任何一个 Schema")
+		}
+	}
+	if len(s.OneOf) > 0 {
+		matched := 0
+		for _, sub := range s.OneOf {
+			if len(sub.check(value, depth+1)) == 0 {
+				matched++
+			}
+		}
+		if matched != 1 {
+			add("必须恰好满足 oneOf 中的一个 Schema，实际满足 %d 个", matched)
+		}
+	}
+	if s.Not != nil && len(s.Not.check(value, depth+1)) == 0 {
+		add("不能满足 not 中的 Schema")
+	}
+}
+
+// check 校验数据但不记录到调用方的错误列表
+func (s *jsonSchema) check(value any, depth int) []FieldError {
+	var errs []FieldError
+	s.validateAt(value, "", &errs, depth)
+	return errs
+}
+
+func (s *jsonSchema) validateObject(v map[string]any, path string, errs *[]FieldError, depth int, add func(string, ...any)) {
+	for _, name := range s.Required {
+		if _, ok := v[name]; !ok {
+			*errs = append(*errs, FieldError{Path: path + "/" + escapePointer(name), Message: "缺少必填字段"})
+		}
+	}
+	if s.MinProperties != nil && len(v) < *s.MinProperties {
+		add("字段数不能少于 %d", *s.MinProperties)
+	}
+	if s.MaxProperties != nil && len(v) > *s.MaxProperties {
+		add("字段数不能多于 %d", *s.MaxProperties)
+	}
+
+	keys := make([]string, 0, len(v))
+	for key := range v {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		child := path + "/" + escapePointer(key)
+		if prop, ok := s.Properties[key]; ok {
+			prop.validateAt(v[key], child, errs, depth+1)
+		} else if s.AdditionalProperties != nil {
+			if s.AdditionalProperties.always != nil && !*s.AdditionalProperties.always {
+				*errs = append(*errs, FieldError{Path: child, Message: "不允许的字段"})
+				continue
+			}
+			s.AdditionalProperties.validateAt(v[key], child, errs, depth+1)
+		}
+	}
+}
+
+func (s *jsonSchema) validateArray(v []any, path string, errs *[]FieldError, depth int, add func(string, ...any)) {
+	if s.MinItems != nil && len(v) < *s.MinItems {
+		add("元素个数不能少于 %d", *s.MinItems)
+	}
+	if s.MaxItems != nil && len(v) > *s.MaxItems {
+		add("元素个数不能多于 %d", *s.MaxItems)
+	}
+	if s.UniqueItems {
+		for i := range v {
+			if containsValue(v[:i], v[i]) {
+				add("第 %d 个元素与之前的元素重复", i)
+				break
+			}
+		}
+	}
+	if s.Items != nil {
+		for i, item := range v {
+			s.Items.validateAt(item, path+"/"+strconv.Itoa(i), errs, depth+1)
+		}
+	}
+}
+
+func (s *jsonSchema) validateNumber(v float64, add func(string, ...any)) {
+	minimum, maximum := s.Minimum, s.Maximum
+	var exclusiveMin, exclusiveMax *float64
+
+	// draft 4 使用布尔值修饰 minimum/maximum，之后的版本直接给出边界
+	if flag, bound, ok := exclusiveBound(s.ExclusiveMinimum); ok {
+		if flag {
+			exclusiveMin, minimum = minimum, nil
+		} else {
+			exclusiveMin = bound
+		}
+	}
+	if flag, bound, ok := exclusiveBound(s.ExclusiveMaximum); ok {
+		if flag {
+			exclusiveMax, maximum = maximum, nil
+		} else {
+			exclusiveMax = bound
+		}
+	}
+
+	if minimum != nil && v < *minimum {
+		add("应大于等于 %v", *minimum)
+	}
+	if maximum != nil && v > *maximum {
+		add("应小于等于 %v", *maximum)
+	}
+	if exclusiveMin != nil && v <= *exclusiveMin {
+		add("应大于 %v", *exclusiveMin)
+	}
+	if exclusiveMax != nil && v >= *exclusiveMax {
+		add("应小于 %v", *exclusiveMax)
+	}
+	if s.MultipleOf != nil && *s.MultipleOf > 0 {
+		quotient := v / *s.MultipleOf
+		if math.Abs(quotient-math.Round(quotient)) > 1e-9 {
+			add("应为 %v 的倍数", *s.MultipleOf)
+		}
+	}
+}
+
+// exclusiveBound 解析 exclusiveMinimum/exclusiveMaximum
+//
+//	返回值 flag 为 true 表示 draft 4 的布尔形式，否则 bound 为数值边界。
+func exclusiveBound(raw json.RawMessage) (flag bool, bound *float64, ok bool) {
+	if len(raw) == 0 {
+		return false, nil, false
+	}
+	var b bool
+	if err := json.Unmarshal(raw, &b); err == nil {
+		return b, nil, b
+	}
+	var n float64
+	if err := json.Unmarshal(raw, &n); err == nil {
+		return false, &n, true
+	}
+	return false, nil, false
+}
+
+func (s *jsonSchema) validateString(v string, add func(string, ...any)) {
+	length := utf8.RuneCountInString(v)
+	if s.MinLength != nil && length < *s.MinLength {
+		add("长度不能小于 %d", *s.MinLength)
+	}
+	if s.MaxLength != nil && length > *s.MaxLength {
+		add("长度不能大于 %d", *s.MaxLength)
+	}
+	if s.pattern != nil && !s.pattern.MatchString(v) {
+		add("不匹配模式 %s", s.Pattern)
+	}
+}
+
+// jsonType 返回数据的 JSON 类型名称
+func jsonType(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == math.Trunc(v) && !math.IsInf(v, 0) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+func matchesAnyType(value any, types []string) bool {
+	actual := jsonType(value)
+	for _, t := range types {
+		if t == actual || (t == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+func containsValue(values []any, value any) bool {
+	for _, v := range values {
+		if reflect.DeepEqual(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func formatValues(values []any) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		data, _ := json.Marshal(v)
+		parts[i] = string(data)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// escapePointer 按 RFC 6901 转义 JSON Pointer 中的字段名
+func escapePointer(name string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(name)
+}
+
+func unescapePointer(name string) string {
+	return strings.NewReplacer("~1", "/", "~0", "~").Replace(name)
+}
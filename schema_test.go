@@ -0,0 +1,147 @@
+package plugmgr
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const testConfigSchema = `{
+	"type": "object",
+	"required": ["host", "port"],
+	"additionalProperties": false,
+	"properties": {
+		"host": {"type": "string", "minLength": 1},
+		"port": {"type": "integer", "minimum": 1, "maximum": 65535},
+		"mode": {"enum": ["fast", "safe"]},
+		"tags": {"type": "array", "items": {"$ref": "#/$defs/tag"}, "uniqueItems": true}
+	},
+	"$defs": {
+		"tag": {"type": "string", "pattern": "^[a-z]+$"}
+	}
+}`
+
+func TestSchemaValidate(t *testing.T) {
+	schema, err := compileSchema([]byte(testConfigSchema))
+	if err != nil {
+		t.Fatalf("编译 Schema 失败: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		doc   string
+		paths []string
+	}{
+		{"有效配置", `{"host": "localhost", "port": 8080, "tags": ["a", "b"]}`, nil},
+		{"缺少字段", `{"host": "localhost"}`, []string{"/port"}},
+		{"类型错误", `{"host": "x", "port": 80.5}`, []string{"/port"}},
+		{"超出范围", `{"host": "x", "port": 70000}`, []string{"/port"}},
+		{"枚举", `{"host": "x", "port": 1, "mode": "slow"}`, []string{"/mode"}},
+		{"多余字段", `{"host": "x", "port": 1, "debug": true}`, []string{"/debug"}},
+		{"引用与模式", `{"host": "", "port": 1, "tags": ["ok", "Bad", "ok"]}`, []string{"/host", "/tags", "/tags/1"}},
+		{"根类型", `[]`, []string{""}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := decodeJSON([]byte(tt.doc))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var paths []string
+			for _, field := range schema.validate(doc) {
+				paths = append(paths, field.Path)
+			}
+			if !reflect.DeepEqual(paths, tt.paths) {
+				t.Fatalf("期望错误路径 %v, 得到 %v", tt.paths, schema.validate(doc))
+			}
+		})
+	}
+}
+
+func TestSchemaCombinators(t *testing.T) {
+	schema, err := compileSchema([]byte(`{
+		"oneOf": [{"type": "integer"}, {"type": "number", "exclusiveMinimum": 10}],
+		"not": {"const": 42}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for doc, valid := range map[any]bool{3.0: true, 10.5: true, 11.0: false, 42.0: false, "x": false} {
+		if got := len(schema.validate(doc)) == 0; got != valid {
+			t.Errorf("%v: 期望 valid=%v", doc, valid)
+		}
+	}
+
+	if _, err := compileSchema([]byte(`{"pattern": "("}`)); err == nil {
+		t.Error("无效的正则表达式应返回错误")
+	}
+}
+
+// schemaPlugin 通过 SchemaProvider 提供 Schema 的插件
+type schemaPlugin struct {
+	fakePlugin
+	updates int
+}
+
+func (p *schemaPlugin) ConfigSchema() []byte { return []byte(testConfigSchema) }
+
+func (p *schemaPlugin) ConfigUpdated(config []byte) ([]byte, error) {
+	p.updates++
+	return p.fakePlugin.ConfigUpdated(config)
+}
+
+func TestConfigUpdatedValidation(t *testing.T) {
+	m := newTestManager(t)
+	p := &schemaPlugin{}
+	loadHostPlugin(t, m, "server", p)
+
+	_, err := m.ConfigUpdated("server", map[string]any{"host": "x", "port": 0})
+	var validationErr *ConfigValidationError
+	if !errors.As(err, &validationErr) || !errors.Is(err, ErrInvalidConfig) {
+		t.Fatalf("期望 *ConfigValidationError, 得到 %v", err)
+	}
+	if len(validationErr.Fields) != 1 || validationErr.Fields[0].Path != "/port" {
+		t.Fatalf("字段错误不正确: %+v", validationErr.Fields)
+	}
+	if p.updates != 0 {
+		t.Fatal("校验失败时不应调用插件的 ConfigUpdated")
+	}
+
+	if _, err := m.ConfigUpdated("server", map[string]any{"host": "x", "port": 80}); err != nil {
+		t.Fatalf("有效配置应通过校验: %v", err)
+	}
+
+	// 通过 HTTP 提交的 JSON 文本同样按 Schema 校验
+	if _, err := m.ConfigUpdated("server", []byte(`{"host": "x"}`)); !errors.Is(err, ErrInvalidConfig) {
+		t.Fatalf("JSON 文本缺少字段时应校验失败, 得到 %v", err)
+	}
+
+	schema, err := m.GetPluginSchema("server")
+	if err != nil || string(schema) != testConfigSchema {
+		t.Fatalf("GetPluginSchema 返回 %q, %v", schema, err)
+	}
+}
+
+func TestLoadPluginWithDataValidation(t *testing.T) {
+	m := newTestManager(t)
+	p := &fakePlugin{metadata: PluginMetadata{ConfigSchema: []byte(testConfigSchema)}}
+	path := filepath.Join(m.pluginDir, "server.so")
+	m.preloadedPlugins.Store("server", &lazyPlugin{path: path, loaded: p})
+
+	err := m.LoadPluginWithData(path, map[string]any{"host": "x", "port": "80"})
+	if !errors.Is(err, ErrInvalidConfig) {
+		t.Fatalf("期望配置校验失败, 得到 %v", err)
+	}
+	if p.config != nil {
+		t.Fatal("校验失败时不应调用 PreLoad")
+	}
+	if _, ok := m.plugins.Load("server"); ok {
+		t.Fatal("校验失败的插件不应保持注册")
+	}
+
+	m.preloadedPlugins.Store("server", &lazyPlugin{path: path, loaded: p})
+	if err := m.LoadPluginWithData(path, map[string]any{"host": "x", "port": 80}); err != nil {
+		t.Fatalf("有效配置应加载成功: %v", err)
+	}
+}
@@ -0,0 +1,203 @@
+// Package sdk 用于编写以子进程方式运行的插件
+//
+// 进程插件是一个独立的可执行文件，由插件管理器启动，并通过标准输入输出
+// 交换长度前缀的 RPC 消息帧。插件只需实现 plugmgr.Plugin 接口并在 main
+// 函数中调用 Serve:
+//
+//	func main() {
+//		if err := sdk.Serve(&MyPlugin{}); err != nil {
+//			log.Fatal(err)
+//		}
+//	}
+//
+// 实现 plugmgr.ContextPlugin 的插件会在宿主取消执行时收到上下文取消信号。
+package sdk
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/darkit/plugmgr"
+)
+
+// Serve 在标准输入输出上运行插件
+//
+//	参数:
+//	- p: 插件实例
+//	返回:
+//	- error: 通信过程中的错误，宿主正常关闭插件时返回 nil
+//	功能:
+//	- 根据宿主设置的环境变量选择编码格式
+//	- 将 os.Stdout 重定向到标准错误，避免插件输出破坏协议数据
+func Serve(p plugmgr.Plugin) error {
+	codec, err := plugmgr.NewRPCCodec(os.Getenv(plugmgr.RPCCodecEnv))
+	if err != nil {
+		return err
+	}
+
+	out := os.Stdout
+	os.Stdout = os.Stderr
+
+	return ServeConn(p, os.Stdin, out, codec)
+}
+
+// ServeConn 在指定的读写通道上运行插件
+//
+//	参数:
+//	- p: 插件实例
+//	- r: 读取宿主请求的通道
+//	- w: 写入响应的通道
+//	- codec: 消息编码器
+//	返回:
+//	- error: 通信过程中的错误，收到 Shutdown 或对端关闭时返回 nil
+func ServeConn(p plugmgr.Plugin, r io.Reader, w io.Writer, codec plugmgr.RPCCodec) error {
+	s := &server{
+		plugin:  p,
+		writer:  w,
+		codec:   codec,
+		cancels: make(map[uint64]context.CancelFunc),
+	}
+	return s.serve(r)
+}
+
+// Decode 将宿主传入的执行数据解码到指定类型
+//
+//	跨进程传递的数据会被还原为 map、切片等通用类型，
+//	可以通过该函数转换为插件自己的结构体。
+func Decode(data any, v any) error {
+	raw, err := plugmgr.Serializer(data)
+	if err != nil {
+		return err
+	}
+	return plugmgr.Deserializer(raw, v)
+}
+
+type server struct {
+	plugin plugmgr.Plugin
+	writer io.Writer
+	codec  plugmgr.RPCCodec
+
+	writeMu sync.Mutex
+	mu      sync.Mutex
+	cancels map[uint64]context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+func (s *server) serve(r io.Reader) error {
+	defer s.wg.Wait()
+
+	for {
+		var req plugmgr.RPCRequest
+		if err := plugmgr.ReadRPCFrame(r, s.codec, &req); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+
+		switch req.Method {
+		case plugmgr.RPCMethodCancel:
+			s.cancel(req.ID)
+		case plugmgr.RPCMethodExecute:
+			s.execute(req)
+		default:
+			if err := s.reply(s.handle(req)); err != nil {
+				return err
+			}
+			if req.Method == plugmgr.RPCMethodShutdown {
+				return nil
+			}
+		}
+	}
+}
+
+// execute 在独立的 goroutine 中执行插件，以便处理取消通知
+func (s *server) execute(req plugmgr.RPCRequest) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.mu.Lock()
+	s.cancels[req.ID] = cancel
+	s.mu.Unlock()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer s.cancel(req.ID)
+
+		resp := s.invoke(req.ID, func(resp *plugmgr.RPCResponse) error {
+			var err error
+			if cp, ok := s.plugin.(plugmgr.ContextPlugin); ok {
+				resp.Result, err = cp.ExecuteContext(ctx, req.Data)
+			} else {
+				resp.Result, err = s.plugin.Execute(req.Data)
+			}
+			return err
+		})
+
+		// 已取消的请求宿主不再等待响应
+		if ctx.Err() == nil {
+			_ = s.reply(resp)
+		}
+	}()
+}
+
+func (s *server) cancel(id uint64) {
+	s.mu.Lock()
+	cancel, ok := s.cancels[id]
+	delete(s.cancels, id)
+	s.mu.Unlock()
+
+	if ok {
+		cancel()
+	}
+}
+
+func (s *server) handle(req plugmgr.RPCRequest) *plugmgr.RPCResponse {
+	return s.invoke(req.ID, func(resp *plugmgr.RPCResponse) error {
+		switch req.Method {
+		case plugmgr.RPCMethodMetadata:
+			metadata := s.plugin.Metadata()
+			resp.Metadata = &metadata
+			return nil
+		case plugmgr.RPCMethodPreLoad:
+			return s.plugin.PreLoad(req.Config)
+		case plugmgr.RPCMethodInit:
+			return s.plugin.Init()
+		case plugmgr.RPCMethodPostLoad:
+			return s.plugin.PostLoad()
+		case plugmgr.RPCMethodConfigUpdated:
+			var err error
+			resp.Config, err = s.plugin.ConfigUpdated(req.Config)
+			return err
+		case plugmgr.RPCMethodPreUnload:
+			return s.plugin.PreUnload()
+		case plugmgr.RPCMethodShutdown:
+			return s.plugin.Shutdown()
+		default:
+			return fmt.Errorf("未知的方法: %s", req.Method)
+		}
+	})
+}
+
+// invoke 调用插件方法并将错误和 panic 转换为响应
+func (s *server) invoke(id uint64, fn func(resp *plugmgr.RPCResponse) error) (resp *plugmgr.RPCResponse) {
+	resp = &plugmgr.RPCResponse{ID: id}
+	defer func() {
+		if r := recover(); r != nil {
+			resp = &plugmgr.RPCResponse{ID: id, Error: fmt.Sprintf("插件发生 panic: %v", r)}
+		}
+	}()
+
+	if err := fn(resp); err != nil {
+		resp.Error = err.Error()
+	}
+	return resp
+}
+
+func (s *server) reply(resp *plugmgr.RPCResponse) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	return plugmgr.WriteRPCFrame(s.writer, s.codec, resp)
+}
@@ -0,0 +1,119 @@
+package sdk
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/darkit/plugmgr"
+)
+
+type testPlugin struct {
+	config []byte
+}
+
+func (p *testPlugin) Metadata() plugmgr.PluginMetadata {
+	return plugmgr.PluginMetadata{Name: "test", Version: "0.1.0"}
+}
+func (p *testPlugin) Init() error      { return nil }
+func (p *testPlugin) PostLoad() error  { return nil }
+func (p *testPlugin) PreUnload() error { return nil }
+func (p *testPlugin) Shutdown() error  { return nil }
+
+func (p *testPlugin) PreLoad(config []byte) error {
+	p.config = config
+	return nil
+}
+
+func (p *testPlugin) ConfigUpdated(config []byte) ([]byte, error) {
+	return append([]byte("updated:"), config...), nil
+}
+
+func (p *testPlugin) Execute(data any) (any, error) {
+	return p.ExecuteContext(context.Background(), data)
+}
+
+func (p *testPlugin) ExecuteContext(ctx context.Context, data any) (any, error) {
+	switch data {
+	case "panic":
+		panic("boom")
+	case "wait":
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return data, nil
+}
+
+type client struct {
+	t     *testing.T
+	r     io.Reader
+	w     io.Writer
+	codec plugmgr.RPCCodec
+}
+
+func (c *client) send(req plugmgr.RPCRequest) {
+	c.t.Helper()
+	if err := plugmgr.WriteRPCFrame(c.w, c.codec, &req); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func (c *client) recv() plugmgr.RPCResponse {
+	c.t.Helper()
+	var resp plugmgr.RPCResponse
+	if err := plugmgr.ReadRPCFrame(c.r, c.codec, &resp); err != nil {
+		c.t.Fatal(err)
+	}
+	return resp
+}
+
+func TestServeConn(t *testing.T) {
+	codec, _ := plugmgr.NewRPCCodec("json")
+	reqR, reqW := io.Pipe()
+	respR, respW := io.Pipe()
+
+	plugin := &testPlugin{}
+	done := make(chan error, 1)
+	go func() { done <- ServeConn(plugin, reqR, respW, codec) }()
+
+	c := &client{t: t, r: respR, w: reqW, codec: codec}
+
+	c.send(plugmgr.RPCRequest{ID: 1, Method: plugmgr.RPCMethodMetadata})
+	if resp := c.recv(); resp.Metadata == nil || resp.Metadata.Name != "test" {
+		t.Fatalf("元数据不正确: %+v", resp)
+	}
+
+	c.send(plugmgr.RPCRequest{ID: 2, Method: plugmgr.RPCMethodConfigUpdated, Config: []byte("a")})
+	if resp := c.recv(); string(resp.Config) != "updated:a" {
+		t.Fatalf("配置不正确: %q", resp.Config)
+	}
+
+	c.send(plugmgr.RPCRequest{ID: 3, Method: plugmgr.RPCMethodExecute, Data: "panic"})
+	if resp := c.recv(); resp.ID != 3 || resp.Error == "" {
+		t.Fatalf("panic 应转换为错误响应: %+v", resp)
+	}
+
+	// 被取消的执行不会产生响应，后续请求的响应应正常到达
+	c.send(plugmgr.RPCRequest{ID: 4, Method: plugmgr.RPCMethodExecute, Data: "wait"})
+	c.send(plugmgr.RPCRequest{ID: 4, Method: plugmgr.RPCMethodCancel})
+	c.send(plugmgr.RPCRequest{ID: 5, Method: plugmgr.RPCMethodExecute, Data: "hi"})
+	if resp := c.recv(); resp.ID != 5 || resp.Result != "hi" {
+		t.Fatalf("执行结果不正确: %+v", resp)
+	}
+
+	c.send(plugmgr.RPCRequest{ID: 6, Method: plugmgr.RPCMethodShutdown})
+	if resp := c.recv(); resp.ID != 6 || resp.Error != "" {
+		t.Fatalf("关闭响应不正确: %+v", resp)
+	}
+	if err := <-done; err != nil && !errors.Is(err, io.EOF) {
+		t.Fatalf("ServeConn 返回错误: %v", err)
+	}
+}
+
+func TestDecode(t *testing.T) {
+	var v struct{ Name string }
+	if err := Decode(map[string]any{"Name": "x"}, &v); err != nil || v.Name != "x" {
+		t.Fatalf("解码失败: %+v, %v", v, err)
+	}
+}
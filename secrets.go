@@ -0,0 +1,584 @@
+package plugmgr
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// RedactedValue 脱敏后替代密钥字段的值
+const RedactedValue = "******"
+
+// sealedPrefix 加密后的密钥字段值的前缀，格式为 enc:v1:<密钥标识>:<base64(nonce|密文)>
+const sealedPrefix = "enc:v1:"
+
+// secretSuffixes 按命名约定视为密钥的字段名后缀，不区分大小写
+var secretSuffixes = []string{"secret", "token", "password"}
+
+// KeyProvider 提供加密插件配置中密钥字段的 AES 密钥
+//
+//	密钥长度为 16、24 或 32 字节，分别对应 AES-128、AES-192 和 AES-256。
+type KeyProvider interface {
+	// CurrentKey 返回用于加密的当前密钥及其标识，标识不能包含 ":"
+	CurrentKey() (id string, key []byte, err error)
+	// Key 返回指定标识的密钥，用于解密以前加密的数据
+	Key(id string) ([]byte, error)
+}
+
+// WithKeyProvider 设置加密插件配置中密钥字段的密钥提供者
+//
+//	未设置时密钥字段以明文保存，但仍会在 GetPluginConfig 等输出中脱敏。
+func WithKeyProvider(provider KeyProvider) ManagerOption {
+	return func(o *managerOptions) {
+		o.keys = provider
+	}
+}
+
+// staticKeyProvider 只有一个密钥的提供者，密钥标识由密钥的摘要生成
+type staticKeyProvider struct {
+	load func() ([]byte, error)
+}
+
+// EnvKeyProvider 返回从环境变量读取 base64 编码密钥的提供者
+func EnvKeyProvider(name string) KeyProvider {
+	return &staticKeyProvider{load: func() ([]byte, error) {
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return nil, wrapf(ErrSecretKeyNotFound, "环境变量 %s 未设置", name)
+		}
+		return decodeKey([]byte(value))
+	}}
+}
+
+// FileKeyProvider 返回从文件读取密钥的提供者，文件内容为原始密钥或 base64 编码的密钥
+func FileKeyProvider(path string) KeyProvider {
+	return &staticKeyProvider{load: func() ([]byte, error) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, wrapf(err, "读取密钥文件 %s 失败", path)
+		}
+		return decodeKey(data)
+	}}
+}
+
+func (p *staticKeyProvider) CurrentKey() (string, []byte, error) {
+	key, err := p.load()
+	if err != nil {
+		return "", nil, err
+	}
+	return keyID(key), key, nil
+}
+
+func (p *staticKeyProvider) Key(id string) ([]byte, error) {
+	key, err := p.load()
+	if err != nil {
+		return nil, err
+	}
+	if keyID(key) != id {
+		return nil, wrapf(ErrSecretKeyNotFound, "密钥 %s", id)
+	}
+	return key, nil
+}
+
+// keyID 返回密钥 SHA-256 摘要的前 8 字节作为标识
+func keyID(key []byte) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:8])
+}
+
+// decodeKey 解析原始密钥或 base64 编码的密钥
+func decodeKey(data []byte) ([]byte, error) {
+	text := strings.TrimSpace(string(data))
+	if key, err := base64.StdEncoding.DecodeString(text); err == nil && validKeySize(len(key)) {
+		return key, nil
+	}
+	if validKeySize(len(data)) {
+		return data, nil
+	}
+	return nil, newErrorf("密钥长度必须为 16、24 或 32 字节")
+}
+
+func validKeySize(n int) bool {
+	return n == 16 || n == 24 || n == 32
+}
+
+// Keyring 保存在本地目录中的密钥环
+//
+//	每个密钥保存为 <标识>.key，current 文件记录当前密钥的标识。
+//	轮换后旧密钥仍保留在目录中，用于解密尚未重新加密的数据。
+type Keyring struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// NewKeyring 打开密钥环目录，目录中没有密钥时生成第一个 AES-256 密钥
+func NewKeyring(dir string) (*Keyring, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, wrapf(err, "创建密钥环目录 %s 失败", dir)
+	}
+	k := &Keyring{dir: dir}
+	if _, err := os.Stat(filepath.Join(dir, "current")); errors.Is(err, os.ErrNotExist) {
+		if _, err := k.Rotate(); err != nil {
+			return nil, err
+		}
+	}
+	return k, nil
+}
+
+// CurrentKey 返回当前密钥
+func (k *Keyring) CurrentKey() (string, []byte, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	data, err := os.ReadFile(filepath.Join(k.dir, "current"))
+	if err != nil {
+		return "", nil, wrap(err, "读取当前密钥标识失败")
+	}
+	id := strings.TrimSpace(string(data))
+	key, err := k.readKey(id)
+	return id, key, err
+}
+
+// Key 返回指定标识的密钥
+func (k *Keyring) Key(id string) ([]byte, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.readKey(id)
+}
+
+// Rotate 生成新的 AES-256 密钥并设为当前密钥，返回新密钥的标识
+func (k *Keyring) Rotate() (string, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", wrap(err, "生成密钥失败")
+	}
+	id := keyID(key)
+
+	encoded := []byte(base64.StdEncoding.EncodeToString(key))
+	if err := os.WriteFile(filepath.Join(k.dir, id+".key"), encoded, 0o600); err != nil {
+		return "", wrap(err, "保存密钥失败")
+	}
+	if err := writeFileAtomic(filepath.Join(k.dir, "current"), []byte(id), 0o600); err != nil {
+		return "", wrap(err, "更新当前密钥标识失败")
+	}
+	return id, nil
+}
+
+func (k *Keyring) readKey(id string) ([]byte, error) {
+	if id == "" || strings.ContainsAny(id, `/\:.`) {
+		return nil, wrapf(ErrSecretKeyNotFound, "无效的密钥标识 %q", id)
+	}
+	data, err := os.ReadFile(filepath.Join(k.dir, id+".key"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, wrapf(ErrSecretKeyNotFound, "密钥 %s", id)
+	}
+	if err != nil {
+		return nil, wrapf(err, "读取密钥 %s 失败", id)
+	}
+	return decodeKey(data)
+}
+
+// writeFileAtomic 通过临时文件和重命名原子地写入文件
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// secretRules 判断配置字段是否为密钥
+//
+//	插件 Schema 中标记 "secret": true 的字段，以及字段名以 secret、token、password
+//	结尾(不区分大小写)的字段视为密钥。
+type secretRules struct {
+	patterns [][]string // Schema 中密钥字段的路径，"*" 匹配任意数组下标或字段名
+	sealed   map[string]bool
+}
+
+// secretRules 返回插件的密钥字段规则，插件未加载时只使用命名约定
+func (m *Manager) secretRules(name string) *secretRules {
+	rules := &secretRules{}
+	if v, ok := m.plugins.Load(name); ok {
+		if p := v.(*lazyPlugin).loaded; p != nil {
+			if raw := pluginSchema(p); len(raw) > 0 {
+				if schema, err := compileSchema(raw); err == nil {
+					schema.secretPaths(nil, &rules.patterns, 0)
+				}
+			}
+		}
+	}
+	return rules
+}
+
+// secretPaths 收集 Schema 中标记为密钥的字段路径
+func (s *jsonSchema) secretPaths(path []string, out *[][]string, depth int) {
+	if s == nil || depth > maxSchemaDepth {
+		return
+	}
+	if s.Ref != "" {
+		if target, err := s.resolve(); err == nil {
+			target.secretPaths(path, out, depth+1)
+		}
+		return
+	}
+	if s.Secret {
+		*out = append(*out, append([]string(nil), path...))
+		return
+	}
+
+	for name, child := range s.Properties {
+		child.secretPaths(append(path, name), out, depth+1)
+	}
+	s.AdditionalProperties.secretPaths(append(path, "*"), out, depth+1)
+	s.Items.secretPaths(append(path, "*"), out, depth+1)
+	for _, schemas := range [][]*jsonSchema{s.AllOf, s.AnyOf, s.OneOf} {
+		for _, child := range schemas {
+			child.secretPaths(path, out, depth+1)
+		}
+	}
+}
+
+// match 检查 JSON Pointer 路径或其任意上级字段是否为密钥
+func (r *secretRules) match(path string) bool {
+	if path == "" {
+		return false
+	}
+
+	var segments []string
+	for _, segment := range strings.Split(path[1:], "/") {
+		segments = append(segments, unescapePointer(segment))
+	}
+
+	for i := range segments {
+		prefix := segments[:i+1]
+		if r.sealed["/"+strings.Join(prefix, "/")] {
+			return true
+		}
+		if _, err := strconv.Atoi(prefix[i]); err != nil {
+			lower := strings.ToLower(prefix[i])
+			for _, suffix := range secretSuffixes {
+				if strings.HasSuffix(lower, suffix) {
+					return true
+				}
+			}
+		}
+		for _, pattern := range r.patterns {
+			if matchSegments(pattern, prefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func matchSegments(pattern, segments []string) bool {
+	if len(pattern) != len(segments) {
+		return false
+	}
+	for i, p := range pattern {
+		if p != "*" && p != segments[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// isSealed 检查值是否为加密后的密钥字段
+func isSealed(value any) bool {
+	s, ok := value.(string)
+	return ok && strings.HasPrefix(s, sealedPrefix)
+}
+
+// sealValue 使用当前密钥加密值，插件名称作为附加认证数据
+func sealValue(provider KeyProvider, plugin string, value any) (string, error) {
+	id, key, err := provider.CurrentKey()
+	if err != nil {
+		return "", wrap(err, "获取加密密钥失败")
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	plaintext, err := json.Marshal(value)
+	if err != nil {
+		return "", wrap(err, "序列化密钥字段失败")
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", wrap(err, "生成随机数失败")
+	}
+	sealed := gcm.Seal(nonce, nonce, plaintext, []byte(plugin))
+	return sealedPrefix + id + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// openValue 解密密钥字段
+func openValue(keyFor func(id string) ([]byte, error), plugin, value string) (any, error) {
+	id, encoded, ok := strings.Cut(strings.TrimPrefix(value, sealedPrefix), ":")
+	if !ok {
+		return nil, newErrorf("无效的加密字段")
+	}
+	key, err := keyFor(id)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < gcm.NonceSize() {
+		return nil, newErrorf("无效的加密字段")
+	}
+	plaintext, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], []byte(plugin))
+	if err != nil {
+		return nil, wrapf(err, "解密插件 %s 的密钥字段失败", plugin)
+	}
+	return decodeJSON(plaintext)
+}
+
+// sealedKeyID 返回加密字段使用的密钥标识
+func sealedKeyID(value string) string {
+	id, _, _ := strings.Cut(strings.TrimPrefix(value, sealedPrefix), ":")
+	return id
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, wrap(err, "无效的加密密钥")
+	}
+	return cipher.NewGCM(block)
+}
+
+// rewriteConfig 先序遍历配置中的字段，fn 返回 true 时用返回值替换字段且不再遍历其子字段
+//
+//	没有字段被替换或配置无法解析时原样返回配置。
+func rewriteConfig(config []byte, fn func(path string, value any) (any, bool, error)) ([]byte, error) {
+	if config == nil {
+		return nil, nil
+	}
+	doc, err := configDocument(config)
+	if err != nil {
+		return config, nil
+	}
+	doc, changed, err := rewriteValue(doc, "", fn)
+	if err != nil || !changed {
+		return config, err
+	}
+	return encodeConfigDocument(doc, isTextConfig(config))
+}
+
+func rewriteValue(value any, path string, fn func(path string, value any) (any, bool, error)) (any, bool, error) {
+	replaced, ok, err := fn(path, value)
+	if err != nil || ok {
+		return replaced, ok, err
+	}
+
+	changed := false
+	switch v := value.(type) {
+	case map[string]any:
+		for key, item := range v {
+			item, c, err := rewriteValue(item, path+"/"+escapePointer(key), fn)
+			if err != nil {
+				return nil, false, err
+			}
+			v[key], changed = item, changed || c
+		}
+	case []any:
+		for i, item := range v {
+			item, c, err := rewriteValue(item, path+"/"+strconv.Itoa(i), fn)
+			if err != nil {
+				return nil, false, err
+			}
+			v[i], changed = item, changed || c
+		}
+	}
+	return value, changed, nil
+}
+
+// sealedPaths 返回配置中已加密字段的路径
+func sealedPaths(configs ...[]byte) map[string]bool {
+	paths := make(map[string]bool)
+	for _, config := range configs {
+		_, _ = rewriteConfig(config, func(path string, value any) (any, bool, error) {
+			if isSealed(value) {
+				paths[path] = true
+			}
+			return nil, false, nil
+		})
+	}
+	return paths
+}
+
+// sealConfig 加密配置中的密钥字段，未设置 KeyProvider 时原样返回
+func (m *Manager) sealConfig(name string, config []byte) ([]byte, error) {
+	if m.keys == nil {
+		return config, nil
+	}
+	rules := m.secretRules(name)
+	sealed, err := rewriteConfig(config, func(path string, value any) (any, bool, error) {
+		if isSealed(value) || !rules.match(path) {
+			return nil, false, nil
+		}
+		s, err := sealValue(m.keys, name, value)
+		return s, err == nil, err
+	})
+	return sealed, wrapf(err, "加密插件 %s 的密钥字段失败", name)
+}
+
+// openConfig 解密配置中的密钥字段，得到交给插件的明文配置
+func (m *Manager) openConfig(name string, config []byte) ([]byte, error) {
+	keyFor := func(id string) ([]byte, error) {
+		if m.keys == nil {
+			return nil, wrapf(ErrSecretKeyNotFound, "未设置 KeyProvider，无法解密密钥 %s", id)
+		}
+		return m.keys.Key(id)
+	}
+	return rewriteConfig(config, func(_ string, value any) (any, bool, error) {
+		if !isSealed(value) {
+			return nil, false, nil
+		}
+		plain, err := openValue(keyFor, name, value.(string))
+		return plain, err == nil, err
+	})
+}
+
+// pluginConfig 返回持久化存储中解密后的插件配置
+func (m *Manager) pluginConfig(name string) ([]byte, error) {
+	data, ok := m.config.GetPluginConfig(name)
+	if !ok {
+		return nil, nil
+	}
+	return m.openConfig(name, data.Config)
+}
+
+// RedactConfig 将配置中的密钥字段替换为 RedactedValue
+//
+//	参数:
+//	- name: 插件名称，用于获取插件 Schema 中标记的密钥字段
+//	- config: 序列化后的配置，可以是明文或加密后的配置
+//	返回:
+//	- []byte: 脱敏后的配置，没有密钥字段时原样返回
+func (m *Manager) RedactConfig(name string, config []byte) []byte {
+	redacted, _ := rewriteConfig(config, m.redactor(m.secretRules(name)))
+	return redacted
+}
+
+func (m *Manager) redactor(rules *secretRules) func(path string, value any) (any, bool, error) {
+	return func(path string, value any) (any, bool, error) {
+		if isSealed(value) || rules.match(path) {
+			return RedactedValue, true, nil
+		}
+		return nil, false, nil
+	}
+}
+
+// redactValue 脱敏位于 path 的值
+func (m *Manager) redactValue(rules *secretRules, path string, value any) any {
+	if value == nil {
+		return nil
+	}
+	redacted, _, _ := rewriteValue(value, path, m.redactor(rules))
+	return redacted
+}
+
+// RotateSecrets 使用 KeyProvider 的当前密钥重新加密所有插件配置和修订历史中的密钥字段
+//
+//	参数:
+//	- previous: 旧密钥的提供者，KeyProvider 本身无法提供旧密钥时使用，例如更换了密钥文件
+//	返回:
+//	- int: 重新加密的字段数量
+func (m *Manager) RotateSecrets(previous ...KeyProvider) (int, error) {
+	if m.keys == nil {
+		return 0, wrap(ErrSecretKeyNotFound, "未设置 KeyProvider")
+	}
+	return rotateSecrets(m.config, m.keys, previous)
+}
+
+// RotateConfigSecrets 使用 provider 的当前密钥重新加密配置存储中的密钥字段
+//
+//	用于在管理器未运行时轮换密钥，存储由调用方关闭。
+func RotateConfigSecrets(store ConfigStore, provider KeyProvider, previous ...KeyProvider) (int, error) {
+	c, err := loadConfig(store)
+	if c == nil {
+		return 0, err
+	}
+	return rotateSecrets(c, provider, previous)
+}
+
+func rotateSecrets(c *config, provider KeyProvider, previous []KeyProvider) (int, error) {
+	currentID, _, err := provider.CurrentKey()
+	if err != nil {
+		return 0, wrap(err, "获取加密密钥失败")
+	}
+	keyFor := func(id string) ([]byte, error) {
+		key, err := provider.Key(id)
+		for _, p := range previous {
+			if err == nil {
+				break
+			}
+			key, err = p.Key(id)
+		}
+		return key, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// 全部重新加密成功后再替换，避免部分失败时配置不一致
+	count := 0
+	rotated := make(map[*[]byte][]byte)
+	for name, data := range c.pluginConfigs {
+		rotate := func(path string, value any) (any, bool, error) {
+			if !isSealed(value) || sealedKeyID(value.(string)) == currentID {
+				return nil, false, nil
+			}
+			plain, err := openValue(keyFor, name, value.(string))
+			if err != nil {
+				return nil, false, err
+			}
+			sealed, err := sealValue(provider, name, plain)
+			if err != nil {
+				return nil, false, err
+			}
+			count++
+			return sealed, true, nil
+		}
+
+		targets := []*[]byte{&data.Config}
+		for i := range data.History {
+			targets = append(targets, &data.History[i].Config)
+		}
+		for _, target := range targets {
+			config, err := rewriteConfig(*target, rotate)
+			if err != nil {
+				return 0, wrapf(err, "重新加密插件 %s 的密钥字段失败", name)
+			}
+			rotated[target] = config
+		}
+	}
+
+	if count == 0 {
+		return 0, nil
+	}
+	for target, config := range rotated {
+		*target = config
+	}
+	return count, c.save(ConfigChange{})
+}
@@ -0,0 +1,180 @@
+package plugmgr
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const secretSchema = `{
+	"type": "object",
+	"properties": {
+		"host": {"type": "string"},
+		"apiKey": {"type": "string", "secret": true}
+	}
+}`
+
+func TestSecretsEncryptedAtRest(t *testing.T) {
+	keyring, err := NewKeyring(filepath.Join(t.TempDir(), "keys"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := NewMemoryConfigStore()
+	m, err := NewManagerWithOptions(t.TempDir(), "config.db", WithConfigStore(store), WithKeyProvider(keyring))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := &fakePlugin{metadata: PluginMetadata{ConfigSchema: []byte(secretSchema)}}
+	loadHostPlugin(t, m, "api", p)
+
+	config := map[string]any{"host": "example.com", "apiKey": "k-123", "db_password": "p-456"}
+	if _, err := m.ConfigUpdated("api", config); err != nil {
+		t.Fatal(err)
+	}
+
+	// 插件收到明文，持久化的配置中没有明文
+	if !bytes.Contains(p.config, []byte("k-123")) {
+		t.Fatal("插件应收到解密后的配置")
+	}
+	stored, _ := m.config.GetPluginConfig("api")
+	for _, plaintext := range []string{"k-123", "p-456"} {
+		if bytes.Contains(stored.Config, []byte(plaintext)) {
+			t.Fatalf("密钥字段 %s 以明文保存", plaintext)
+		}
+	}
+	if !bytes.Contains(stored.Config, []byte("example.com")) {
+		t.Fatal("普通字段不应加密")
+	}
+
+	// 对外输出的配置已脱敏
+	data, err := m.GetPluginConfig("api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var redacted map[string]any
+	if err := Deserializer(data.Config, &redacted); err != nil {
+		t.Fatal(err)
+	}
+	if redacted["apiKey"] != RedactedValue || redacted["db_password"] != RedactedValue || redacted["host"] != "example.com" {
+		t.Fatalf("GetPluginConfig 未脱敏: %v", redacted)
+	}
+	if bytes.Contains(data.History[0].Config, []byte("enc:v1:")) {
+		t.Fatal("修订历史应脱敏")
+	}
+
+	// 修改密钥字段后差异中不包含密钥
+	config["apiKey"] = "k-789"
+	if _, err := m.ConfigUpdated("api", config); err != nil {
+		t.Fatal(err)
+	}
+	diffs, err := m.DiffConfig("api", 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 1 || diffs[0].Path != "/apiKey" || diffs[0].Old != RedactedValue || diffs[0].New != RedactedValue {
+		t.Fatalf("差异应只包含脱敏后的密钥字段: %+v", diffs)
+	}
+
+	// 重新加载时 PreLoad 收到解密后的配置
+	m2, err := NewManagerWithOptions(t.TempDir(), "config.db", WithConfigStore(store), WithKeyProvider(keyring))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p2 := &fakePlugin{metadata: PluginMetadata{ConfigSchema: []byte(secretSchema)}}
+	loadHostPlugin(t, m2, "api", p2)
+	var loaded map[string]any
+	if err := Deserializer(p2.config, &loaded); err != nil || loaded["apiKey"] != "k-789" {
+		t.Fatalf("PreLoad 应收到解密后的配置: %v, %v", loaded, err)
+	}
+
+	// 没有密钥时无法加载加密的配置
+	m3, err := NewManagerWithOptions(t.TempDir(), "config.db", WithConfigStore(store))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(m3.pluginDir, "api.so")
+	m3.preloadedPlugins.Store("api", &lazyPlugin{path: path, loaded: &fakePlugin{}})
+	if err := m3.LoadPlugin(path); !errors.Is(err, ErrSecretKeyNotFound) {
+		t.Fatalf("期望 ErrSecretKeyNotFound, 得到 %v", err)
+	}
+}
+
+func TestRotateSecrets(t *testing.T) {
+	keyring, err := NewKeyring(filepath.Join(t.TempDir(), "keys"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := NewManagerWithOptions(t.TempDir(), "config.db", WithConfigStore(NewMemoryConfigStore()), WithKeyProvider(keyring))
+	if err != nil {
+		t.Fatal(err)
+	}
+	loadHostPlugin(t, m, "api", &fakePlugin{})
+	if _, err := m.ConfigUpdated("api", map[string]any{"token": "t-1"}); err != nil {
+		t.Fatal(err)
+	}
+	oldID, _, _ := keyring.CurrentKey()
+
+	newID, err := keyring.Rotate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	count, err := m.RotateSecrets()
+	if err != nil || count != 2 {
+		t.Fatalf("期望重新加密配置和修订历史中的 2 个字段, 得到 %d, %v", count, err)
+	}
+
+	stored, _ := m.config.GetPluginConfig("api")
+	if bytes.Contains(stored.Config, []byte(oldID)) || !bytes.Contains(stored.Config, []byte(newID)) {
+		t.Fatal("密钥字段应使用新密钥加密")
+	}
+	config, err := m.pluginConfig("api")
+	if err != nil || !bytes.Contains(config, []byte("t-1")) {
+		t.Fatalf("轮换后应能解密: %v", err)
+	}
+	if count, _ := m.RotateSecrets(); count != 0 {
+		t.Fatal("已使用当前密钥的字段不应重新加密")
+	}
+}
+
+func TestRotateConfigSecretsWithKeyFiles(t *testing.T) {
+	dir := t.TempDir()
+	oldKey, newKey := filepath.Join(dir, "old.key"), filepath.Join(dir, "new.key")
+	writeFile(t, oldKey, "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=")
+	if err := os.WriteFile(newKey, bytes.Repeat([]byte{7}, 32), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "config.db")
+	c, err := loadConfig(NewFileConfigStore(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := sealValue(FileKeyProvider(oldKey), "api", "s-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, _ := Serializer(map[string]any{"secret": sealed})
+	if err := c.SetPluginConfig("api", config); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := RotateConfigSecrets(NewFileConfigStore(path), FileKeyProvider(newKey)); !errors.Is(err, ErrSecretKeyNotFound) {
+		t.Fatalf("缺少旧密钥时期望 ErrSecretKeyNotFound, 得到 %v", err)
+	}
+	count, err := RotateConfigSecrets(NewFileConfigStore(path), FileKeyProvider(newKey), FileKeyProvider(oldKey))
+	if err != nil || count != 2 {
+		t.Fatalf("期望重新加密 2 个字段, 得到 %d, %v", count, err)
+	}
+
+	m, err := NewManagerWithOptions(dir, "config.db", WithKeyProvider(FileKeyProvider(newKey)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := m.pluginConfig("api")
+	if err != nil || !bytes.Contains(plain, []byte("s-1")) {
+		t.Fatalf("新密钥应能解密轮换后的配置: %v", err)
+	}
+}
@@ -0,0 +1,600 @@
+package plugmgr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version 语义化版本(SemVer 2.0)
+//
+//	字段说明:
+//	- Major/Minor/Patch: 主版本号、次版本号、修订号
+//	- Prerelease: 先行版本标识，例如 1.2.0-beta.1 中的 ["beta", "1"]
+//	- Build: 版本编译信息，例如 1.2.0+20240101 中的 ["20240101"]，不参与版本比较
+type Version struct {
+	Major      uint64
+	Minor      uint64
+	Patch      uint64
+	Prerelease []string
+	Build      []string
+}
+
+// ParseVersion 解析语义化版本字符串
+//
+//	参数:
+//	- s: 版本字符串，允许 "v" 前缀，缺省的次版本号和修订号视为 0(例如 "1.2" 等同于 "1.2.0")
+//	返回:
+//	- *Version: 解析后的版本
+//	- error: 版本格式错误时返回包装了 ErrInvalidVersion 的错误
+func ParseVersion(s string) (*Version, error) {
+	v, parts, err := parseVersionParts(s)
+	if err != nil {
+		return nil, err
+	}
+	for i, part := range parts {
+		if isWildcard(part) {
+			return nil, wrapf(ErrInvalidVersion, "版本 %q 的第 %d 段不能使用通配符", s, i+1)
+		}
+	}
+	return v, nil
+}
+
+// MustParseVersion 解析语义化版本字符串，格式错误时 panic
+func MustParseVersion(s string) *Version {
+	v, err := ParseVersion(s)
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+// parseVersionParts 解析版本字符串，返回版本及原始的数字段(可能包含通配符)
+func parseVersionParts(s string) (*Version, []string, error) {
+	raw := strings.TrimSpace(s)
+	raw = strings.TrimPrefix(strings.TrimPrefix(raw, "v"), "V")
+	if raw == "" {
+		return nil, nil, wrapf(ErrInvalidVersion, "版本不能为空")
+	}
+
+	v := &Version{}
+
+	if i := strings.IndexByte(raw, '+'); i >= 0 {
+		build, err := parseIdentifiers(raw[i+1:], false)
+		if err != nil {
+			return nil, nil, wrapf(ErrInvalidVersion, "版本 %q 的编译信息无效: %v", s, err)
+		}
+		v.Build = build
+		raw = raw[:i]
+	}
+
+	if i := strings.IndexByte(raw, '-'); i >= 0 {
+		pre, err := parseIdentifiers(raw[i+1:], true)
+		if err != nil {
+			return nil, nil, wrapf(ErrInvalidVersion, "版本 %q 的先行版本标识无效: %v", s, err)
+		}
+		v.Prerelease = pre
+		raw = raw[:i]
+	}
+
+	parts := strings.Split(raw, ".")
+	if len(parts) > 3 {
+		return nil, nil, wrapf(ErrInvalidVersion, "版本 %q 最多包含主版本号、次版本号和修订号三段", s)
+	}
+
+	numbers := []*uint64{&v.Major, &v.Minor, &v.Patch}
+	for i, part := range parts {
+		if isWildcard(part) {
+			continue
+		}
+		n, err := parseNumericIdentifier(part)
+		if err != nil {
+			return nil, nil, wrapf(ErrInvalidVersion, "版本 %q 的第 %d 段无效: %v", s, i+1, err)
+		}
+		*numbers[i] = n
+	}
+
+	return v, parts, nil
+}
+
+// parseIdentifiers 解析以点分隔的先行版本或编译信息标识
+func parseIdentifiers(s string, prerelease bool) ([]string, error) {
+	if s == "" {
+		return nil, fmt.Errorf("标识不能为空")
+	}
+
+	ids := strings.Split(s, ".")
+	for _, id := range ids {
+		if id == "" {
+			return nil, fmt.Errorf("存在空的标识")
+		}
+		for _, r := range id {
+			if !(r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r == '-') {
+				return nil, fmt.Errorf("标识 %q 包含非法字符 %q", id, r)
+			}
+		}
+		if prerelease && isNumeric(id) && len(id) > 1 && id[0] == '0' {
+			return nil, fmt.Errorf("数字标识 %q 不能有前导零", id)
+		}
+	}
+	return ids, nil
+}
+
+func parseNumericIdentifier(s string) (uint64, error) {
+	if s == "" {
+		return 0, fmt.Errorf("不能为空")
+	}
+	if !isNumeric(s) {
+		return 0, fmt.Errorf("%q 不是数字", s)
+	}
+	if len(s) > 1 && s[0] == '0' {
+		return 0, fmt.Errorf("%q 不能有前导零", s)
+	}
+	return strconv.ParseUint(s, 10, 64)
+}
+
+func isNumeric(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func isWildcard(s string) bool {
+	return s == "x" || s == "X" || s == "*"
+}
+
+// String 返回版本的规范字符串形式
+func (v *Version) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if len(v.Prerelease) > 0 {
+		s += "-" + strings.Join(v.Prerelease, ".")
+	}
+	if len(v.Build) > 0 {
+		s += "+" + strings.Join(v.Build, ".")
+	}
+	return s
+}
+
+// Compare 按 SemVer 2.0 的优先级规则比较版本
+//
+//	返回:
+//	- -1: v 低于 o
+//	- 0: 优先级相同(编译信息不参与比较)
+//	- 1: v 高于 o
+func (v *Version) Compare(o *Version) int {
+	if c := compareUint(v.Major, o.Major); c != 0 {
+		return c
+	}
+	if c := compareUint(v.Minor, o.Minor); c != 0 {
+		return c
+	}
+	if c := compareUint(v.Patch, o.Patch); c != 0 {
+		return c
+	}
+
+	// 先行版本的优先级低于正式版本
+	switch {
+	case len(v.Prerelease) == 0 && len(o.Prerelease) == 0:
+		return 0
+	case len(v.Prerelease) == 0:
+		return 1
+	case len(o.Prerelease) == 0:
+		return -1
+	}
+
+	for i := 0; i < len(v.Prerelease) && i < len(o.Prerelease); i++ {
+		if c := comparePrereleaseIdentifier(v.Prerelease[i], o.Prerelease[i]); c != 0 {
+			return c
+		}
+	}
+	return compareUint(uint64(len(v.Prerelease)), uint64(len(o.Prerelease)))
+}
+
+// sameTuple 判断主版本号、次版本号和修订号是否相同
+func (v *Version) sameTuple(o *Version) bool {
+	return v.Major == o.Major && v.Minor == o.Minor && v.Patch == o.Patch
+}
+
+func comparePrereleaseIdentifier(a, b string) int {
+	aNum, bNum := isNumeric(a), isNumeric(b)
+	switch {
+	case aNum && bNum:
+		if len(a) != len(b) {
+			return compareUint(uint64(len(a)), uint64(len(b)))
+		}
+		return strings.Compare(a, b)
+	case aNum:
+		// 数字标识的优先级低于字母标识
+		return -1
+	case bNum:
+		return 1
+	default:
+		return strings.Compare(a, b)
+	}
+}
+
+func compareUint(a, b uint64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// CompareVersions 比较两个版本字符串
+//
+//	返回:
+//	- int: -1、0 或 1，含义同 Version.Compare
+//	- error: 任一版本格式错误时返回
+func CompareVersions(v1, v2 string) (int, error) {
+	a, err := ParseVersion(v1)
+	if err != nil {
+		return 0, err
+	}
+	b, err := ParseVersion(v2)
+	if err != nil {
+		return 0, err
+	}
+	return a.Compare(b), nil
+}
+
+// compareVersions 比较两个版本字符串，用于排序
+//
+//	无效的版本排在所有有效版本之后，无效版本之间按字符串比较。
+func compareVersions(v1, v2 string) int {
+	a, errA := ParseVersion(v1)
+	b, errB := ParseVersion(v2)
+	switch {
+	case errA == nil && errB == nil:
+		return a.Compare(b)
+	case errA == nil:
+		return 1
+	case errB == nil:
+		return -1
+	default:
+		return strings.Compare(v1, v2)
+	}
+}
+
+// comparator 单个版本比较条件
+type comparator struct {
+	op      string
+	version *Version
+}
+
+func (c comparator) check(v *Version) bool {
+	cmp := v.Compare(c.version)
+	switch c.op {
+	case "=":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	default:
+		return false
+	}
+}
+
+func (c comparator) String() string {
+	return c.op + c.version.String()
+}
+
+// Constraint 版本约束
+//
+//	支持的语法:
+//	- 比较运算: =1.2.3、==1.2.3、!=1.2.3、>1.2、>=1.2.0、<2、<=2.0.0，运算符与版本之间可以有空格
+//	- 插入符范围: ^1.2.3 等同于 >=1.2.3 <2.0.0-0，^0.2.3 等同于 >=0.2.3 <0.3.0-0
+//	- 波浪号范围: ~1.2.3 等同于 >=1.2.3 <1.3.0-0，~1 等同于 >=1.0.0 <2.0.0-0
+//	- 通配符: 1.x、1.2.*、*，缺省的版本段等同于通配符
+//	- 连字符范围: 1.2.3 - 2.3.4 等同于 >=1.2.3 <=2.3.4
+//	- 组合: 以空格(或逗号)分隔表示同时满足，以 || 分隔表示满足其一
+//
+//	与 node-semver 一致，先行版本只有在同一组条件中存在相同主次修订号的先行版本时才会匹配。
+type Constraint struct {
+	raw  string
+	sets [][]comparator
+}
+
+// ParseConstraint 解析版本约束
+//
+//	参数:
+//	- s: 约束字符串，为空或 "*" 时匹配任意正式版本
+//	返回:
+//	- *Constraint: 解析后的约束
+//	- error: 约束格式错误时返回包装了 ErrInvalidConstraint 的错误
+func ParseConstraint(s string) (*Constraint, error) {
+	c := &Constraint{raw: s}
+	for _, group := range strings.Split(s, "||") {
+		set, err := parseComparatorSet(group)
+		if err != nil {
+			return nil, wrapf(ErrInvalidConstraint, "版本约束 %q 无效: %v", s, err)
+		}
+		c.sets = append(c.sets, set)
+	}
+	return c, nil
+}
+
+// Check 检查版本是否满足约束
+func (c *Constraint) Check(v *Version) bool {
+	for _, set := range c.sets {
+		if checkComparatorSet(set, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// String 返回约束的原始字符串
+func (c *Constraint) String() string {
+	return c.raw
+}
+
+// SatisfiesConstraint 检查版本字符串是否满足约束字符串
+//
+//	返回:
+//	- bool: 是否满足
+//	- error: 版本或约束格式错误时返回
+func SatisfiesConstraint(version, constraint string) (bool, error) {
+	v, err := ParseVersion(version)
+	if err != nil {
+		return false, err
+	}
+	c, err := ParseConstraint(constraint)
+	if err != nil {
+		return false, err
+	}
+	return c.Check(v), nil
+}
+
+func checkComparatorSet(set []comparator, v *Version) bool {
+	for _, c := range set {
+		if !c.check(v) {
+			return false
+		}
+	}
+
+	if len(v.Prerelease) == 0 {
+		return true
+	}
+	for _, c := range set {
+		if len(c.version.Prerelease) > 0 && c.version.sameTuple(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseComparatorSet 解析一组需要同时满足的条件
+func parseComparatorSet(s string) ([]comparator, error) {
+	s = strings.TrimSpace(strings.ReplaceAll(s, ",", " "))
+
+	if lower, upper, ok := strings.Cut(s, " - "); ok {
+		return parseHyphenRange(strings.TrimSpace(lower), strings.TrimSpace(upper))
+	}
+
+	// 将独立的运算符与后面的版本合并，兼容 ">= 1.0" 的写法
+	var tokens []string
+	pending := ""
+	for _, field := range strings.Fields(s) {
+		if isOperator(field) {
+			if pending != "" {
+				return nil, fmt.Errorf("运算符 %q 后缺少版本", pending)
+			}
+			pending = field
+			continue
+		}
+		tokens = append(tokens, pending+field)
+		pending = ""
+	}
+	if pending != "" {
+		return nil, fmt.Errorf("运算符 %q 后缺少版本", pending)
+	}
+
+	if len(tokens) == 0 {
+		return []comparator{{op: ">=", version: &Version{}}}, nil
+	}
+
+	var set []comparator
+	for _, token := range tokens {
+		comparators, err := parseComparator(token)
+		if err != nil {
+			return nil, err
+		}
+		set = append(set, comparators...)
+	}
+	return set, nil
+}
+
+var operators = []string{"==", "!=", ">=", "<=", "~>", ">", "<", "=", "^", "~"}
+
+func isOperator(s string) bool {
+	for _, op := range operators {
+		if s == op {
+			return true
+		}
+	}
+	return false
+}
+
+// parseComparator 解析单个条件并展开为基本比较
+func parseComparator(token string) ([]comparator, error) {
+	op := ""
+	for _, candidate := range operators {
+		if strings.HasPrefix(token, candidate) {
+			op = candidate
+			break
+		}
+	}
+
+	v, parts, err := parseVersionParts(token[len(op):])
+	if err != nil {
+		return nil, err
+	}
+	precision := wildcardPrecision(parts)
+	if precision < 3 && len(v.Prerelease) > 0 {
+		return nil, fmt.Errorf("%q: 通配符版本不能包含先行版本标识", token)
+	}
+
+	switch op {
+	case "^":
+		return caretRange(v, precision), nil
+	case "~", "~>":
+		return tildeRange(v, precision), nil
+	case "", "=", "==":
+		if precision == 3 {
+			return []comparator{{op: "=", version: v}}, nil
+		}
+		return xRange(v, precision), nil
+	case "!=":
+		if precision < 3 {
+			return nil, fmt.Errorf("%q: != 不支持通配符版本", token)
+		}
+		return []comparator{{op: "!=", version: v}}, nil
+	case ">":
+		if precision == 0 {
+			// >* 不匹配任何版本
+			return []comparator{{op: "<", version: &Version{Prerelease: []string{"0"}}}}, nil
+		}
+		if precision < 3 {
+			return []comparator{{op: ">=", version: bump(v, precision)}}, nil
+		}
+		return []comparator{{op: ">", version: v}}, nil
+	case ">=":
+		return []comparator{{op: ">=", version: v}}, nil
+	case "<":
+		if precision < 3 {
+			return []comparator{{op: "<", version: withMinPrerelease(v)}}, nil
+		}
+		return []comparator{{op: "<", version: v}}, nil
+	case "<=":
+		if precision == 0 {
+			return []comparator{{op: ">=", version: &Version{}}}, nil
+		}
+		if precision < 3 {
+			return []comparator{{op: "<", version: withMinPrerelease(bump(v, precision))}}, nil
+		}
+		return []comparator{{op: "<=", version: v}}, nil
+	}
+	return nil, fmt.Errorf("不支持的运算符 %q", op)
+}
+
+// wildcardPrecision 返回版本中有效(非通配符)段的数量
+func wildcardPrecision(parts []string) int {
+	for i, part := range parts {
+		if isWildcard(part) {
+			return i
+		}
+	}
+	return len(parts)
+}
+
+// bump 将版本在指定精度上加一，低位清零
+func bump(v *Version, precision int) *Version {
+	switch precision {
+	case 1:
+		return &Version{Major: v.Major + 1}
+	case 2:
+		return &Version{Major: v.Major, Minor: v.Minor + 1}
+	default:
+		return &Version{Major: v.Major, Minor: v.Minor, Patch: v.Patch + 1}
+	}
+}
+
+// withMinPrerelease 返回该版本最小的先行版本，用作排除先行版本的上界
+func withMinPrerelease(v *Version) *Version {
+	return &Version{Major: v.Major, Minor: v.Minor, Patch: v.Patch, Prerelease: []string{"0"}}
+}
+
+func xRange(v *Version, precision int) []comparator {
+	if precision == 0 {
+		return []comparator{{op: ">=", version: &Version{}}}
+	}
+	return []comparator{
+		{op: ">=", version: v},
+		{op: "<", version: withMinPrerelease(bump(v, precision))},
+	}
+}
+
+func tildeRange(v *Version, precision int) []comparator {
+	switch precision {
+	case 0:
+		return xRange(v, 0)
+	case 1:
+		return xRange(v, 1)
+	default:
+		return []comparator{
+			{op: ">=", version: v},
+			{op: "<", version: withMinPrerelease(bump(v, 2))},
+		}
+	}
+}
+
+func caretRange(v *Version, precision int) []comparator {
+	if precision == 0 {
+		return xRange(v, 0)
+	}
+
+	// 上界为第一个非零段加一
+	var upper *Version
+	switch {
+	case v.Major > 0 || precision == 1:
+		upper = bump(v, 1)
+	case v.Minor > 0 || precision == 2:
+		upper = bump(v, 2)
+	default:
+		upper = bump(v, 3)
+	}
+	return []comparator{
+		{op: ">=", version: v},
+		{op: "<", version: withMinPrerelease(upper)},
+	}
+}
+
+func parseHyphenRange(lower, upper string) ([]comparator, error) {
+	lv, lparts, err := parseVersionParts(lower)
+	if err != nil {
+		return nil, err
+	}
+	uv, uparts, err := parseVersionParts(upper)
+	if err != nil {
+		return nil, err
+	}
+
+	var set []comparator
+	if wildcardPrecision(lparts) > 0 {
+		set = append(set, comparator{op: ">=", version: lv})
+	} else {
+		set = append(set, comparator{op: ">=", version: &Version{}})
+	}
+
+	switch precision := wildcardPrecision(uparts); {
+	case precision == 0:
+	case precision < 3:
+		set = append(set, comparator{op: "<", version: withMinPrerelease(bump(uv, precision))})
+	default:
+		set = append(set, comparator{op: "<=", version: uv})
+	}
+	return set, nil
+}
+
+// isVersionCompatible 检查版本是否满足约束，格式错误视为不兼容
+func isVersionCompatible(currentVersion, constraint string) bool {
+	ok, err := SatisfiesConstraint(currentVersion, constraint)
+	return err == nil && ok
+}
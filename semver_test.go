@@ -0,0 +1,176 @@
+package plugmgr
+
+import (
+	"errors"
+	"sort"
+	"testing"
+)
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"1.2.3", "1.2.3"},
+		{"v1.2.3", "1.2.3"},
+		{"1.2", "1.2.0"},
+		{"1", "1.0.0"},
+		{"1.0.0-alpha.1", "1.0.0-alpha.1"},
+		{"1.0.0-x-y.0+build.7", "1.0.0-x-y.0+build.7"},
+	}
+	for _, tt := range tests {
+		v, err := ParseVersion(tt.input)
+		if err != nil {
+			t.Fatalf("解析 %q 失败: %v", tt.input, err)
+		}
+		if v.String() != tt.want {
+			t.Errorf("解析 %q 期望 %s, 得到 %s", tt.input, tt.want, v)
+		}
+	}
+
+	for _, input := range []string{"", "1.2.3.4", "01.2.3", "1.a.3", "1.2.3-", "1.2.3-01", "1.2.3+", "1.2.3-a..b", "1.x"} {
+		if _, err := ParseVersion(input); !errors.Is(err, ErrInvalidVersion) {
+			t.Errorf("解析 %q 期望 ErrInvalidVersion, 得到 %v", input, err)
+		}
+	}
+}
+
+func TestVersionPrecedence(t *testing.T) {
+	// SemVer 2.0 规范第 11 节的示例，按优先级从低到高排列
+	ordered := []string{
+		"1.0.0-alpha",
+		"1.0.0-alpha.1",
+		"1.0.0-alpha.beta",
+		"1.0.0-beta",
+		"1.0.0-beta.2",
+		"1.0.0-beta.11",
+		"1.0.0-rc.1",
+		"1.0.0",
+		"2.0.0",
+		"2.1.0",
+		"2.1.1",
+		"10.0.0",
+	}
+	for i := 0; i < len(ordered)-1; i++ {
+		if c, _ := CompareVersions(ordered[i], ordered[i+1]); c != -1 {
+			t.Errorf("期望 %s < %s", ordered[i], ordered[i+1])
+		}
+	}
+
+	if c, _ := CompareVersions("1.0.0+a", "1.0.0+b"); c != 0 {
+		t.Errorf("编译信息不应参与比较")
+	}
+
+	shuffled := []string{"1.0.0", "10.0.0", "1.0.0-beta.11", "2.0.0", "1.0.0-alpha", "1.0.0-beta.2"}
+	sort.Slice(shuffled, func(i, j int) bool { return compareVersions(shuffled[i], shuffled[j]) < 0 })
+	want := []string{"1.0.0-alpha", "1.0.0-beta.2", "1.0.0-beta.11", "1.0.0", "2.0.0", "10.0.0"}
+	for i := range want {
+		if shuffled[i] != want[i] {
+			t.Fatalf("排序结果错误: %v", shuffled)
+		}
+	}
+}
+
+func TestConstraintCheck(t *testing.T) {
+	tests := []struct {
+		constraint string
+		version    string
+		want       bool
+	}{
+		{">= 1.0", "1.0.0", true},
+		{">=1.0.0", "0.9.9", false},
+		{"== 1.2.3", "1.2.3", true},
+		{"1.2.3", "1.2.4", false},
+		{"!=1.2.3", "1.2.4", true},
+		{">1.2", "1.2.9", false},
+		{">1.2", "1.3.0", true},
+		{"<=1.2", "1.2.9", true},
+		{"<1.2", "1.1.9", true},
+		{"<1.2", "1.2.0", false},
+
+		{"^1.2", "1.9.0", true},
+		{"^1.2", "2.0.0", false},
+		{"^1.2.3", "1.2.2", false},
+		{"^0.2.3", "0.2.9", true},
+		{"^0.2.3", "0.3.0", false},
+		{"^0.0.3", "0.0.4", false},
+		{"^0.x", "0.9.0", true},
+
+		{"~1.2.3", "1.2.9", true},
+		{"~1.2.3", "1.3.0", false},
+		{"~1", "1.9.0", true},
+		{"~>1.2", "1.2.5", true},
+
+		{"1.x", "1.5.2", true},
+		{"1.x", "2.0.0", false},
+		{"1.2.*", "1.2.7", true},
+		{"1.2", "1.3.0", false},
+		{"*", "3.4.5", true},
+		{"", "0.0.1", true},
+
+		{"1.2.3 - 2.3.4", "2.3.4", true},
+		{"1.2.3 - 2.3.4", "2.3.5", false},
+		{"1.2 - 2.3", "2.3.9", true},
+		{"1.2 - 2", "2.9.9", true},
+		{"1.2 - 2", "3.0.0", false},
+
+		{">=1.2 <2.0 || 3.x", "1.5.0", true},
+		{">=1.2 <2.0 || 3.x", "2.5.0", false},
+		{">=1.2 <2.0 || 3.x", "3.1.0", true},
+		{">=1.2, <2.0", "1.9.9", true},
+
+		// 先行版本只匹配声明了相同主次修订号先行版本的条件
+		{"^1.2.3", "1.5.0-beta", false},
+		{">=1.2.3-alpha", "1.2.3-beta", true},
+		{">=1.2.3-alpha", "1.2.4-beta", false},
+		{">=1.2.3-alpha", "1.2.4", true},
+		{"^1.x", "2.0.0-rc.1", false},
+	}
+	for _, tt := range tests {
+		got, err := SatisfiesConstraint(tt.version, tt.constraint)
+		if err != nil {
+			t.Fatalf("检查 %q 满足 %q 失败: %v", tt.version, tt.constraint, err)
+		}
+		if got != tt.want {
+			t.Errorf("%q 满足 %q: 期望 %v, 得到 %v", tt.version, tt.constraint, tt.want, got)
+		}
+	}
+}
+
+func TestParseConstraintErrors(t *testing.T) {
+	for _, input := range []string{">=", ">= <2.0", "^1.a", "1.2.3 - ", ">=1.0 ||| 2.0", "!=1.x", "1.x-beta", "1.2.3.4"} {
+		if _, err := ParseConstraint(input); !errors.Is(err, ErrInvalidConstraint) {
+			t.Errorf("解析 %q 期望 ErrInvalidConstraint, 得到 %v", input, err)
+		}
+	}
+}
+
+func TestVersionManagerResolveVersion(t *testing.T) {
+	vm := newVersionManager()
+	for _, v := range []string{"1.0.0", "1.10.0", "1.2.0", "2.0.0-rc.1", "2.0.0", "1.2.0"} {
+		if err := vm.AddVersion("demo", v); err != nil {
+			t.Fatalf("添加版本 %s 失败: %v", v, err)
+		}
+	}
+	if err := vm.AddVersion("demo", "latest"); !errors.Is(err, ErrInvalidVersion) {
+		t.Fatalf("期望 ErrInvalidVersion, 得到 %v", err)
+	}
+
+	want := []string{"2.0.0", "2.0.0-rc.1", "1.10.0", "1.2.0", "1.0.0"}
+	got := vm.GetVersions("demo")
+	if len(got) != len(want) {
+		t.Fatalf("期望版本列表 %v, 得到 %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("期望版本列表 %v, 得到 %v", want, got)
+		}
+	}
+
+	if v, err := vm.ResolveVersion("demo", "^1.2"); err != nil || v != "1.10.0" {
+		t.Fatalf("期望 1.10.0, 得到 %q (%v)", v, err)
+	}
+	if _, err := vm.ResolveVersion("demo", "^3"); !errors.Is(err, ErrIncompatibleVersion) {
+		t.Fatalf("期望 ErrIncompatibleVersion, 得到 %v", err)
+	}
+}
@@ -0,0 +1,538 @@
+package plugmgr
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// decodeTOML 解析 TOML 文档
+//
+//	支持配置覆盖文件常用的 TOML 1.0 子集: 表、数组表、点分键、内联表、数组、
+//	基本字符串、字面量字符串(含多行形式)、整数、浮点数和布尔值。
+//	日期时间按原始文本保存为字符串。
+func decodeTOML(data []byte) (map[string]any, error) {
+	p := &tomlParser{data: data, line: 1}
+	root := make(map[string]any)
+	current := root
+
+	for {
+		p.skipBlank()
+		if p.eof() {
+			return root, nil
+		}
+
+		if p.peek() == '[' {
+			array := p.hasPrefix("[[")
+			p.pos++
+			if array {
+				p.pos++
+			}
+			keys, err := p.parseKey()
+			if err != nil {
+				return nil, err
+			}
+			closing := "]"
+			if array {
+				closing = "]]"
+			}
+			p.skipSpaces()
+			if !p.hasPrefix(closing) {
+				return nil, p.errorf("表头缺少 %s", closing)
+			}
+			p.pos += len(closing)
+			if err := p.expectLineEnd(); err != nil {
+				return nil, err
+			}
+			if current, err = p.openTable(root, keys, array); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		keys, err := p.parseKey()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpaces()
+		if p.eof() || p.peek() != '=' {
+			return nil, p.errorf("键 %s 后缺少 =", strings.Join(keys, "."))
+		}
+		p.pos++
+		p.skipSpaces()
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.setKey(current, keys, value); err != nil {
+			return nil, err
+		}
+		if err := p.expectLineEnd(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+type tomlParser struct {
+	data []byte
+	pos  int
+	line int
+}
+
+func (p *tomlParser) errorf(format string, args ...any) error {
+	return newErrorf("TOML 第 %d 行: "+format, append([]any{p.line}, args...)...)
+}
+
+func (p *tomlParser) eof() bool { return p.pos >= len(p.data) }
+
+func (p *tomlParser) peek() byte { return p.data[p.pos] }
+
+func (p *tomlParser) hasPrefix(s string) bool {
+	return strings.HasPrefix(string(p.data[p.pos:]), s)
+}
+
+// skipSpaces 跳过行内空白
+func (p *tomlParser) skipSpaces() {
+	for !p.eof() && (p.peek() == ' ' || p.peek() == '\t') {
+		p.pos++
+	}
+}
+
+// skipBlank 跳过空白、换行和注释
+func (p *tomlParser) skipBlank() {
+	for !p.eof() {
+		switch p.peek() {
+		case ' ', '\t', '\r':
+			p.pos++
+		case '\n':
+			p.pos++
+			p.line++
+		case '#':
+			for !p.eof() && p.peek() != '\n' {
+				p.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// expectLineEnd 要求当前行剩余部分只有空白或注释
+func (p *tomlParser) expectLineEnd() error {
+	p.skipSpaces()
+	if !p.eof() && p.peek() == '#' {
+		for !p.eof() && p.peek() != '\n' {
+			p.pos++
+		}
+	}
+	if p.hasPrefix("\r\n") {
+		p.pos++
+	}
+	if p.eof() {
+		return nil
+	}
+	if p.peek() != '\n' {
+		return p.errorf("值后存在多余内容")
+	}
+	p.pos++
+	p.line++
+	return nil
+}
+
+// parseKey 解析点分键
+func (p *tomlParser) parseKey() ([]string, error) {
+	var keys []string
+	for {
+		p.skipSpaces()
+		if p.eof() {
+			return nil, p.errorf("缺少键")
+		}
+
+		var key string
+		var err error
+		switch c := p.peek(); {
+		case c == '"':
+			key, err = p.parseBasicString()
+		case c == '\'':
+			key, err = p.parseLiteralString()
+		default:
+			start := p.pos
+			for !p.eof() && isBareKeyChar(p.peek()) {
+				p.pos++
+			}
+			if start == p.pos {
+				return nil, p.errorf("无效的键")
+			}
+			key = string(p.data[start:p.pos])
+		}
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+
+		p.skipSpaces()
+		if p.eof() || p.peek() != '.' {
+			return keys, nil
+		}
+		p.pos++
+	}
+}
+
+func isBareKeyChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-'
+}
+
+// openTable 打开表头指定的表，数组表追加一个新表
+func (p *tomlParser) openTable(root map[string]any, keys []string, array bool) (map[string]any, error) {
+	table := root
+	for i, key := range keys {
+		last := i == len(keys)-1
+		switch v := table[key].(type) {
+		case nil:
+			if last && array {
+				next := make(map[string]any)
+				table[key] = []any{next}
+				return next, nil
+			}
+			next := make(map[string]any)
+			table[key] = next
+			table = next
+		case map[string]any:
+			if last && array {
+				return nil, p.errorf("%s 已定义为表", strings.Join(keys, "."))
+			}
+			table = v
+		case []any:
+			tables, ok := lastTable(v)
+			if !ok {
+				return nil, p.errorf("%s 不是表", strings.Join(keys[:i+1], "."))
+			}
+			if last && array {
+				next := make(map[string]any)
+				table[key] = append(v, next)
+				return next, nil
+			}
+			table = tables
+		default:
+			return nil, p.errorf("%s 不是表", strings.Join(keys[:i+1], "."))
+		}
+	}
+	return table, nil
+}
+
+func lastTable(values []any) (map[string]any, bool) {
+	if len(values) == 0 {
+		return nil, false
+	}
+	table, ok := values[len(values)-1].(map[string]any)
+	return table, ok
+}
+
+// setKey 在表中设置点分键的值
+func (p *tomlParser) setKey(table map[string]any, keys []string, value any) error {
+	for _, key := range keys[:len(keys)-1] {
+		switch v := table[key].(type) {
+		case nil:
+			next := make(map[string]any)
+			table[key] = next
+			table = next
+		case map[string]any:
+			table = v
+		default:
+			return p.errorf("%s 不是表", key)
+		}
+	}
+
+	key := keys[len(keys)-1]
+	if _, exists := table[key]; exists {
+		return p.errorf("重复定义键 %s", strings.Join(keys, "."))
+	}
+	table[key] = value
+	return nil
+}
+
+// parseValue 解析值
+func (p *tomlParser) parseValue() (any, error) {
+	if p.eof() {
+		return nil, p.errorf("缺少值")
+	}
+
+	switch c := p.peek(); {
+	case c == '"':
+		return p.parseBasicString()
+	case c == '\'':
+		return p.parseLiteralString()
+	case c == '[':
+		return p.parseArray()
+	case c == '{':
+		return p.parseInlineTable()
+	case p.hasPrefix("true"):
+		p.pos += 4
+		return true, nil
+	case p.hasPrefix("false"):
+		p.pos += 5
+		return false, nil
+	}
+
+	start := p.pos
+	p.scanScalar()
+	// 以空格分隔日期和时间的日期时间
+	if p.pos-start == len("2006-01-02") && p.hasPrefix(" ") &&
+		p.pos+1 < len(p.data) && p.data[p.pos+1] >= '0' && p.data[p.pos+1] <= '9' {
+		p.pos++
+		p.scanScalar()
+	}
+	return p.parseScalar(string(p.data[start:p.pos]))
+}
+
+func (p *tomlParser) scanScalar() {
+	for !p.eof() && strings.IndexByte("0123456789abcdefinxoABCDEFINXOT_+-.:Z", p.peek()) >= 0 {
+		p.pos++
+	}
+}
+
+// parseScalar 解析数字和日期时间
+func (p *tomlParser) parseScalar(token string) (any, error) {
+	switch token {
+	case "inf", "+inf":
+		return math.Inf(1), nil
+	case "-inf":
+		return math.Inf(-1), nil
+	case "nan", "+nan", "-nan":
+		return math.NaN(), nil
+	case "":
+		return nil, p.errorf("无效的值")
+	}
+
+	if strings.Contains(token, ":") || strings.Count(token, "-") >= 2 && !strings.ContainsAny(token, "eE") {
+		return token, nil
+	}
+
+	digits := strings.ReplaceAll(token, "_", "")
+	if len(digits) > 2 && digits[0] == '0' && strings.IndexByte("xob", digits[1]) >= 0 {
+		base := map[byte]int{'x': 16, 'o': 8, 'b': 2}[digits[1]]
+		n, err := strconv.ParseInt(digits[2:], base, 64)
+		if err != nil {
+			return nil, p.errorf("无效的整数 %s", token)
+		}
+		return n, nil
+	}
+	if strings.ContainsAny(digits, ".eE") {
+		f, err := strconv.ParseFloat(digits, 64)
+		if err != nil {
+			return nil, p.errorf("无效的浮点数 %s", token)
+		}
+		return f, nil
+	}
+	n, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil {
+		return nil, p.errorf("无效的值 %s", token)
+	}
+	return n, nil
+}
+
+// parseArray 解析数组，元素之间允许换行和注释
+func (p *tomlParser) parseArray() ([]any, error) {
+	p.pos++
+	values := []any{}
+	for {
+		p.skipBlank()
+		if p.eof() {
+			return nil, p.errorf("数组缺少 ]")
+		}
+		if p.peek() == ']' {
+			p.pos++
+			return values, nil
+		}
+
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+
+		p.skipBlank()
+		if !p.eof() && p.peek() == ',' {
+			p.pos++
+		} else if p.eof() || p.peek() != ']' {
+			return nil, p.errorf("数组元素之间缺少 ,")
+		}
+	}
+}
+
+// parseInlineTable 解析单行的内联表
+func (p *tomlParser) parseInlineTable() (map[string]any, error) {
+	p.pos++
+	table := make(map[string]any)
+	p.skipSpaces()
+	if !p.eof() && p.peek() == '}' {
+		p.pos++
+		return table, nil
+	}
+
+	for {
+		keys, err := p.parseKey()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpaces()
+		if p.eof() || p.peek() != '=' {
+			return nil, p.errorf("内联表的键后缺少 =")
+		}
+		p.pos++
+		p.skipSpaces()
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.setKey(table, keys, value); err != nil {
+			return nil, err
+		}
+
+		p.skipSpaces()
+		if p.eof() {
+			return nil, p.errorf("内联表缺少 }")
+		}
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case '}':
+			p.pos++
+			return table, nil
+		default:
+			return nil, p.errorf("内联表的键值之间缺少 ,")
+		}
+	}
+}
+
+// parseBasicString 解析基本字符串，支持多行形式和转义字符
+func (p *tomlParser) parseBasicString() (string, error) {
+	multiline := p.hasPrefix(`"""`)
+	if multiline {
+		p.pos += 3
+		p.trimFirstNewline()
+	} else {
+		p.pos++
+	}
+
+	var b strings.Builder
+	for {
+		if p.eof() {
+			return "", p.errorf("字符串未结束")
+		}
+		if multiline && p.hasPrefix(`"""`) {
+			p.pos += 3
+			return b.String(), nil
+		}
+
+		c := p.peek()
+		switch {
+		case !multiline && c == '"':
+			p.pos++
+			return b.String(), nil
+		case !multiline && c == '\n':
+			return "", p.errorf("字符串未结束")
+		case c == '\\':
+			p.pos++
+			if err := p.parseEscape(&b, multiline); err != nil {
+				return "", err
+			}
+		default:
+			if c == '\n' {
+				p.line++
+			}
+			b.WriteByte(c)
+			p.pos++
+		}
+	}
+}
+
+// parseEscape 解析转义字符，多行字符串中行尾的反斜杠删除换行及其后的空白
+func (p *tomlParser) parseEscape(b *strings.Builder, multiline bool) error {
+	if p.eof() {
+		return p.errorf("字符串未结束")
+	}
+
+	c := p.peek()
+	p.pos++
+	switch c {
+	case 'b':
+		b.WriteByte('\b')
+	case 't':
+		b.WriteByte('\t')
+	case 'n':
+		b.WriteByte('\n')
+	case 'f':
+		b.WriteByte('\f')
+	case 'r':
+		b.WriteByte('\r')
+	case '"':
+		b.WriteByte('"')
+	case '\\':
+		b.WriteByte('\\')
+	case 'u', 'U':
+		size := 4
+		if c == 'U' {
+			size = 8
+		}
+		if p.pos+size > len(p.data) {
+			return p.errorf("无效的 Unicode 转义")
+		}
+		code, err := strconv.ParseUint(string(p.data[p.pos:p.pos+size]), 16, 32)
+		if err != nil || !utf8.ValidRune(rune(code)) {
+			return p.errorf("无效的 Unicode 转义")
+		}
+		b.WriteRune(rune(code))
+		p.pos += size
+	case ' ', '\t', '\r', '\n':
+		if !multiline {
+			return p.errorf("无效的转义字符")
+		}
+		p.pos--
+		for !p.eof() && strings.IndexByte(" \t\r\n", p.peek()) >= 0 {
+			if p.peek() == '\n' {
+				p.line++
+			}
+			p.pos++
+		}
+	default:
+		return p.errorf("无效的转义字符 \\%c", c)
+	}
+	return nil
+}
+
+// parseLiteralString 解析字面量字符串，支持多行形式
+func (p *tomlParser) parseLiteralString() (string, error) {
+	delimiter := "'"
+	if p.hasPrefix("'''") {
+		delimiter = "'''"
+	}
+	p.pos += len(delimiter)
+	if len(delimiter) == 3 {
+		p.trimFirstNewline()
+	}
+
+	end := strings.Index(string(p.data[p.pos:]), delimiter)
+	if end < 0 {
+		return "", p.errorf("字符串未结束")
+	}
+	s := string(p.data[p.pos : p.pos+end])
+	if len(delimiter) == 1 && strings.Contains(s, "\n") {
+		return "", p.errorf("字符串未结束")
+	}
+	p.line += strings.Count(s, "\n")
+	p.pos += end + len(delimiter)
+	return s, nil
+}
+
+// trimFirstNewline 删除多行字符串开头紧跟的换行
+func (p *tomlParser) trimFirstNewline() {
+	if p.hasPrefix("\r\n") {
+		p.pos += 2
+		p.line++
+	} else if p.hasPrefix("\n") {
+		p.pos++
+		p.line++
+	}
+}
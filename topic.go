@@ -0,0 +1,249 @@
+package plugmgr
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// 插件主题的权限操作名称
+//
+//	TopicActionPublish 允许插件向自己的任意主题发布事件，也可以使用 "topic.publish:<主题>" 只允许指定主题。
+//	TopicActionSubscribe 允许插件订阅任意插件的主题，也可以使用 "topic.subscribe:<事件名称或模式>"
+//	只允许指定主题，例如 "topic.subscribe:plugin.billing.*"。订阅默认不授予，插件只能订阅自己的主题。
+//	将带主题的操作设置为 false 可以在拥有通用权限时禁止单个主题。
+const (
+	TopicActionPublish   = "topic.publish"
+	TopicActionSubscribe = "topic.subscribe"
+)
+
+// topicPrefix 插件主题事件名称的前缀
+const topicPrefix = "plugin."
+
+// TopicEvent 返回插件主题的事件名称 plugin.<插件名称>.<主题>
+func TopicEvent(plugin, topic string) string {
+	return topicPrefix + plugin + "." + topic
+}
+
+// isTopicEvent 检查事件名称或模式是否属于插件主题
+func isTopicEvent(eventName string) bool {
+	return strings.HasPrefix(eventName, topicPrefix)
+}
+
+// topicAllowed 检查插件是否拥有对指定主题的权限
+//
+//	带主题的操作优先于通用操作，任一目标被明确禁止时拒绝。
+//	没有授予订阅权限时，只允许订阅插件自己命名空间中的主题。
+func (m *Manager) topicAllowed(plugin, action string, targets ...string) bool {
+	permission, ok := m.getPermission(plugin)
+	if !ok {
+		return false
+	}
+	granted := false
+	for _, target := range targets {
+		if allowed, set := permission.AllowedActions[action+":"+target]; set {
+			if !allowed {
+				return false
+			}
+			granted = true
+		}
+	}
+	if granted || permission.AllowedActions[action] {
+		return true
+	}
+	// 插件总是可以订阅自己命名空间中的主题
+	own := topicPrefix + plugin + "."
+	for _, target := range targets {
+		if action != TopicActionSubscribe || !strings.HasPrefix(target, own) {
+			return false
+		}
+	}
+	return len(targets) > 0
+}
+
+// PublishTopic 以插件的名义向其主题发布事件
+//
+//	参数:
+//	- plugin: 发布事件的插件名称，必须已加载
+//	- topic: 主题名称，不能为空或包含通配符 *
+//	- data: 事件数据
+//	功能:
+//	- 检查插件的 TopicActionPublish 权限
+//	- 异步发布名称为 plugin.<plugin>.<topic> 的事件
+func (m *Manager) PublishTopic(plugin, topic string, data any) error {
+	if _, ok := m.plugins.Load(plugin); !ok {
+		return wrapf(ErrPluginNotFound, "插件 %s 未加载", plugin)
+	}
+	if topic == "" || strings.Contains(topic, "*") {
+		return newErrorf("无效的主题名称: %q", topic)
+	}
+	if !m.topicAllowed(plugin, TopicActionPublish, topic) {
+		return wrapf(ErrPermissionDenied, "插件 %s 没有发布主题 %s 的权限", plugin, topic)
+	}
+	return m.eventBus.PublishAsync(Event{
+		EventName: TopicEvent(plugin, topic),
+		Data: EventData{
+			Name: plugin,
+			Data: data,
+		},
+	})
+}
+
+// TopicSubscription 插件对主题的订阅
+//
+//	订阅属于插件，插件卸载时自动取消，插件热重载后重新挂载到事件总线。
+type TopicSubscription struct {
+	manager  *Manager
+	plugin   string
+	pattern  string
+	handler  EventHandler
+	filters  []EventFilter
+	canceled atomic.Bool
+
+	mu  sync.Mutex
+	sub *Subscription // 当前挂载的事件总线订阅，未挂载时为 nil
+}
+
+// Plugin 返回订阅所属的插件名称
+func (s *TopicSubscription) Plugin() string {
+	return s.plugin
+}
+
+// Pattern 返回订阅的事件名称或通配符模式
+func (s *TopicSubscription) Pattern() string {
+	return s.pattern
+}
+
+// Cancel 取消订阅，可以重复调用
+func (s *TopicSubscription) Cancel() {
+	if s.canceled.Swap(true) {
+		return
+	}
+	s.manager.topics.remove(s)
+	s.detach()
+}
+
+// attach 在事件总线上创建订阅，投递前再次检查插件的订阅权限
+func (s *TopicSubscription) attach() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.sub != nil || s.canceled.Load() {
+		return
+	}
+	allowed := func(e Event) bool {
+		return s.manager.topicAllowed(s.plugin, TopicActionSubscribe, s.pattern, e.EventName)
+	}
+	s.sub = s.manager.eventBus.Subscribe(s.pattern, s.handler, append([]EventFilter{allowed}, s.filters...)...)
+}
+
+// detach 取消事件总线上的订阅，队列中尚未处理的事件被丢弃
+func (s *TopicSubscription) detach() {
+	s.mu.Lock()
+	sub := s.sub
+	s.sub = nil
+	s.mu.Unlock()
+
+	if sub != nil {
+		sub.Cancel()
+	}
+}
+
+// topicRegistry 按插件记录主题订阅
+type topicRegistry struct {
+	mu   sync.Mutex
+	subs map[string][]*TopicSubscription
+}
+
+func (r *topicRegistry) add(s *TopicSubscription) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.subs == nil {
+		r.subs = make(map[string][]*TopicSubscription)
+	}
+	r.subs[s.plugin] = append(r.subs[s.plugin], s)
+}
+
+func (r *topicRegistry) remove(s *TopicSubscription) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	subs := r.subs[s.plugin]
+	for i, sub := range subs {
+		if sub == s {
+			subs = append(subs[:i:i], subs[i+1:]...)
+			break
+		}
+	}
+	if len(subs) == 0 {
+		delete(r.subs, s.plugin)
+	} else {
+		r.subs[s.plugin] = subs
+	}
+}
+
+// get 返回插件的主题订阅
+func (r *topicRegistry) get(plugin string) []*TopicSubscription {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*TopicSubscription(nil), r.subs[plugin]...)
+}
+
+// SubscribeTopic 以插件的名义订阅主题事件
+//
+//	参数:
+//	- plugin: 订阅所属的插件名称，必须已加载
+//	- eventName: 主题事件名称，以 plugin. 开头，可以包含通配符 *，例如 "plugin.billing.*"
+//	- handler: 事件处理函数
+//	- filters: 过滤条件
+//	功能:
+//	- 检查插件的 TopicActionSubscribe 权限，每次投递前再次检查，撤销权限后立即停止投递
+//	- 插件卸载时自动取消订阅
+//	- 插件热重载期间暂停订阅，新版本就绪后重新挂载
+//	返回:
+//	- *TopicSubscription: 订阅句柄
+//	- error: 插件未加载、事件名称不属于插件主题或没有权限
+func (m *Manager) SubscribeTopic(plugin, eventName string, handler EventHandler, filters ...EventFilter) (*TopicSubscription, error) {
+	if _, ok := m.plugins.Load(plugin); !ok {
+		return nil, wrapf(ErrPluginNotFound, "插件 %s 未加载", plugin)
+	}
+	if !isTopicEvent(eventName) {
+		return nil, newErrorf("事件 %s 不是插件主题，主题事件名称以 %s 开头", eventName, topicPrefix)
+	}
+	if !m.topicAllowed(plugin, TopicActionSubscribe, eventName) {
+		return nil, wrapf(ErrPermissionDenied, "插件 %s 没有订阅主题 %s 的权限", plugin, eventName)
+	}
+
+	s := &TopicSubscription{
+		manager: m,
+		plugin:  plugin,
+		pattern: eventName,
+		handler: handler,
+		filters: filters,
+	}
+	m.topics.add(s)
+	s.attach()
+	return s, nil
+}
+
+// removeTopics 取消插件的所有主题订阅
+func (m *Manager) removeTopics(plugin string) {
+	for _, s := range m.topics.get(plugin) {
+		s.Cancel()
+	}
+}
+
+// detachTopics 暂停插件的所有主题订阅
+func (m *Manager) detachTopics(plugin string) {
+	for _, s := range m.topics.get(plugin) {
+		s.detach()
+	}
+}
+
+// attachTopics 重新挂载插件的所有主题订阅
+func (m *Manager) attachTopics(plugin string) {
+	for _, s := range m.topics.get(plugin) {
+		s.attach()
+	}
+}
@@ -0,0 +1,172 @@
+package plugmgr
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+// topicRecorder 记录收到的主题事件
+type topicRecorder struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func (r *topicRecorder) handle(e Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, e)
+}
+
+func (r *topicRecorder) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.events)
+}
+
+func grantTopics(m *Manager, name string, actions map[string]bool) {
+	m.permissions.Store(name, PluginPermission{AllowedActions: actions})
+}
+
+func TestPluginTopicPermissions(t *testing.T) {
+	m := newTestManager(t)
+	addTestPlugin(m, "a", &fakePlugin{})
+	addTestPlugin(m, "b", &fakePlugin{})
+
+	var received topicRecorder
+	if _, err := m.SubscribeTopic("b", "plugin.a.*", received.handle); !errors.Is(err, ErrPermissionDenied) {
+		t.Fatalf("没有订阅权限时应返回 ErrPermissionDenied, 得到 %v", err)
+	}
+
+	grantTopics(m, "a", map[string]bool{TopicActionPublish: true, "topic.publish:secret": false})
+	grantTopics(m, "b", map[string]bool{"topic.subscribe:plugin.a.*": true})
+	if _, err := m.SubscribeTopic("b", "plugin.c.*", received.handle); !errors.Is(err, ErrPermissionDenied) {
+		t.Fatalf("只允许订阅 plugin.a.*, 得到 %v", err)
+	}
+	if _, err := m.SubscribeTopic("b", PluginLoaded, received.handle); err == nil {
+		t.Fatal("不能通过 SubscribeTopic 订阅内置事件")
+	}
+	sub, err := m.SubscribeTopic("b", "plugin.a.*", received.handle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sub.Plugin() != "b" || sub.Pattern() != "plugin.a.*" {
+		t.Fatalf("订阅信息不正确: %s %s", sub.Plugin(), sub.Pattern())
+	}
+
+	if err := m.PublishTopic("a", "secret", nil); !errors.Is(err, ErrPermissionDenied) {
+		t.Fatalf("被禁止的主题应返回 ErrPermissionDenied, 得到 %v", err)
+	}
+	if err := m.PublishTopic("a", "*", nil); err == nil {
+		t.Fatal("主题名称不能包含通配符")
+	}
+	if err := m.PublishTopic("a", "created", 1); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { return received.count() == 1 })
+	if e := received.events[0]; e.EventName != "plugin.a.created" || e.Data.Name != "a" || e.Data.Data != 1 {
+		t.Fatalf("收到的事件不正确: %+v", e)
+	}
+
+	// 撤销订阅权限后不再投递
+	grantTopics(m, "b", map[string]bool{"topic.subscribe:plugin.a.*": false})
+	if err := m.PublishTopic("a", "created", 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.eventBus.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if received.count() != 1 {
+		t.Fatalf("撤销权限后不应收到事件, 共收到 %d 个", received.count())
+	}
+}
+
+func TestPluginTopicLifecycle(t *testing.T) {
+	m := newTestManager(t)
+	p := &hostPlugin{}
+	loadHostPlugin(t, m, "a", p)
+	loadHostPlugin(t, m, "b", &fakePlugin{})
+
+	if err := p.host.Publish("plugin.b.created", nil); !errors.Is(err, ErrPermissionDenied) {
+		t.Fatalf("不能通过 Publish 伪造其他插件的主题, 得到 %v", err)
+	}
+
+	var fromManager, fromHost topicRecorder
+	if _, err := m.SubscribeTopic("b", "plugin.a.created", fromManager.handle); !errors.Is(err, ErrPermissionDenied) {
+		t.Fatalf("默认不允许订阅其他插件的主题, 得到 %v", err)
+	}
+	grantTopics(m, "b", map[string]bool{TopicActionSubscribe: true})
+	sub, err := m.SubscribeTopic("b", "plugin.a.created", fromManager.handle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.host.SubscribeTopic("plugin.a.created", fromHost.handle); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.host.PublishTopic("created", nil); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { return fromManager.count() == 1 && fromHost.count() == 1 })
+
+	// 热重载期间暂停，完成后重新挂载
+	m.detachTopics("b")
+	if m.eventBus.SubscribersCount("plugin.a.created") != 1 {
+		t.Fatal("暂停后应只剩插件 a 的订阅")
+	}
+	m.attachTopics("b")
+	if err := m.PublishTopic("a", "created", nil); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { return fromManager.count() == 2 })
+
+	// 卸载插件时自动取消订阅
+	if err := m.UnloadPlugin("b"); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.topics.get("b")) != 0 || m.eventBus.SubscribersCount("plugin.a.created") != 1 {
+		t.Fatal("卸载后插件 b 的主题订阅应被删除")
+	}
+	sub.Cancel()
+
+	if err := m.UnloadPlugin("a"); err != nil {
+		t.Fatal(err)
+	}
+	if m.eventBus.HasSubscribers("plugin.a.created") {
+		t.Fatal("卸载后插件 a 通过宿主服务创建的订阅应被删除")
+	}
+}
+
+func TestHostSubscribeCannotReadTopics(t *testing.T) {
+	m := newTestManager(t)
+	a := &hostPlugin{}
+	b := &hostPlugin{}
+	loadHostPlugin(t, m, "a", a)
+	loadHostPlugin(t, m, "b", b)
+
+	for _, pattern := range []string{"plugin.a.created", "plugin.*"} {
+		if _, err := b.host.Subscribe(pattern, func(Event) {}); !errors.Is(err, ErrPermissionDenied) {
+			t.Fatalf("不能通过 Subscribe 订阅主题事件 %s, 得到 %v", pattern, err)
+		}
+	}
+	var all, topics topicRecorder
+	if _, err := b.host.Subscribe("*", all.handle); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.host.Subscribe("plug*", topics.handle); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.host.PublishTopic("secret", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.PublishTopic("a", "created", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.eventBus.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range append(all.events, topics.events...) {
+		if isTopicEvent(e.EventName) {
+			t.Fatalf("没有主题订阅权限时不应通过通配符收到 %s", e.EventName)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package plugmgr
 
 import (
+	"slices"
 	"sort"
 	"sync"
 )
@@ -18,17 +19,20 @@ func newVersionManager() *VersionManager {
 	}
 }
 
-func (vm *VersionManager) AddVersion(pluginName, version string) {
+// AddVersion 记录插件的可用版本
+//
+//	版本列表按语义化版本从高到低排序，重复的版本会被忽略。
+//	版本号格式错误时返回包装了 ErrInvalidVersion 的错误。
+func (vm *VersionManager) AddVersion(pluginName, version string) error {
+	if _, err := ParseVersion(version); err != nil {
+		return err
+	}
+
 	vm.mu.Lock()
 	defer vm.mu.Unlock()
 
-	if _, exists := vm.versions[pluginName]; !exists {
-		vm.versions[pluginName] = []string{}
-	}
-	vm.versions[pluginName] = append(vm.versions[pluginName], version)
-	sort.Slice(vm.versions[pluginName], func(i, j int) bool {
-		return compareVersions(vm.versions[pluginName][i], vm.versions[pluginName][j]) > 0
-	})
+	vm.versions[pluginName] = addSortedVersion(vm.versions[pluginName], version)
+	return nil
 }
 
 func (vm *VersionManager) SetActiveVersion(pluginName, version string) {
@@ -50,7 +54,47 @@ func (vm *VersionManager) GetVersions(pluginName string) []string {
 	vm.mu.RLock()
 	defer vm.mu.RUnlock()
 
-	return vm.versions[pluginName]
+	return slices.Clone(vm.versions[pluginName])
+}
+
+// ResolveVersion 获取满足约束的最高版本
+//
+//	参数:
+//	- pluginName: 插件名称
+//	- constraint: 版本约束，例如 "^1.2" 或 ">=1.0 <2.0 || 3.x"
+//	返回:
+//	- string: 满足约束的最高版本
+//	- error: 约束格式错误，或没有满足约束的版本时返回
+func (vm *VersionManager) ResolveVersion(pluginName, constraint string) (string, error) {
+	c, err := ParseConstraint(constraint)
+	if err != nil {
+		return "", err
+	}
+
+	vm.mu.RLock()
+	defer vm.mu.RUnlock()
+
+	// 版本列表已按从高到低排序
+	for _, version := range vm.versions[pluginName] {
+		if c.Check(MustParseVersion(version)) {
+			return version, nil
+		}
+	}
+	return "", wrapf(ErrIncompatibleVersion, "插件 %s 没有满足约束 %s 的版本", pluginName, constraint)
+}
+
+// addSortedVersion 将版本加入列表并按从高到低排序，忽略优先级相同的版本
+func addSortedVersion(versions []string, version string) []string {
+	for _, existing := range versions {
+		if compareVersions(existing, version) == 0 {
+			return versions
+		}
+	}
+	versions = append(versions, version)
+	sort.SliceStable(versions, func(i, j int) bool {
+		return compareVersions(versions[i], versions[j]) > 0
+	})
+	return versions
 }
 
 // 插件市场相关代码
@@ -74,20 +118,27 @@ func newPluginMarket() *PluginMarket {
 	}
 }
 
-func (pm *PluginMarket) AddPlugin(info PluginInfo) {
+// AddPlugin 添加插件信息
+//
+//	已存在的插件会合并版本列表，Version 字段始终为最高版本。
+//	版本号格式错误时返回包装了 ErrInvalidVersion 的错误。
+func (pm *PluginMarket) AddPlugin(info PluginInfo) error {
+	if _, err := ParseVersion(info.Version); err != nil {
+		return err
+	}
+
 	pm.mu.Lock()
 	defer pm.mu.Unlock()
 
 	if existing, exists := pm.plugins[info.Name]; exists {
-		existing.Versions = append(existing.Versions, info.Version)
-		sort.Slice(existing.Versions, func(i, j int) bool {
-			return compareVersions(existing.Versions[i], existing.Versions[j]) > 0
-		})
+		existing.Versions = addSortedVersion(existing.Versions, info.Version)
+		existing.Version = existing.Versions[0]
 		pm.plugins[info.Name] = existing
 	} else {
 		info.Versions = []string{info.Version}
 		pm.plugins[info.Name] = info
 	}
+	return nil
 }
 
 func (pm *PluginMarket) GetPlugin(name string) (PluginInfo, bool) {